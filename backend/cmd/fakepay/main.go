@@ -0,0 +1,32 @@
+// fakepay - локальный провайдер платежей для проверки пополнения баланса без настоящего провайдера.
+// Хаб настраивается на него через PAYMENT_PROVIDER_URL=http://localhost:8090
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"oneui-hub/internal/payment"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8090", "адрес сервера")
+	webhookURL := flag.String("webhook-url", "http://localhost:8080/api/v1/payments/webhook", "адрес вебхука хаба")
+	flag.Parse()
+
+	apiKey := os.Getenv("PAYMENT_API_KEY")
+	webhookSecret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if apiKey == "" || webhookSecret == "" {
+		log.Fatal("PAYMENT_API_KEY and PAYMENT_WEBHOOK_SECRET must be set to the same values as in the hub")
+	}
+
+	server := payment.NewFakeServer(apiKey, webhookSecret, *webhookURL)
+	server.BaseURL = "http://" + *addr
+
+	log.Printf("Fake payment provider listening on %s, webhooks go to %s", *addr, *webhookURL)
+	if err := http.ListenAndServe(*addr, server); err != nil {
+		log.Fatalf("Failed to start fake payment provider: %v", err)
+	}
+}
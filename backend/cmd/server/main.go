@@ -3,12 +3,21 @@ package main
 import (
 	"context"
 	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
 
 	"oneui-hub/internal/api/handlers"
 	"oneui-hub/internal/api/routes"
 	"oneui-hub/internal/config"
+	"oneui-hub/internal/leader"
 	"oneui-hub/internal/litellm"
+	"oneui-hub/internal/mail"
 	"oneui-hub/internal/middleware"
+	"oneui-hub/internal/notification"
+	"oneui-hub/internal/payment"
+	"oneui-hub/internal/ratelimit"
 	"oneui-hub/internal/repository"
 	"oneui-hub/internal/service"
 	"oneui-hub/pkg/auth"
@@ -34,8 +43,6 @@ func main() {
 	// 	log.Fatalf("Failed to migrate database: %v", err)
 	// }
 
-	jwtManager := auth.NewJWTManager(cfg.Auth.JWTSecret, cfg.Auth.TokenDuration)
-
 	litellmClient := litellm.NewClient(&cfg.LiteLLM)
 
 	userRepo := repository.NewUserRepository(db.DB)
@@ -51,13 +58,125 @@ func main() {
 	rateLimitRepo := repository.NewRateLimitRepository(db.DB)
 	apiKeyRepo := repository.NewApiKeyRepository(db.DB)
 	requestRepo := repository.NewRequestRepository(db.DB)
+	jobRunRepo := repository.NewJobRunRepository(db.DB)
+	ledgerRepo := repository.NewLedgerRepository(db.DB)
+	pricingRepo := repository.NewPricingRepository(db.DB)
+	invoiceRepo := repository.NewInvoiceRepository(db.DB)
+	promoRepo := repository.NewPromoRepository(db.DB)
+	paymentRepo := repository.NewPaymentRepository(db.DB)
+	tierHistoryRepo := repository.NewTierHistoryRepository(db.DB)
+	teamRepo := repository.NewTeamRepository(db.DB)
+	teamInvitationRepo := repository.NewTeamInvitationRepository(db.DB)
+	sessionRepo := repository.NewSessionRepository(db.DB)
+	signingKeyRepo := repository.NewSigningKeyRepository(db.DB)
+
+	// Ссылки из писем дают доступ к аккаунту и команде: без собственного секрета хаб не запускается
+	if err := cfg.Auth.ValidateLinkSecret(); err != nil {
+		log.Fatalf("Invalid signed link secret: %v", err)
+	}
+
+	// Токены подписываются ротируемыми ключами из БД, открытые части публикуются в JWKS.
+	// HS256 оставлен для совместимости: такие токены может проверить только хаб
+	var signingKeyService service.SigningKeyService
+	var jwtManager *auth.JWTManager
+	switch {
+	case auth.ValidAsymmetricAlgorithm(cfg.Auth.Algorithm):
+		signingKeyService = service.NewSigningKeyService(
+			signingKeyRepo,
+			cfg.Auth.Algorithm,
+			cfg.Auth.KeyRotationInterval,
+			cfg.Auth.KeyActivationDelay,
+			cfg.Auth.TokenDuration,
+		)
+		if err := signingKeyService.RotateKeys(context.Background()); err != nil {
+			log.Fatalf("Failed to prepare JWT signing keys: %v", err)
+		}
+		jwtManager = auth.NewKeyStoreJWTManager(signingKeyService, cfg.Auth.TokenDuration)
+	case cfg.Auth.Algorithm == auth.AlgorithmHS256:
+		jwtManager = auth.NewJWTManager(cfg.Auth.JWTSecret, cfg.Auth.TokenDuration)
+	default:
+		log.Fatalf("Unknown JWT algorithm %q, expected RS256, EdDSA or HS256", cfg.Auth.Algorithm)
+	}
+
+	// Письма отправляются через SMTP, а при локальной разработке сохраняются в файлы или пишутся в лог
+	var mailSender mail.Sender
+	switch cfg.Mail.Driver {
+	case mail.DriverSMTP:
+		mailSender = mail.NewSMTPSender(
+			cfg.Notifications.SMTPHost,
+			cfg.Notifications.SMTPPort,
+			cfg.Notifications.SMTPUsername,
+			cfg.Notifications.SMTPPassword,
+			cfg.Notifications.SMTPFrom,
+		)
+	case mail.DriverFile:
+		mailSender = mail.NewFileSender(cfg.Mail.FileDir, cfg.Notifications.SMTPFrom)
+	case mail.DriverLog:
+		mailSender = mail.NewLogSender()
+	default:
+		log.Fatalf("Unknown mail driver %q, expected smtp, file or log", cfg.Mail.Driver)
+	}
+
+	// Уведомления всегда пишутся в лог, а при наличии настроек дублируются в вебхук и на почту
+	notifiers := []notification.Notifier{notification.NewLogNotifier()}
+	if cfg.Notifications.WebhookURL != "" {
+		notifiers = append(notifiers, notification.NewWebhookNotifier(cfg.Notifications.WebhookURL))
+	}
+	if cfg.Mail.Driver != mail.DriverLog {
+		notifiers = append(notifiers, notification.NewEmailNotifier(mailSender))
+	}
+	notifier := notification.NewMultiNotifier(notifiers...)
 
 	userService := service.NewUserService(userRepo, userLimitRepo, tierRepo)
+	sessionService := service.NewSessionService(sessionRepo, userRepo, jwtManager, cfg.Auth.RefreshTokenDuration)
 	modelService := service.NewModelService(modelRepo, companyRepo, modelConfigRepo, litellmClient)
-	budgetService := service.NewBudgetService(budgetRepo, userRepo, litellmClient)
+	budgetService := service.NewBudgetService(budgetRepo, userRepo, teamRepo, litellmClient, notifier)
 	currencyService := service.NewCurrencyService(exchangeRateRepo, currencyRepo, cfg.Currency.ExchangeRateAPIKey)
-	tierService := service.NewTierService(tierRepo, userRepo, userSpendingRepo)
+	tierService := service.NewTierService(tierRepo, userRepo, userSpendingRepo, tierHistoryRepo, notifier)
 	rateLimitService := service.NewRateLimitService(rateLimitRepo, modelRepo, tierRepo)
+	requestService := service.NewRequestService(requestRepo, userRepo, modelRepo, apiKeyRepo, litellmClient)
+	ledgerService := service.NewLedgerService(ledgerRepo, cfg.Ledger.UsageStart)
+	pricingService := service.NewPricingService(pricingRepo, modelRepo, companyRepo, tierRepo)
+	invoiceService := service.NewInvoiceService(invoiceRepo, userRepo, teamRepo, pricingService, currencyService, cfg.Invoices.StorageDir, cfg.Invoices.DefaultCurrency)
+	promoService := service.NewPromoService(promoRepo, tierRepo, ledgerService)
+
+	// Без адреса провайдера пополнение баланса отключено
+	var paymentProvider payment.Provider
+	if cfg.Payments.ProviderURL != "" {
+		paymentProvider = payment.NewHTTPProvider(cfg.Payments.ProviderName, cfg.Payments.ProviderURL, cfg.Payments.APIKey, cfg.Payments.WebhookSecret, cfg.Payments.WebhookTolerance)
+	}
+	paymentService := service.NewPaymentService(paymentRepo, userRepo, ledgerService, tierService, paymentProvider, cfg.Payments.MinAmount, cfg.Payments.MaxAmount, cfg.Payments.SuccessURL, cfg.Payments.CancelURL)
+
+	apiKeyExpiryNotice := time.Duration(cfg.ApiKeys.ExpiryNoticeDays) * 24 * time.Hour
+	apiKeyService := service.NewApiKeyService(apiKeyRepo, modelRepo, companyRepo, requestRepo, litellmClient, notifier, cfg.ApiKeys.RotationGracePeriod, apiKeyExpiryNotice)
+	teamService := service.NewTeamService(teamRepo, userRepo, tierRepo, apiKeyRepo, requestRepo, budgetService, litellmClient)
+	teamInvitationService := service.NewTeamInvitationService(teamInvitationRepo, teamRepo, userRepo, mailSender, litellmClient, cfg.Auth.LinkSecret, cfg.Teams.InvitationTTL, cfg.Teams.InvitationURL)
+	accountService := service.NewAccountService(
+		userRepo,
+		sessionService,
+		mailSender,
+		cfg.Auth.LinkSecret,
+		cfg.Accounts.PasswordResetTTL,
+		cfg.Accounts.PasswordResetURL,
+		cfg.Accounts.EmailVerificationTTL,
+		cfg.Accounts.EmailVerificationURL,
+	)
+
+	// Счетчики лимитов храним в БД, чтобы квоты соблюдались на всех репликах
+	var rateLimitStore ratelimit.Store
+	if cfg.RateLimit.Store == "memory" {
+		rateLimitStore = ratelimit.NewMemoryStore()
+	} else {
+		rateLimitStore = ratelimit.NewSQLStore(db.DB)
+	}
+	rateLimiter := ratelimit.NewLimiter(rateLimitStore)
+
+	// Баланс и месячный лимит токенов проверяются перед каждым запросом к модели
+	var quotaRepo repository.QuotaRepository
+	if cfg.Gateway.EnforceQuotas {
+		quotaRepo = repository.NewQuotaRepository(db.DB)
+	}
+	gatewayService := service.NewGatewayService(modelRepo, requestRepo, userSpendingRepo, tierService, budgetService, apiKeyService, rateLimitService, rateLimiter, ledgerService, pricingService, promoService, quotaRepo, litellmClient, cfg.Gateway.DefaultMaxTokens, cfg.Gateway.QuotaHoldTTL)
 
 	// Автоматическое обновление курсов валют при старте сервера
 	if cfg.Currency.ExchangeRateAPIKey != "" {
@@ -71,22 +190,148 @@ func main() {
 		log.Printf("Предупреждение: API ключ для валютного сервиса не настроен (EXCHANGE_RATE_API_KEY)")
 	}
 
-	authHandler := handlers.NewAuthHandler(userService, jwtManager)
+	// При нескольких репликах задачи по расписанию выполняет только лидер
+	var leadership service.Leadership
+	if cfg.Leader.Enabled {
+		instanceID := cfg.Leader.InstanceID
+		if instanceID == "" {
+			hostname, _ := os.Hostname()
+			instanceID = hostname + "-" + uuid.New().String()[:8]
+		}
+		elector := leader.NewElector(db.DB, "scheduler", instanceID, cfg.Leader.LeaseTTL, cfg.Leader.RenewInterval)
+		// Записи задач по расписанию проверяют токен аренды в той же транзакции
+		if err := elector.RegisterFencing(db.DB); err != nil {
+			log.Fatalf("Failed to register leader fencing: %v", err)
+		}
+		electorCtx, stopElector := context.WithCancel(context.Background())
+		go elector.Run(electorCtx)
+		defer stopElector()
+		leadership = elector
+		log.Printf("Leader election enabled, instance ID: %s", instanceID)
+	}
+
+	// Фоновые задачи. История запусков хранится в таблице job_runs
+	scheduler := service.NewSchedulerService(jobRunRepo, leadership)
+	jobs := []service.Job{
+		{
+			Name:     "model_sync",
+			Schedule: cfg.Scheduler.ModelSyncSchedule,
+			// Синхронизация перезаписывает стоимость провайдера, поэтому сразу фиксируем новые версии цен
+			Run: func(ctx context.Context) error {
+				if err := modelService.SyncModelsFromModelGroup(ctx); err != nil {
+					return err
+				}
+				return pricingService.RefreshPrices(ctx)
+			},
+		},
+		{
+			Name:     "budget_sync",
+			Schedule: cfg.Scheduler.BudgetSyncSchedule,
+			Run:      budgetService.SyncBudgetsFromLiteLLM,
+		},
+		{
+			Name:     "budget_reset",
+			Schedule: cfg.Scheduler.BudgetResetSchedule,
+			Run:      budgetService.ResetBudgets,
+		},
+		{
+			Name:     "spend_log_sync",
+			Schedule: cfg.Scheduler.SpendLogSyncSchedule,
+			Run:      requestService.SyncAllUsersRequests,
+		},
+		{
+			Name:     "api_key_expiry",
+			Schedule: cfg.Scheduler.ApiKeyExpirySchedule,
+			Run: func(ctx context.Context) error {
+				if err := apiKeyService.NotifyExpiringApiKeys(ctx); err != nil {
+					log.Printf("Предупреждение: не удалось разослать уведомления об истечении ключей: %v", err)
+				}
+				return apiKeyService.ExpireApiKeys(ctx)
+			},
+		},
+		{
+			Name:     "ledger_reconcile",
+			Schedule: cfg.Scheduler.LedgerReconcileSchedule,
+			Run:      ledgerService.ReconcileUsage,
+		},
+		{
+			Name:     "invoice_generation",
+			Schedule: cfg.Scheduler.InvoiceSchedule,
+			Run:      invoiceService.GenerateMonthlyInvoices,
+		},
+		{
+			Name:     "promo_expiry",
+			Schedule: cfg.Scheduler.PromoExpirySchedule,
+			Run:      promoService.RevertExpiredGrants,
+		},
+		{
+			Name:     "tier_evaluation",
+			Schedule: cfg.Scheduler.TierEvaluationSchedule,
+			Run:      tierService.EvaluateTiers,
+		},
+		{
+			Name:     "session_cleanup",
+			Schedule: cfg.Scheduler.SessionCleanupSchedule,
+			Run:      sessionService.CleanupSessions,
+		},
+		{
+			Name:     "rate_limit_cleanup",
+			Schedule: cfg.Scheduler.RateLimitCleanupSchedule,
+			Run:      rateLimiter.Cleanup,
+		},
+	}
+	if cfg.Currency.ExchangeRateAPIKey != "" {
+		jobs = append(jobs, service.Job{
+			Name:     "exchange_rates",
+			Schedule: cfg.Scheduler.ExchangeRateSchedule,
+			Run:      currencyService.UpdateExchangeRates,
+		})
+	}
+	if signingKeyService != nil {
+		jobs = append(jobs, service.Job{
+			Name:     "jwt_key_rotation",
+			Schedule: cfg.Scheduler.JWTKeyRotationSchedule,
+			Run:      signingKeyService.RotateKeys,
+		})
+	}
+	for _, job := range jobs {
+		job.Timeout = cfg.Scheduler.JobTimeout
+		if err := scheduler.Register(job); err != nil {
+			log.Fatalf("Failed to register job: %v", err)
+		}
+	}
+	scheduler.Start(context.Background())
+	defer scheduler.Stop()
+
+	authHandler := handlers.NewAuthHandler(userService, sessionService, teamInvitationService, accountService)
 	modelHandler := handlers.NewModelHandler(modelService)
 	companyHandler := handlers.NewCompanyHandler(modelService)
 	budgetHandler := handlers.NewBudgetHandler(budgetService)
 	currencyHandler := handlers.NewCurrencyHandler(currencyService)
 	tierHandler := handlers.NewTierHandler(tierService)
-	userHandler := handlers.NewUserHandler(userService, litellmClient, apiKeyRepo, requestRepo)
+	userHandler := handlers.NewUserHandler(userService, apiKeyService, teamService, litellmClient, apiKeyRepo, requestRepo)
 	rateLimitHandler := handlers.NewRateLimitHandler(rateLimitService)
 	uploadHandler := handlers.NewUploadHandler()
 	litellmAdminHandler := handlers.NewLiteLLMAdminHandler(litellmClient)
+	gatewayHandler := handlers.NewGatewayHandler(gatewayService)
+	jobHandler := handlers.NewJobHandler(scheduler)
+	ledgerHandler := handlers.NewLedgerHandler(ledgerService, userService)
+	pricingHandler := handlers.NewPricingHandler(pricingService)
+	invoiceHandler := handlers.NewInvoiceHandler(invoiceService, userService, teamService)
+	promoHandler := handlers.NewPromoHandler(promoService, userService)
+	paymentHandler := handlers.NewPaymentHandler(paymentService)
+	teamHandler := handlers.NewTeamHandler(teamService, teamInvitationService, apiKeyService, budgetService)
+	jwksHandler := handlers.NewJWKSHandler(signingKeyService)
 
-	authMiddleware := middleware.NewAuthMiddleware(jwtManager)
+	authMiddleware := middleware.NewAuthMiddleware(jwtManager, sessionService)
+	apiKeyMiddleware := middleware.NewApiKeyMiddleware(apiKeyRepo)
 
-	router := routes.NewRouter(authHandler, modelHandler, companyHandler, budgetHandler, currencyHandler, tierHandler, userHandler, rateLimitHandler, uploadHandler, litellmAdminHandler, authMiddleware)
+	router := routes.NewRouter(authHandler, modelHandler, companyHandler, budgetHandler, currencyHandler, tierHandler, userHandler, rateLimitHandler, uploadHandler, litellmAdminHandler, gatewayHandler, jobHandler, ledgerHandler, pricingHandler, invoiceHandler, promoHandler, paymentHandler, teamHandler, jwksHandler, authMiddleware, apiKeyMiddleware)
 
 	engine := router.SetupRoutes()
+	if err := engine.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 	address := cfg.Server.Host + ":" + cfg.Server.Port
 	log.Printf("Server starting on %s", address)
 
@@ -1,23 +1,33 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/middleware"
+	"oneui-hub/internal/repository"
 	"oneui-hub/internal/service"
-	"oneui-hub/pkg/auth"
 )
 
 type AuthHandler struct {
-	userService service.UserServiceInterface
-	jwtManager  *auth.JWTManager
+	userService       service.UserServiceInterface
+	sessionService    service.SessionService
+	invitationService service.TeamInvitationService
+	accountService    service.AccountService
 }
 
-func NewAuthHandler(userService service.UserServiceInterface, jwtManager *auth.JWTManager) *AuthHandler {
+func NewAuthHandler(userService service.UserServiceInterface, sessionService service.SessionService, invitationService service.TeamInvitationService, accountService service.AccountService) *AuthHandler {
 	return &AuthHandler{
-		userService: userService,
-		jwtManager:  jwtManager,
+		userService:       userService,
+		sessionService:    sessionService,
+		invitationService: invitationService,
+		accountService:    accountService,
 	}
 }
 
@@ -25,6 +35,8 @@ type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=8"`
 	TierName string `json:"tier_name,omitempty"`
+	// InvitationToken - токен из письма-приглашения: пользователь сразу вступает в команду
+	InvitationToken string `json:"invitation_token,omitempty"`
 }
 
 type LoginRequest struct {
@@ -32,9 +44,32 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// AuthResponse - токены новой сессии. Access токен (token) короткоживущий и продлевается
+// через POST /auth/refresh по refresh токену
 type AuthResponse struct {
-	Token string      `json:"token"`
-	User  interface{} `json:"user"`
+	Token        string      `json:"token"`
+	RefreshToken string      `json:"refresh_token,omitempty"`
+	ExpiresAt    *time.Time  `json:"expires_at,omitempty"`
+	User         interface{} `json:"user"`
+	// TeamMember - участие в команде, если регистрация прошла по приглашению
+	TeamMember *domain.TeamMember `json:"team_member,omitempty"`
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -44,6 +79,23 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	// Приглашение проверяем до создания пользователя, чтобы не регистрировать его по негодной ссылке
+	if req.InvitationToken != "" {
+		if h.invitationService == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invitations are not supported"})
+			return
+		}
+		invitation, err := h.invitationService.ValidateToken(c.Request.Context(), req.InvitationToken)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !strings.EqualFold(invitation.Email, req.Email) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invitation was sent to another email"})
+			return
+		}
+	}
+
 	// Создаем пользователя
 	createUserReq := &service.CreateUserRequest{
 		Email:    req.Email,
@@ -57,19 +109,38 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// Генерируем JWT токен
-	token, err := h.jwtManager.GenerateToken(user)
+	// Открываем сессию
+	tokens, err := h.sessionService.StartSession(c.Request.Context(), user, sessionMetadata(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
+	// Письмо можно запросить повторно, поэтому ошибка отправки не отменяет регистрацию
+	if h.accountService != nil {
+		if err := h.accountService.SendVerification(c.Request.Context(), user.ID); err != nil {
+			fmt.Printf("Warning: failed to send verification email to user %s: %v\n", user.ID, err)
+		}
+	}
+
+	// Пользователь уже создан: если принять приглашение не удалось, его можно принять позже из профиля
+	var member *domain.TeamMember
+	if req.InvitationToken != "" {
+		member, err = h.invitationService.AcceptToken(c.Request.Context(), req.InvitationToken, user.ID)
+		if err != nil {
+			fmt.Printf("Warning: failed to accept invitation for new user %s: %v\n", user.ID, err)
+		}
+	}
+
 	// Убираем чувствительные данные
 	user.PasswordHash = ""
 
 	c.JSON(http.StatusCreated, AuthResponse{
-		Token: token,
-		User:  user,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    &tokens.ExpiresAt,
+		User:         user,
+		TeamMember:   member,
 	})
 }
 
@@ -92,8 +163,8 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Генерируем JWT токен
-	token, err := h.jwtManager.GenerateToken(user)
+	// Открываем сессию
+	tokens, err := h.sessionService.StartSession(c.Request.Context(), user, sessionMetadata(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -103,35 +174,230 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	user.PasswordHash = ""
 
 	c.JSON(http.StatusOK, AuthResponse{
-		Token: token,
-		User:  user,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    &tokens.ExpiresAt,
+		User:         user,
 	})
 }
 
+// RefreshToken обменивает refresh токен на новую пару токенов. Предъявленный refresh токен
+// больше не действует, а его повторное предъявление отзывает сессию
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.sessionService.Refresh(c.Request.Context(), req.RefreshToken, sessionMetadata(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRefreshTokenReused):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected, session revoked"})
+		case errors.Is(err, service.ErrInvalidRefreshToken):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to refresh token"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout завершает текущую сессию: ее refresh токен и access токены перестают действовать
+func (h *AuthHandler) Logout(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if ok && claims.SessionID != "" {
+		err := h.sessionService.RevokeSession(c.Request.Context(), claims.UserID, claims.SessionID, domain.SessionRevokedLogout)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Logged out successfully",
+	})
+}
+
+// GetUserSessions возвращает действующие сессии пользователя; текущая помечена полем current
+func (h *AuthHandler) GetUserSessions(c *gin.Context) {
+	userID := c.Param("user_id")
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	sessions, err := h.sessionService.ListSessions(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var currentSessionID string
+	if claims, ok := middleware.GetClaims(c); ok {
+		currentSessionID = claims.SessionID
+	}
+
+	result := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, gin.H{
+			"id":           session.ID,
+			"user_agent":   session.UserAgent,
+			"ip_address":   session.IPAddress,
+			"created_at":   session.CreatedAt,
+			"last_used_at": session.LastUsedAt,
+			"expires_at":   session.ExpiresAt,
+			"current":      session.ID == currentSessionID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// RevokeUserSession завершает одну сессию пользователя
+func (h *AuthHandler) RevokeUserSession(c *gin.Context) {
+	userID := c.Param("user_id")
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	if err := h.sessionService.RevokeSession(c.Request.Context(), userID, c.Param("session_id"), domain.SessionRevokedByUser); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Session revoked successfully",
+	})
+}
+
+// RevokeAllUserSessions завершает все сессии пользователя (выход на всех устройствах)
+func (h *AuthHandler) RevokeAllUserSessions(c *gin.Context) {
+	userID := c.Param("user_id")
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	revoked, err := h.sessionService.RevokeAllSessions(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"revoked": revoked,
+	})
+}
+
+// ForgotPassword отправляет ссылку сброса пароля. Ответ не зависит от того, есть ли аккаунт с этим email
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accountService.RequestPasswordReset(c.Request.Context(), req.Email); err != nil {
+		fmt.Printf("Warning: failed to request password reset: %v\n", err)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": "If an account with this email exists, a password reset link has been sent",
+	})
+}
+
+// ResetPassword устанавливает новый пароль по токену из письма; все сессии пользователя завершаются
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Получаем токен из заголовка
-	var token string
-	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-		token = authHeader[7:]
-	} else {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+	if err := h.accountService.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		if errors.Is(err, service.ErrInvalidAccountToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
 		return
 	}
 
-	// Обновляем токен
-	newToken, err := h.jwtManager.RefreshToken(token)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Password has been reset",
+	})
+}
+
+// VerifyEmail подтверждает email по токену из письма
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.accountService.VerifyEmail(c.Request.Context(), req.Token)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to refresh token"})
+		if errors.Is(err, service.ErrInvalidAccountToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": newToken})
+	// Убираем чувствительные данные
+	user.PasswordHash = ""
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// ResendVerification повторно отправляет письмо подтверждения email текущему пользователю
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.accountService.SendVerification(c.Request.Context(), userID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrEmailAlreadyVerified):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrAccountMailThrottled):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Verification email was sent recently, please try again later"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": "Verification email has been sent",
+	})
+}
+
+// sessionMetadata описывает устройство, с которого пришел запрос
+func sessionMetadata(c *gin.Context) service.SessionMetadata {
+	return service.SessionMetadata{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	}
 }
 
 func (h *AuthHandler) Me(c *gin.Context) {
@@ -17,7 +17,6 @@ import (
 
 	"oneui-hub/internal/domain"
 	"oneui-hub/internal/service"
-	"oneui-hub/pkg/auth"
 )
 
 // Mock UserService
@@ -83,11 +82,62 @@ func (m *MockUserService) ChangePassword(ctx context.Context, userID, oldPasswor
 	return args.Error(0)
 }
 
-func setupAuthHandler() (*AuthHandler, *MockUserService, *auth.JWTManager) {
+// Mock SessionService
+type MockSessionService struct {
+	mock.Mock
+}
+
+func (m *MockSessionService) StartSession(ctx context.Context, user *domain.User, meta service.SessionMetadata) (*service.AuthTokens, error) {
+	args := m.Called(ctx, user, meta)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.AuthTokens), args.Error(1)
+}
+
+func (m *MockSessionService) Refresh(ctx context.Context, refreshToken string, meta service.SessionMetadata) (*service.AuthTokens, error) {
+	args := m.Called(ctx, refreshToken, meta)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.AuthTokens), args.Error(1)
+}
+
+func (m *MockSessionService) IsSessionActive(ctx context.Context, sessionID string) (bool, error) {
+	args := m.Called(ctx, sessionID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockSessionService) ListSessions(ctx context.Context, userID string) ([]*domain.Session, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Session), args.Error(1)
+}
+
+func (m *MockSessionService) RevokeSession(ctx context.Context, userID, sessionID, reason string) error {
+	args := m.Called(ctx, userID, sessionID, reason)
+	return args.Error(0)
+}
+
+func (m *MockSessionService) RevokeAllSessions(ctx context.Context, userID string) (int64, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockSessionService) CleanupSessions(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func setupAuthHandler() (*AuthHandler, *MockUserService, *MockSessionService) {
 	mockUserService := new(MockUserService)
-	jwtManager := auth.NewJWTManager("test-secret", time.Hour)
-	handler := NewAuthHandler(mockUserService, jwtManager)
-	return handler, mockUserService, jwtManager
+	mockSessionService := new(MockSessionService)
+	mockSessionService.On("StartSession", mock.Anything, mock.Anything, mock.Anything).Return(
+		&service.AuthTokens{SessionID: "session-1", AccessToken: "access-token", RefreshToken: "refresh-token", ExpiresAt: time.Now().Add(time.Hour)}, nil)
+	handler := NewAuthHandler(mockUserService, mockSessionService, nil, nil)
+	return handler, mockUserService, mockSessionService
 }
 
 func TestAuthHandler_Register(t *testing.T) {
@@ -296,58 +346,51 @@ func TestAuthHandler_Login(t *testing.T) {
 
 func TestAuthHandler_RefreshToken(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	handler, _, jwtManager := setupAuthHandler()
+	handler, _, mockSessionService := setupAuthHandler()
 
-	// Создаем валидный токен
-	user := &domain.User{
-		ID:    uuid.New().String(),
-		Email: "test@example.com",
-		Role:  domain.RoleCustomer,
-	}
-	validToken, _ := jwtManager.GenerateToken(user)
+	mockSessionService.On("Refresh", mock.Anything, "valid-refresh", mock.Anything).Return(
+		&service.AuthTokens{SessionID: "session-1", AccessToken: "new-access", RefreshToken: "next-refresh"}, nil)
+	mockSessionService.On("Refresh", mock.Anything, "used-refresh", mock.Anything).Return(nil, service.ErrRefreshTokenReused)
+	mockSessionService.On("Refresh", mock.Anything, mock.Anything, mock.Anything).Return(nil, service.ErrInvalidRefreshToken)
 
 	tests := []struct {
 		name           string
-		authHeader     string
+		body           string
 		expectedStatus int
 		checkResponse  func(*testing.T, *httptest.ResponseRecorder)
 	}{
 		{
 			name:           "successful token refresh",
-			authHeader:     "Bearer " + validToken,
+			body:           `{"refresh_token": "valid-refresh"}`,
 			expectedStatus: http.StatusOK,
 			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
 				var response map[string]interface{}
 				err := json.Unmarshal(w.Body.Bytes(), &response)
 				require.NoError(t, err)
-				assert.NotEmpty(t, response["token"])
+				assert.Equal(t, "new-access", response["token"])
+				assert.Equal(t, "next-refresh", response["refresh_token"])
 			},
 		},
 		{
-			name:           "missing authorization header",
-			authHeader:     "",
-			expectedStatus: http.StatusUnauthorized,
-			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
-				var response map[string]interface{}
-				err := json.Unmarshal(w.Body.Bytes(), &response)
-				require.NoError(t, err)
-				assert.Contains(t, response["error"], "Authorization header required")
-			},
+			name:           "missing refresh token",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  func(t *testing.T, w *httptest.ResponseRecorder) {},
 		},
 		{
-			name:           "invalid authorization header format",
-			authHeader:     "InvalidFormat " + validToken,
+			name:           "reused refresh token",
+			body:           `{"refresh_token": "used-refresh"}`,
 			expectedStatus: http.StatusUnauthorized,
 			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
 				var response map[string]interface{}
 				err := json.Unmarshal(w.Body.Bytes(), &response)
 				require.NoError(t, err)
-				assert.Contains(t, response["error"], "Invalid authorization header format")
+				assert.Contains(t, response["error"], "reuse detected")
 			},
 		},
 		{
-			name:           "invalid token",
-			authHeader:     "Bearer invalid-token",
+			name:           "invalid refresh token",
+			body:           `{"refresh_token": "unknown"}`,
 			expectedStatus: http.StatusUnauthorized,
 			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
 				var response map[string]interface{}
@@ -361,10 +404,8 @@ func TestAuthHandler_RefreshToken(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Создаем запрос
-			req := httptest.NewRequest(http.MethodPost, "/auth/refresh", nil)
-			if tt.authHeader != "" {
-				req.Header.Set("Authorization", tt.authHeader)
-			}
+			req := httptest.NewRequest(http.MethodPost, "/auth/refresh", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
 			w := httptest.NewRecorder()
 
 			// Создаем gin контекст
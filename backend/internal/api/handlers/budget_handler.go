@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
@@ -27,6 +28,7 @@ type CreateBudgetRequest struct {
 	TeamID         *string    `json:"team_id"`
 	MaxBudget      float64    `json:"max_budget" binding:"required,gt=0"`
 	BudgetDuration string     `json:"budget_duration"`
+	SoftLimit      bool       `json:"soft_limit"`
 	ResetAt        *time.Time `json:"reset_at"`
 }
 
@@ -35,6 +37,7 @@ type UpdateBudgetRequest struct {
 	TeamID         *string    `json:"team_id"`
 	MaxBudget      *float64   `json:"max_budget"`
 	BudgetDuration *string    `json:"budget_duration"`
+	SoftLimit      *bool      `json:"soft_limit"`
 	ResetAt        *time.Time `json:"reset_at"`
 }
 
@@ -110,14 +113,19 @@ func (h *BudgetHandler) CreateBudget(c *gin.Context) {
 		TeamID:         req.TeamID,
 		MaxBudget:      req.MaxBudget,
 		BudgetDuration: req.BudgetDuration,
+		SoftLimit:      req.SoftLimit,
 		ResetAt:        req.ResetAt,
 	}
 
 	if budget.BudgetDuration == "" {
-		budget.BudgetDuration = "monthly"
+		budget.BudgetDuration = domain.BudgetDurationMonthly
 	}
 
 	if err := h.budgetService.CreateBudget(c.Request.Context(), budget); err != nil {
+		if errors.Is(err, service.ErrInvalidBudget) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -154,11 +162,18 @@ func (h *BudgetHandler) UpdateBudget(c *gin.Context) {
 	if req.BudgetDuration != nil {
 		budget.BudgetDuration = *req.BudgetDuration
 	}
+	if req.SoftLimit != nil {
+		budget.SoftLimit = *req.SoftLimit
+	}
 	if req.ResetAt != nil {
 		budget.ResetAt = req.ResetAt
 	}
 
 	if err := h.budgetService.UpdateBudget(c.Request.Context(), budget); err != nil {
+		if errors.Is(err, service.ErrInvalidBudget) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
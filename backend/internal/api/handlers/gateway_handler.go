@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/middleware"
+	"oneui-hub/internal/service"
+)
+
+type GatewayHandler struct {
+	gatewayService service.GatewayService
+}
+
+func NewGatewayHandler(gatewayService service.GatewayService) *GatewayHandler {
+	return &GatewayHandler{
+		gatewayService: gatewayService,
+	}
+}
+
+// ChatCompletions обрабатывает OpenAI-совместимый запрос /v1/chat/completions
+func (h *GatewayHandler) ChatCompletions(c *gin.Context) {
+	apiKey, ok := middleware.GetApiKey(c)
+	if !ok {
+		writeGatewayError(c, &service.GatewayError{
+			StatusCode: http.StatusUnauthorized,
+			Type:       "invalid_request_error",
+			Code:       "missing_api_key",
+			Message:    "You didn't provide an API key",
+		})
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		writeGatewayError(c, &service.GatewayError{
+			StatusCode: http.StatusBadRequest,
+			Type:       "invalid_request_error",
+			Code:       "invalid_body",
+			Message:    "Failed to read request body",
+		})
+		return
+	}
+
+	call, err := h.gatewayService.Prepare(c.Request.Context(), &service.GatewayRequest{
+		ApiKey:   apiKey,
+		CallType: domain.CallTypeChat,
+		Body:     body,
+	})
+	if err != nil {
+		writeGatewayError(c, err)
+		return
+	}
+
+	if call.RateLimit != nil {
+		for name, value := range call.RateLimit.Headers() {
+			c.Header(name, value)
+		}
+	}
+
+	if call.Payload.Stream {
+		if err := h.gatewayService.StreamChatCompletion(c.Request.Context(), call, &sseSink{c: c}); err != nil {
+			writeGatewayError(c, err)
+		}
+		return
+	}
+
+	resp, err := h.gatewayService.ChatCompletion(c.Request.Context(), call)
+	if err != nil {
+		writeGatewayError(c, err)
+		return
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	c.Data(resp.StatusCode, contentType, resp.Body)
+}
+
+// ListModels возвращает модели, доступные API ключу, в формате OpenAI /v1/models
+func (h *GatewayHandler) ListModels(c *gin.Context) {
+	apiKey, ok := middleware.GetApiKey(c)
+	if !ok {
+		writeGatewayError(c, &service.GatewayError{
+			StatusCode: http.StatusUnauthorized,
+			Type:       "invalid_request_error",
+			Code:       "missing_api_key",
+			Message:    "You didn't provide an API key",
+		})
+		return
+	}
+
+	models, err := h.gatewayService.ListModels(c.Request.Context(), apiKey)
+	if err != nil {
+		writeGatewayError(c, err)
+		return
+	}
+
+	data := make([]gin.H, 0, len(models))
+	for _, model := range models {
+		ownedBy := ""
+		if model.Company != nil {
+			ownedBy = model.Company.ExternalID
+		}
+
+		data = append(data, gin.H{
+			"id":       model.ExternalID,
+			"object":   "model",
+			"created":  model.CreatedAt.Unix(),
+			"owned_by": ownedBy,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   data,
+	})
+}
+
+// sseSink передает потоковый ответ шлюза клиенту без буферизации
+type sseSink struct {
+	c *gin.Context
+}
+
+func (s *sseSink) Start(statusCode int, contentType string) {
+	s.c.Header("Content-Type", contentType)
+	if contentType == "text/event-stream" {
+		s.c.Header("Cache-Control", "no-cache")
+		s.c.Header("Connection", "keep-alive")
+		// Отключаем буферизацию на стороне nginx
+		s.c.Header("X-Accel-Buffering", "no")
+	}
+	s.c.Status(statusCode)
+	s.c.Writer.WriteHeaderNow()
+}
+
+func (s *sseSink) Write(p []byte) error {
+	_, err := s.c.Writer.Write(p)
+	return err
+}
+
+func (s *sseSink) Flush() {
+	s.c.Writer.Flush()
+}
+
+// writeGatewayError отдает ошибку в формате OpenAI API
+func writeGatewayError(c *gin.Context, err error) {
+	var gwErr *service.GatewayError
+	if !errors.As(err, &gwErr) {
+		fmt.Printf("ERROR: gateway request failed: %v\n", err)
+		gwErr = &service.GatewayError{
+			StatusCode: http.StatusInternalServerError,
+			Type:       "api_error",
+			Code:       "internal_error",
+			Message:    "Internal server error",
+		}
+	}
+
+	for name, value := range gwErr.Headers {
+		c.Header(name, value)
+	}
+
+	c.AbortWithStatusJSON(gwErr.StatusCode, gin.H{
+		"error": gin.H{
+			"message": gwErr.Message,
+			"type":    gwErr.Type,
+			"code":    gwErr.Code,
+		},
+	})
+}
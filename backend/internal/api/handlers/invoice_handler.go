@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/middleware"
+	"oneui-hub/internal/repository"
+	"oneui-hub/internal/service"
+)
+
+type InvoiceHandler struct {
+	invoiceService service.InvoiceService
+	userService    *service.UserService
+	teamService    service.TeamService
+}
+
+func NewInvoiceHandler(invoiceService service.InvoiceService, userService *service.UserService, teamService service.TeamService) *InvoiceHandler {
+	return &InvoiceHandler{
+		invoiceService: invoiceService,
+		userService:    userService,
+		teamService:    teamService,
+	}
+}
+
+// GenerateInvoiceRequest - выставление счета администратором
+type GenerateInvoiceRequest struct {
+	// Period - месяц в формате YYYY-MM
+	Period   string `json:"period" binding:"required"`
+	Currency string `json:"currency"`
+}
+
+// GetUserInvoices возвращает счета пользователя, начиная с последнего периода
+func (h *InvoiceHandler) GetUserInvoices(c *gin.Context) {
+	userID := c.Param("user_id")
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	h.listInvoices(c, func(limit, offset int) ([]*domain.Invoice, error) {
+		return h.invoiceService.ListInvoices(c.Request.Context(), userID, limit, offset)
+	})
+}
+
+// GetTeamInvoices возвращает счета команды (владелец, администратор и бухгалтер команды)
+func (h *InvoiceHandler) GetTeamInvoices(c *gin.Context) {
+	teamID := c.Param("team_id")
+	if !h.teamBillingAccess(c, teamID) {
+		return
+	}
+
+	h.listInvoices(c, func(limit, offset int) ([]*domain.Invoice, error) {
+		return h.invoiceService.ListTeamInvoices(c.Request.Context(), teamID, limit, offset)
+	})
+}
+
+// listInvoices отвечает страницей счетов
+func (h *InvoiceHandler) listInvoices(c *gin.Context, list func(limit, offset int) ([]*domain.Invoice, error)) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	offset := (page - 1) * limit
+
+	invoices, err := list(limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"data":     invoices,
+			"page":     page,
+			"limit":    limit,
+			"has_next": len(invoices) == limit,
+			"has_prev": page > 1,
+		},
+	})
+}
+
+// GetUserInvoice возвращает счет со строками по моделям
+func (h *InvoiceHandler) GetUserInvoice(c *gin.Context) {
+	invoice, ok := h.loadUserInvoice(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": invoice})
+}
+
+// DownloadUserInvoice отдает файл счета. Параметр format: pdf (по умолчанию) или csv
+func (h *InvoiceHandler) DownloadUserInvoice(c *gin.Context) {
+	invoice, ok := h.loadUserInvoice(c)
+	if !ok {
+		return
+	}
+
+	h.sendInvoiceFile(c, invoice)
+}
+
+// GetTeamInvoice возвращает счет команды со строками по моделям
+func (h *InvoiceHandler) GetTeamInvoice(c *gin.Context) {
+	invoice, ok := h.loadTeamInvoice(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": invoice})
+}
+
+// DownloadTeamInvoice отдает файл счета команды. Параметр format: pdf (по умолчанию) или csv
+func (h *InvoiceHandler) DownloadTeamInvoice(c *gin.Context) {
+	invoice, ok := h.loadTeamInvoice(c)
+	if !ok {
+		return
+	}
+
+	h.sendInvoiceFile(c, invoice)
+}
+
+// sendInvoiceFile отдает файл счета в формате из параметра format
+func (h *InvoiceHandler) sendInvoiceFile(c *gin.Context, invoice *domain.Invoice) {
+	format := c.DefaultQuery("format", domain.InvoiceFormatPDF)
+	path, err := h.invoiceService.InvoiceFile(c.Request.Context(), invoice, format)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInvoiceRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.FileAttachment(path, filepath.Base(path))
+}
+
+// loadUserInvoice находит личный счет из пути запроса и проверяет доступ к нему
+func (h *InvoiceHandler) loadUserInvoice(c *gin.Context) (*domain.Invoice, bool) {
+	userID := c.Param("user_id")
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+
+	return h.loadInvoice(c, func(invoice *domain.Invoice) bool {
+		return invoice.UserID == userID && invoice.TeamID == ""
+	})
+}
+
+// loadTeamInvoice находит счет команды из пути запроса и проверяет доступ к нему
+func (h *InvoiceHandler) loadTeamInvoice(c *gin.Context) (*domain.Invoice, bool) {
+	teamID := c.Param("team_id")
+	if !h.teamBillingAccess(c, teamID) {
+		return nil, false
+	}
+
+	return h.loadInvoice(c, func(invoice *domain.Invoice) bool {
+		return invoice.TeamID == teamID
+	})
+}
+
+// teamBillingAccess проверяет, что текущий пользователь - администратор или участник команды,
+// которому доступны ее расходы. Отвечает клиенту сам и возвращает false, если доступа нет
+func (h *InvoiceHandler) teamBillingAccess(c *gin.Context, teamID string) bool {
+	if role, ok := middleware.GetUserRole(c); ok && role == domain.RoleAdmin {
+		return true
+	}
+
+	userID, _ := middleware.GetUserID(c)
+	member, err := h.teamService.GetMember(c.Request.Context(), teamID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			// Не раскрываем существование чужих команд
+			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !member.CanViewBilling() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return false
+	}
+	return true
+}
+
+// loadInvoice находит счет из пути запроса; счет, для которого belongs вернула false, считается ненайденным
+func (h *InvoiceHandler) loadInvoice(c *gin.Context, belongs func(invoice *domain.Invoice) bool) (*domain.Invoice, bool) {
+	invoice, err := h.invoiceService.GetInvoice(c.Request.Context(), c.Param("invoice_id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if !belongs(invoice) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return nil, false
+	}
+
+	return invoice, true
+}
+
+// GenerateUserInvoice выставляет пользователю счет за завершенный месяц
+func (h *InvoiceHandler) GenerateUserInvoice(c *gin.Context) {
+	userID := c.Param("user_id")
+
+	period, currency, ok := bindGenerateInvoiceRequest(c)
+	if !ok {
+		return
+	}
+
+	if _, err := h.userService.GetUserByID(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	h.generateInvoice(c, &service.GenerateInvoiceRequest{
+		UserID:      userID,
+		PeriodStart: period,
+		Currency:    currency,
+	})
+}
+
+// GenerateTeamInvoice выставляет команде счет за запросы по ее ключам за завершенный месяц
+func (h *InvoiceHandler) GenerateTeamInvoice(c *gin.Context) {
+	teamID := c.Param("team_id")
+
+	period, currency, ok := bindGenerateInvoiceRequest(c)
+	if !ok {
+		return
+	}
+
+	if _, err := h.teamService.GetTeam(c.Request.Context(), teamID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		return
+	}
+
+	h.generateInvoice(c, &service.GenerateInvoiceRequest{
+		TeamID:      teamID,
+		PeriodStart: period,
+		Currency:    currency,
+	})
+}
+
+func bindGenerateInvoiceRequest(c *gin.Context) (time.Time, string, bool) {
+	var req GenerateInvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return time.Time{}, "", false
+	}
+
+	period, err := time.Parse("2006-01", req.Period)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Period must be in YYYY-MM format"})
+		return time.Time{}, "", false
+	}
+	return period, req.Currency, true
+}
+
+func (h *InvoiceHandler) generateInvoice(c *gin.Context, req *service.GenerateInvoiceRequest) {
+	invoice, err := h.invoiceService.GenerateInvoice(c.Request.Context(), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidInvoiceRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, repository.ErrDuplicate):
+			c.JSON(http.StatusConflict, gin.H{"error": "Invoice for this period already exists"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": invoice})
+}
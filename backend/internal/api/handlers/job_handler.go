@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"oneui-hub/internal/service"
+)
+
+type JobHandler struct {
+	schedulerService service.SchedulerService
+}
+
+func NewJobHandler(schedulerService service.SchedulerService) *JobHandler {
+	return &JobHandler{
+		schedulerService: schedulerService,
+	}
+}
+
+// GetJobs возвращает зарегистрированные фоновые задачи с расписанием и последним запуском
+func (h *JobHandler) GetJobs(c *gin.Context) {
+	jobs, err := h.schedulerService.ListJobs(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": jobs})
+}
+
+// GetJobRuns возвращает историю запусков. Параметр job фильтрует запуски одной задачи
+func (h *JobHandler) GetJobRuns(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	offset := (page - 1) * limit
+
+	runs, err := h.schedulerService.ListRuns(c.Request.Context(), c.Query("job"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"data":     runs,
+			"page":     page,
+			"limit":    limit,
+			"has_next": len(runs) == limit,
+			"has_prev": page > 1,
+		},
+	})
+}
+
+// TriggerJob запускает задачу вне расписания. Задача выполняется в фоне,
+// результат появляется в истории запусков
+func (h *JobHandler) TriggerJob(c *gin.Context) {
+	run, err := h.schedulerService.Trigger(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrJobNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		case errors.Is(err, service.ErrJobAlreadyRunning):
+			c.JSON(http.StatusConflict, gin.H{"error": "Job is already running"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"data": run})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"oneui-hub/internal/service"
+	"oneui-hub/pkg/auth"
+)
+
+// jwksMaxAge - сколько секунд клиенты могут кэшировать JWKS.
+// Должно быть меньше JWT_KEY_ACTIVATION_DELAY, чтобы новый ключ успел попасть в кэши до первой подписи
+const jwksMaxAge = 900
+
+type JWKSHandler struct {
+	keyService service.SigningKeyService
+}
+
+// NewJWKSHandler создает обработчик JWKS. keyService равен nil при подписи HS256 -
+// тогда публиковать нечего и список ключей пуст
+func NewJWKSHandler(keyService service.SigningKeyService) *JWKSHandler {
+	return &JWKSHandler{
+		keyService: keyService,
+	}
+}
+
+// GetJWKS отдает открытые ключи для проверки токенов хаба другими сервисами
+func (h *JWKSHandler) GetJWKS(c *gin.Context) {
+	keys := []auth.JWK{}
+	if h.keyService != nil {
+		published, err := h.keyService.PublicKeys(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load signing keys"})
+			return
+		}
+		keys = published
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", jwksMaxAge))
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
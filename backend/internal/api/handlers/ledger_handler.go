@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/middleware"
+	"oneui-hub/internal/repository"
+	"oneui-hub/internal/service"
+)
+
+type LedgerHandler struct {
+	ledgerService service.LedgerService
+	userService   *service.UserService
+}
+
+func NewLedgerHandler(ledgerService service.LedgerService, userService *service.UserService) *LedgerHandler {
+	return &LedgerHandler{
+		ledgerService: ledgerService,
+		userService:   userService,
+	}
+}
+
+// BalanceOperationRequest - ручное начисление или списание администратором
+type BalanceOperationRequest struct {
+	Amount float64 `json:"amount" binding:"required,gt=0"`
+	Reason string  `json:"reason" binding:"required"`
+	// Type - тип начисления: topup, refund, promo_credit или adjustment (по умолчанию).
+	// Списания всегда проводятся как adjustment
+	Type      string `json:"type"`
+	Reference string `json:"reference"`
+}
+
+// GetUserBalance возвращает текущий баланс пользователя
+func (h *LedgerHandler) GetUserBalance(c *gin.Context) {
+	userID := c.Param("user_id")
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	balance, err := h.ledgerService.GetBalance(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":  userID,
+		"balance":  balance,
+		"currency": "USD",
+	})
+}
+
+// GetUserTransactions возвращает операции по балансу пользователя, начиная с последних
+func (h *LedgerHandler) GetUserTransactions(c *gin.Context) {
+	userID := c.Param("user_id")
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	offset := (page - 1) * limit
+
+	entries, err := h.ledgerService.ListTransactions(c.Request.Context(), userID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	transactions := make([]gin.H, 0, len(entries))
+	for _, entry := range entries {
+		item := gin.H{
+			"id":            entry.TransactionID,
+			"amount":        entry.Amount,
+			"balance_after": entry.BalanceAfter,
+			"created_at":    entry.CreatedAt,
+		}
+		if entry.Transaction != nil {
+			item["type"] = entry.Transaction.Type
+			item["reason"] = entry.Transaction.Reason
+			item["reference"] = entry.Transaction.Reference
+		}
+		transactions = append(transactions, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"data":     transactions,
+			"page":     page,
+			"limit":    limit,
+			"has_next": len(entries) == limit,
+			"has_prev": page > 1,
+		},
+	})
+}
+
+// CreditUser начисляет средства на баланс пользователя
+func (h *LedgerHandler) CreditUser(c *gin.Context) {
+	h.postOperation(c, 1)
+}
+
+// DebitUser списывает средства с баланса пользователя
+func (h *LedgerHandler) DebitUser(c *gin.Context) {
+	h.postOperation(c, -1)
+}
+
+func (h *LedgerHandler) postOperation(c *gin.Context, sign float64) {
+	userID := c.Param("user_id")
+
+	var req BalanceOperationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	txType := req.Type
+	if txType == "" || sign < 0 {
+		txType = domain.LedgerTxAdjustment
+	}
+	if txType == domain.LedgerTxUsage || txType == domain.LedgerTxPaymentRefund || txType == domain.LedgerTxChargeback {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Usage charges and payment reversals are posted automatically"})
+		return
+	}
+
+	if _, err := h.userService.GetUserByID(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	adminID, _ := middleware.GetUserID(c)
+	transaction, err := h.ledgerService.Post(c.Request.Context(), &service.LedgerPosting{
+		UserID:    userID,
+		Amount:    sign * req.Amount,
+		Type:      txType,
+		Reason:    req.Reason,
+		Reference: req.Reference,
+		CreatedBy: adminID,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidLedgerPosting):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, repository.ErrDuplicate):
+			c.JSON(http.StatusConflict, gin.H{"error": "Transaction with this reference already exists"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	balance, err := h.ledgerService.GetBalance(c.Request.Context(), userID)
+	if err != nil {
+		fmt.Printf("Warning: failed to get balance for user %s: %v\n", userID, err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"transaction": transaction,
+		"balance":     balance,
+	})
+}
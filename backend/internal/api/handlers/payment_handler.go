@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"oneui-hub/internal/payment"
+	"oneui-hub/internal/service"
+)
+
+// maxWebhookBodySize - ограничение размера тела вебхука провайдера платежей
+const maxWebhookBodySize = 1 << 20
+
+type PaymentHandler struct {
+	paymentService service.PaymentService
+}
+
+func NewPaymentHandler(paymentService service.PaymentService) *PaymentHandler {
+	return &PaymentHandler{
+		paymentService: paymentService,
+	}
+}
+
+// CreateCheckoutRequest - пополнение баланса
+type CreateCheckoutRequest struct {
+	Amount float64 `json:"amount" binding:"required"`
+}
+
+// CreateCheckout создает платеж и возвращает ссылку на страницу оплаты провайдера
+func (h *PaymentHandler) CreateCheckout(c *gin.Context) {
+	userID := c.Param("user_id")
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	var req CreateCheckoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	p, err := h.paymentService.CreateCheckout(c.Request.Context(), userID, req.Amount)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidPaymentRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrPaymentsDisabled):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payments are not configured"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": p})
+}
+
+// GetUserPayments возвращает пополнения пользователя, начиная с последних
+func (h *PaymentHandler) GetUserPayments(c *gin.Context) {
+	userID := c.Param("user_id")
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	offset := (page - 1) * limit
+
+	payments, err := h.paymentService.ListPayments(c.Request.Context(), userID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"data":     payments,
+			"page":     page,
+			"limit":    limit,
+			"has_next": len(payments) == limit,
+			"has_prev": page > 1,
+		},
+	})
+}
+
+// HandleWebhook принимает события провайдера платежей. Подпись проверяется по исходному телу запроса.
+// Ответ 5xx заставляет провайдера повторить доставку
+func (h *PaymentHandler) HandleWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBodySize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	if err := h.paymentService.HandleWebhook(c.Request.Context(), payload, c.Request.Header); err != nil {
+		switch {
+		case errors.Is(err, payment.ErrInvalidSignature):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, payment.ErrInvalidEvent):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrPaymentsDisabled):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payments are not configured"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
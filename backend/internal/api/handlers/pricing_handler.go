@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"oneui-hub/internal/middleware"
+	"oneui-hub/internal/repository"
+	"oneui-hub/internal/service"
+)
+
+type PricingHandler struct {
+	pricingService service.PricingService
+}
+
+func NewPricingHandler(pricingService service.PricingService) *PricingHandler {
+	return &PricingHandler{
+		pricingService: pricingService,
+	}
+}
+
+// GetPriceRules возвращает все правила наценки, включая еще не вступившие в силу
+func (h *PricingHandler) GetPriceRules(c *gin.Context) {
+	rules, err := h.pricingService.ListRules(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": rules})
+}
+
+// CreatePriceRule создает правило наценки. Без effective_from правило действует сразу
+func (h *PricingHandler) CreatePriceRule(c *gin.Context) {
+	var req service.CreatePriceRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	req.CreatedBy, _ = middleware.GetUserID(c)
+
+	rule, err := h.pricingService.CreateRule(c.Request.Context(), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidPriceRule) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": rule})
+}
+
+// DeletePriceRule удаляет правило наценки. Уже созданные версии цен не изменяются
+func (h *PricingHandler) DeletePriceRule(c *gin.Context) {
+	if err := h.pricingService.DeleteRule(c.Request.Context(), c.Param("id")); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Price rule not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Price rule deleted successfully"})
+}
+
+// GetModelPriceHistory возвращает версии цены модели, начиная с последних.
+// Параметр tier_id оставляет версии одного тарифа
+func (h *PricingHandler) GetModelPriceHistory(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	offset := (page - 1) * limit
+
+	prices, err := h.pricingService.ListPriceHistory(c.Request.Context(), c.Param("model_id"), c.Query("tier_id"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"data":     prices,
+			"page":     page,
+			"limit":    limit,
+			"has_next": len(prices) == limit,
+			"has_prev": page > 1,
+		},
+	})
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"oneui-hub/internal/middleware"
+	"oneui-hub/internal/repository"
+	"oneui-hub/internal/service"
+)
+
+type PromoHandler struct {
+	promoService service.PromoService
+	userService  *service.UserService
+}
+
+func NewPromoHandler(promoService service.PromoService, userService *service.UserService) *PromoHandler {
+	return &PromoHandler{
+		promoService: promoService,
+		userService:  userService,
+	}
+}
+
+// RedeemPromoCodeRequest - активация промокода пользователем
+type RedeemPromoCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// GetPromoCodes возвращает промокоды, начиная с последних созданных
+func (h *PromoHandler) GetPromoCodes(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	offset := (page - 1) * limit
+
+	codes, err := h.promoService.ListCodes(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"data":     codes,
+			"page":     page,
+			"limit":    limit,
+			"has_next": len(codes) == limit,
+			"has_prev": page > 1,
+		},
+	})
+}
+
+// CreatePromoCode создает промокод. Без code значение генерируется автоматически
+func (h *PromoHandler) CreatePromoCode(c *gin.Context) {
+	var req service.CreatePromoCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	req.CreatedBy, _ = middleware.GetUserID(c)
+
+	code, err := h.promoService.CreateCode(c.Request.Context(), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidPromoCode):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, repository.ErrDuplicate):
+			c.JSON(http.StatusConflict, gin.H{"error": "Promo code already exists"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": code})
+}
+
+// DeactivatePromoCode запрещает новые активации промокода
+func (h *PromoHandler) DeactivatePromoCode(c *gin.Context) {
+	code, err := h.promoService.DeactivateCode(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Promo code not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": code})
+}
+
+// RedeemPromoCode активирует промокод для пользователя
+func (h *PromoHandler) RedeemPromoCode(c *gin.Context) {
+	userID := c.Param("user_id")
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	var req RedeemPromoCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if _, err := h.userService.GetUserByID(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	redemption, err := h.promoService.Redeem(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidPromoCode):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Promo code not found"})
+		case errors.Is(err, service.ErrPromoCodeUnavailable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": redemption})
+}
+
+// GetUserPromoRedemptions возвращает активированные пользователем промокоды
+func (h *PromoHandler) GetUserPromoRedemptions(c *gin.Context) {
+	userID := c.Param("user_id")
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	offset := (page - 1) * limit
+
+	redemptions, err := h.promoService.ListRedemptions(c.Request.Context(), userID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"data":     redemptions,
+			"page":     page,
+			"limit":    limit,
+			"has_next": len(redemptions) == limit,
+			"has_prev": page > 1,
+		},
+	})
+}
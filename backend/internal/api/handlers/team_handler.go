@@ -0,0 +1,733 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/middleware"
+	"oneui-hub/internal/repository"
+	"oneui-hub/internal/service"
+)
+
+type TeamHandler struct {
+	teamService       service.TeamService
+	invitationService service.TeamInvitationService
+	apiKeyService     service.ApiKeyService
+	budgetService     service.BudgetService
+}
+
+func NewTeamHandler(teamService service.TeamService, invitationService service.TeamInvitationService, apiKeyService service.ApiKeyService, budgetService service.BudgetService) *TeamHandler {
+	return &TeamHandler{
+		teamService:       teamService,
+		invitationService: invitationService,
+		apiKeyService:     apiKeyService,
+		budgetService:     budgetService,
+	}
+}
+
+// Структуры запросов
+type CreateTeamRequest struct {
+	Name        string `json:"name" binding:"required,max=255"`
+	Description string `json:"description"`
+}
+
+type UpdateTeamRequest struct {
+	Name        *string `json:"name,omitempty" binding:"omitempty,max=255"`
+	Description *string `json:"description,omitempty"`
+}
+
+type AddTeamMemberRequest struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+	Role   string `json:"role" binding:"required"`
+}
+
+type InviteTeamMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required"`
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type UpdateTeamMemberRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type CreateTeamBudgetRequest struct {
+	MaxBudget      float64    `json:"max_budget" binding:"required,gt=0"`
+	BudgetDuration string     `json:"budget_duration"`
+	SoftLimit      bool       `json:"soft_limit"`
+	ResetAt        *time.Time `json:"reset_at"`
+}
+
+type SetTeamTierRequest struct {
+	// Пустой tier_id снимает тариф команды
+	TierID *string `json:"tier_id"`
+}
+
+// teamAccess проверяет, что текущий пользователь - участник команды с подходящей ролью или администратор.
+// Отвечает клиенту сам и возвращает false, если доступа нет
+func (h *TeamHandler) teamAccess(c *gin.Context, allowed func(member *domain.TeamMember) bool) (*domain.TeamMember, bool) {
+	teamID := c.Param("team_id")
+
+	if role, ok := middleware.GetUserRole(c); ok && role == domain.RoleAdmin {
+		if _, err := h.teamService.GetTeam(c.Request.Context(), teamID); err != nil {
+			respondTeamError(c, err)
+			return nil, false
+		}
+		// Администратор действует с правами владельца
+		userID, _ := middleware.GetUserID(c)
+		return &domain.TeamMember{TeamID: teamID, UserID: userID, Role: domain.TeamRoleOwner}, true
+	}
+
+	userID, _ := middleware.GetUserID(c)
+	member, err := h.teamService.GetMember(c.Request.Context(), teamID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			// Не раскрываем существование чужих команд
+			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if allowed != nil && !allowed(member) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+	return member, true
+}
+
+func respondTeamError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidTeamRequest), errors.Is(err, service.ErrInvalidBudget), errors.Is(err, service.ErrInvalidApiKeyRequest),
+		errors.Is(err, service.ErrInvalidInvitation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// CreateTeam создает команду, текущий пользователь становится ее владельцем
+func (h *TeamHandler) CreateTeam(c *gin.Context) {
+	var req CreateTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := middleware.GetUserID(c)
+	team, err := h.teamService.CreateTeam(c.Request.Context(), &service.CreateTeamRequest{
+		Name:        req.Name,
+		Description: req.Description,
+		CreatedBy:   userID,
+	})
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    team,
+	})
+}
+
+// GetMyTeams возвращает команды текущего пользователя
+func (h *TeamHandler) GetMyTeams(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+	teams, err := h.teamService.ListUserTeams(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": teams})
+}
+
+// GetAllTeams возвращает все команды (административный метод)
+func (h *TeamHandler) GetAllTeams(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	offset := (page - 1) * limit
+
+	teams, err := h.teamService.ListTeams(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"data":     teams,
+			"page":     page,
+			"limit":    limit,
+			"has_next": len(teams) == limit,
+			"has_prev": page > 1,
+		},
+	})
+}
+
+// GetTeam возвращает команду и роль текущего пользователя в ней
+func (h *TeamHandler) GetTeam(c *gin.Context) {
+	member, ok := h.teamAccess(c, nil)
+	if !ok {
+		return
+	}
+
+	team, err := h.teamService.GetTeam(c.Request.Context(), member.TeamID)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": team,
+		"role": member.Role,
+	})
+}
+
+// UpdateTeam изменяет название и описание команды (владелец или администратор команды)
+func (h *TeamHandler) UpdateTeam(c *gin.Context) {
+	member, ok := h.teamAccess(c, (*domain.TeamMember).CanManage)
+	if !ok {
+		return
+	}
+
+	var req UpdateTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	team, err := h.teamService.UpdateTeam(c.Request.Context(), member.TeamID, &service.UpdateTeamRequest{
+		Name:        req.Name,
+		Description: req.Description,
+	})
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    team,
+	})
+}
+
+// DeleteTeam удаляет команду (только владелец)
+func (h *TeamHandler) DeleteTeam(c *gin.Context) {
+	member, ok := h.teamAccess(c, isTeamOwner)
+	if !ok {
+		return
+	}
+
+	if err := h.teamService.DeleteTeam(c.Request.Context(), member.TeamID); err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Team deleted successfully",
+	})
+}
+
+// SetTeamTier назначает тариф команды (административный метод)
+func (h *TeamHandler) SetTeamTier(c *gin.Context) {
+	var req SetTeamTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	team, err := h.teamService.SetTeamTier(c.Request.Context(), c.Param("team_id"), req.TierID)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    team,
+	})
+}
+
+// GetTeamMembers возвращает участников команды
+func (h *TeamHandler) GetTeamMembers(c *gin.Context) {
+	member, ok := h.teamAccess(c, nil)
+	if !ok {
+		return
+	}
+
+	members, err := h.teamService.ListMembers(c.Request.Context(), member.TeamID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": members})
+}
+
+// AddTeamMember добавляет участника по user_id или email. Назначить владельца может только владелец
+func (h *TeamHandler) AddTeamMember(c *gin.Context) {
+	member, ok := h.teamAccess(c, (*domain.TeamMember).CanManage)
+	if !ok {
+		return
+	}
+
+	var req AddTeamMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Role == domain.TeamRoleOwner && !isTeamOwner(member) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only team owners can add owners"})
+		return
+	}
+
+	added, err := h.teamService.AddMember(c.Request.Context(), member.TeamID, &service.AddTeamMemberRequest{
+		UserID: req.UserID,
+		Email:  req.Email,
+		Role:   req.Role,
+	})
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    added,
+	})
+}
+
+// UpdateTeamMember меняет роль участника. Роли владельцев меняет только владелец
+func (h *TeamHandler) UpdateTeamMember(c *gin.Context) {
+	member, ok := h.teamAccess(c, (*domain.TeamMember).CanManage)
+	if !ok {
+		return
+	}
+
+	var req UpdateTeamMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.Param("user_id")
+	target, err := h.teamService.GetMember(c.Request.Context(), member.TeamID, userID)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+	if (req.Role == domain.TeamRoleOwner || target.Role == domain.TeamRoleOwner) && !isTeamOwner(member) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only team owners can change owners"})
+		return
+	}
+
+	updated, err := h.teamService.UpdateMemberRole(c.Request.Context(), member.TeamID, userID, req.Role)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    updated,
+	})
+}
+
+// RemoveTeamMember исключает участника из команды. Участник может выйти из команды сам
+func (h *TeamHandler) RemoveTeamMember(c *gin.Context) {
+	member, ok := h.teamAccess(c, nil)
+	if !ok {
+		return
+	}
+
+	userID := c.Param("user_id")
+	if userID != member.UserID {
+		if !member.CanManage() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			return
+		}
+		target, err := h.teamService.GetMember(c.Request.Context(), member.TeamID, userID)
+		if err != nil {
+			respondTeamError(c, err)
+			return
+		}
+		if target.Role == domain.TeamRoleOwner && !isTeamOwner(member) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only team owners can remove owners"})
+			return
+		}
+	}
+
+	if err := h.teamService.RemoveMember(c.Request.Context(), member.TeamID, userID); err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Team member removed successfully",
+	})
+}
+
+// GetTeamApiKeys возвращает ключи команды. Участники без права управления видят только свои ключи
+func (h *TeamHandler) GetTeamApiKeys(c *gin.Context) {
+	member, ok := h.teamAccess(c, nil)
+	if !ok {
+		return
+	}
+
+	apiKeys, err := h.teamService.ListTeamApiKeys(c.Request.Context(), member.TeamID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	result := make([]gin.H, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		if !member.CanManage() && apiKey.UserID != member.UserID {
+			continue
+		}
+		result = append(result, gin.H{
+			"id":              apiKey.ID,
+			"user_id":         apiKey.UserID,
+			"team_id":         apiKey.TeamID,
+			"name":            apiKey.Name,
+			"api_key_preview": apiKey.ApiKeyPreview,
+			"created_at":      apiKey.CreatedAt.Format(time.RFC3339),
+			"expires_at":      apiKey.ExpiresAt,
+			"is_active":       apiKey.IsActive(now),
+			"scopes":          apiKey.Scopes(),
+			"max_budget":      apiKey.MaxBudget,
+			"budget_duration": apiKey.BudgetDuration,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// CreateTeamApiKey выпускает ключ команды для текущего пользователя
+func (h *TeamHandler) CreateTeamApiKey(c *gin.Context) {
+	member, ok := h.teamAccess(c, (*domain.TeamMember).CanUseModels)
+	if !ok {
+		return
+	}
+
+	var req service.CreateApiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	apiKey, key, err := h.apiKeyService.CreateTeamApiKey(c.Request.Context(), member.TeamID, member.UserID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidApiKeyRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		fmt.Printf("ERROR: failed to create API key for team %s: %v\n", member.TeamID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":              apiKey.ID,
+		"user_id":         apiKey.UserID,
+		"team_id":         apiKey.TeamID,
+		"name":            apiKey.Name,
+		"api_key":         key, // Возвращаем ключ только при создании
+		"api_key_preview": apiKey.ApiKeyPreview,
+		"created_at":      apiKey.CreatedAt.Format(time.RFC3339),
+		"is_active":       true,
+		"scopes":          apiKey.Scopes(),
+		"max_budget":      apiKey.MaxBudget,
+		"budget_duration": apiKey.BudgetDuration,
+	})
+}
+
+// RevokeTeamApiKey прекращает действие ключа команды. Участник может отозвать свой ключ,
+// владелец и администратор команды - любой
+func (h *TeamHandler) RevokeTeamApiKey(c *gin.Context) {
+	member, ok := h.teamAccess(c, nil)
+	if !ok {
+		return
+	}
+
+	keyID := c.Param("key_id")
+	if !member.CanManage() {
+		keys, err := h.teamService.ListTeamApiKeys(c.Request.Context(), member.TeamID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		own := false
+		for _, apiKey := range keys {
+			if apiKey.ID == keyID && apiKey.UserID == member.UserID {
+				own = true
+				break
+			}
+		}
+		if !own {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			return
+		}
+	}
+
+	apiKey, err := h.teamService.RevokeTeamApiKey(c.Request.Context(), member.TeamID, keyID)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"id":         apiKey.ID,
+			"expires_at": apiKey.ExpiresAt,
+		},
+	})
+}
+
+// GetTeamBudgets возвращает бюджеты команды
+func (h *TeamHandler) GetTeamBudgets(c *gin.Context) {
+	member, ok := h.teamAccess(c, (*domain.TeamMember).CanViewBilling)
+	if !ok {
+		return
+	}
+
+	budgets, err := h.budgetService.GetBudgetsByTeamID(c.Request.Context(), member.TeamID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": budgets})
+}
+
+// CreateTeamBudget создает бюджет команды: он учитывает запросы всех ключей команды
+func (h *TeamHandler) CreateTeamBudget(c *gin.Context) {
+	member, ok := h.teamAccess(c, (*domain.TeamMember).CanManage)
+	if !ok {
+		return
+	}
+
+	var req CreateTeamBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	teamID := member.TeamID
+	budget := &domain.Budget{
+		TeamID:         &teamID,
+		MaxBudget:      req.MaxBudget,
+		BudgetDuration: req.BudgetDuration,
+		SoftLimit:      req.SoftLimit,
+		ResetAt:        req.ResetAt,
+	}
+	if budget.BudgetDuration == "" {
+		budget.BudgetDuration = domain.BudgetDurationMonthly
+	}
+
+	if err := h.budgetService.CreateBudget(c.Request.Context(), budget); err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    budget,
+	})
+}
+
+// GetTeamUsage возвращает использование команды по участникам за период from..to (RFC3339 или YYYY-MM-DD).
+// По умолчанию - с начала текущего месяца
+func (h *TeamHandler) GetTeamUsage(c *gin.Context) {
+	member, ok := h.teamAccess(c, (*domain.TeamMember).CanViewBilling)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := now
+	var err error
+	if value := c.Query("from"); value != "" {
+		if from, err = parseTeamUsageTime(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from: " + err.Error()})
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = parseTeamUsageTime(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to: " + err.Error()})
+			return
+		}
+	}
+
+	usage, err := h.teamService.GetTeamUsage(c.Request.Context(), member.TeamID, from, to)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": usage})
+}
+
+// InviteTeamMember отправляет приглашение в команду на email. Владельцев приглашает только владелец
+func (h *TeamHandler) InviteTeamMember(c *gin.Context) {
+	member, ok := h.teamAccess(c, (*domain.TeamMember).CanManage)
+	if !ok {
+		return
+	}
+
+	var req InviteTeamMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Role == domain.TeamRoleOwner && !isTeamOwner(member) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only team owners can invite owners"})
+		return
+	}
+
+	invitation, err := h.invitationService.Invite(c.Request.Context(), member.TeamID, &service.InviteTeamMemberRequest{
+		Email:     req.Email,
+		Role:      req.Role,
+		InvitedBy: member.UserID,
+	})
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    invitation,
+	})
+}
+
+// GetTeamInvitations возвращает действующие приглашения команды
+func (h *TeamHandler) GetTeamInvitations(c *gin.Context) {
+	member, ok := h.teamAccess(c, (*domain.TeamMember).CanManage)
+	if !ok {
+		return
+	}
+
+	invitations, err := h.invitationService.ListPending(c.Request.Context(), member.TeamID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": invitations})
+}
+
+// RevokeTeamInvitation отзывает приглашение: ссылка из письма перестает действовать
+func (h *TeamHandler) RevokeTeamInvitation(c *gin.Context) {
+	member, ok := h.teamAccess(c, (*domain.TeamMember).CanManage)
+	if !ok {
+		return
+	}
+
+	if err := h.invitationService.Revoke(c.Request.Context(), member.TeamID, c.Param("invitation_id")); err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Invitation revoked successfully",
+	})
+}
+
+// GetUserInvitations возвращает действующие приглашения на email пользователя
+func (h *TeamHandler) GetUserInvitations(c *gin.Context) {
+	userID := c.Param("user_id")
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	invitations, err := h.invitationService.ListUserInvitations(c.Request.Context(), userID)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": invitations})
+}
+
+// AcceptUserInvitation принимает приглашение из профиля. Принять приглашение может только сам пользователь
+func (h *TeamHandler) AcceptUserInvitation(c *gin.Context) {
+	userID := c.Param("user_id")
+	if currentUserID, _ := middleware.GetUserID(c); currentUserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	member, err := h.invitationService.AcceptInvitation(c.Request.Context(), c.Param("invitation_id"), userID)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    member,
+	})
+}
+
+// AcceptInvitation принимает приглашение по токену из письма от имени текущего пользователя
+func (h *TeamHandler) AcceptInvitation(c *gin.Context) {
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := middleware.GetUserID(c)
+	member, err := h.invitationService.AcceptToken(c.Request.Context(), req.Token, userID)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    member,
+	})
+}
+
+func parseTeamUsageTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func isTeamOwner(member *domain.TeamMember) bool {
+	return member.Role == domain.TeamRoleOwner
+}
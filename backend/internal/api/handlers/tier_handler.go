@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
+	"oneui-hub/internal/middleware"
+	"oneui-hub/internal/repository"
 	"oneui-hub/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -20,17 +24,27 @@ func NewTierHandler(tierService service.TierService) *TierHandler {
 
 // Структуры запросов для административных методов
 type CreateTierRequest struct {
-	Name        string  `json:"name" binding:"required"`
-	Description string  `json:"description"`
-	IsFree      bool    `json:"is_free"`
-	Price       float64 `json:"price" binding:"min=0"`
+	Name                    string  `json:"name" binding:"required"`
+	Description             string  `json:"description"`
+	IsFree                  bool    `json:"is_free"`
+	Price                   float64 `json:"price" binding:"min=0"`
+	QualificationWindowDays int     `json:"qualification_window_days" binding:"min=0"`
+	DowngradeGraceDays      *int    `json:"downgrade_grace_days,omitempty" binding:"omitempty,min=0"`
 }
 
 type UpdateTierRequest struct {
-	Name        *string  `json:"name,omitempty"`
-	Description *string  `json:"description,omitempty"`
-	IsFree      *bool    `json:"is_free,omitempty"`
-	Price       *float64 `json:"price,omitempty" binding:"omitempty,min=0"`
+	Name                    *string  `json:"name,omitempty"`
+	Description             *string  `json:"description,omitempty"`
+	IsFree                  *bool    `json:"is_free,omitempty"`
+	Price                   *float64 `json:"price,omitempty" binding:"omitempty,min=0"`
+	QualificationWindowDays *int     `json:"qualification_window_days,omitempty" binding:"omitempty,min=0"`
+	DowngradeGraceDays      *int     `json:"downgrade_grace_days,omitempty" binding:"omitempty,min=0"`
+}
+
+type SetUserTierRequest struct {
+	TierID string `json:"tier_id" binding:"required"`
+	Pinned bool   `json:"pinned"`
+	Note   string `json:"note" binding:"max=255"`
 }
 
 // GetAllTiers получает список всех тарифов
@@ -76,10 +90,12 @@ func (h *TierHandler) CreateTier(c *gin.Context) {
 	}
 
 	serviceReq := &service.CreateTierRequest{
-		Name:        req.Name,
-		Description: req.Description,
-		IsFree:      req.IsFree,
-		Price:       req.Price,
+		Name:                    req.Name,
+		Description:             req.Description,
+		IsFree:                  req.IsFree,
+		Price:                   req.Price,
+		QualificationWindowDays: req.QualificationWindowDays,
+		DowngradeGraceDays:      req.DowngradeGraceDays,
 	}
 
 	tier, err := h.tierService.CreateTier(c.Request.Context(), serviceReq)
@@ -128,6 +144,12 @@ func (h *TierHandler) UpdateTier(c *gin.Context) {
 	if req.Price != nil {
 		tier.Price = *req.Price
 	}
+	if req.QualificationWindowDays != nil {
+		tier.QualificationWindowDays = *req.QualificationWindowDays
+	}
+	if req.DowngradeGraceDays != nil {
+		tier.DowngradeGraceDays = *req.DowngradeGraceDays
+	}
 
 	if err := h.tierService.UpdateTier(c.Request.Context(), tier); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -240,3 +262,90 @@ func (h *TierHandler) CheckAndUpgradeTier(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Tier check completed"})
 }
+
+// GetUserTierHistory возвращает историю тарифов пользователя
+func (h *TierHandler) GetUserTierHistory(c *gin.Context) {
+	userID := c.Param("user_id")
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	offset := (page - 1) * limit
+
+	changes, err := h.tierService.GetTierHistory(c.Request.Context(), userID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"data":     changes,
+			"page":     page,
+			"limit":    limit,
+			"has_next": len(changes) == limit,
+			"has_prev": page > 1,
+		},
+	})
+}
+
+// GetScheduledDowngrade возвращает запланированное понижение тарифа пользователя или null
+func (h *TierHandler) GetScheduledDowngrade(c *gin.Context) {
+	userID := c.Param("user_id")
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	downgrade, err := h.tierService.GetScheduledDowngrade(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": downgrade})
+}
+
+// SetUserTier назначает пользователю тариф и при необходимости закрепляет его (административный метод)
+func (h *TierHandler) SetUserTier(c *gin.Context) {
+	var req SetUserTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID, _ := middleware.GetUserID(c)
+	change, err := h.tierService.SetUserTier(c.Request.Context(), &service.SetUserTierRequest{
+		UserID:    c.Param("user_id"),
+		TierID:    req.TierID,
+		Pinned:    req.Pinned,
+		Note:      req.Note,
+		ChangedBy: adminID,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidTierChange):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    change,
+	})
+}
@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"crypto/sha256"
+	"errors"
 	"fmt"
 	"net/http"
 	"sort"
@@ -9,10 +9,10 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 
 	"oneui-hub/internal/domain"
 	"oneui-hub/internal/litellm"
+	"oneui-hub/internal/middleware"
 	"oneui-hub/internal/repository"
 	"oneui-hub/internal/service"
 	"oneui-hub/pkg/auth"
@@ -20,14 +20,18 @@ import (
 
 type UserHandler struct {
 	userService   *service.UserService
+	apiKeyService service.ApiKeyService
+	teamService   service.TeamService
 	litellmClient *litellm.Client
 	apiKeyRepo    repository.ApiKeyRepository
 	requestRepo   repository.RequestRepository
 }
 
-func NewUserHandler(userService *service.UserService, litellmClient *litellm.Client, apiKeyRepo repository.ApiKeyRepository, requestRepo repository.RequestRepository) *UserHandler {
+func NewUserHandler(userService *service.UserService, apiKeyService service.ApiKeyService, teamService service.TeamService, litellmClient *litellm.Client, apiKeyRepo repository.ApiKeyRepository, requestRepo repository.RequestRepository) *UserHandler {
 	return &UserHandler{
 		userService:   userService,
+		apiKeyService: apiKeyService,
+		teamService:   teamService,
 		litellmClient: litellmClient,
 		apiKeyRepo:    apiKeyRepo,
 		requestRepo:   requestRepo,
@@ -69,6 +73,12 @@ func (h *UserHandler) GetUserApiKeys(c *gin.Context) {
 		return
 	}
 
+	// Ключи пользователя видит он сам или администратор
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
 	// Получаем ключи пользователя из локальной БД
 	apiKeys, err := h.apiKeyRepo.GetByUserID(c.Request.Context(), userID)
 	if err != nil {
@@ -85,18 +95,33 @@ func (h *UserHandler) GetUserApiKeys(c *gin.Context) {
 			"api_key_preview": key.ApiKeyPreview,
 			"external_id":     key.ExternalID,
 			"created_at":      key.CreatedAt.Format(time.RFC3339),
-			"is_active":       true,
+			"is_active":       key.IsActive(time.Now()),
 			"usage_count":     0,
 			"total_cost":      0.0,
 			"last_used":       "",
+			"scopes":          key.Scopes(),
+			"predecessor_id":  key.PredecessorID,
+			"successor_id":    key.SuccessorID,
+		}
+
+		// Бюджет ключа считается по локальной истории запросов
+		budget, err := h.apiKeyService.GetApiKeyBudget(c.Request.Context(), key)
+		if err != nil {
+			fmt.Printf("Warning: failed to get budget for API key %s: %v\n", key.Name, err)
+		} else {
+			keyData["budget"] = budget
 		}
 
 		if key.ExpiresAt != nil {
 			keyData["expires_at"] = key.ExpiresAt.Format(time.RFC3339)
 		}
 
-		// Получаем статистику использования из LiteLLM
-		if key.OriginalKey != "" {
+		if key.RevokedAt != nil {
+			keyData["revoked_at"] = key.RevokedAt.Format(time.RFC3339)
+		}
+
+		// Получаем статистику использования из LiteLLM. Отозванные ключи там уже удалены
+		if key.OriginalKey != "" && key.RevokedAt == nil {
 			// Расшифровываем ключ для запроса статистики
 			originalKey, err := auth.DecryptAPIKey(key.OriginalKey)
 			if err != nil {
@@ -140,75 +165,99 @@ func (h *UserHandler) CreateUserApiKey(c *gin.Context) {
 		return
 	}
 
-	var req struct {
-		Name string `json:"name" binding:"required"`
+	// Выпустить ключ от имени пользователя может он сам или администратор
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
 	}
 
+	var req service.CreateApiKeyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Создаем ключ в LiteLLM
-	keyReq := &litellm.LiteLLMKeyRequest{
-		KeyAlias: req.Name,
-		UserID:   userID,
+	apiKey, key, err := h.apiKeyService.CreateApiKey(c.Request.Context(), userID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidApiKeyRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		fmt.Printf("ERROR: failed to create API key for user %s: %v\n", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
 	}
 
-	keyResponse, err := h.litellmClient.CreateKey(c.Request.Context(), keyReq)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key in LiteLLM"})
+	response := map[string]interface{}{
+		"id":              apiKey.ID,
+		"name":            apiKey.Name,
+		"api_key":         key, // Возвращаем ключ только при создании
+		"api_key_preview": apiKey.ApiKeyPreview,
+		"external_id":     apiKey.ExternalID,
+		"created_at":      apiKey.CreatedAt.Format(time.RFC3339),
+		"is_active":       true,
+		"usage_count":     0,
+		"scopes":          apiKey.Scopes(),
+		"max_budget":      apiKey.MaxBudget,
+		"budget_duration": apiKey.BudgetDuration,
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// UpdateUserApiKey изменяет название и бюджет API ключа
+func (h *UserHandler) UpdateUserApiKey(c *gin.Context) {
+	keyID := c.Param("key_id")
+	if keyID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Key ID is required"})
 		return
 	}
 
-	// Шифруем оригинальный ключ для хранения
-	encryptedKey, err := auth.EncryptAPIKey(keyResponse.Key)
+	apiKey, err := h.apiKeyRepo.GetByID(c.Request.Context(), keyID)
 	if err != nil {
-		// Если не удалось зашифровать, удаляем ключ из LiteLLM
-		_ = h.litellmClient.DeleteKey(c.Request.Context(), keyResponse.KeyName)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt API key"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
 		return
 	}
 
-	// Создаем превью ключа
-	keyPreview := auth.CreateAPIKeyPreview(keyResponse.Key)
-
-	// Создаем хеш ключа
-	keyHash := fmt.Sprintf("%x", sha256.Sum256([]byte(keyResponse.Key)))
+	// Изменять ключ может владелец или администратор
+	if !canManageUser(c, apiKey.UserID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
 
-	apiKey := &domain.ApiKey{
-		ID:            uuid.New().String(),
-		UserID:        userID,
-		KeyHash:       keyHash,
-		OriginalKey:   encryptedKey,
-		ApiKeyPreview: keyPreview,
-		ExternalID:    keyResponse.KeyName,
-		Name:          req.Name,
-		CreatedAt:     time.Now(),
+	var req service.UpdateApiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	if err := h.apiKeyRepo.Create(c.Request.Context(), apiKey); err != nil {
-		// Если не удалось сохранить в БД, удаляем ключ из LiteLLM
-		_ = h.litellmClient.DeleteKey(c.Request.Context(), keyResponse.KeyName)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save API key"})
+	updated, err := h.apiKeyService.UpdateApiKey(c.Request.Context(), keyID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidApiKeyRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		fmt.Printf("ERROR: failed to update API key %s: %v\n", keyID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update API key"})
 		return
 	}
 
-	response := map[string]interface{}{
-		"id":              apiKey.ID,
-		"name":            apiKey.Name,
-		"api_key":         keyResponse.Key, // Возвращаем ключ только при создании
-		"api_key_preview": keyPreview,
-		"external_id":     apiKey.ExternalID,
-		"created_at":      apiKey.CreatedAt.Format(time.RFC3339),
-		"is_active":       true,
-		"usage_count":     0,
+	budget, err := h.apiKeyService.GetApiKeyBudget(c.Request.Context(), updated)
+	if err != nil {
+		fmt.Printf("Warning: failed to get budget for API key %s: %v\n", updated.Name, err)
 	}
 
-	c.JSON(http.StatusCreated, response)
+	c.JSON(http.StatusOK, gin.H{
+		"id":              updated.ID,
+		"name":            updated.Name,
+		"api_key_preview": updated.ApiKeyPreview,
+		"scopes":          updated.Scopes(),
+		"budget":          budget,
+	})
 }
 
-// DeleteUserApiKey удаляет API ключ пользователя
+// DeleteUserApiKey отзывает API ключ. Отозвать ключ может владелец, администратор хаба
+// и, для ключа команды, владелец или администратор команды
 func (h *UserHandler) DeleteUserApiKey(c *gin.Context) {
 	keyID := c.Param("key_id")
 	if keyID == "" {
@@ -216,63 +265,140 @@ func (h *UserHandler) DeleteUserApiKey(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("DEBUG: DeleteUserApiKey called for key ID: %s\n", keyID)
+	apiKey, err := h.apiKeyRepo.GetByID(c.Request.Context(), keyID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	allowed, err := h.canManageApiKey(c, apiKey)
+	if err != nil {
+		fmt.Printf("ERROR: failed to check access to API key %s: %v\n", keyID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	// Ключ не удаляется из БД: на него ссылаются ротация и история запросов
+	revoked, err := h.apiKeyService.RevokeApiKey(c.Request.Context(), keyID)
+	if err != nil {
+		fmt.Printf("ERROR: failed to revoke API key %s: %v\n", keyID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "API key revoked successfully",
+		"id":         revoked.ID,
+		"expires_at": revoked.ExpiresAt,
+		"revoked_at": revoked.RevokedAt,
+	})
+}
+
+// RotateUserApiKey выпускает новый ключ на замену существующему.
+// Старый ключ продолжает работать в течение периода перекрытия.
+func (h *UserHandler) RotateUserApiKey(c *gin.Context) {
+	keyID := c.Param("key_id")
+	if keyID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Key ID is required"})
+		return
+	}
 
-	// Получаем информацию о ключе из локальной БД
 	apiKey, err := h.apiKeyRepo.GetByID(c.Request.Context(), keyID)
 	if err != nil {
-		fmt.Printf("ERROR: API key not found in DB: %s, error: %v\n", keyID, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
 		return
 	}
 
-	fmt.Printf("DEBUG: Found API key: name=%s, external_id=%s, has_original_key=%t\n",
-		apiKey.Name, apiKey.ExternalID, apiKey.OriginalKey != "")
+	if !canManageUser(c, apiKey.UserID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
 
-	// Удаляем ключ из LiteLLM
-	var keyToDelete string
+	// Период перекрытия можно переопределить, например {"grace_period": "1h"}
+	var req struct {
+		GracePeriod string `json:"grace_period"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
-	// Сначала пробуем использовать расшифрованный оригинальный ключ
-	if apiKey.OriginalKey != "" {
-		originalKey, err := auth.DecryptAPIKey(apiKey.OriginalKey)
+	var gracePeriod *time.Duration
+	if req.GracePeriod != "" {
+		duration, err := time.ParseDuration(req.GracePeriod)
 		if err != nil {
-			fmt.Printf("WARNING: Failed to decrypt API key %s: %v, trying ExternalID\n", apiKey.Name, err)
-			// Если не удалось расшифровать, пробуем ExternalID
-			if apiKey.ExternalID != "" {
-				keyToDelete = apiKey.ExternalID
-			}
-		} else {
-			keyToDelete = originalKey
-			fmt.Printf("DEBUG: Using decrypted original key for deletion\n")
-		}
-	} else if apiKey.ExternalID != "" {
-		// Если нет оригинального ключа, используем ExternalID
-		keyToDelete = apiKey.ExternalID
-		fmt.Printf("DEBUG: Using ExternalID for deletion (no original key)\n")
-	}
-
-	if keyToDelete != "" {
-		fmt.Printf("DEBUG: Attempting to delete key from LiteLLM: %s...\n", keyToDelete[:min(10, len(keyToDelete))])
-		if err := h.litellmClient.DeleteKey(c.Request.Context(), keyToDelete); err != nil {
-			fmt.Printf("ERROR: Failed to delete API key from LiteLLM: %v\n", err)
-			// Не возвращаем ошибку, продолжаем удаление из локальной БД
-			fmt.Printf("WARNING: Continuing with local DB deletion despite LiteLLM error\n")
-		} else {
-			fmt.Printf("DEBUG: Successfully deleted key from LiteLLM\n")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid grace_period, expected a duration like 1h or 30m"})
+			return
 		}
-	} else {
-		fmt.Printf("WARNING: No key available for LiteLLM deletion, only deleting from local DB\n")
+		gracePeriod = &duration
 	}
 
-	// Удаляем ключ из локальной БД
-	if err := h.apiKeyRepo.Delete(c.Request.Context(), keyID); err != nil {
-		fmt.Printf("ERROR: Failed to delete API key from local DB: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete API key"})
+	successor, previous, key, err := h.apiKeyService.RotateApiKey(c.Request.Context(), keyID, gracePeriod)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidApiKeyRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		fmt.Printf("ERROR: failed to rotate API key %s: %v\n", keyID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate API key"})
 		return
 	}
 
-	fmt.Printf("DEBUG: Successfully deleted API key %s from local DB\n", keyID)
-	c.JSON(http.StatusOK, gin.H{"message": "API key deleted successfully"})
+	c.JSON(http.StatusCreated, gin.H{
+		"id":              successor.ID,
+		"name":            successor.Name,
+		"api_key":         key, // Возвращаем ключ только при создании
+		"api_key_preview": successor.ApiKeyPreview,
+		"external_id":     successor.ExternalID,
+		"created_at":      successor.CreatedAt.Format(time.RFC3339),
+		"scopes":          successor.Scopes(),
+		"max_budget":      successor.MaxBudget,
+		"budget_duration": successor.BudgetDuration,
+		"predecessor": gin.H{
+			"id":         previous.ID,
+			"expires_at": previous.ExpiresAt.Format(time.RFC3339),
+		},
+	})
+}
+
+// canManageUser проверяет, что текущий пользователь - владелец ресурса или администратор
+func canManageUser(c *gin.Context, userID string) bool {
+	if role, ok := middleware.GetUserRole(c); ok && role == domain.RoleAdmin {
+		return true
+	}
+
+	currentUserID, ok := middleware.GetUserID(c)
+	return ok && currentUserID == userID
+}
+
+// canManageApiKey проверяет, что текущий пользователь - владелец ключа или администратор хаба,
+// а для ключа команды - также владелец или администратор этой команды
+func (h *UserHandler) canManageApiKey(c *gin.Context, apiKey *domain.ApiKey) (bool, error) {
+	if canManageUser(c, apiKey.UserID) {
+		return true, nil
+	}
+	if apiKey.TeamID == nil || h.teamService == nil {
+		return false, nil
+	}
+
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		return false, nil
+	}
+	member, err := h.teamService.GetMember(c.Request.Context(), *apiKey.TeamID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return member.CanManage(), nil
 }
 
 // GetUserBudget получает бюджет пользователя из LiteLLM
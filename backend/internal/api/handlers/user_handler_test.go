@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/repository"
+	"oneui-hub/internal/service"
+)
+
+// stubApiKeyRepository возвращает ключи по ID из памяти
+type stubApiKeyRepository struct {
+	repository.ApiKeyRepository
+	keys map[string]*domain.ApiKey
+}
+
+func (r *stubApiKeyRepository) GetByID(ctx context.Context, id string) (*domain.ApiKey, error) {
+	apiKey, ok := r.keys[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return apiKey, nil
+}
+
+// stubApiKeyService запоминает отозванные ключи
+type stubApiKeyService struct {
+	service.ApiKeyService
+	revoked []string
+}
+
+func (s *stubApiKeyService) RevokeApiKey(ctx context.Context, keyID string) (*domain.ApiKey, error) {
+	s.revoked = append(s.revoked, keyID)
+	now := time.Now()
+	return &domain.ApiKey{ID: keyID, ExpiresAt: &now, RevokedAt: &now}, nil
+}
+
+// stubTeamService возвращает участников команд по ключу "team_id/user_id"
+type stubTeamService struct {
+	service.TeamService
+	members map[string]*domain.TeamMember
+}
+
+func (s *stubTeamService) GetMember(ctx context.Context, teamID, userID string) (*domain.TeamMember, error) {
+	member, ok := s.members[teamID+"/"+userID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return member, nil
+}
+
+func TestUserHandler_DeleteUserApiKeyChecksAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	teamID := "team-1"
+	apiKeyRepo := &stubApiKeyRepository{keys: map[string]*domain.ApiKey{
+		"own-key":  {ID: "own-key", UserID: "owner"},
+		"team-key": {ID: "team-key", UserID: "owner", TeamID: &teamID},
+	}}
+	teamService := &stubTeamService{members: map[string]*domain.TeamMember{
+		"team-1/team-admin":  {TeamID: teamID, UserID: "team-admin", Role: domain.TeamRoleAdmin},
+		"team-1/team-member": {TeamID: teamID, UserID: "team-member", Role: domain.TeamRoleMember},
+	}}
+
+	tests := []struct {
+		name           string
+		userID         string
+		role           domain.UserRole
+		keyID          string
+		expectedStatus int
+	}{
+		{name: "owner", userID: "owner", role: domain.RoleCustomer, keyID: "own-key", expectedStatus: http.StatusOK},
+		{name: "hub admin", userID: "admin", role: domain.RoleAdmin, keyID: "own-key", expectedStatus: http.StatusOK},
+		{name: "other user", userID: "stranger", role: domain.RoleCustomer, keyID: "own-key", expectedStatus: http.StatusForbidden},
+		{name: "team admin on team key", userID: "team-admin", role: domain.RoleCustomer, keyID: "team-key", expectedStatus: http.StatusOK},
+		{name: "team admin on personal key", userID: "team-admin", role: domain.RoleCustomer, keyID: "own-key", expectedStatus: http.StatusForbidden},
+		{name: "team member on team key", userID: "team-member", role: domain.RoleCustomer, keyID: "team-key", expectedStatus: http.StatusForbidden},
+		{name: "missing key", userID: "owner", role: domain.RoleCustomer, keyID: "missing", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiKeyService := &stubApiKeyService{}
+			handler := NewUserHandler(nil, apiKeyService, teamService, nil, apiKeyRepo, nil)
+
+			router := gin.New()
+			router.DELETE("/api-keys/:key_id", func(c *gin.Context) {
+				c.Set("user_id", tt.userID)
+				c.Set("user_role", tt.role)
+			}, handler.DeleteUserApiKey)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api-keys/"+tt.keyID, nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, []string{tt.keyID}, apiKeyService.revoked)
+			} else {
+				assert.Empty(t, apiKeyService.revoked)
+			}
+		})
+	}
+}
@@ -18,8 +18,18 @@ type Router struct {
 	rateLimitHandler    *handlers.RateLimitHandler
 	uploadHandler       *handlers.UploadHandler
 	litellmAdminHandler *handlers.LiteLLMAdminHandler
+	gatewayHandler      *handlers.GatewayHandler
+	jobHandler          *handlers.JobHandler
+	ledgerHandler       *handlers.LedgerHandler
+	pricingHandler      *handlers.PricingHandler
+	invoiceHandler      *handlers.InvoiceHandler
+	promoHandler        *handlers.PromoHandler
+	paymentHandler      *handlers.PaymentHandler
+	teamHandler         *handlers.TeamHandler
+	jwksHandler         *handlers.JWKSHandler
 	// settingsHandler *handlers.SettingsHandler
-	authMiddleware *middleware.AuthMiddleware
+	authMiddleware   *middleware.AuthMiddleware
+	apiKeyMiddleware *middleware.ApiKeyMiddleware
 }
 
 func NewRouter(
@@ -33,8 +43,18 @@ func NewRouter(
 	rateLimitHandler *handlers.RateLimitHandler,
 	uploadHandler *handlers.UploadHandler,
 	litellmAdminHandler *handlers.LiteLLMAdminHandler,
+	gatewayHandler *handlers.GatewayHandler,
+	jobHandler *handlers.JobHandler,
+	ledgerHandler *handlers.LedgerHandler,
+	pricingHandler *handlers.PricingHandler,
+	invoiceHandler *handlers.InvoiceHandler,
+	promoHandler *handlers.PromoHandler,
+	paymentHandler *handlers.PaymentHandler,
+	teamHandler *handlers.TeamHandler,
+	jwksHandler *handlers.JWKSHandler,
 	// settingsHandler *handlers.SettingsHandler,
 	authMiddleware *middleware.AuthMiddleware,
+	apiKeyMiddleware *middleware.ApiKeyMiddleware,
 ) *Router {
 	return &Router{
 		authHandler:         authHandler,
@@ -47,19 +67,32 @@ func NewRouter(
 		rateLimitHandler:    rateLimitHandler,
 		uploadHandler:       uploadHandler,
 		litellmAdminHandler: litellmAdminHandler,
+		gatewayHandler:      gatewayHandler,
+		jobHandler:          jobHandler,
+		ledgerHandler:       ledgerHandler,
+		pricingHandler:      pricingHandler,
+		invoiceHandler:      invoiceHandler,
+		promoHandler:        promoHandler,
+		paymentHandler:      paymentHandler,
+		teamHandler:         teamHandler,
+		jwksHandler:         jwksHandler,
 		// settingsHandler: settingsHandler,
-		authMiddleware: authMiddleware,
+		authMiddleware:   authMiddleware,
+		apiKeyMiddleware: apiKeyMiddleware,
 	}
 }
 
 func (r *Router) SetupRoutes() *gin.Engine {
 	router := gin.Default()
+	// По умолчанию X-Forwarded-For не доверяется никому, иначе клиент подделает свой адрес
+	// и обойдет ограничение ключа по подсетям. Прокси перед хабом задаются в TRUSTED_PROXIES
+	_ = router.SetTrustedProxies(nil)
 
 	// CORS middleware
 	router.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-Api-Key")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -77,9 +110,20 @@ func (r *Router) SetupRoutes() *gin.Engine {
 		})
 	})
 
+	// Открытые ключи подписи JWT для проверки токенов хаба другими сервисами
+	router.GET("/.well-known/jwks.json", r.jwksHandler.GetJWKS)
+
 	// Статические файлы для загруженных логотипов
 	router.Static("/uploads", "./uploads")
 
+	// OpenAI-совместимый шлюз, авторизация по API ключам хаба
+	gateway := router.Group("/v1")
+	gateway.Use(r.apiKeyMiddleware.RequireApiKey())
+	{
+		gateway.GET("/models", r.gatewayHandler.ListModels)
+		gateway.POST("/chat/completions", r.gatewayHandler.ChatCompletions)
+	}
+
 	// API группа
 	api := router.Group("/api/v1")
 
@@ -89,13 +133,21 @@ func (r *Router) SetupRoutes() *gin.Engine {
 		auth.POST("/register", r.authHandler.Register)
 		auth.POST("/login", r.authHandler.Login)
 		auth.POST("/refresh", r.authHandler.RefreshToken)
+		auth.POST("/password/forgot", r.authHandler.ForgotPassword)
+		auth.POST("/password/reset", r.authHandler.ResetPassword)
+		auth.POST("/email/verify", r.authHandler.VerifyEmail)
 	}
 
+	// Вебхук провайдера платежей, запрос проверяется по подписи
+	api.POST("/payments/webhook", r.paymentHandler.HandleWebhook)
+
 	// Защищенные маршруты
 	protected := api.Group("/")
 	protected.Use(r.authMiddleware.RequireAuth())
 	{
 		protected.GET("/me", r.authHandler.Me)
+		protected.POST("/auth/logout", r.authHandler.Logout)
+		protected.POST("/auth/email/verify/resend", r.authHandler.ResendVerification)
 	}
 
 	// Административные маршруты
@@ -208,6 +260,48 @@ func (r *Router) SetupRoutes() *gin.Engine {
 			currencies.POST("/update-rates", r.currencyHandler.UpdateExchangeRates)
 		}
 
+		// Маршруты для управления балансом и счетами пользователей
+		adminUsers := admin.Group("/users")
+		{
+			adminUsers.POST("/:user_id/balance/credit", r.ledgerHandler.CreditUser)
+			adminUsers.POST("/:user_id/balance/debit", r.ledgerHandler.DebitUser)
+			adminUsers.POST("/:user_id/invoices", r.invoiceHandler.GenerateUserInvoice)
+			adminUsers.PUT("/:user_id/tier", r.tierHandler.SetUserTier)
+		}
+
+		// Маршруты для правил наценки и истории цен
+		pricing := admin.Group("/pricing")
+		{
+			pricing.GET("/rules", r.pricingHandler.GetPriceRules)
+			pricing.POST("/rules", r.pricingHandler.CreatePriceRule)
+			pricing.DELETE("/rules/:id", r.pricingHandler.DeletePriceRule)
+			pricing.GET("/models/:model_id/prices", r.pricingHandler.GetModelPriceHistory)
+		}
+
+		// Маршруты для промокодов
+		promoCodes := admin.Group("/promo-codes")
+		{
+			promoCodes.GET("", r.promoHandler.GetPromoCodes)
+			promoCodes.POST("", r.promoHandler.CreatePromoCode)
+			promoCodes.DELETE("/:id", r.promoHandler.DeactivatePromoCode)
+		}
+
+		// Маршруты для команд
+		adminTeams := admin.Group("/teams")
+		{
+			adminTeams.GET("", r.teamHandler.GetAllTeams)
+			adminTeams.PUT("/:team_id/tier", r.teamHandler.SetTeamTier)
+			adminTeams.POST("/:team_id/invoices", r.invoiceHandler.GenerateTeamInvoice)
+		}
+
+		// Маршруты для фоновых задач
+		jobs := admin.Group("/jobs")
+		{
+			jobs.GET("", r.jobHandler.GetJobs)
+			jobs.GET("/runs", r.jobHandler.GetJobRuns)
+			jobs.POST("/:name/run", r.jobHandler.TriggerJob)
+		}
+
 		// Маршруты для LiteLLM админских функций
 		litellm := admin.Group("/litellm")
 		{
@@ -274,6 +368,8 @@ func (r *Router) SetupRoutes() *gin.Engine {
 		// Тарифы и обновления тарифов
 		users.GET("/:user_id/tier", r.tierHandler.GetUserTier)
 		users.POST("/:user_id/tier/check", r.tierHandler.CheckAndUpgradeTier)
+		users.GET("/:user_id/tier/history", r.tierHandler.GetUserTierHistory)
+		users.GET("/:user_id/tier/downgrade", r.tierHandler.GetScheduledDowngrade)
 
 		// Данные из LiteLLM
 		users.GET("/:user_id/spending", r.userHandler.GetUserSpending)
@@ -282,16 +378,79 @@ func (r *Router) SetupRoutes() *gin.Engine {
 		users.GET("/:user_id/usage-stats", r.userHandler.GetUsageStats)
 		users.GET("/:user_id/requests", r.userHandler.GetRequestHistory)
 
+		// Баланс и журнал операций
+		users.GET("/:user_id/balance", r.ledgerHandler.GetUserBalance)
+		users.GET("/:user_id/transactions", r.ledgerHandler.GetUserTransactions)
+
+		// Пополнение баланса
+		users.POST("/:user_id/payments/checkout", r.paymentHandler.CreateCheckout)
+		users.GET("/:user_id/payments", r.paymentHandler.GetUserPayments)
+
+		// Счета
+		users.GET("/:user_id/invoices", r.invoiceHandler.GetUserInvoices)
+		users.GET("/:user_id/invoices/:invoice_id", r.invoiceHandler.GetUserInvoice)
+		users.GET("/:user_id/invoices/:invoice_id/download", r.invoiceHandler.DownloadUserInvoice)
+
+		// Промокоды
+		users.POST("/:user_id/promo-codes/redeem", r.promoHandler.RedeemPromoCode)
+		users.GET("/:user_id/promo-redemptions", r.promoHandler.GetUserPromoRedemptions)
+
 		// API ключи
 		users.GET("/:user_id/api-keys", r.userHandler.GetUserApiKeys)
 		users.POST("/:user_id/api-keys", r.userHandler.CreateUserApiKey)
+
+		// Сессии: список, завершение одной и выход на всех устройствах
+		users.GET("/:user_id/sessions", r.authHandler.GetUserSessions)
+		users.DELETE("/:user_id/sessions", r.authHandler.RevokeAllUserSessions)
+		users.DELETE("/:user_id/sessions/:session_id", r.authHandler.RevokeUserSession)
+
+		// Приглашения в команды
+		users.GET("/:user_id/invitations", r.teamHandler.GetUserInvitations)
+		users.POST("/:user_id/invitations/:invitation_id/accept", r.teamHandler.AcceptUserInvitation)
 	}
 
+	// Принятие приглашения в команду по токену из письма
+	protected.POST("/invitations/accept", r.teamHandler.AcceptInvitation)
+
 	// Маршруты для управления API ключами
 	apiKeys := protected.Group("/api-keys")
 	{
+		apiKeys.PUT("/:key_id", r.userHandler.UpdateUserApiKey)
+		apiKeys.POST("/:key_id/rotate", r.userHandler.RotateUserApiKey)
 		apiKeys.DELETE("/:key_id", r.userHandler.DeleteUserApiKey)
 	}
 
+	// Маршруты для команд. Права проверяются по роли пользователя в команде
+	teams := protected.Group("/teams")
+	{
+		teams.POST("", r.teamHandler.CreateTeam)
+		teams.GET("", r.teamHandler.GetMyTeams)
+		teams.GET("/:team_id", r.teamHandler.GetTeam)
+		teams.PUT("/:team_id", r.teamHandler.UpdateTeam)
+		teams.DELETE("/:team_id", r.teamHandler.DeleteTeam)
+
+		teams.GET("/:team_id/members", r.teamHandler.GetTeamMembers)
+		teams.POST("/:team_id/members", r.teamHandler.AddTeamMember)
+		teams.PUT("/:team_id/members/:user_id", r.teamHandler.UpdateTeamMember)
+		teams.DELETE("/:team_id/members/:user_id", r.teamHandler.RemoveTeamMember)
+
+		teams.GET("/:team_id/invitations", r.teamHandler.GetTeamInvitations)
+		teams.POST("/:team_id/invitations", r.teamHandler.InviteTeamMember)
+		teams.DELETE("/:team_id/invitations/:invitation_id", r.teamHandler.RevokeTeamInvitation)
+
+		teams.GET("/:team_id/api-keys", r.teamHandler.GetTeamApiKeys)
+		teams.POST("/:team_id/api-keys", r.teamHandler.CreateTeamApiKey)
+		teams.DELETE("/:team_id/api-keys/:key_id", r.teamHandler.RevokeTeamApiKey)
+
+		teams.GET("/:team_id/budgets", r.teamHandler.GetTeamBudgets)
+		teams.POST("/:team_id/budgets", r.teamHandler.CreateTeamBudget)
+
+		teams.GET("/:team_id/usage", r.teamHandler.GetTeamUsage)
+
+		teams.GET("/:team_id/invoices", r.invoiceHandler.GetTeamInvoices)
+		teams.GET("/:team_id/invoices/:invoice_id", r.invoiceHandler.GetTeamInvoice)
+		teams.GET("/:team_id/invoices/:invoice_id/download", r.invoiceHandler.DownloadTeamInvoice)
+	}
+
 	return router
 }
@@ -1,26 +1,43 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Auth     AuthConfig
-	LiteLLM  LiteLLMConfig
-	Currency CurrencyConfig
+	Server        ServerConfig
+	Database      DatabaseConfig
+	Auth          AuthConfig
+	LiteLLM       LiteLLMConfig
+	Currency      CurrencyConfig
+	RateLimit     RateLimitConfig
+	ApiKeys       ApiKeysConfig
+	Notifications NotificationConfig
+	Scheduler     SchedulerConfig
+	Leader        LeaderElectionConfig
+	Ledger        LedgerConfig
+	Gateway       GatewayConfig
+	Invoices      InvoiceConfig
+	Payments      PaymentConfig
+	Mail          MailConfig
+	Teams         TeamConfig
+	Accounts      AccountConfig
 }
 
 type ServerConfig struct {
 	Host string
 	Port string
+	// TrustedProxies - адреса и подсети прокси, которым доверяется X-Forwarded-For.
+	// По умолчанию пусто: адресом клиента считается адрес TCP соединения
+	TrustedProxies []string
 }
 
 type DatabaseConfig struct {
@@ -33,8 +50,21 @@ type DatabaseConfig struct {
 }
 
 type AuthConfig struct {
-	JWTSecret     string
+	// JWTSecret - секрет HS256 подписи JWT
+	JWTSecret string
+	// LinkSecret - секрет подписи ссылок из писем (приглашения в команды, сброс пароля,
+	// подтверждение email). Значения по умолчанию нет: без него хаб не запускается
+	LinkSecret string
+	// Algorithm - алгоритм подписи JWT: RS256 и EdDSA используют ротируемые ключи из БД, HS256 - JWTSecret
+	Algorithm string
+	// KeyRotationInterval - как часто выпускается новый ключ подписи
+	KeyRotationInterval time.Duration
+	// KeyActivationDelay - сколько новый ключ публикуется в JWKS до начала подписи
+	KeyActivationDelay time.Duration
+	// TokenDuration - срок действия access токена; продлевается refresh токеном сессии
 	TokenDuration time.Duration
+	// RefreshTokenDuration - сколько сессия живет без продления
+	RefreshTokenDuration time.Duration
 }
 
 type LiteLLMConfig struct {
@@ -47,6 +77,128 @@ type CurrencyConfig struct {
 	ExchangeRateAPIKey string
 }
 
+type RateLimitConfig struct {
+	// Store - хранилище счетчиков лимитов: "sql" (общее для всех реплик) или "memory"
+	Store string
+}
+
+type ApiKeysConfig struct {
+	// RotationGracePeriod - сколько старый ключ остается действительным после ротации
+	RotationGracePeriod time.Duration
+	// ExpiryNoticeDays - за сколько дней до истечения ключа уведомлять владельца
+	ExpiryNoticeDays int
+}
+
+// SchedulerConfig задает cron расписания фоновых задач. Значение "off" отключает
+// автоматический запуск, задачу можно запустить вручную через API администратора
+type SchedulerConfig struct {
+	JobTimeout           time.Duration
+	ModelSyncSchedule    string
+	BudgetSyncSchedule   string
+	SpendLogSyncSchedule string
+	ExchangeRateSchedule string
+	ApiKeyExpirySchedule string
+	// LedgerReconcileSchedule - списание с баланса стоимости запросов
+	LedgerReconcileSchedule string
+	// InvoiceSchedule - выставление счетов корпоративным клиентам за прошедший месяц
+	InvoiceSchedule string
+	// PromoExpirySchedule - возврат прежнего тарифа после окончания временного по промокоду
+	PromoExpirySchedule string
+	// TierEvaluationSchedule - понижение тарифов пользователей, траты которых им больше не соответствуют
+	TierEvaluationSchedule string
+	// BudgetResetSchedule - сброс трат бюджетов, период которых закончился
+	BudgetResetSchedule string
+	// SessionCleanupSchedule - удаление давно истекших и отозванных сессий
+	SessionCleanupSchedule string
+	// JWTKeyRotationSchedule - выпуск новых и удаление выведенных ключей подписи JWT
+	JWTKeyRotationSchedule string
+	// RateLimitCleanupSchedule - удаление истекших окон счетчиков лимитов запросов
+	RateLimitCleanupSchedule string
+}
+
+type NotificationConfig struct {
+	WebhookURL   string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+}
+
+// LeaderElectionConfig - выбор реплики, которая выполняет фоновые задачи.
+// Лидер держит аренду в общей БД и продлевает ее каждые RenewInterval
+type LeaderElectionConfig struct {
+	Enabled bool
+	// InstanceID - идентификатор реплики; по умолчанию генерируется при старте
+	InstanceID    string
+	LeaseTTL      time.Duration
+	RenewInterval time.Duration
+}
+
+type LedgerConfig struct {
+	// UsageStart - запросы, созданные раньше этого момента, не списываются с баланса.
+	// Позволяет не списывать историю, накопленную до включения журнала
+	UsageStart time.Time
+}
+
+type GatewayConfig struct {
+	// EnforceQuotas включает проверку баланса и месячного лимита токенов перед запросом к модели
+	EnforceQuotas bool
+	// DefaultMaxTokens - оценка длины ответа, если запрос и модель ее не ограничивают
+	DefaultMaxTokens int
+	// QuotaHoldTTL - сколько удерживается баланс незавершенного запроса
+	QuotaHoldTTL time.Duration
+}
+
+type InvoiceConfig struct {
+	// StorageDir - каталог для PDF и CSV файлов счетов
+	StorageDir string
+	// DefaultCurrency - валюта первого счета клиента; следующие счета выставляются в валюте предыдущего
+	DefaultCurrency string
+}
+
+type PaymentConfig struct {
+	// ProviderName - имя провайдера в платежах и проводках
+	ProviderName string
+	// ProviderURL - адрес API провайдера платежей; пустое значение отключает пополнение баланса
+	ProviderURL   string
+	APIKey        string
+	WebhookSecret string
+	// WebhookTolerance - допустимый возраст подписи вебхука
+	WebhookTolerance time.Duration
+	// MinAmount и MaxAmount - границы суммы одного пополнения в USD
+	MinAmount float64
+	MaxAmount float64
+	// SuccessURL и CancelURL - куда провайдер возвращает пользователя после оплаты
+	SuccessURL string
+	CancelURL  string
+}
+
+type MailConfig struct {
+	// Driver - способ отправки писем: smtp, file (каталог FileDir) или log.
+	// По умолчанию smtp, если задан SMTP_HOST, иначе log
+	Driver  string
+	FileDir string
+}
+
+type TeamConfig struct {
+	// InvitationTTL - срок действия приглашения в команду
+	InvitationTTL time.Duration
+	// InvitationURL - страница принятия приглашения; токен добавляется параметром token
+	InvitationURL string
+}
+
+type AccountConfig struct {
+	// PasswordResetTTL - срок действия ссылки сброса пароля
+	PasswordResetTTL time.Duration
+	// PasswordResetURL - страница ввода нового пароля; токен добавляется параметром token
+	PasswordResetURL string
+	// EmailVerificationTTL - срок действия ссылки подтверждения email
+	EmailVerificationTTL time.Duration
+	// EmailVerificationURL - страница подтверждения email; токен добавляется параметром token
+	EmailVerificationURL string
+}
+
 func Load() (*Config, error) {
 	// Получаем путь к корню backend директории
 	_, filename, _, _ := runtime.Caller(0)
@@ -67,8 +219,9 @@ func Load() (*Config, error) {
 
 	config := &Config{
 		Server: ServerConfig{
-			Host: getEnv("SERVER_HOST", "localhost"),
-			Port: getEnv("SERVER_PORT", "8080"),
+			Host:           getEnv("SERVER_HOST", "localhost"),
+			Port:           getEnv("SERVER_PORT", "8080"),
+			TrustedProxies: getListEnv("TRUSTED_PROXIES"),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -78,8 +231,13 @@ func Load() (*Config, error) {
 			DBName:   getEnv("DB_NAME", "oneui_hub"),
 		},
 		Auth: AuthConfig{
-			JWTSecret:     getEnv("JWT_SECRET", "your-secret-key"),
-			TokenDuration: getDurationEnv("TOKEN_DURATION", 24*time.Hour),
+			JWTSecret:            getEnv("JWT_SECRET", defaultJWTSecret),
+			LinkSecret:           getEnv("SIGNED_LINK_SECRET", ""),
+			TokenDuration:        getDurationEnv("TOKEN_DURATION", 15*time.Minute),
+			RefreshTokenDuration: getDurationEnv("REFRESH_TOKEN_DURATION", 30*24*time.Hour),
+			Algorithm:            getEnv("JWT_ALGORITHM", "RS256"),
+			KeyRotationInterval:  getDurationEnv("JWT_KEY_ROTATION_INTERVAL", 30*24*time.Hour),
+			KeyActivationDelay:   getDurationEnv("JWT_KEY_ACTIVATION_DELAY", time.Hour),
 		},
 		LiteLLM: LiteLLMConfig{
 			BaseURL: getEnv("LITELLM_BASE_URL", "http://localhost:4000"),
@@ -89,6 +247,87 @@ func Load() (*Config, error) {
 		Currency: CurrencyConfig{
 			ExchangeRateAPIKey: getEnv("EXCHANGE_RATE_API_KEY", ""),
 		},
+		RateLimit: RateLimitConfig{
+			Store: getEnv("RATE_LIMIT_STORE", "sql"),
+		},
+		ApiKeys: ApiKeysConfig{
+			RotationGracePeriod: getDurationEnv("API_KEY_ROTATION_GRACE_PERIOD", 24*time.Hour),
+			ExpiryNoticeDays:    getIntEnv("API_KEY_EXPIRY_NOTICE_DAYS", 7),
+		},
+		Notifications: NotificationConfig{
+			WebhookURL:   getEnv("NOTIFICATION_WEBHOOK_URL", ""),
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     getEnv("SMTP_PORT", "587"),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			SMTPFrom:     getEnv("SMTP_FROM", "noreply@oneui-hub.local"),
+		},
+		Scheduler: SchedulerConfig{
+			JobTimeout:               getDurationEnv("JOB_TIMEOUT", 30*time.Minute),
+			ModelSyncSchedule:        getScheduleEnv("JOB_MODEL_SYNC_SCHEDULE", "0 */6 * * *"),
+			BudgetSyncSchedule:       getScheduleEnv("JOB_BUDGET_SYNC_SCHEDULE", "30 * * * *"),
+			SpendLogSyncSchedule:     getScheduleEnv("JOB_SPEND_LOG_SYNC_SCHEDULE", "*/15 * * * *"),
+			ExchangeRateSchedule:     getScheduleEnv("JOB_EXCHANGE_RATES_SCHEDULE", "0 0 * * *"),
+			ApiKeyExpirySchedule:     getScheduleEnv("JOB_API_KEY_EXPIRY_SCHEDULE", "0 * * * *"),
+			LedgerReconcileSchedule:  getScheduleEnv("JOB_LEDGER_RECONCILE_SCHEDULE", "*/5 * * * *"),
+			InvoiceSchedule:          getScheduleEnv("JOB_INVOICE_SCHEDULE", "0 3 1 * *"),
+			PromoExpirySchedule:      getScheduleEnv("JOB_PROMO_EXPIRY_SCHEDULE", "*/10 * * * *"),
+			TierEvaluationSchedule:   getScheduleEnv("JOB_TIER_EVALUATION_SCHEDULE", "15 * * * *"),
+			BudgetResetSchedule:      getScheduleEnv("JOB_BUDGET_RESET_SCHEDULE", "*/5 * * * *"),
+			SessionCleanupSchedule:   getScheduleEnv("JOB_SESSION_CLEANUP_SCHEDULE", "0 4 * * *"),
+			JWTKeyRotationSchedule:   getScheduleEnv("JOB_JWT_KEY_ROTATION_SCHEDULE", "0 * * * *"),
+			RateLimitCleanupSchedule: getScheduleEnv("JOB_RATE_LIMIT_CLEANUP_SCHEDULE", "20 * * * *"),
+		},
+		Leader: LeaderElectionConfig{
+			Enabled:       getBoolEnv("LEADER_ELECTION_ENABLED", true),
+			InstanceID:    getEnv("INSTANCE_ID", ""),
+			LeaseTTL:      getDurationEnv("LEADER_LEASE_TTL", 15*time.Second),
+			RenewInterval: getDurationEnv("LEADER_RENEW_INTERVAL", 5*time.Second),
+		},
+		Ledger: LedgerConfig{
+			UsageStart: getTimeEnv("LEDGER_USAGE_START", time.Time{}),
+		},
+		Gateway: GatewayConfig{
+			EnforceQuotas:    getBoolEnv("GATEWAY_ENFORCE_QUOTAS", true),
+			DefaultMaxTokens: getIntEnv("GATEWAY_DEFAULT_MAX_TOKENS", 4096),
+			QuotaHoldTTL:     getDurationEnv("GATEWAY_QUOTA_HOLD_TTL", 10*time.Minute),
+		},
+		Invoices: InvoiceConfig{
+			StorageDir:      getEnv("INVOICE_STORAGE_DIR", "storage/invoices"),
+			DefaultCurrency: getEnv("INVOICE_DEFAULT_CURRENCY", "USD"),
+		},
+		Payments: PaymentConfig{
+			ProviderName:     getEnv("PAYMENT_PROVIDER_NAME", "default"),
+			ProviderURL:      getEnv("PAYMENT_PROVIDER_URL", ""),
+			APIKey:           getEnv("PAYMENT_API_KEY", ""),
+			WebhookSecret:    getEnv("PAYMENT_WEBHOOK_SECRET", ""),
+			WebhookTolerance: getDurationEnv("PAYMENT_WEBHOOK_TOLERANCE", 5*time.Minute),
+			MinAmount:        getFloatEnv("PAYMENT_MIN_AMOUNT", 5),
+			MaxAmount:        getFloatEnv("PAYMENT_MAX_AMOUNT", 10000),
+			SuccessURL:       getEnv("PAYMENT_SUCCESS_URL", ""),
+			CancelURL:        getEnv("PAYMENT_CANCEL_URL", ""),
+		},
+		Mail: MailConfig{
+			Driver:  getEnv("MAIL_DRIVER", ""),
+			FileDir: getEnv("MAIL_FILE_DIR", "storage/mail"),
+		},
+		Teams: TeamConfig{
+			InvitationTTL: getDurationEnv("TEAM_INVITATION_TTL", 7*24*time.Hour),
+			InvitationURL: getEnv("TEAM_INVITATION_URL", "http://localhost:3000/invitations/accept"),
+		},
+		Accounts: AccountConfig{
+			PasswordResetTTL:     getDurationEnv("PASSWORD_RESET_TTL", time.Hour),
+			PasswordResetURL:     getEnv("PASSWORD_RESET_URL", "http://localhost:3000/password/reset"),
+			EmailVerificationTTL: getDurationEnv("EMAIL_VERIFICATION_TTL", 72*time.Hour),
+			EmailVerificationURL: getEnv("EMAIL_VERIFICATION_URL", "http://localhost:3000/email/verify"),
+		},
+	}
+
+	if config.Mail.Driver == "" {
+		config.Mail.Driver = "log"
+		if config.Notifications.SMTPHost != "" {
+			config.Mail.Driver = "smtp"
+		}
 	}
 
 	// Создаем DSN для подключения к базе данных
@@ -99,6 +338,26 @@ func Load() (*Config, error) {
 	return config, nil
 }
 
+// defaultJWTSecret - JWT_SECRET, если он не задан
+const defaultJWTSecret = "your-secret-key"
+
+// minLinkSecretLength - минимальная длина секрета подписанных ссылок (256 бит в hex)
+const minLinkSecretLength = 32
+
+// ValidateLinkSecret проверяет, что ссылки из писем подписываются собственным стойким секретом.
+// Ссылкой сброса пароля можно захватить аккаунт, поэтому секрет по умолчанию или общий с JWT не допускается
+func (c AuthConfig) ValidateLinkSecret() error {
+	switch {
+	case c.LinkSecret == "":
+		return fmt.Errorf("SIGNED_LINK_SECRET is not set")
+	case c.LinkSecret == defaultJWTSecret || c.LinkSecret == c.JWTSecret:
+		return fmt.Errorf("SIGNED_LINK_SECRET must differ from JWT_SECRET and its default")
+	case len(c.LinkSecret) < minLinkSecretLength:
+		return fmt.Errorf("SIGNED_LINK_SECRET must be at least %d characters long", minLinkSecretLength)
+	}
+	return nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -106,6 +365,26 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getListEnv читает список значений через запятую
+func getListEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getScheduleEnv читает cron расписание. "off" превращается в пустое расписание
+func getScheduleEnv(key, defaultValue string) string {
+	value := getEnv(key, defaultValue)
+	if value == "off" {
+		return ""
+	}
+	return value
+}
+
 func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
@@ -115,6 +394,28 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	return defaultValue
 }
 
+// getTimeEnv читает момент времени в формате RFC3339 или дату YYYY-MM-DD (UTC)
+func getTimeEnv(key string, defaultValue time.Time) time.Time {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+			return parsed
+		}
+		if parsed, err := time.Parse("2006-01-02", value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getBoolEnv(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
 func getIntEnv(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
@@ -124,6 +425,15 @@ func getIntEnv(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 // Debug выводит информацию о загруженной конфигурации
 func (c *Config) Debug() {
 	println("=== Configuration Debug ===")
@@ -135,6 +445,7 @@ func (c *Config) Debug() {
 	println("DB Name:", c.Database.DBName)
 	println("DB Password:", c.Database.Password)
 	println("JWT Secret:", c.Auth.JWTSecret[:10]+"...")
+	println("JWT Algorithm:", c.Auth.Algorithm)
 	println("LiteLLM Base URL:", c.LiteLLM.BaseURL)
 	println("===========================")
 }
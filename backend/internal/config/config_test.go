@@ -175,6 +175,33 @@ func TestLoad(t *testing.T) {
 	}
 }
 
+func TestAuthConfig_ValidateLinkSecret(t *testing.T) {
+	strong := "0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		name    string
+		config  AuthConfig
+		wantErr bool
+	}{
+		{name: "not set", config: AuthConfig{JWTSecret: "jwt-secret"}, wantErr: true},
+		{name: "jwt default", config: AuthConfig{JWTSecret: "jwt-secret", LinkSecret: "your-secret-key"}, wantErr: true},
+		{name: "same as jwt secret", config: AuthConfig{JWTSecret: strong, LinkSecret: strong}, wantErr: true},
+		{name: "too short", config: AuthConfig{JWTSecret: "jwt-secret", LinkSecret: "short-secret"}, wantErr: true},
+		{name: "dedicated secret", config: AuthConfig{JWTSecret: "jwt-secret", LinkSecret: strong}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.ValidateLinkSecret()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
 func TestGetEnv(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -1,9 +1,20 @@
 package domain
 
 import (
+	"encoding/json"
+	"regexp"
+	"strconv"
 	"time"
 )
 
+// Права API ключа
+const (
+	// ApiKeyPermissionInference разрешает вызовы моделей
+	ApiKeyPermissionInference = "inference"
+	// ApiKeyPermissionReadOnly разрешает только чтение (например, список моделей)
+	ApiKeyPermissionReadOnly = "read_only"
+)
+
 type ApiKey struct {
 	ID            string     `json:"id" gorm:"type:varchar(36);primaryKey"`
 	UserID        string     `json:"user_id" gorm:"type:varchar(36);not null"`
@@ -15,10 +26,180 @@ type ApiKey struct {
 	CreatedAt     time.Time  `json:"created_at" gorm:"autoCreateTime"`
 	ExpiresAt     *time.Time `json:"expires_at"`
 
+	// Ограничения ключа. Пустой список означает отсутствие ограничения.
+	AllowedModels    string `json:"allowed_models" gorm:"type:text"`                        // JSON массив external_id моделей
+	AllowedCompanies string `json:"allowed_companies" gorm:"type:text"`                     // JSON массив ID компаний
+	AllowedCallTypes string `json:"allowed_call_types" gorm:"type:text"`                    // JSON массив типов вызовов
+	AllowedCIDRs     string `json:"allowed_cidrs" gorm:"type:text;column:allowed_cidrs"`    // JSON массив подсетей
+	Permission       string `json:"permission" gorm:"type:varchar(20);default:'inference'"` // inference или read_only
+
+	// Бюджет ключа в USD. BudgetDuration задается в формате LiteLLM ("30d", "1mo" и т.п.),
+	// пустое значение означает лимит на все время жизни ключа.
+	MaxBudget         *float64   `json:"max_budget" gorm:"type:decimal(14,6)"`
+	BudgetDuration    string     `json:"budget_duration" gorm:"type:varchar(20)"`
+	BudgetPeriodStart *time.Time `json:"budget_period_start"`
+
+	// TeamID - команда, которой принадлежит ключ; запросы ключа учитываются и за пользователем, и за командой
+	TeamID *string `json:"team_id" gorm:"type:varchar(36);index"`
+
+	// Цепочка ротации: ключ-предшественник и ключ, выпущенный ему на замену
+	PredecessorID *string `json:"predecessor_id" gorm:"type:varchar(36);index"`
+	SuccessorID   *string `json:"successor_id" gorm:"type:varchar(36)"`
+
+	// RevokedAt - момент отзыва истекшего ключа (ключ удален в LiteLLM, но сохранен в истории)
+	RevokedAt *time.Time `json:"revoked_at" gorm:"index"`
+	// ExpiryNotifiedAt - когда владелец был предупрежден о скором истечении ключа
+	ExpiryNotifiedAt *time.Time `json:"expiry_notified_at"`
+
 	// Связи
 	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Team *Team `json:"team,omitempty" gorm:"foreignKey:TeamID"`
 }
 
 func (ApiKey) TableName() string {
 	return "api_keys"
 }
+
+// ApiKeyScopes - разобранные ограничения API ключа
+type ApiKeyScopes struct {
+	Models     []string `json:"allowed_models"`
+	Companies  []string `json:"allowed_companies"`
+	CallTypes  []string `json:"allowed_call_types"`
+	CIDRs      []string `json:"allowed_cidrs"`
+	Permission string   `json:"permission"`
+}
+
+// Scopes разбирает JSON поля ограничений ключа
+func (k *ApiKey) Scopes() ApiKeyScopes {
+	scopes := ApiKeyScopes{
+		Models:     parseStringList(k.AllowedModels),
+		Companies:  parseStringList(k.AllowedCompanies),
+		CallTypes:  parseStringList(k.AllowedCallTypes),
+		CIDRs:      parseStringList(k.AllowedCIDRs),
+		Permission: k.Permission,
+	}
+	if scopes.Permission == "" {
+		scopes.Permission = ApiKeyPermissionInference
+	}
+	return scopes
+}
+
+// SetScopes сохраняет ограничения в JSON поля ключа
+func (k *ApiKey) SetScopes(scopes ApiKeyScopes) {
+	k.AllowedModels = formatStringList(scopes.Models)
+	k.AllowedCompanies = formatStringList(scopes.Companies)
+	k.AllowedCallTypes = formatStringList(scopes.CallTypes)
+	k.AllowedCIDRs = formatStringList(scopes.CIDRs)
+	k.Permission = scopes.Permission
+}
+
+// IsActive сообщает, что ключ не отозван и не истек
+func (k *ApiKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || k.ExpiresAt.After(now))
+}
+
+// EffectiveTierID возвращает тариф, по которому тарифицируются запросы ключа:
+// тариф команды, если он задан, иначе тариф владельца
+func (k *ApiKey) EffectiveTierID() string {
+	if k.Team != nil && k.Team.TierID != nil && *k.Team.TierID != "" {
+		return *k.Team.TierID
+	}
+	if k.User != nil {
+		return k.User.TierID
+	}
+	return ""
+}
+
+// HasBudget сообщает, что для ключа задан лимит трат
+func (k *ApiKey) HasBudget() bool {
+	return k.MaxBudget != nil && *k.MaxBudget > 0
+}
+
+// BudgetPeriod возвращает начало текущего периода бюджета и момент следующего сброса.
+// Для бюджета без периода начало - нулевое время, а сброса нет.
+func (k *ApiKey) BudgetPeriod(now time.Time) (time.Time, *time.Time) {
+	months, duration, ok := ParseBudgetDuration(k.BudgetDuration)
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	start := k.CreatedAt
+	if k.BudgetPeriodStart != nil {
+		start = *k.BudgetPeriodStart
+	}
+	return budgetPeriod(months, duration, start, now)
+}
+
+// budgetPeriod находит период, содержащий now, среди периодов, отсчитываемых от start
+func budgetPeriod(months int, duration time.Duration, start, now time.Time) (time.Time, *time.Time) {
+	if duration > 0 {
+		periods := now.Sub(start) / duration
+		if periods > 0 {
+			start = start.Add(periods * duration)
+		}
+		next := start.Add(duration)
+		return start, &next
+	}
+
+	next := start.AddDate(0, months, 0)
+	for !next.After(now) {
+		start = next
+		next = start.AddDate(0, months, 0)
+	}
+	return start, &next
+}
+
+var budgetDurationPattern = regexp.MustCompile(`^([1-9][0-9]*)(s|m|h|d|w|mo)$`)
+
+// ParseBudgetDuration разбирает период бюджета в формате LiteLLM: "30s", "30m", "30h", "30d", "1w", "1mo".
+// Возвращает количество месяцев или фиксированную длительность периода.
+func ParseBudgetDuration(value string) (int, time.Duration, bool) {
+	match := budgetDurationPattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, 0, false
+	}
+
+	count, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, 0, false
+	}
+
+	switch match[2] {
+	case "s":
+		return 0, time.Duration(count) * time.Second, true
+	case "m":
+		return 0, time.Duration(count) * time.Minute, true
+	case "h":
+		return 0, time.Duration(count) * time.Hour, true
+	case "d":
+		return 0, time.Duration(count) * 24 * time.Hour, true
+	case "w":
+		return 0, time.Duration(count) * 7 * 24 * time.Hour, true
+	default:
+		return count, 0, true
+	}
+}
+
+func parseStringList(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal([]byte(raw), &list); err != nil {
+		return nil
+	}
+	return list
+}
+
+func formatStringList(list []string) string {
+	if len(list) == 0 {
+		return ""
+	}
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
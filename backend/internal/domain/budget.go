@@ -4,17 +4,34 @@ import (
 	"time"
 )
 
+// Периоды бюджета. Кроме них допускается период в формате LiteLLM ("30d", "2w", "3mo")
+const (
+	BudgetDurationDaily   = "daily"
+	BudgetDurationWeekly  = "weekly"
+	BudgetDurationMonthly = "monthly"
+)
+
+// BudgetThresholds - доли лимита в процентах, при достижении которых владелец бюджета получает уведомление
+var BudgetThresholds = []int{50, 80, 100}
+
 type Budget struct {
-	ID             string     `json:"id" gorm:"type:varchar(36);primaryKey"`
-	UserID         *string    `json:"user_id" gorm:"type:varchar(36)"`
-	TeamID         *string    `json:"team_id" gorm:"type:varchar(36)"`
-	MaxBudget      float64    `json:"max_budget" gorm:"type:decimal(10,2);not null"`
-	SpentBudget    float64    `json:"spent_budget" gorm:"type:decimal(10,2);default:0"`
-	BudgetDuration string     `json:"budget_duration" gorm:"type:varchar(50);default:'monthly'"`
-	ResetAt        *time.Time `json:"reset_at"`
-	ExternalID     string     `json:"external_id" gorm:"type:varchar(255);uniqueIndex"`
-	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt      time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+	ID             string  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	UserID         *string `json:"user_id" gorm:"type:varchar(36)"`
+	TeamID         *string `json:"team_id" gorm:"type:varchar(36);index"`
+	MaxBudget      float64 `json:"max_budget" gorm:"type:decimal(10,2);not null"`
+	SpentBudget    float64 `json:"spent_budget" gorm:"type:decimal(14,6);default:0"`
+	BudgetDuration string  `json:"budget_duration" gorm:"type:varchar(50);default:'monthly'"`
+	// SoftLimit - при исчерпании бюджета владелец только уведомляется, иначе запросы через шлюз отклоняются
+	SoftLimit bool `json:"soft_limit" gorm:"not null;default:false"`
+	// PeriodStart - начало текущего периода, от него отсчитываются следующие сбросы
+	PeriodStart *time.Time `json:"period_start"`
+	ResetAt     *time.Time `json:"reset_at" gorm:"index"`
+	// NotifiedThreshold - последний порог из BudgetThresholds, о котором уведомлен владелец в текущем периоде
+	NotifiedThreshold int `json:"notified_threshold" gorm:"not null;default:0"`
+	// ExternalID - ID бюджета в LiteLLM, пусто, пока бюджет туда не отправлен
+	ExternalID *string   `json:"external_id" gorm:"type:varchar(255);uniqueIndex"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 
 	// Связи
 	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
@@ -23,3 +40,66 @@ type Budget struct {
 func (Budget) TableName() string {
 	return "budgets"
 }
+
+// LiteLLMDuration возвращает период бюджета в формате LiteLLM
+func (b *Budget) LiteLLMDuration() string {
+	switch b.BudgetDuration {
+	case BudgetDurationDaily:
+		return "1d"
+	case BudgetDurationWeekly:
+		return "7d"
+	case BudgetDurationMonthly:
+		return "1mo"
+	default:
+		return b.BudgetDuration
+	}
+}
+
+// HasValidDuration сообщает, что период бюджета пуст (лимит на все время) или известен
+func (b *Budget) HasValidDuration() bool {
+	if b.BudgetDuration == "" {
+		return true
+	}
+	_, _, ok := ParseBudgetDuration(b.LiteLLMDuration())
+	return ok
+}
+
+// Period возвращает начало периода бюджета, содержащего now, и момент следующего сброса.
+// Для бюджета без периода начало - нулевое время, а сброса нет.
+func (b *Budget) Period(now time.Time) (time.Time, *time.Time) {
+	months, duration, ok := ParseBudgetDuration(b.LiteLLMDuration())
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	start := b.CreatedAt
+	if b.PeriodStart != nil {
+		start = *b.PeriodStart
+	}
+	return budgetPeriod(months, duration, start, now)
+}
+
+// Lapsed сообщает, что период бюджета закончился, но траты еще не сброшены
+func (b *Budget) Lapsed(now time.Time) bool {
+	return b.ResetAt != nil && !now.Before(*b.ResetAt)
+}
+
+// Exhausted сообщает, что траты текущего периода достигли лимита
+func (b *Budget) Exhausted() bool {
+	return b.MaxBudget > 0 && b.SpentBudget >= b.MaxBudget
+}
+
+// ReachedThreshold возвращает наибольший достигнутый порог из BudgetThresholds или 0
+func (b *Budget) ReachedThreshold() int {
+	if b.MaxBudget <= 0 {
+		return 0
+	}
+
+	reached := 0
+	for _, threshold := range BudgetThresholds {
+		if b.SpentBudget*100 >= b.MaxBudget*float64(threshold) {
+			reached = threshold
+		}
+	}
+	return reached
+}
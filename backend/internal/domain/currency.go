@@ -30,10 +30,13 @@ func (ExchangeRate) TableName() string {
 	return "exchange_rates"
 }
 
-// UserSpending - для отслеживания общих трат пользователя
+// UserSpending - для отслеживания общих трат пользователя.
+// TotalSpent - стоимость использования моделей, TotalPaid - оплаты (пополнения баланса за вычетом возвратов).
+// Это два источника одних и тех же денег, поэтому для тарифа они не складываются
 type UserSpending struct {
 	UserID     string    `json:"user_id" gorm:"type:varchar(36);primaryKey"`
-	TotalSpent float64   `json:"total_spent" gorm:"type:decimal(10,2);not null;default:0.00"`
+	TotalSpent float64   `json:"total_spent" gorm:"type:decimal(14,6);not null;default:0"`
+	TotalPaid  float64   `json:"total_paid" gorm:"type:decimal(14,6);not null;default:0"`
 	UpdatedAt  time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 
 	// Связи
@@ -43,3 +46,15 @@ type UserSpending struct {
 func (UserSpending) TableName() string {
 	return "user_spendings"
 }
+
+// UserSpendingDay - траты пользователя за день (UTC), по ним считаются траты за скользящее окно
+type UserSpendingDay struct {
+	UserID string    `json:"user_id" gorm:"type:varchar(36);primaryKey"`
+	Day    time.Time `json:"day" gorm:"type:date;primaryKey"`
+	Amount float64   `json:"amount" gorm:"type:decimal(14,6);not null;default:0"`
+	Paid   float64   `json:"paid" gorm:"type:decimal(14,6);not null;default:0"`
+}
+
+func (UserSpendingDay) TableName() string {
+	return "user_spending_daily"
+}
@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"time"
+)
+
+// Статусы счетов
+const (
+	InvoiceStatusIssued = "issued"
+)
+
+// Форматы файлов счета
+const (
+	InvoiceFormatPDF = "pdf"
+	InvoiceFormatCSV = "csv"
+)
+
+// Invoice - счет за расчетный период. Суммы строк берутся из стоимости запросов,
+// посчитанной по версиям цен на момент запроса, и пересчитываются в валюту счета.
+// Счет выставляется пользователю за его личные ключи или команде за ключи команды.
+type Invoice struct {
+	ID string `json:"id" gorm:"type:varchar(36);primaryKey"`
+	// Number - сквозной номер счета внутри года (INV-2024-000042)
+	Number string `json:"number" gorm:"type:varchar(32);not null;uniqueIndex"`
+	// UserID - получатель личного счета (пустой у счета команды)
+	UserID string `json:"user_id" gorm:"type:varchar(36);not null;uniqueIndex:idx_invoices_period"`
+	// TeamID - получатель счета команды (пустой у личного счета, не NULL, чтобы работал уникальный индекс периода)
+	TeamID string `json:"team_id,omitempty" gorm:"type:varchar(36);not null;default:'';uniqueIndex:idx_invoices_period"`
+	// PeriodStart и PeriodEnd - границы периода в UTC, конец не включается
+	PeriodStart time.Time `json:"period_start" gorm:"not null;uniqueIndex:idx_invoices_period"`
+	PeriodEnd   time.Time `json:"period_end" gorm:"not null"`
+	Currency    string    `json:"currency" gorm:"type:varchar(3);not null"`
+	// ExchangeRate - курс USD к валюте счета на момент выставления
+	ExchangeRate float64 `json:"exchange_rate" gorm:"type:decimal(15,8);not null;default:1"`
+	// SubtotalUSD - сумма строк в USD до пересчета
+	SubtotalUSD float64 `json:"subtotal_usd" gorm:"type:decimal(14,6);not null;default:0"`
+	// Total - итог в валюте счета
+	Total     float64   `json:"total" gorm:"type:decimal(14,2);not null;default:0"`
+	Status    string    `json:"status" gorm:"type:varchar(20);not null;default:issued"`
+	PDFPath   string    `json:"-" gorm:"type:varchar(255)"`
+	CSVPath   string    `json:"-" gorm:"type:varchar(255)"`
+	IssuedAt  time.Time `json:"issued_at" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+
+	// Связи
+	Lines []InvoiceLine `json:"lines,omitempty" gorm:"foreignKey:InvoiceID"`
+}
+
+func (Invoice) TableName() string {
+	return "invoices"
+}
+
+// InvoiceLine - использование одной модели по одной версии цены за период
+type InvoiceLine struct {
+	ID           string  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	InvoiceID    string  `json:"invoice_id" gorm:"type:varchar(36);not null;index"`
+	ModelID      string  `json:"model_id" gorm:"type:varchar(36)"`
+	ModelName    string  `json:"model_name" gorm:"type:varchar(255)"`
+	ModelPriceID *string `json:"model_price_id" gorm:"type:varchar(36)"`
+	// Цены продажи за токен в USD из версии цены (0, если запросы посчитаны без версии)
+	InputTokenPrice  float64 `json:"input_token_price" gorm:"type:decimal(20,12);not null;default:0"`
+	OutputTokenPrice float64 `json:"output_token_price" gorm:"type:decimal(20,12);not null;default:0"`
+	Requests         int64   `json:"requests" gorm:"not null;default:0"`
+	InputTokens      int64   `json:"input_tokens" gorm:"not null;default:0"`
+	OutputTokens     int64   `json:"output_tokens" gorm:"not null;default:0"`
+	AmountUSD        float64 `json:"amount_usd" gorm:"type:decimal(14,6);not null;default:0"`
+	// Amount - сумма строки в валюте счета
+	Amount float64 `json:"amount" gorm:"type:decimal(14,2);not null;default:0"`
+}
+
+func (InvoiceLine) TableName() string {
+	return "invoice_lines"
+}
+
+// InvoiceSequence - последний выданный номер счета за год
+type InvoiceSequence struct {
+	Year       int   `json:"year" gorm:"primaryKey;autoIncrement:false"`
+	LastNumber int64 `json:"last_number" gorm:"not null;default:0"`
+}
+
+func (InvoiceSequence) TableName() string {
+	return "invoice_sequences"
+}
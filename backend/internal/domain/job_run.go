@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"time"
+)
+
+// Статусы запуска фоновой задачи
+const (
+	JobRunStatusRunning   = "running"
+	JobRunStatusSucceeded = "succeeded"
+	JobRunStatusFailed    = "failed"
+)
+
+// Способы запуска фоновой задачи
+const (
+	JobTriggerSchedule = "schedule"
+	JobTriggerManual   = "manual"
+)
+
+// JobRun - запись истории запуска фоновой задачи планировщика
+type JobRun struct {
+	ID         string     `json:"id" gorm:"type:varchar(36);primaryKey"`
+	JobName    string     `json:"job_name" gorm:"type:varchar(100);not null;index"`
+	Trigger    string     `json:"trigger" gorm:"type:varchar(20);not null"`
+	Status     string     `json:"status" gorm:"type:varchar(20);not null;index"`
+	Error      string     `json:"error,omitempty" gorm:"type:text"`
+	StartedAt  time.Time  `json:"started_at" gorm:"not null;index"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	DurationMs int64      `json:"duration_ms" gorm:"default:0"`
+	// FencingToken - токен аренды лидера, при котором выполнялся запуск по расписанию
+	FencingToken int64 `json:"fencing_token,omitempty" gorm:"default:0"`
+}
+
+func (JobRun) TableName() string {
+	return "job_runs"
+}
@@ -0,0 +1,20 @@
+package domain
+
+import (
+	"time"
+)
+
+// LeaderLease - аренда лидерства между репликами backend. Держатель аренды считается лидером,
+// пока не истек ExpiresAt. FencingToken увеличивается при каждой смене держателя, поэтому
+// по нему можно отличить устаревшего лидера от текущего.
+type LeaderLease struct {
+	Name         string    `json:"name" gorm:"type:varchar(100);primaryKey"`
+	HolderID     string    `json:"holder_id" gorm:"type:varchar(191);not null"`
+	FencingToken int64     `json:"fencing_token" gorm:"not null;default:0"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"not null"`
+	UpdatedAt    time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (LeaderLease) TableName() string {
+	return "leader_leases"
+}
@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"time"
+)
+
+// Типы операций по балансу
+const (
+	LedgerTxTopUp       = "topup"
+	LedgerTxUsage       = "usage"
+	LedgerTxRefund      = "refund"
+	LedgerTxAdjustment  = "adjustment"
+	LedgerTxPromoCredit = "promo_credit"
+	// LedgerTxPaymentRefund и LedgerTxChargeback отменяют пополнение, возвращенное провайдером платежей
+	LedgerTxPaymentRefund = "payment_refund"
+	LedgerTxChargeback    = "chargeback"
+)
+
+// Системные счета, на которые приходится вторая сторона проводки
+const (
+	// LedgerAccountCash - деньги, поступившие от пользователей
+	LedgerAccountCash = "system:cash"
+	// LedgerAccountRevenue - выручка от использования моделей
+	LedgerAccountRevenue = "system:revenue"
+	// LedgerAccountPromotions - расходы на промо начисления
+	LedgerAccountPromotions = "system:promotions"
+	// LedgerAccountAdjustments - ручные корректировки администраторов
+	LedgerAccountAdjustments = "system:adjustments"
+)
+
+// LedgerUserAccount возвращает счет баланса пользователя
+func LedgerUserAccount(userID string) string {
+	return "user:" + userID
+}
+
+// LedgerAccount - счет с текущим остатком. Остаток меняется только проводками
+type LedgerAccount struct {
+	ID        string    `json:"id" gorm:"type:varchar(100);primaryKey"`
+	UserID    *string   `json:"user_id,omitempty" gorm:"type:varchar(36);uniqueIndex"`
+	Balance   float64   `json:"balance" gorm:"type:decimal(14,6);not null;default:0"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (LedgerAccount) TableName() string {
+	return "ledger_accounts"
+}
+
+// LedgerTransaction - неизменяемая операция по балансу пользователя.
+// Amount - изменение баланса пользователя (отрицательное для списаний).
+// Reference связывает операцию с источником, например с ID запроса для списаний за использование,
+// и вместе с типом операции защищает от повторного проведения.
+type LedgerTransaction struct {
+	ID        string    `json:"id" gorm:"type:varchar(36);primaryKey"`
+	Type      string    `json:"type" gorm:"type:varchar(20);not null;uniqueIndex:idx_ledger_transactions_reference,priority:1"`
+	UserID    string    `json:"user_id" gorm:"type:varchar(36);not null;index"`
+	Amount    float64   `json:"amount" gorm:"type:decimal(14,6);not null"`
+	Reason    string    `json:"reason" gorm:"type:text"`
+	Reference *string   `json:"reference,omitempty" gorm:"type:varchar(191);uniqueIndex:idx_ledger_transactions_reference,priority:2"`
+	CreatedBy *string   `json:"created_by,omitempty" gorm:"type:varchar(36)"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+
+	// Связи
+	Entries []LedgerEntry `json:"entries,omitempty" gorm:"foreignKey:TransactionID"`
+}
+
+func (LedgerTransaction) TableName() string {
+	return "ledger_transactions"
+}
+
+// LedgerEntry - одна сторона проводки. Сумма проводок одной операции всегда равна нулю.
+// BalanceAfter - остаток счета сразу после проводки
+type LedgerEntry struct {
+	ID            string    `json:"id" gorm:"type:varchar(36);primaryKey"`
+	TransactionID string    `json:"transaction_id" gorm:"type:varchar(36);not null;index"`
+	AccountID     string    `json:"account_id" gorm:"type:varchar(100);not null;index:idx_ledger_entries_account,priority:1"`
+	Amount        float64   `json:"amount" gorm:"type:decimal(14,6);not null"`
+	BalanceAfter  float64   `json:"balance_after" gorm:"type:decimal(14,6);not null"`
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime;index:idx_ledger_entries_account,priority:2"`
+
+	// Связи
+	Transaction *LedgerTransaction `json:"transaction,omitempty" gorm:"foreignKey:TransactionID"`
+}
+
+func (LedgerEntry) TableName() string {
+	return "ledger_entries"
+}
@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"time"
+)
+
+// Статусы платежа
+const (
+	PaymentStatusPending           = "pending"
+	PaymentStatusSucceeded         = "succeeded"
+	PaymentStatusFailed            = "failed"
+	PaymentStatusPartiallyRefunded = "partially_refunded"
+	PaymentStatusRefunded          = "refunded"
+	PaymentStatusChargedBack       = "charged_back"
+)
+
+// Payment - пополнение баланса через провайдера платежей. Сумма зачисляется на баланс
+// после подтверждения оплаты вебхуком провайдера
+type Payment struct {
+	ID                string  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	UserID            string  `json:"user_id" gorm:"type:varchar(36);not null;index"`
+	Provider          string  `json:"provider" gorm:"type:varchar(50);not null"`
+	ProviderSessionID *string `json:"provider_session_id,omitempty" gorm:"type:varchar(191);index"`
+	ProviderPaymentID *string `json:"provider_payment_id,omitempty" gorm:"type:varchar(191)"`
+	CheckoutURL       string  `json:"checkout_url,omitempty" gorm:"type:text"`
+	Amount            float64 `json:"amount" gorm:"type:decimal(14,2);not null"`
+	Currency          string  `json:"currency" gorm:"type:varchar(3);not null"`
+	Status            string  `json:"status" gorm:"type:varchar(20);not null;default:'pending'"`
+	// RefundedAmount - сумма возвратов и чарджбэков, списанная с баланса
+	RefundedAmount float64    `json:"refunded_amount" gorm:"type:decimal(14,2);not null;default:0"`
+	CompletedAt    *time.Time `json:"completed_at"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (Payment) TableName() string {
+	return "payments"
+}
+
+// PaymentEvent - обработанное событие вебхука провайдера. Повторная доставка того же события
+// не меняет платеж. Amount - изменение баланса пользователя, вызванное событием
+type PaymentEvent struct {
+	ID        string    `json:"id" gorm:"type:varchar(36);primaryKey"`
+	Provider  string    `json:"provider" gorm:"type:varchar(50);not null;uniqueIndex:idx_payment_events_event,priority:1"`
+	EventID   string    `json:"event_id" gorm:"type:varchar(191);not null;uniqueIndex:idx_payment_events_event,priority:2"`
+	Type      string    `json:"type" gorm:"type:varchar(50);not null"`
+	PaymentID string    `json:"payment_id" gorm:"type:varchar(36);not null;index"`
+	ObjectID  string    `json:"object_id" gorm:"type:varchar(191)"`
+	Amount    float64   `json:"amount" gorm:"type:decimal(14,2);not null;default:0"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (PaymentEvent) TableName() string {
+	return "payment_events"
+}
@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"time"
+)
+
+// PriceRule - правило наценки на стоимость провайдера. Правило действует для моделей,
+// подходящих под все заданные условия (модель, компания, тариф); пустое условие подходит
+// под любое значение. Правила не изменяются: чтобы поменять наценку, создается новое
+// правило с теми же условиями и более поздней датой EffectiveFrom.
+type PriceRule struct {
+	ID        string  `json:"id" gorm:"type:varchar(36);primaryKey"`
+	Name      string  `json:"name" gorm:"type:varchar(255)"`
+	ModelID   *string `json:"model_id" gorm:"type:varchar(36);index"`
+	CompanyID *string `json:"company_id" gorm:"type:varchar(36);index"`
+	TierID    *string `json:"tier_id" gorm:"type:varchar(36);index"`
+	// MarkupPercent - наценка в процентах к стоимости провайдера (20 - цена продажи на 20% выше)
+	MarkupPercent float64   `json:"markup_percent" gorm:"type:decimal(10,4);not null;default:0"`
+	EffectiveFrom time.Time `json:"effective_from" gorm:"not null;index"`
+	CreatedBy     *string   `json:"created_by" gorm:"type:varchar(36)"`
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (PriceRule) TableName() string {
+	return "price_rules"
+}
+
+// Specificity - приоритет правила: правило для модели важнее правила для компании,
+// а правило для компании важнее правила только для тарифа
+func (r *PriceRule) Specificity() int {
+	specificity := 0
+	if r.ModelID != nil {
+		specificity += 4
+	}
+	if r.CompanyID != nil {
+		specificity += 2
+	}
+	if r.TierID != nil {
+		specificity++
+	}
+	return specificity
+}
+
+// Matches проверяет, что правило действует для модели на тарифе
+func (r *PriceRule) Matches(model *Model, tierID string) bool {
+	return (r.ModelID == nil || *r.ModelID == model.ID) &&
+		(r.CompanyID == nil || *r.CompanyID == model.CompanyID) &&
+		(r.TierID == nil || *r.TierID == tierID)
+}
+
+// ModelPrice - версия цены продажи модели для тарифа. Новая версия создается, когда меняется
+// стоимость провайдера или действующее правило наценки; старые версии не изменяются,
+// поэтому по ссылке из запроса всегда можно узнать, по какой цене он был списан.
+type ModelPrice struct {
+	ID      string `json:"id" gorm:"type:varchar(36);primaryKey"`
+	ModelID string `json:"model_id" gorm:"type:varchar(36);not null;uniqueIndex:idx_model_prices_version"`
+	// TierID - тариф, для которого действует цена (пустой, если у пользователя нет тарифа)
+	TierID  string `json:"tier_id" gorm:"type:varchar(36);not null;default:'';uniqueIndex:idx_model_prices_version"`
+	Version int    `json:"version" gorm:"not null;uniqueIndex:idx_model_prices_version"`
+	// Стоимость провайдера за токен на момент создания версии
+	UpstreamInputCost  float64 `json:"upstream_input_cost" gorm:"type:decimal(20,12);not null;default:0"`
+	UpstreamOutputCost float64 `json:"upstream_output_cost" gorm:"type:decimal(20,12);not null;default:0"`
+	PriceRuleID        *string `json:"price_rule_id" gorm:"type:varchar(36)"`
+	MarkupPercent      float64 `json:"markup_percent" gorm:"type:decimal(10,4);not null;default:0"`
+	// Цена продажи за токен
+	InputTokenCost  float64   `json:"input_token_cost" gorm:"type:decimal(20,12);not null;default:0"`
+	OutputTokenCost float64   `json:"output_token_cost" gorm:"type:decimal(20,12);not null;default:0"`
+	EffectiveFrom   time.Time `json:"effective_from" gorm:"not null"`
+	CreatedAt       time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (ModelPrice) TableName() string {
+	return "model_prices"
+}
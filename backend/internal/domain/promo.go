@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"time"
+)
+
+// Типы промокодов
+const (
+	// PromoTypeCredit начисляет сумму на баланс
+	PromoTypeCredit = "credit"
+	// PromoTypeTierUpgrade временно переводит пользователя на другой тариф
+	PromoTypeTierUpgrade = "tier_upgrade"
+	// PromoTypeDiscount дает скидку на использование моделей на несколько дней
+	PromoTypeDiscount = "discount"
+)
+
+// PromoCode - промокод или ваучер. Для credit задается CreditAmount, для tier_upgrade - TierID,
+// для discount - DiscountPercent; для tier_upgrade и discount DurationDays задает срок действия
+type PromoCode struct {
+	ID          string `json:"id" gorm:"type:varchar(36);primaryKey"`
+	Code        string `json:"code" gorm:"type:varchar(64);not null;uniqueIndex"`
+	Description string `json:"description" gorm:"type:text"`
+	Type        string `json:"type" gorm:"type:varchar(20);not null"`
+
+	CreditAmount    *float64 `json:"credit_amount,omitempty" gorm:"type:decimal(14,6)"`
+	TierID          *string  `json:"tier_id,omitempty" gorm:"type:varchar(36)"`
+	DiscountPercent *float64 `json:"discount_percent,omitempty" gorm:"type:decimal(5,2)"`
+	DurationDays    int      `json:"duration_days" gorm:"not null;default:0"`
+
+	// MaxRedemptions - сколько раз код можно активировать всего (nil - без ограничения)
+	MaxRedemptions *int `json:"max_redemptions" gorm:"type:int"`
+	// PerUserLimit - сколько раз один пользователь может активировать код
+	PerUserLimit    int        `json:"per_user_limit" gorm:"not null;default:1"`
+	RedemptionCount int        `json:"redemption_count" gorm:"not null;default:0"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	IsActive        bool       `json:"is_active" gorm:"default:true"`
+	CreatedBy       *string    `json:"created_by" gorm:"type:varchar(36)"`
+	CreatedAt       time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt       time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (PromoCode) TableName() string {
+	return "promo_codes"
+}
+
+// PromoRedemption - активация промокода пользователем. Хранит то, что было выдано,
+// чтобы временный тариф и скидка закончились в срок даже после изменения кода
+type PromoRedemption struct {
+	ID          string `json:"id" gorm:"type:varchar(36);primaryKey"`
+	PromoCodeID string `json:"promo_code_id" gorm:"type:varchar(36);not null;index"`
+	UserID      string `json:"user_id" gorm:"type:varchar(36);not null;index"`
+	Code        string `json:"code" gorm:"type:varchar(64);not null"`
+	Type        string `json:"type" gorm:"type:varchar(20);not null"`
+
+	CreditAmount    *float64 `json:"credit_amount,omitempty" gorm:"type:decimal(14,6)"`
+	DiscountPercent *float64 `json:"discount_percent,omitempty" gorm:"type:decimal(5,2)"`
+	GrantedTierID   *string  `json:"granted_tier_id,omitempty" gorm:"type:varchar(36)"`
+	// PreviousTierID - тариф, который возвращается пользователю после окончания срока
+	PreviousTierID *string `json:"previous_tier_id,omitempty" gorm:"type:varchar(36)"`
+
+	// ExpiresAt - окончание временного тарифа или скидки
+	ExpiresAt  *time.Time `json:"expires_at" gorm:"index"`
+	RevertedAt *time.Time `json:"reverted_at"`
+	RedeemedAt time.Time  `json:"redeemed_at" gorm:"not null"`
+}
+
+func (PromoRedemption) TableName() string {
+	return "promo_redemptions"
+}
+
+// IsActive сообщает, действует ли еще временный тариф или скидка
+func (r *PromoRedemption) IsActive(now time.Time) bool {
+	return r.RevertedAt == nil && r.ExpiresAt != nil && now.Before(*r.ExpiresAt)
+}
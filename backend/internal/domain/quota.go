@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"time"
+)
+
+// QuotaHold - удержание баланса и месячных токенов на время выполнения запроса к модели.
+// Удержание создается до отправки запроса по максимальной оценке стоимости и снимается
+// после списания фактической стоимости. Если backend упал во время запроса,
+// удержание перестает учитываться после ExpiresAt.
+type QuotaHold struct {
+	ID     string `json:"id" gorm:"type:varchar(36);primaryKey"`
+	UserID string `json:"user_id" gorm:"type:varchar(36);not null;index"`
+	// ApiKeyID - ключ запроса; удержание учитывается и в бюджете ключа
+	ApiKeyID  string    `json:"api_key_id" gorm:"type:varchar(36);not null;default:'';index"`
+	Amount    float64   `json:"amount" gorm:"type:decimal(14,6);not null;default:0"`
+	Tokens    int64     `json:"tokens" gorm:"not null;default:0"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (QuotaHold) TableName() string {
+	return "quota_holds"
+}
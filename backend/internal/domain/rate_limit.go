@@ -23,3 +23,16 @@ type RateLimit struct {
 func (RateLimit) TableName() string {
 	return "rate_limits"
 }
+
+// RateLimitCounter - значение счетчика лимита в одном фиксированном окне.
+// Общая таблица позволяет соблюдать лимиты при нескольких репликах backend.
+type RateLimitCounter struct {
+	CounterKey string    `json:"counter_key" gorm:"type:varchar(191);primaryKey"`
+	Bucket     int64     `json:"bucket" gorm:"primaryKey;autoIncrement:false"`
+	Amount     int64     `json:"amount" gorm:"not null;default:0"`
+	ExpiresAt  time.Time `json:"expires_at" gorm:"not null;index"`
+}
+
+func (RateLimitCounter) TableName() string {
+	return "rate_limit_counters"
+}
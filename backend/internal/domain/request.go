@@ -4,17 +4,33 @@ import (
 	"time"
 )
 
+// Статусы запросов
+const (
+	RequestStatusCompleted = "completed"
+	RequestStatusFailed    = "failed"
+	RequestStatusCancelled = "cancelled"
+)
+
+// Типы вызовов, проходящих через шлюз
+const (
+	CallTypeChat       = "chat"
+	CallTypeEmbeddings = "embeddings"
+	CallTypeImages     = "images"
+)
+
 type Request struct {
 	ID                string     `json:"id" gorm:"type:varchar(36);primaryKey"`
 	UserID            string     `json:"user_id" gorm:"type:varchar(36);not null"`
 	ModelID           string     `json:"model_id" gorm:"type:varchar(36)"`
 	ApiKeyID          *string    `json:"api_key_id" gorm:"type:varchar(36)"`
+	TeamID            *string    `json:"team_id" gorm:"type:varchar(36);index"` // Команда ключа, от имени которой выполнен запрос
 	ExternalRequestID *string    `json:"external_request_id" gorm:"type:varchar(255)"`
 	InputTokens       int        `json:"input_tokens" gorm:"not null"`
 	OutputTokens      int        `json:"output_tokens" gorm:"not null"`
 	InputCost         float64    `json:"input_cost" gorm:"type:decimal(10,6);not null"`
 	OutputCost        float64    `json:"output_cost" gorm:"type:decimal(10,6);not null"`
 	TotalCost         float64    `json:"total_cost" gorm:"type:decimal(10,6);not null"`
+	ModelPriceID      *string    `json:"model_price_id" gorm:"type:varchar(36);index"` // Версия цены, по которой посчитана стоимость
 	Status            string     `json:"status" gorm:"type:varchar(50);default:completed"`
 	CallType          *string    `json:"call_type" gorm:"type:varchar(50)"`
 	ModelName         *string    `json:"model_name" gorm:"type:varchar(255)"`
@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"time"
+)
+
+// Причины отзыва сессии
+const (
+	SessionRevokedLogout = "logout"
+	// SessionRevokedByUser - сессию завершили из списка сессий или выходом на всех устройствах
+	SessionRevokedByUser = "revoked"
+	// SessionRevokedTokenReuse - предъявлен уже использованный refresh токен: вероятно, он украден
+	SessionRevokedTokenReuse = "refresh_token_reuse"
+)
+
+// Session - вход пользователя с одного устройства. Access токены сессии короткоживущие и содержат
+// ее ID (sid), а продлеваются непрозрачными refresh токенами, которые меняются при каждом продлении
+type Session struct {
+	ID        string `json:"id" gorm:"type:varchar(36);primaryKey"`
+	UserID    string `json:"user_id" gorm:"type:varchar(36);not null;index"`
+	UserAgent string `json:"user_agent" gorm:"type:varchar(512)"`
+	IPAddress string `json:"ip_address" gorm:"type:varchar(45)"`
+	// ExpiresAt - срок действия текущего refresh токена, сдвигается при каждом продлении
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null"`
+	LastUsedAt   time.Time  `json:"last_used_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	RevokeReason string     `json:"revoke_reason,omitempty" gorm:"type:varchar(50)"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (Session) TableName() string {
+	return "user_sessions"
+}
+
+// IsActive сообщает, что сессия не отозвана и ее можно продлить
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// RefreshToken - выданный сессии refresh токен. Хранится только хеш; использованные токены
+// остаются в таблице, чтобы распознать их повторное предъявление
+type RefreshToken struct {
+	TokenHash string     `json:"-" gorm:"type:varchar(64);primaryKey"`
+	SessionID string     `json:"session_id" gorm:"type:varchar(36);not null;index"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
@@ -0,0 +1,22 @@
+package domain
+
+import (
+	"time"
+)
+
+// JWTSigningKey - асимметричный ключ подписи access токенов. Закрытый ключ хранится
+// в PKCS#8 PEM, зашифрованном ENCRYPTION_KEY; открытая часть публикуется в JWKS
+type JWTSigningKey struct {
+	// ID - kid в заголовке токена и в JWKS
+	ID         string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	Algorithm  string `json:"algorithm" gorm:"type:varchar(10);not null"`
+	PrivateKey string `json:"-" gorm:"type:text;not null"`
+	// ActivatesAt - с этого момента ключ подписывает токены; до него ключ только опубликован,
+	// чтобы проверяющие сервисы успели обновить закешированный JWKS
+	ActivatesAt time.Time `json:"activates_at" gorm:"not null;index"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (JWTSigningKey) TableName() string {
+	return "jwt_signing_keys"
+}
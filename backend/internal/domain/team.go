@@ -0,0 +1,111 @@
+package domain
+
+import (
+	"time"
+)
+
+// Роли участников команды
+const (
+	// TeamRoleOwner управляет командой целиком, в том числе назначает других владельцев
+	TeamRoleOwner = "owner"
+	// TeamRoleAdmin управляет участниками, ключами и бюджетами команды
+	TeamRoleAdmin = "admin"
+	// TeamRoleMember пользуется моделями через ключи команды
+	TeamRoleMember = "member"
+	// TeamRoleBilling видит расходы и бюджеты команды, но не вызывает модели
+	TeamRoleBilling = "billing"
+)
+
+// ValidTeamRole сообщает, что роль участника команды известна
+func ValidTeamRole(role string) bool {
+	switch role {
+	case TeamRoleOwner, TeamRoleAdmin, TeamRoleMember, TeamRoleBilling:
+		return true
+	default:
+		return false
+	}
+}
+
+// Team - команда (организация, отдел). ID команды совпадает с team_id в LiteLLM
+type Team struct {
+	ID          string `json:"id" gorm:"type:varchar(36);primaryKey"`
+	Name        string `json:"name" gorm:"type:varchar(255);not null"`
+	Description string `json:"description" gorm:"type:text"`
+	// TierID - тариф команды для ключей команды; пусто - действует тариф владельца ключа
+	TierID    *string   `json:"tier_id" gorm:"type:varchar(36)"`
+	CreatedBy string    `json:"created_by" gorm:"type:varchar(36);not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+
+	// Связи
+	Tier *Tier `json:"tier,omitempty" gorm:"foreignKey:TierID"`
+}
+
+func (Team) TableName() string {
+	return "teams"
+}
+
+// TeamMember - участие пользователя в команде
+type TeamMember struct {
+	TeamID    string    `json:"team_id" gorm:"type:varchar(36);primaryKey"`
+	UserID    string    `json:"user_id" gorm:"type:varchar(36);primaryKey;index"`
+	Role      string    `json:"role" gorm:"type:varchar(20);not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+
+	// Связи
+	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+func (TeamMember) TableName() string {
+	return "team_members"
+}
+
+// CanManage сообщает, что участник управляет участниками, ключами и бюджетами команды
+func (m *TeamMember) CanManage() bool {
+	return m.Role == TeamRoleOwner || m.Role == TeamRoleAdmin
+}
+
+// CanViewBilling сообщает, что участнику доступны расходы и бюджеты команды
+func (m *TeamMember) CanViewBilling() bool {
+	return m.CanManage() || m.Role == TeamRoleBilling
+}
+
+// CanUseModels сообщает, что участник может выпускать ключи команды для вызова моделей
+func (m *TeamMember) CanUseModels() bool {
+	return m.CanManage() || m.Role == TeamRoleMember
+}
+
+// LiteLLMRole возвращает роль участника в терминах LiteLLM
+func (m *TeamMember) LiteLLMRole() string {
+	if m.CanManage() {
+		return "admin"
+	}
+	return "user"
+}
+
+// TeamInvitation - приглашение в команду по email с заранее назначенной ролью.
+// Ссылка приглашения содержит подписанный токен с ID приглашения; принять приглашение можно один раз
+type TeamInvitation struct {
+	ID         string     `json:"id" gorm:"type:varchar(36);primaryKey"`
+	TeamID     string     `json:"team_id" gorm:"type:varchar(36);not null;index"`
+	Email      string     `json:"email" gorm:"type:varchar(255);not null;index"`
+	Role       string     `json:"role" gorm:"type:varchar(20);not null"`
+	InvitedBy  string     `json:"invited_by" gorm:"type:varchar(36);not null"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+	AcceptedBy *string    `json:"accepted_by" gorm:"type:varchar(36)"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+
+	// Связи
+	Team *Team `json:"team,omitempty" gorm:"foreignKey:TeamID"`
+}
+
+func (TeamInvitation) TableName() string {
+	return "team_invitations"
+}
+
+// IsPending сообщает, что приглашение еще можно принять
+func (i *TeamInvitation) IsPending(now time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && now.Before(i.ExpiresAt)
+}
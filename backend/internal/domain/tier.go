@@ -10,8 +10,12 @@ type Tier struct {
 	Description string `json:"description" gorm:"type:text"`
 	IsFree      bool   `json:"is_free" gorm:"default:false"`
 	// Price - сумма в USD, которую нужно потратить для перехода на этот тариф
-	Price     float64   `json:"price" gorm:"type:decimal(10,2);default:0.00"`
-	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	Price float64 `json:"price" gorm:"type:decimal(10,2);default:0.00"`
+	// QualificationWindowDays - за сколько последних дней учитываются траты; 0 - за все время
+	QualificationWindowDays int `json:"qualification_window_days" gorm:"not null;default:0"`
+	// DowngradeGraceDays - через сколько дней после потери права на тариф пользователь переводится ниже
+	DowngradeGraceDays int       `json:"downgrade_grace_days" gorm:"not null;default:0"`
+	CreatedAt          time.Time `json:"created_at" gorm:"autoCreateTime"`
 
 	// Связи
 	Users      []User      `json:"users,omitempty" gorm:"foreignKey:TierID"`
@@ -21,3 +25,47 @@ type Tier struct {
 func (Tier) TableName() string {
 	return "tiers"
 }
+
+// Причины смены тарифа пользователя
+const (
+	TierChangeReasonSpending     = "spending"
+	TierChangeReasonAdmin        = "admin"
+	TierChangeReasonPromo        = "promo"
+	TierChangeReasonPromoExpired = "promo_expired"
+	TierChangeReasonDowngrade    = "downgrade"
+)
+
+// TierChange - запись истории тарифов пользователя
+type TierChange struct {
+	ID     string `json:"id" gorm:"type:varchar(36);primaryKey"`
+	UserID string `json:"user_id" gorm:"type:varchar(36);not null;index"`
+	// FromTierID совпадает с ToTierID, если администратор изменил только закрепление тарифа
+	FromTierID string `json:"from_tier_id" gorm:"type:varchar(36)"`
+	ToTierID   string `json:"to_tier_id" gorm:"type:varchar(36);not null"`
+	Reason     string `json:"reason" gorm:"type:varchar(20);not null"`
+	// Pinned - закреплен ли тариф администратором после смены
+	Pinned bool `json:"pinned" gorm:"default:false"`
+	// ChangedBy - администратор, сменивший тариф
+	ChangedBy *string   `json:"changed_by,omitempty" gorm:"type:varchar(36)"`
+	Note      string    `json:"note,omitempty" gorm:"type:varchar(255)"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+func (TierChange) TableName() string {
+	return "tier_history"
+}
+
+// TierDowngrade - запланированное понижение тарифа пользователя, траты которого больше
+// не соответствуют текущему тарифу
+type TierDowngrade struct {
+	UserID     string `json:"user_id" gorm:"type:varchar(36);primaryKey"`
+	FromTierID string `json:"from_tier_id" gorm:"type:varchar(36);not null"`
+	ToTierID   string `json:"to_tier_id" gorm:"type:varchar(36);not null"`
+	// DowngradeAt - когда тариф будет понижен, если траты не вернутся к уровню тарифа
+	DowngradeAt time.Time `json:"downgrade_at" gorm:"not null;index"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (TierDowngrade) TableName() string {
+	return "tier_downgrades"
+}
@@ -14,14 +14,20 @@ const (
 )
 
 type User struct {
-	ID           string    `json:"id" gorm:"type:varchar(36);primaryKey"`
-	Email        string    `json:"email" gorm:"type:varchar(255);uniqueIndex;not null"`
-	Name         *string   `json:"name" gorm:"type:varchar(255)"`
-	PasswordHash string    `json:"-" gorm:"type:varchar(255);not null"`
-	TierID       string    `json:"tier_id" gorm:"type:varchar(36);not null"`
-	Role         UserRole  `json:"role" gorm:"type:enum('customer','enterprise','support','admin');default:'customer'"`
-	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt    time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	ID           string   `json:"id" gorm:"type:varchar(36);primaryKey"`
+	Email        string   `json:"email" gorm:"type:varchar(255);uniqueIndex;not null"`
+	Name         *string  `json:"name" gorm:"type:varchar(255)"`
+	PasswordHash string   `json:"-" gorm:"type:varchar(255);not null"`
+	TierID       string   `json:"tier_id" gorm:"type:varchar(36);not null"`
+	TierPinned   bool     `json:"tier_pinned" gorm:"default:false"`
+	Role         UserRole `json:"role" gorm:"type:enum('customer','enterprise','support','admin');default:'customer'"`
+	// EmailVerifiedAt - когда пользователь подтвердил email; до подтверждения доступны только бесплатные модели
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// EmailVerificationSentAt и PasswordResetSentAt - время последних писем, ограничивают частоту повторной отправки
+	EmailVerificationSentAt *time.Time `json:"-"`
+	PasswordResetSentAt     *time.Time `json:"-"`
+	CreatedAt               time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt               time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
 
 	// Связи
 	Tier         *Tier         `json:"tier,omitempty" gorm:"foreignKey:TierID"`
@@ -36,10 +42,16 @@ func (User) TableName() string {
 	return "users"
 }
 
+// IsEmailVerified сообщает, что пользователь подтвердил email
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
 type UserLimit struct {
-	UserID            string   `json:"user_id" gorm:"type:varchar(36);primaryKey"`
-	MonthlyTokenLimit *int64   `json:"monthly_token_limit" gorm:"type:bigint"`
-	Balance           *float64 `json:"balance" gorm:"type:decimal(10,2);default:0.00"`
+	UserID            string `json:"user_id" gorm:"type:varchar(36);primaryKey"`
+	MonthlyTokenLimit *int64 `json:"monthly_token_limit" gorm:"type:bigint"`
+	// Balance - копия остатка счета пользователя в журнале операций, обновляется при каждой проводке
+	Balance *float64 `json:"balance" gorm:"type:decimal(14,6);default:0"`
 
 	// Связи
 	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
@@ -0,0 +1,289 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"oneui-hub/internal/domain"
+)
+
+// ErrNotLeader возвращается, если реплика больше не держит аренду с указанным токеном
+var ErrNotLeader = errors.New("not the leader")
+
+// Elector выбирает лидера среди реплик через аренду в общей БД.
+// Лидер продлевает аренду каждые renewInterval; если реплика перестает продлевать
+// аренду (упала или потеряла связь с БД), после ttl аренду забирает другая реплика.
+type Elector struct {
+	db            *gorm.DB
+	name          string
+	holderID      string
+	ttl           time.Duration
+	renewInterval time.Duration
+	now           func() time.Time
+
+	mu        sync.Mutex
+	token     int64
+	expiresAt time.Time
+	leaderCtx context.Context
+	cancel    context.CancelFunc
+}
+
+func NewElector(db *gorm.DB, name, holderID string, ttl, renewInterval time.Duration) *Elector {
+	if renewInterval <= 0 || renewInterval >= ttl {
+		renewInterval = ttl / 3
+	}
+	return &Elector{
+		db:            db,
+		name:          name,
+		holderID:      holderID,
+		ttl:           ttl,
+		renewInterval: renewInterval,
+		now:           time.Now,
+	}
+}
+
+// Run участвует в выборах до отмены ctx. При остановке аренда освобождается,
+// чтобы другая реплика могла стать лидером, не дожидаясь истечения ttl.
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.renewInterval)
+	defer ticker.Stop()
+
+	e.tick(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			e.tick(ctx)
+		case <-ctx.Done():
+			releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := e.Release(releaseCtx); err != nil {
+				log.Printf("Failed to release leader lease %s: %v", e.name, err)
+			}
+			cancel()
+			return
+		}
+	}
+}
+
+func (e *Elector) tick(ctx context.Context) {
+	token, acquired, err := e.tryAcquire(ctx)
+	if err != nil {
+		log.Printf("Failed to renew leader lease %s: %v", e.name, err)
+		// Без связи с БД лидерство сохраняется только до истечения уже продленной аренды
+		e.mu.Lock()
+		expired := !e.now().Before(e.expiresAt)
+		e.mu.Unlock()
+		if expired {
+			e.stepDown()
+		}
+		return
+	}
+
+	if acquired {
+		e.becomeLeader(token)
+	} else {
+		e.stepDown()
+	}
+}
+
+// tryAcquire продлевает собственную аренду или забирает истекшую
+func (e *Elector) tryAcquire(ctx context.Context) (int64, bool, error) {
+	now := e.now()
+	expiresAt := now.Add(e.ttl)
+
+	var token int64
+	acquired := false
+	err := e.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Продление аренды, которую реплика уже держит. Токен не меняется
+		result := tx.Model(&domain.LeaderLease{}).
+			Where("name = ? AND holder_id = ? AND expires_at > ?", e.name, e.holderID, now).
+			Update("expires_at", expiresAt)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			// Захват истекшей аренды с увеличением токена
+			result = tx.Model(&domain.LeaderLease{}).
+				Where("name = ? AND expires_at <= ?", e.name, now).
+				Updates(map[string]interface{}{
+					"holder_id":     e.holderID,
+					"fencing_token": gorm.Expr("fencing_token + 1"),
+					"expires_at":    expiresAt,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		if result.RowsAffected == 0 {
+			// Аренды еще нет - создаем ее, если другая реплика не успела раньше
+			result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&domain.LeaderLease{
+				Name:         e.name,
+				HolderID:     e.holderID,
+				FencingToken: 1,
+				ExpiresAt:    expiresAt,
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		var lease domain.LeaderLease
+		if err := tx.First(&lease, "name = ? AND holder_id = ?", e.name, e.holderID).Error; err != nil {
+			return err
+		}
+		token = lease.FencingToken
+		acquired = true
+		return nil
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to acquire leader lease: %w", err)
+	}
+
+	if acquired {
+		e.mu.Lock()
+		e.expiresAt = expiresAt
+		e.mu.Unlock()
+	}
+
+	return token, acquired, nil
+}
+
+func (e *Elector) becomeLeader(token int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.leaderCtx != nil && e.token == token {
+		return
+	}
+	if e.cancel != nil {
+		e.cancel()
+	}
+
+	e.token = token
+	e.leaderCtx, e.cancel = context.WithCancel(context.Background())
+	log.Printf("Became leader for %s with fencing token %d", e.name, token)
+}
+
+func (e *Elector) stepDown() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.leaderCtx == nil {
+		return
+	}
+
+	e.cancel()
+	e.leaderCtx = nil
+	e.cancel = nil
+	e.token = 0
+	log.Printf("Lost leadership for %s", e.name)
+}
+
+// Lease возвращает токен текущей аренды и контекст, который отменяется при потере лидерства.
+// ok = false, если реплика сейчас не лидер.
+func (e *Elector) Lease() (int64, context.Context, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.leaderCtx == nil || !e.now().Before(e.expiresAt) {
+		return 0, nil, false
+	}
+	return e.token, e.leaderCtx, true
+}
+
+// IsLeader сообщает, держит ли реплика аренду
+func (e *Elector) IsLeader() bool {
+	_, _, ok := e.Lease()
+	return ok
+}
+
+// Validate проверяет по БД, что аренда с токеном token все еще принадлежит реплике.
+// Вызывается перед записями, которые не должен выполнить устаревший лидер.
+func (e *Elector) Validate(ctx context.Context, token int64) error {
+	return e.checkLease(e.db.WithContext(ctx), token)
+}
+
+// checkLease проверяет аренду в переданном соединении. Строка аренды блокируется на чтение
+// до конца транзакции, поэтому захват аренды другой репликой дождется ее завершения
+func (e *Elector) checkLease(db *gorm.DB, token int64) error {
+	var count int64
+	err := db.Model(&domain.LeaderLease{}).
+		Clauses(clause.Locking{Strength: "SHARE"}).
+		Where("name = ? AND holder_id = ? AND fencing_token = ? AND expires_at > ?", e.name, e.holderID, token, e.now()).
+		Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("failed to validate leader lease: %w", err)
+	}
+	if count == 0 {
+		return ErrNotLeader
+	}
+	return nil
+}
+
+// RegisterFencing подключает к db проверку токена аренды при каждой записи. Если в контексте
+// запроса есть токен (WithFencingToken), вставка, изменение или удаление выполняются только
+// вместе с проверкой, что аренда с этим токеном еще действует, иначе запрос завершается ErrNotLeader.
+// Так записи задачи, запущенной устаревшим лидером, отклоняются, даже если он еще не узнал о потере лидерства
+func (e *Elector) RegisterFencing(db *gorm.DB) error {
+	const name = "leader:fencing"
+	if err := db.Callback().Create().After("gorm:begin_transaction").Before("gorm:create").Register(name, e.fence); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:begin_transaction").Before("gorm:update").Register(name, e.fence); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:begin_transaction").Before("gorm:delete").Register(name, e.fence)
+}
+
+// fence выполняется в той же транзакции, что и запись
+func (e *Elector) fence(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Context == nil {
+		return
+	}
+	token, ok := FencingToken(db.Statement.Context)
+	if !ok || db.Statement.Table == (domain.LeaderLease{}).TableName() {
+		return
+	}
+
+	if err := e.checkLease(db.Session(&gorm.Session{NewDB: true}), token); err != nil {
+		db.AddError(err)
+	}
+}
+
+// Release досрочно завершает аренду, если реплика ее держит
+func (e *Elector) Release(ctx context.Context) error {
+	e.stepDown()
+
+	err := e.db.WithContext(ctx).Model(&domain.LeaderLease{}).
+		Where("name = ? AND holder_id = ?", e.name, e.holderID).
+		Update("expires_at", e.now()).Error
+	if err != nil {
+		return fmt.Errorf("failed to release leader lease: %w", err)
+	}
+	return nil
+}
+
+type fencingTokenKey struct{}
+
+// WithFencingToken сохраняет токен аренды в контексте задачи
+func WithFencingToken(ctx context.Context, token int64) context.Context {
+	return context.WithValue(ctx, fencingTokenKey{}, token)
+}
+
+// FencingToken извлекает токен аренды, при котором была запущена задача
+func FencingToken(ctx context.Context) (int64, bool) {
+	token, ok := ctx.Value(fencingTokenKey{}).(int64)
+	return token, ok
+}
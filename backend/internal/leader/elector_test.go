@@ -0,0 +1,156 @@
+package leader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"oneui-hub/internal/domain"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	// Каждое соединение с :memory: открывает отдельную БД
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	require.NoError(t, db.AutoMigrate(&domain.LeaderLease{}))
+	return db
+}
+
+func newTestElector(db *gorm.DB, holderID string, clock *fakeClock) *Elector {
+	elector := NewElector(db, "scheduler", holderID, 15*time.Second, 5*time.Second)
+	elector.now = clock.Now
+	return elector
+}
+
+func TestElector_SingleLeaderAndFailover(t *testing.T) {
+	db := newTestDB(t)
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	ctx := context.Background()
+
+	a := newTestElector(db, "pod-a", clock)
+	b := newTestElector(db, "pod-b", clock)
+
+	a.tick(ctx)
+	b.tick(ctx)
+
+	token, leaseCtx, ok := a.Lease()
+	require.True(t, ok)
+	assert.Equal(t, int64(1), token)
+	assert.False(t, b.IsLeader())
+	require.NoError(t, a.Validate(ctx, 1))
+
+	// Продление аренды не меняет токен
+	clock.Advance(5 * time.Second)
+	a.tick(ctx)
+	b.tick(ctx)
+	token, _, ok = a.Lease()
+	require.True(t, ok)
+	assert.Equal(t, int64(1), token)
+	assert.False(t, b.IsLeader())
+
+	// pod-a перестал продлевать аренду: после ttl лидером становится pod-b с новым токеном
+	clock.Advance(16 * time.Second)
+	assert.False(t, a.IsLeader())
+	b.tick(ctx)
+	token, _, ok = b.Lease()
+	require.True(t, ok)
+	assert.Equal(t, int64(2), token)
+
+	// Ожившая реплика узнает о потере лидерства, а ее токен больше не действителен
+	a.tick(ctx)
+	assert.False(t, a.IsLeader())
+	assert.Error(t, leaseCtx.Err())
+	assert.ErrorIs(t, a.Validate(ctx, 1), ErrNotLeader)
+	require.NoError(t, b.Validate(ctx, 2))
+}
+
+func TestElector_ReleaseHandsOverImmediately(t *testing.T) {
+	db := newTestDB(t)
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	ctx := context.Background()
+
+	a := newTestElector(db, "pod-a", clock)
+	b := newTestElector(db, "pod-b", clock)
+
+	a.tick(ctx)
+	require.True(t, a.IsLeader())
+
+	require.NoError(t, a.Release(ctx))
+	assert.False(t, a.IsLeader())
+
+	clock.Advance(time.Millisecond)
+	b.tick(ctx)
+	token, _, ok := b.Lease()
+	require.True(t, ok)
+	assert.Equal(t, int64(2), token)
+}
+
+// fencedRecord - запись, которую делает задача лидера
+type fencedRecord struct {
+	ID    uint `gorm:"primaryKey"`
+	Value string
+}
+
+func TestElector_FencingRejectsWritesOfDeposedLeader(t *testing.T) {
+	db := newTestDB(t)
+	require.NoError(t, db.AutoMigrate(&fencedRecord{}))
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	ctx := context.Background()
+
+	a := newTestElector(db, "pod-a", clock)
+	b := newTestElector(db, "pod-b", clock)
+	require.NoError(t, a.RegisterFencing(db))
+
+	a.tick(ctx)
+	token, _, ok := a.Lease()
+	require.True(t, ok)
+	jobCtx := WithFencingToken(ctx, token)
+
+	// Пока аренда действует, задача пишет как обычно
+	record := &fencedRecord{Value: "before"}
+	require.NoError(t, db.WithContext(jobCtx).Create(record).Error)
+
+	// Во время выполнения задачи лидером стала другая реплика, а pod-a об этом еще не знает
+	clock.Advance(16 * time.Second)
+	b.tick(ctx)
+	_, _, ok = b.Lease()
+	require.True(t, ok)
+
+	assert.ErrorIs(t, db.WithContext(jobCtx).Create(&fencedRecord{Value: "stale"}).Error, ErrNotLeader)
+	assert.ErrorIs(t, db.WithContext(jobCtx).Model(record).Update("value", "stale").Error, ErrNotLeader)
+	assert.ErrorIs(t, db.WithContext(jobCtx).Delete(record).Error, ErrNotLeader)
+	err := db.WithContext(jobCtx).Transaction(func(tx *gorm.DB) error {
+		return tx.Model(&fencedRecord{}).Where("id = ?", record.ID).Update("value", "stale").Error
+	})
+	assert.ErrorIs(t, err, ErrNotLeader)
+
+	var records []fencedRecord
+	require.NoError(t, db.Find(&records).Error)
+	require.Len(t, records, 1)
+	assert.Equal(t, "before", records[0].Value)
+
+	// Записи без токена (запросы API, ручной запуск задач) проверка не затрагивает
+	require.NoError(t, db.WithContext(ctx).Model(record).Update("value", "manual").Error)
+}
@@ -17,6 +17,9 @@ type Client struct {
 	baseURL    string
 	apiKey     string
 	httpClient *http.Client
+	// streamClient используется для потоковых ответов: общий таймаут обрезал бы
+	// длинную генерацию, поэтому ограничено только ожидание заголовков ответа
+	streamClient *http.Client
 }
 
 type LiteLLMModel struct {
@@ -112,13 +115,14 @@ type LiteLLMBudgetUpdateRequest struct {
 }
 
 type LiteLLMKeyRequest struct {
-	KeyAlias  string                 `json:"key_alias,omitempty"`
-	TeamID    string                 `json:"team_id,omitempty"`
-	UserID    string                 `json:"user_id,omitempty"`
-	MaxBudget *float64               `json:"max_budget,omitempty"`
-	ExpiresAt *time.Time             `json:"expires,omitempty"`
-	Models    []string               `json:"models,omitempty"`
-	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	KeyAlias       string                 `json:"key_alias,omitempty"`
+	TeamID         string                 `json:"team_id,omitempty"`
+	UserID         string                 `json:"user_id,omitempty"`
+	MaxBudget      *float64               `json:"max_budget,omitempty"`
+	BudgetDuration string                 `json:"budget_duration,omitempty"`
+	ExpiresAt      *time.Time             `json:"expires,omitempty"`
+	Models         []string               `json:"models,omitempty"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
 }
 
 type LiteLLMKeyResponse struct {
@@ -196,6 +200,12 @@ func NewClient(cfg *config.LiteLLMConfig) *Client {
 		httpClient: &http.Client{
 			Timeout: cfg.Timeout,
 		},
+		streamClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				ResponseHeaderTimeout: cfg.Timeout,
+			},
+		},
 	}
 }
 
@@ -418,6 +428,116 @@ func (c *Client) DeleteBudget(ctx context.Context, budgetID string) error {
 	return nil
 }
 
+// LiteLLMTeamMember - участник команды LiteLLM. role - "admin" или "user"
+type LiteLLMTeamMember struct {
+	UserID string `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// LiteLLMTeamRequest - параметры команды LiteLLM
+type LiteLLMTeamRequest struct {
+	TeamID           string              `json:"team_id"`
+	TeamAlias        string              `json:"team_alias,omitempty"`
+	MembersWithRoles []LiteLLMTeamMember `json:"members_with_roles,omitempty"`
+	Metadata         map[string]string   `json:"metadata,omitempty"`
+}
+
+// Методы для работы с командами
+func (c *Client) CreateTeam(ctx context.Context, teamReq *LiteLLMTeamRequest) error {
+	req, err := c.newRequest(ctx, "POST", "/team/new", teamReq)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err := c.doRequest(req, nil); err != nil {
+		return fmt.Errorf("failed to create team: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) UpdateTeam(ctx context.Context, teamReq *LiteLLMTeamRequest) error {
+	req, err := c.newRequest(ctx, "POST", "/team/update", teamReq)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err := c.doRequest(req, nil); err != nil {
+		return fmt.Errorf("failed to update team: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) DeleteTeam(ctx context.Context, teamID string) error {
+	reqBody := map[string]interface{}{"team_ids": []string{teamID}}
+	req, err := c.newRequest(ctx, "POST", "/team/delete", reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err := c.doRequest(req, nil); err != nil {
+		return fmt.Errorf("failed to delete team: %w", err)
+	}
+
+	return nil
+}
+
+// AddTeamMember добавляет участника в команду LiteLLM
+func (c *Client) AddTeamMember(ctx context.Context, teamID string, member LiteLLMTeamMember) error {
+	reqBody := map[string]interface{}{
+		"team_id": teamID,
+		"member":  member,
+	}
+	req, err := c.newRequest(ctx, "POST", "/team/member_add", reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err := c.doRequest(req, nil); err != nil {
+		return fmt.Errorf("failed to add team member: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateTeamMember меняет роль участника команды LiteLLM
+func (c *Client) UpdateTeamMember(ctx context.Context, teamID string, member LiteLLMTeamMember) error {
+	reqBody := map[string]interface{}{
+		"team_id": teamID,
+		"user_id": member.UserID,
+		"role":    member.Role,
+	}
+	req, err := c.newRequest(ctx, "POST", "/team/member_update", reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err := c.doRequest(req, nil); err != nil {
+		return fmt.Errorf("failed to update team member: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveTeamMember удаляет участника из команды LiteLLM
+func (c *Client) RemoveTeamMember(ctx context.Context, teamID, userID string) error {
+	reqBody := map[string]string{
+		"team_id": teamID,
+		"user_id": userID,
+	}
+	req, err := c.newRequest(ctx, "POST", "/team/member_delete", reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err := c.doRequest(req, nil); err != nil {
+		return fmt.Errorf("failed to remove team member: %w", err)
+	}
+
+	return nil
+}
+
 // Существующие методы
 func (c *Client) CreateKey(ctx context.Context, keyReq *LiteLLMKeyRequest) (*LiteLLMKeyResponse, error) {
 	req, err := c.newRequest(ctx, "POST", "/key/generate", keyReq)
@@ -743,6 +863,9 @@ func (c *Client) UpdateKey(ctx context.Context, keyID string, keyReq *LiteLLMKey
 	if keyReq.MaxBudget != nil {
 		reqBody["max_budget"] = *keyReq.MaxBudget
 	}
+	if keyReq.BudgetDuration != "" {
+		reqBody["budget_duration"] = keyReq.BudgetDuration
+	}
 	if keyReq.ExpiresAt != nil {
 		reqBody["expires"] = keyReq.ExpiresAt
 	}
@@ -765,6 +888,30 @@ func (c *Client) UpdateKey(ctx context.Context, keyID string, keyReq *LiteLLMKey
 	return nil
 }
 
+// UpdateKeyBudget задает лимит трат ключа в LiteLLM. maxBudget = nil снимает лимит.
+func (c *Client) UpdateKeyBudget(ctx context.Context, keyID string, maxBudget *float64, budgetDuration string) error {
+	reqBody := map[string]interface{}{
+		"key":        keyID,
+		"max_budget": maxBudget,
+	}
+	if budgetDuration != "" {
+		reqBody["budget_duration"] = budgetDuration
+	} else {
+		reqBody["budget_duration"] = nil
+	}
+
+	req, err := c.newRequest(ctx, "POST", "/key/update", reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err := c.doRequest(req, nil); err != nil {
+		return fmt.Errorf("failed to update key budget: %w", err)
+	}
+
+	return nil
+}
+
 // GetGlobalSpend получает глобальные расходы из LiteLLM
 func (c *Client) GetGlobalSpend(ctx context.Context) (*LiteLLMGlobalSpend, error) {
 	req, err := c.newRequest(ctx, "GET", "/global/spend", nil)
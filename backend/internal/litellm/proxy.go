@@ -0,0 +1,73 @@
+package litellm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ProxyResponse - сырой ответ LiteLLM для передачи клиенту шлюза
+type ProxyResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// ChatCompletion проксирует запрос /v1/chat/completions в LiteLLM.
+// apiKey - ключ пользователя в LiteLLM; если пустой, используется мастер-ключ клиента.
+func (c *Client) ChatCompletion(ctx context.Context, apiKey string, body []byte) (*ProxyResponse, error) {
+	req, err := c.newProxyRequest(ctx, "/v1/chat/completions", apiKey, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return &ProxyResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       respBody,
+	}, nil
+}
+
+// ChatCompletionStream открывает потоковый запрос /v1/chat/completions.
+// Вызывающая сторона обязана закрыть тело ответа.
+func (c *Client) ChatCompletionStream(ctx context.Context, apiKey string, body []byte) (*http.Response, error) {
+	req, err := c.newProxyRequest(ctx, "/v1/chat/completions", apiKey, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.streamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (c *Client) newProxyRequest(ctx context.Context, endpoint, apiKey string, body []byte) (*http.Request, error) {
+	req, err := c.newRequest(ctx, "POST", endpoint, json.RawMessage(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("x-litellm-api-key", apiKey)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,82 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Драйверы отправки почты
+const (
+	DriverSMTP = "smtp"
+	DriverFile = "file"
+	DriverLog  = "log"
+)
+
+// Message - письмо с текстовым телом
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Sender отправляет письма. Реализации: SMTP, файлы (локальная разработка) и лог
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// LogSender пишет письма в лог целиком, чтобы ссылки из писем можно было открыть при разработке
+type LogSender struct{}
+
+func NewLogSender() *LogSender {
+	return &LogSender{}
+}
+
+func (s *LogSender) Send(ctx context.Context, msg *Message) error {
+	log.Printf("Mail to <%s>: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
+
+// FileSender сохраняет каждое письмо в отдельный .eml файл каталога dir
+type FileSender struct {
+	dir  string
+	from string
+}
+
+func NewFileSender(dir, from string) *FileSender {
+	return &FileSender{dir: dir, from: from}
+}
+
+func (s *FileSender) Send(ctx context.Context, msg *Message) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102-150405"), uuid.New().String()[:8])
+	path := filepath.Join(s.dir, name)
+	if err := os.WriteFile(path, format(s.from, msg), 0o644); err != nil {
+		return fmt.Errorf("failed to write mail file: %w", err)
+	}
+
+	log.Printf("Mail to <%s> saved to %s", msg.To, path)
+	return nil
+}
+
+// format собирает письмо в формате RFC 5322
+func format(from string, msg *Message) []byte {
+	return []byte(strings.Join([]string{
+		"From: " + from,
+		"To: " + msg.To,
+		"Subject: " + msg.Subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		msg.Text,
+	}, "\r\n"))
+}
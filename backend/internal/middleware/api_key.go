@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/repository"
+)
+
+type ApiKeyMiddleware struct {
+	apiKeyRepo repository.ApiKeyRepository
+}
+
+func NewApiKeyMiddleware(apiKeyRepo repository.ApiKeyRepository) *ApiKeyMiddleware {
+	return &ApiKeyMiddleware{
+		apiKeyRepo: apiKeyRepo,
+	}
+}
+
+// RequireApiKey проверяет API ключ хаба из заголовка Authorization: Bearer sk-... или x-api-key.
+// Ошибки возвращаются в формате OpenAI API, так как middleware используется для программных клиентов.
+func (m *ApiKeyMiddleware) RequireApiKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := extractApiKey(c)
+		if key == "" {
+			abortWithApiKeyError(c, http.StatusUnauthorized, "missing_api_key",
+				"You didn't provide an API key. Use the Authorization: Bearer header or the x-api-key header")
+			return
+		}
+
+		keyHash := fmt.Sprintf("%x", sha256.Sum256([]byte(key)))
+
+		apiKey, err := m.apiKeyRepo.GetByKeyHash(c.Request.Context(), keyHash)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				abortWithApiKeyError(c, http.StatusUnauthorized, "invalid_api_key", "Incorrect API key provided")
+				return
+			}
+			fmt.Printf("ERROR: failed to look up API key: %v\n", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"message": "Internal server error",
+					"type":    "api_error",
+					"code":    "internal_error",
+				},
+			})
+			return
+		}
+
+		if apiKey.RevokedAt != nil {
+			abortWithApiKeyError(c, http.StatusUnauthorized, "revoked_api_key", "The API key provided has been revoked")
+			return
+		}
+
+		if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(time.Now()) {
+			abortWithApiKeyError(c, http.StatusUnauthorized, "expired_api_key", "The API key provided has expired")
+			return
+		}
+
+		if apiKey.User == nil {
+			abortWithApiKeyError(c, http.StatusUnauthorized, "invalid_api_key", "Incorrect API key provided")
+			return
+		}
+
+		scopes := apiKey.Scopes()
+
+		if len(scopes.CIDRs) > 0 && !ipAllowed(c.ClientIP(), scopes.CIDRs) {
+			abortWithApiKeyError(c, http.StatusForbidden, "ip_not_allowed",
+				fmt.Sprintf("The API key cannot be used from IP address %s", c.ClientIP()))
+			return
+		}
+
+		// Ключ только для чтения не может выполнять вызовы моделей
+		if scopes.Permission == domain.ApiKeyPermissionReadOnly &&
+			c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			abortWithApiKeyError(c, http.StatusForbidden, "insufficient_permissions",
+				"The API key is read-only and cannot be used for inference")
+			return
+		}
+
+		// Сохраняем информацию о ключе и его владельце в контексте
+		c.Set("user_id", apiKey.UserID)
+		c.Set("user_email", apiKey.User.Email)
+		c.Set("user_role", apiKey.User.Role)
+		c.Set("tier_id", apiKey.EffectiveTierID())
+		c.Set("api_key_id", apiKey.ID)
+		c.Set("api_key", apiKey)
+
+		c.Next()
+	}
+}
+
+// extractApiKey извлекает ключ из заголовков запроса. x-api-key имеет приоритет,
+// так как некоторые SDK передают в Authorization собственные токены.
+func extractApiKey(c *gin.Context) string {
+	if key := strings.TrimSpace(c.GetHeader("x-api-key")); key != "" {
+		return key
+	}
+
+	authHeader := c.GetHeader("Authorization")
+	tokenParts := strings.Split(authHeader, " ")
+	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+		return ""
+	}
+
+	return strings.TrimSpace(tokenParts[1])
+}
+
+// ipAllowed проверяет, что адрес клиента входит в одну из разрешенных подсетей
+func ipAllowed(clientIP string, cidrs []string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func abortWithApiKeyError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    "invalid_request_error",
+			"code":    code,
+		},
+	})
+}
+
+// GetApiKey извлекает API ключ, которым авторизован запрос
+func GetApiKey(c *gin.Context) (*domain.ApiKey, bool) {
+	value, exists := c.Get("api_key")
+	if !exists {
+		return nil, false
+	}
+
+	apiKey, ok := value.(*domain.ApiKey)
+	return apiKey, ok
+}
+
+// GetApiKeyID извлекает ID API ключа из контекста
+func GetApiKeyID(c *gin.Context) (string, bool) {
+	value, exists := c.Get("api_key_id")
+	if !exists {
+		return "", false
+	}
+
+	id, ok := value.(string)
+	return id, ok
+}
+
+// GetTierID извлекает ID тарифа пользователя из контекста
+func GetTierID(c *gin.Context) (string, bool) {
+	value, exists := c.Get("tier_id")
+	if !exists {
+		return "", false
+	}
+
+	id, ok := value.(string)
+	return id, ok
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/repository"
+)
+
+// stubApiKeyRepository возвращает один ключ по его хэшу
+type stubApiKeyRepository struct {
+	repository.ApiKeyRepository
+	key *domain.ApiKey
+}
+
+func (r *stubApiKeyRepository) GetByKeyHash(ctx context.Context, keyHash string) (*domain.ApiKey, error) {
+	if r.key.KeyHash != keyHash {
+		return nil, repository.ErrNotFound
+	}
+	return r.key, nil
+}
+
+func TestRequireApiKey_AllowedCIDRsIgnoreSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const rawKey = "sk-test-key"
+	apiKey := &domain.ApiKey{
+		ID:      "key-1",
+		UserID:  "user-1",
+		KeyHash: fmt.Sprintf("%x", sha256.Sum256([]byte(rawKey))),
+		User:    &domain.User{ID: "user-1", Email: "user@example.com"},
+	}
+	apiKey.SetScopes(domain.ApiKeyScopes{CIDRs: []string{"10.0.0.0/8"}})
+	middleware := NewApiKeyMiddleware(&stubApiKeyRepository{key: apiKey})
+
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		forwardedFor   string
+		expectedStatus int
+	}{
+		{
+			name:           "spoofed header from untrusted peer",
+			remoteAddr:     "203.0.113.5:40000",
+			forwardedFor:   "10.1.2.3",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "direct connection from allowed subnet",
+			remoteAddr:     "10.1.2.3:40000",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "header from trusted proxy",
+			trustedProxies: []string{"192.0.2.1"},
+			remoteAddr:     "192.0.2.1:40000",
+			forwardedFor:   "10.1.2.3",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "trusted proxy forwards disallowed client",
+			trustedProxies: []string{"192.0.2.1"},
+			remoteAddr:     "192.0.2.1:40000",
+			forwardedFor:   "203.0.113.5",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Движок настраивается так же, как в routes.SetupRoutes и main
+			router := gin.New()
+			require.NoError(t, router.SetTrustedProxies(tt.trustedProxies))
+			router.GET("/v1/models", middleware.RequireApiKey(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("Authorization", "Bearer "+rawKey)
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
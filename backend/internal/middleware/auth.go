@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
@@ -10,14 +11,29 @@ import (
 	"oneui-hub/pkg/auth"
 )
 
+// SessionChecker проверяет, что сессия, в которой выдан токен, не отозвана
+type SessionChecker interface {
+	IsSessionActive(ctx context.Context, sessionID string) (bool, error)
+}
+
 type AuthMiddleware struct {
 	jwtManager *auth.JWTManager
+	sessions   SessionChecker
 }
 
-func NewAuthMiddleware(jwtManager *auth.JWTManager) *AuthMiddleware {
+func NewAuthMiddleware(jwtManager *auth.JWTManager, sessions SessionChecker) *AuthMiddleware {
 	return &AuthMiddleware{
 		jwtManager: jwtManager,
+		sessions:   sessions,
+	}
+}
+
+// sessionActive сообщает, что сессия токена не отозвана. Токены вне сессии проверяются только по сроку действия
+func (m *AuthMiddleware) sessionActive(c *gin.Context, claims *auth.Claims) (bool, error) {
+	if m.sessions == nil || claims.SessionID == "" {
+		return true, nil
 	}
+	return m.sessions.IsSessionActive(c.Request.Context(), claims.SessionID)
 }
 
 // RequireAuth проверяет наличие и валидность JWT токена
@@ -46,6 +62,18 @@ func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 			return
 		}
 
+		active, err := m.sessionActive(c, claims)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check session"})
+			c.Abort()
+			return
+		}
+		if !active {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session revoked"})
+			c.Abort()
+			return
+		}
+
 		// Сохраняем информацию о пользователе в контексте
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
@@ -112,6 +140,10 @@ func (m *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 			c.Next()
 			return
 		}
+		if active, err := m.sessionActive(c, claims); err != nil || !active {
+			c.Next()
+			return
+		}
 
 		// Сохраняем информацию о пользователе в контексте
 		c.Set("user_id", claims.UserID)
@@ -0,0 +1,28 @@
+package notification
+
+import (
+	"context"
+
+	"oneui-hub/internal/mail"
+)
+
+// EmailNotifier отправляет уведомления письмом через настроенный mail.Sender
+type EmailNotifier struct {
+	sender mail.Sender
+}
+
+func NewEmailNotifier(sender mail.Sender) *EmailNotifier {
+	return &EmailNotifier{sender: sender}
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, notification *Notification) error {
+	if notification.Email == "" {
+		return nil
+	}
+
+	return n.sender.Send(ctx, &mail.Message{
+		To:      notification.Email,
+		Subject: notification.Subject,
+		Text:    notification.Text,
+	})
+}
@@ -0,0 +1,64 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// Типы событий, о которых уведомляется пользователь
+const (
+	EventApiKeyExpiring         = "api_key.expiring"
+	EventApiKeyRevoked          = "api_key.revoked"
+	EventTierChanged            = "tier.changed"
+	EventTierDowngradeScheduled = "tier.downgrade_scheduled"
+	EventBudgetThreshold        = "budget.threshold"
+)
+
+// Notification - уведомление пользователю
+type Notification struct {
+	Event     string                 `json:"event"`
+	UserID    string                 `json:"user_id"`
+	Email     string                 `json:"email"`
+	Subject   string                 `json:"subject"`
+	Text      string                 `json:"text"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// Notifier доставляет уведомления пользователям
+type Notifier interface {
+	Notify(ctx context.Context, n *Notification) error
+}
+
+// LogNotifier пишет уведомления в лог. Используется, когда доставка не настроена.
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, notification *Notification) error {
+	log.Printf("Notification %s for user %s <%s>: %s", notification.Event, notification.UserID, notification.Email, notification.Subject)
+	return nil
+}
+
+// MultiNotifier отправляет уведомление через все настроенные каналы
+type MultiNotifier struct {
+	notifiers []Notifier
+}
+
+func NewMultiNotifier(notifiers ...Notifier) *MultiNotifier {
+	return &MultiNotifier{notifiers: notifiers}
+}
+
+func (m *MultiNotifier) Notify(ctx context.Context, n *Notification) error {
+	var errs []error
+	for _, notifier := range m.notifiers {
+		if err := notifier.Notify(ctx, n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
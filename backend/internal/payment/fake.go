@@ -0,0 +1,202 @@
+package payment
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FakeServer - локальный провайдер платежей для разработки и тестов. Он создает сессии оплаты
+// через тот же API, что и HTTPProvider, а оплату, возврат и чарджбэк выполняет по запросу,
+// отправляя подписанный вебхук на webhookURL:
+//
+//	POST /v1/checkout/sessions/{id}/complete?status=succeeded|failed
+//	POST /v1/checkout/sessions/{id}/refund?amount=<центы, по умолчанию вся сумма>
+//	POST /v1/checkout/sessions/{id}/chargeback
+type FakeServer struct {
+	apiKey        string
+	webhookSecret string
+	webhookURL    string
+	// BaseURL - адрес сервера для ссылок на страницу оплаты
+	BaseURL string
+
+	mu       sync.Mutex
+	sessions map[string]*fakeSession
+	// byReference - сессии по ключу идемпотентности
+	byReference map[string]*fakeSession
+	mux         *http.ServeMux
+	httpClient  *http.Client
+}
+
+type fakeSession struct {
+	ID        string
+	PaymentID string
+	Reference string
+	Amount    int64
+	Currency  string
+}
+
+func NewFakeServer(apiKey, webhookSecret, webhookURL string) *FakeServer {
+	s := &FakeServer{
+		apiKey:        apiKey,
+		webhookSecret: webhookSecret,
+		webhookURL:    webhookURL,
+		sessions:      map[string]*fakeSession{},
+		byReference:   map[string]*fakeSession{},
+		mux:           http.NewServeMux(),
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+	}
+	s.mux.HandleFunc("POST /v1/checkout/sessions", s.createSession)
+	s.mux.HandleFunc("POST /v1/checkout/sessions/{id}/{action}", s.sessionAction)
+	s.mux.HandleFunc("GET /checkout/{id}", s.checkoutPage)
+	return s
+}
+
+// SetWebhookURL меняет адрес доставки вебхуков
+func (s *FakeServer) SetWebhookURL(url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhookURL = url
+}
+
+func (s *FakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *FakeServer) createSession(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+s.apiKey {
+		http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req checkoutSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Reference == "" || req.Amount <= 0 {
+		http.Error(w, `{"error":"invalid checkout request"}`, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	session, ok := s.byReference[r.Header.Get("Idempotency-Key")]
+	if !ok {
+		session = &fakeSession{
+			ID:        "cs_" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+			PaymentID: "pi_" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+			Reference: req.Reference,
+			Amount:    req.Amount,
+			Currency:  req.Currency,
+		}
+		s.sessions[session.ID] = session
+		if key := r.Header.Get("Idempotency-Key"); key != "" {
+			s.byReference[key] = session
+		}
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&checkoutSessionResponse{ID: session.ID, URL: s.BaseURL + "/checkout/" + session.ID})
+}
+
+func (s *FakeServer) checkoutPage(w http.ResponseWriter, r *http.Request) {
+	session := s.session(r.PathValue("id"))
+	if session == nil {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprintf(w, "Fake checkout %s: %.2f %s. POST /v1/checkout/sessions/%s/complete to pay.\n",
+		session.ID, fromMinorUnits(session.Amount), strings.ToUpper(session.Currency), session.ID)
+}
+
+func (s *FakeServer) sessionAction(w http.ResponseWriter, r *http.Request) {
+	session := s.session(r.PathValue("id"))
+	if session == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	eventType, objectID, amount := "", session.PaymentID, session.Amount
+	switch r.PathValue("action") {
+	case "complete":
+		eventType = EventPaymentSucceeded
+		if r.URL.Query().Get("status") == "failed" {
+			eventType = EventPaymentFailed
+		}
+	case "refund":
+		eventType = EventRefundSucceeded
+		objectID = "re_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+		if value := r.URL.Query().Get("amount"); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed <= 0 {
+				http.Error(w, `{"error":"invalid amount"}`, http.StatusBadRequest)
+				return
+			}
+			amount = parsed
+		}
+	case "chargeback":
+		eventType = EventChargebackCreated
+		objectID = "dp_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	status, err := s.deliver(eventType, objectID, session, amount)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"event_type": eventType, "webhook_status": status})
+}
+
+func (s *FakeServer) session(id string) *fakeSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[id]
+}
+
+// deliver отправляет подписанный вебхук и возвращает код ответа хаба
+func (s *FakeServer) deliver(eventType, objectID string, session *fakeSession, amount int64) (int, error) {
+	var event webhookEvent
+	event.ID = "evt_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	event.Type = eventType
+	event.Created = time.Now().Unix()
+	event.Data.ID = objectID
+	event.Data.SessionID = session.ID
+	event.Data.Reference = session.Reference
+	event.Data.Amount = amount
+	event.Data.Currency = session.Currency
+
+	payload, err := json.Marshal(&event)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	webhookURL := s.webhookURL
+	s.mu.Unlock()
+
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(s.webhookSecret, time.Now(), payload))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,154 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPProvider работает с провайдером по REST API с hosted checkout: хаб создает сессию оплаты,
+// пользователь платит на странице провайдера, результат приходит подписанным вебхуком.
+// Суммы в API передаются в минимальных единицах валюты (центах)
+type HTTPProvider struct {
+	name          string
+	baseURL       string
+	apiKey        string
+	webhookSecret string
+	// tolerance - допустимое расхождение времени подписи вебхука
+	tolerance  time.Duration
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+func NewHTTPProvider(name, baseURL, apiKey, webhookSecret string, tolerance time.Duration) *HTTPProvider {
+	return &HTTPProvider{
+		name:          name,
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		apiKey:        apiKey,
+		webhookSecret: webhookSecret,
+		tolerance:     tolerance,
+		httpClient: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+		now: time.Now,
+	}
+}
+
+// checkoutSessionRequest - тело запроса создания сессии оплаты
+type checkoutSessionRequest struct {
+	Reference     string `json:"reference"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+	CustomerEmail string `json:"customer_email,omitempty"`
+	SuccessURL    string `json:"success_url,omitempty"`
+	CancelURL     string `json:"cancel_url,omitempty"`
+}
+
+type checkoutSessionResponse struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// webhookEvent - тело вебхука провайдера
+type webhookEvent struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		ID        string `json:"id"`
+		SessionID string `json:"session_id"`
+		Reference string `json:"reference"`
+		Amount    int64  `json:"amount"`
+		Currency  string `json:"currency"`
+	} `json:"data"`
+}
+
+func (p *HTTPProvider) Name() string {
+	return p.name
+}
+
+func (p *HTTPProvider) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*CheckoutSession, error) {
+	body, err := json.Marshal(&checkoutSessionRequest{
+		Reference:     req.Reference,
+		Amount:        toMinorUnits(req.Amount),
+		Currency:      strings.ToLower(req.Currency),
+		CustomerEmail: req.Email,
+		SuccessURL:    req.SuccessURL,
+		CancelURL:     req.CancelURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal checkout request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/v1/checkout/sessions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkout request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	// Повтор запроса с тем же платежом не создает вторую сессию
+	httpReq.Header.Set("Idempotency-Key", req.Reference)
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkout session: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkout response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("payment provider returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var session checkoutSessionResponse
+	if err := json.Unmarshal(respBody, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse checkout response: %w", err)
+	}
+	if session.ID == "" || session.URL == "" {
+		return nil, fmt.Errorf("payment provider returned incomplete checkout session")
+	}
+
+	return &CheckoutSession{ID: session.ID, URL: session.URL}, nil
+}
+
+func (p *HTTPProvider) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	if err := VerifySignature(p.webhookSecret, header.Get(SignatureHeader), payload, p.tolerance, p.now()); err != nil {
+		return nil, err
+	}
+
+	var raw webhookEvent
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if raw.ID == "" || raw.Type == "" {
+		return nil, fmt.Errorf("%w: id and type are required", ErrInvalidEvent)
+	}
+
+	return &Event{
+		ID:        raw.ID,
+		Type:      raw.Type,
+		ObjectID:  raw.Data.ID,
+		SessionID: raw.Data.SessionID,
+		Reference: raw.Data.Reference,
+		Amount:    fromMinorUnits(raw.Data.Amount),
+		Currency:  strings.ToUpper(raw.Data.Currency),
+		CreatedAt: time.Unix(raw.Created, 0).UTC(),
+	}, nil
+}
+
+func toMinorUnits(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func fromMinorUnits(amount int64) float64 {
+	return float64(amount) / 100
+}
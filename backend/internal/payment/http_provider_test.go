@@ -0,0 +1,82 @@
+package payment
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPProvider_CheckoutAndWebhooks(t *testing.T) {
+	provider := NewHTTPProvider("fake", "", "sk_test", "whsec_test", 5*time.Minute)
+
+	events := make(chan *Event, 4)
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		event, err := provider.ParseWebhook(payload, r.Header)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		events <- event
+	}))
+	t.Cleanup(hub.Close)
+
+	fake := NewFakeServer("sk_test", "whsec_test", hub.URL)
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	fake.BaseURL = server.URL
+	provider.baseURL = server.URL
+
+	ctx := context.Background()
+	session, err := provider.CreateCheckout(ctx, &CheckoutRequest{Reference: "payment-1", Amount: 25.5, Currency: "USD"})
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/checkout/"+session.ID, session.URL)
+
+	// Повтор с тем же платежом возвращает ту же сессию
+	again, err := provider.CreateCheckout(ctx, &CheckoutRequest{Reference: "payment-1", Amount: 25.5, Currency: "USD"})
+	require.NoError(t, err)
+	assert.Equal(t, session.ID, again.ID)
+
+	resp, err := http.Post(server.URL+"/v1/checkout/sessions/"+session.ID+"/complete", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	event := <-events
+	assert.Equal(t, EventPaymentSucceeded, event.Type)
+	assert.Equal(t, "payment-1", event.Reference)
+	assert.Equal(t, session.ID, event.SessionID)
+	assert.Equal(t, 25.5, event.Amount)
+	assert.Equal(t, "USD", event.Currency)
+
+	resp, err = http.Post(server.URL+"/v1/checkout/sessions/"+session.ID+"/refund?amount=550", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	event = <-events
+	assert.Equal(t, EventRefundSucceeded, event.Type)
+	assert.Equal(t, 5.5, event.Amount)
+
+	// Ключ API проверяется
+	provider.apiKey = "wrong"
+	_, err = provider.CreateCheckout(ctx, &CheckoutRequest{Reference: "payment-2", Amount: 10, Currency: "USD"})
+	assert.Error(t, err)
+}
+
+func TestVerifySignature(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","type":"payment.succeeded"}`)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	header := Sign("secret", now, payload)
+
+	assert.NoError(t, VerifySignature("secret", header, payload, 5*time.Minute, now.Add(time.Minute)))
+	// Несколько подписей при смене секрета
+	assert.NoError(t, VerifySignature("secret", "v1=deadbeef,"+header, payload, 5*time.Minute, now))
+
+	assert.ErrorIs(t, VerifySignature("other", header, payload, 5*time.Minute, now), ErrInvalidSignature)
+	assert.ErrorIs(t, VerifySignature("secret", header, []byte(`{"id":"evt_1","type":"refund.succeeded"}`), 5*time.Minute, now), ErrInvalidSignature)
+	assert.ErrorIs(t, VerifySignature("secret", header, payload, 5*time.Minute, now.Add(10*time.Minute)), ErrInvalidSignature)
+	assert.ErrorIs(t, VerifySignature("secret", "", payload, 5*time.Minute, now), ErrInvalidSignature)
+}
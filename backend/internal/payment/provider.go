@@ -0,0 +1,121 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Типы событий вебхука, которые обрабатывает хаб
+const (
+	EventPaymentSucceeded  = "payment.succeeded"
+	EventPaymentFailed     = "payment.failed"
+	EventRefundSucceeded   = "refund.succeeded"
+	EventChargebackCreated = "chargeback.created"
+)
+
+// SignatureHeader - заголовок с подписью вебхука в формате "t=<unix время>,v1=<hex HMAC-SHA256>"
+const SignatureHeader = "X-Payment-Signature"
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInvalidEvent     = errors.New("invalid webhook event")
+)
+
+// CheckoutRequest - параметры страницы оплаты
+type CheckoutRequest struct {
+	// Reference - ID платежа в хабе, возвращается в событиях вебхука
+	Reference  string
+	Amount     float64
+	Currency   string
+	Email      string
+	SuccessURL string
+	CancelURL  string
+}
+
+// CheckoutSession - созданная провайдером страница оплаты
+type CheckoutSession struct {
+	ID  string
+	URL string
+}
+
+// Event - проверенное событие вебхука. Amount указан в основных единицах валюты
+type Event struct {
+	ID   string
+	Type string
+	// ObjectID - ID объекта провайдера: платежа, возврата или чарджбэка
+	ObjectID  string
+	SessionID string
+	Reference string
+	Amount    float64
+	Currency  string
+	CreatedAt time.Time
+}
+
+// Provider - провайдер платежей
+type Provider interface {
+	Name() string
+	CreateCheckout(ctx context.Context, req *CheckoutRequest) (*CheckoutSession, error)
+	// ParseWebhook проверяет подпись вебхука и разбирает событие
+	ParseWebhook(payload []byte, header http.Header) (*Event, error)
+}
+
+// Sign возвращает значение заголовка подписи для тела вебхука
+func Sign(secret string, timestamp time.Time, payload []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, computeSignature(secret, ts, payload))
+}
+
+// VerifySignature проверяет подпись вебхука. Подписи старше tolerance отклоняются,
+// чтобы перехваченный вебхук нельзя было отправить повторно
+func VerifySignature(secret, header string, payload []byte, tolerance time.Duration, now time.Time) error {
+	var ts string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if ts == "" || len(signatures) == 0 {
+		return fmt.Errorf("%w: malformed header", ErrInvalidSignature)
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed timestamp", ErrInvalidSignature)
+	}
+	if age := now.Sub(time.Unix(unix, 0)); tolerance > 0 && (age > tolerance || age < -tolerance) {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+	}
+
+	expected := computeSignature(secret, ts, payload)
+	for _, signature := range signatures {
+		// Во время смены секрета провайдер может передать несколько подписей
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func computeSignature(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
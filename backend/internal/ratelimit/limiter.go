@@ -0,0 +1,284 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Limits - квоты для одного счетчика. Нулевое значение означает отсутствие ограничения.
+type Limits struct {
+	RequestsPerMinute int
+	RequestsPerDay    int
+	TokensPerMinute   int
+	TokensPerDay      int
+}
+
+// IsZero сообщает, что ни одна квота не задана
+func (l Limits) IsZero() bool {
+	return l.RequestsPerMinute <= 0 && l.RequestsPerDay <= 0 && l.TokensPerMinute <= 0 && l.TokensPerDay <= 0
+}
+
+// Decision - результат проверки лимитов для одного запроса
+type Decision struct {
+	Allowed bool
+	// Exceeded - описание нарушенного лимита, например "requests per minute (RPM)"
+	Exceeded   string
+	RetryAfter time.Duration
+
+	// Значения для заголовков x-ratelimit-* по самому строгому окну
+	LimitRequests     int
+	RemainingRequests int
+	ResetRequests     time.Duration
+	LimitTokens       int
+	RemainingTokens   int
+	ResetTokens       time.Duration
+}
+
+// Headers возвращает заголовки в формате OpenAI API
+func (d *Decision) Headers() map[string]string {
+	headers := map[string]string{}
+
+	if d.LimitRequests > 0 {
+		headers["x-ratelimit-limit-requests"] = strconv.Itoa(d.LimitRequests)
+		headers["x-ratelimit-remaining-requests"] = strconv.Itoa(d.RemainingRequests)
+		headers["x-ratelimit-reset-requests"] = formatReset(d.ResetRequests)
+	}
+	if d.LimitTokens > 0 {
+		headers["x-ratelimit-limit-tokens"] = strconv.Itoa(d.LimitTokens)
+		headers["x-ratelimit-remaining-tokens"] = strconv.Itoa(d.RemainingTokens)
+		headers["x-ratelimit-reset-tokens"] = formatReset(d.ResetTokens)
+	}
+	if !d.Allowed {
+		headers["Retry-After"] = strconv.Itoa(int(math.Ceil(d.RetryAfter.Seconds())))
+	}
+
+	return headers
+}
+
+// Reservation - учтенный запрос, токены которого уточняются после ответа
+type Reservation struct {
+	Key    string
+	Tokens int
+	At     time.Time
+}
+
+type dimension struct {
+	name  string
+	label string
+}
+
+var (
+	dimRequests = dimension{name: "requests", label: "requests"}
+	dimTokens   = dimension{name: "tokens", label: "tokens"}
+)
+
+type window struct {
+	name     string
+	duration time.Duration
+}
+
+var (
+	windowMinute = window{name: "minute", duration: time.Minute}
+	windowDay    = window{name: "day", duration: 24 * time.Hour}
+)
+
+// counter - одно ограничение: измерение, окно и квота
+type counter struct {
+	dim    dimension
+	window window
+	limit  int
+	abbr   string
+}
+
+func (l Limits) counters() []counter {
+	all := []counter{
+		{dim: dimRequests, window: windowMinute, limit: l.RequestsPerMinute, abbr: "RPM"},
+		{dim: dimRequests, window: windowDay, limit: l.RequestsPerDay, abbr: "RPD"},
+		{dim: dimTokens, window: windowMinute, limit: l.TokensPerMinute, abbr: "TPM"},
+		{dim: dimTokens, window: windowDay, limit: l.TokensPerDay, abbr: "TPD"},
+	}
+
+	active := make([]counter, 0, len(all))
+	for _, c := range all {
+		if c.limit > 0 {
+			active = append(active, c)
+		}
+	}
+	return active
+}
+
+// Limiter считает запросы и токены в скользящих окнах (минута и сутки).
+// Используется алгоритм sliding window counter: значение предыдущего окна
+// учитывается пропорционально доле, которая еще попадает в скользящее окно.
+type Limiter struct {
+	store Store
+	now   func() time.Time
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// Cleanup удаляет из хранилища окна, которые больше не участвуют в подсчете
+func (l *Limiter) Cleanup(ctx context.Context) error {
+	return l.store.Cleanup(ctx, l.now())
+}
+
+// Acquire учитывает запрос с предварительной оценкой токенов. Если хотя бы один лимит
+// превышен, учет откатывается и возвращается решение с Allowed = false.
+func (l *Limiter) Acquire(ctx context.Context, key string, limits Limits, tokens int) (*Decision, *Reservation, error) {
+	now := l.now()
+	decision := &Decision{Allowed: true}
+	reservation := &Reservation{Key: key, Tokens: tokens, At: now}
+
+	type applied struct {
+		name   string
+		bucket int64
+		window window
+		delta  int64
+	}
+	var increments []applied
+
+	for _, c := range limits.counters() {
+		delta := int64(1)
+		if c.dim == dimTokens {
+			delta = int64(tokens)
+		}
+
+		name := counterName(key, c)
+		bucket, elapsed := bucketAt(now, c.window)
+
+		current, previous, err := l.store.Increment(ctx, name, bucket, delta, expiresAt(bucket, c.window))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to increment rate limit counter: %w", err)
+		}
+		increments = append(increments, applied{name: name, bucket: bucket, window: c.window, delta: delta})
+
+		used := slidingCount(current, previous, elapsed, c.window)
+		remaining := c.limit - int(math.Ceil(used))
+		if remaining < 0 {
+			remaining = 0
+		}
+		reset := c.window.duration - elapsed
+		decision.observe(c, remaining, reset)
+
+		if used > float64(c.limit) && decision.Allowed {
+			decision.Allowed = false
+			decision.Exceeded = fmt.Sprintf("%s per %s (%s): Limit %d, Used %d, Requested %d",
+				c.dim.label, c.window.name, c.abbr, c.limit, int(math.Ceil(used))-int(delta), delta)
+			decision.RetryAfter = retryAfter(current, previous, elapsed, c.window, c.limit)
+		}
+	}
+
+	if !decision.Allowed {
+		for _, inc := range increments {
+			if _, _, err := l.store.Increment(ctx, inc.name, inc.bucket, -inc.delta, expiresAt(inc.bucket, inc.window)); err != nil {
+				return nil, nil, fmt.Errorf("failed to roll back rate limit counter: %w", err)
+			}
+		}
+		return decision, nil, nil
+	}
+
+	return decision, reservation, nil
+}
+
+// Reconcile уточняет количество токенов после получения ответа: разница между
+// фактическим и зарезервированным количеством добавляется в окна момента резервирования
+func (l *Limiter) Reconcile(ctx context.Context, reservation *Reservation, limits Limits, actualTokens int) error {
+	if reservation == nil {
+		return nil
+	}
+
+	delta := int64(actualTokens - reservation.Tokens)
+	if delta == 0 {
+		return nil
+	}
+
+	for _, c := range limits.counters() {
+		if c.dim != dimTokens {
+			continue
+		}
+
+		bucket, _ := bucketAt(reservation.At, c.window)
+		if _, _, err := l.store.Increment(ctx, counterName(reservation.Key, c), bucket, delta, expiresAt(bucket, c.window)); err != nil {
+			return fmt.Errorf("failed to reconcile rate limit counter: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// observe запоминает самое строгое окно для заголовков x-ratelimit-*
+func (d *Decision) observe(c counter, remaining int, reset time.Duration) {
+	switch c.dim {
+	case dimRequests:
+		if d.LimitRequests == 0 || remaining < d.RemainingRequests {
+			d.LimitRequests = c.limit
+			d.RemainingRequests = remaining
+			d.ResetRequests = reset
+		}
+	case dimTokens:
+		if d.LimitTokens == 0 || remaining < d.RemainingTokens {
+			d.LimitTokens = c.limit
+			d.RemainingTokens = remaining
+			d.ResetTokens = reset
+		}
+	}
+}
+
+func counterName(key string, c counter) string {
+	return key + ":" + c.dim.name + ":" + c.window.name
+}
+
+// bucketAt возвращает номер фиксированного окна и время, прошедшее с его начала
+func bucketAt(t time.Time, w window) (int64, time.Duration) {
+	bucket := t.UnixNano() / int64(w.duration)
+	elapsed := time.Duration(t.UnixNano() - bucket*int64(w.duration))
+	return bucket, elapsed
+}
+
+// expiresAt возвращает момент, когда окно перестает быть даже предыдущим
+func expiresAt(bucket int64, w window) time.Time {
+	return time.Unix(0, (bucket+2)*int64(w.duration))
+}
+
+func slidingCount(current, previous int64, elapsed time.Duration, w window) float64 {
+	weight := 1 - float64(elapsed)/float64(w.duration)
+	return float64(previous)*weight + float64(current)
+}
+
+// retryAfter оценивает, через сколько времени значение скользящего окна опустится до лимита
+func retryAfter(current, previous int64, elapsed time.Duration, w window, limit int) time.Duration {
+	untilNextBucket := w.duration - elapsed
+
+	excess := float64(current) + float64(previous)*(1-float64(elapsed)/float64(w.duration)) - float64(limit)
+	if previous > 0 {
+		wait := time.Duration(excess / float64(previous) * float64(w.duration))
+		if wait <= untilNextBucket {
+			return maxDuration(wait, time.Second)
+		}
+	}
+
+	return maxDuration(untilNextBucket, time.Second)
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// formatReset форматирует время сброса как в OpenAI: "1s", "6m0s", "120ms"
+func formatReset(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,200 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"oneui-hub/internal/domain"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter() (*Limiter, *fakeClock) {
+	return newTestLimiterWithStore(NewMemoryStore())
+}
+
+func newTestLimiterWithStore(store Store) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := NewLimiter(store)
+	limiter.now = clock.Now
+	return limiter, clock
+}
+
+func newTestSQLStore(t *testing.T) *SQLStore {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	// Каждое соединение с :memory: открывает отдельную БД
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	require.NoError(t, db.AutoMigrate(&domain.RateLimitCounter{}))
+	return NewSQLStore(db)
+}
+
+func TestLimiter_RequestsPerMinute(t *testing.T) {
+	limiter, clock := newTestLimiter()
+	ctx := context.Background()
+	limits := Limits{RequestsPerMinute: 2}
+
+	for i := 0; i < 2; i++ {
+		decision, reservation, err := limiter.Acquire(ctx, "user-1", limits, 0)
+		require.NoError(t, err)
+		assert.True(t, decision.Allowed)
+		assert.NotNil(t, reservation)
+	}
+
+	decision, reservation, err := limiter.Acquire(ctx, "user-1", limits, 0)
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Nil(t, reservation)
+	assert.Contains(t, decision.Exceeded, "RPM")
+	assert.Equal(t, 0, decision.RemainingRequests)
+	assert.Equal(t, "60", decision.Headers()["Retry-After"])
+
+	// Другие ключи считаются независимо
+	decision, _, err = limiter.Acquire(ctx, "user-2", limits, 0)
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+
+	// Через полминуты предыдущее окно учитывается наполовину: 2 * 0.5 + 1 <= 2
+	clock.Advance(90 * time.Second)
+	decision, _, err = limiter.Acquire(ctx, "user-1", limits, 0)
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+
+	decision, _, err = limiter.Acquire(ctx, "user-1", limits, 0)
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 30*time.Second, decision.RetryAfter)
+}
+
+func TestLimiter_DeniedRequestIsNotCounted(t *testing.T) {
+	limiter, _ := newTestLimiter()
+	ctx := context.Background()
+	limits := Limits{RequestsPerMinute: 10, TokensPerMinute: 100}
+
+	decision, _, err := limiter.Acquire(ctx, "user-1", limits, 80)
+	require.NoError(t, err)
+	require.True(t, decision.Allowed)
+
+	// Превышение TPM не должно оставить следов в счетчике запросов
+	decision, _, err = limiter.Acquire(ctx, "user-1", limits, 50)
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Contains(t, decision.Exceeded, "TPM")
+
+	decision, _, err = limiter.Acquire(ctx, "user-1", limits, 20)
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, 8, decision.RemainingRequests)
+	assert.Equal(t, 0, decision.RemainingTokens)
+}
+
+func TestLimiter_ReconcileReleasesReservedTokens(t *testing.T) {
+	limiter, _ := newTestLimiter()
+	ctx := context.Background()
+	limits := Limits{TokensPerMinute: 1000, TokensPerDay: 5000}
+
+	decision, reservation, err := limiter.Acquire(ctx, "user-1", limits, 900)
+	require.NoError(t, err)
+	require.True(t, decision.Allowed)
+
+	decision, _, err = limiter.Acquire(ctx, "user-1", limits, 200)
+	require.NoError(t, err)
+	require.False(t, decision.Allowed)
+
+	// Фактически запрос потратил только 100 токенов
+	require.NoError(t, limiter.Reconcile(ctx, reservation, limits, 100))
+
+	decision, _, err = limiter.Acquire(ctx, "user-1", limits, 200)
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, 700, decision.RemainingTokens)
+	assert.Equal(t, 1000, decision.LimitTokens)
+}
+
+func TestDecision_Headers(t *testing.T) {
+	decision := &Decision{
+		Allowed:           true,
+		LimitRequests:     60,
+		RemainingRequests: 59,
+		ResetRequests:     1500 * time.Millisecond,
+		LimitTokens:       1000,
+		RemainingTokens:   900,
+		ResetTokens:       6 * time.Minute,
+	}
+
+	headers := decision.Headers()
+	assert.Equal(t, "60", headers["x-ratelimit-limit-requests"])
+	assert.Equal(t, "59", headers["x-ratelimit-remaining-requests"])
+	assert.Equal(t, "2s", headers["x-ratelimit-reset-requests"])
+	assert.Equal(t, "1000", headers["x-ratelimit-limit-tokens"])
+	assert.Equal(t, "900", headers["x-ratelimit-remaining-tokens"])
+	assert.Equal(t, "6m0s", headers["x-ratelimit-reset-tokens"])
+	assert.NotContains(t, headers, "Retry-After")
+}
+
+func TestSQLStore_Increment(t *testing.T) {
+	store := newTestSQLStore(t)
+	ctx := context.Background()
+	expires := time.Date(2024, 5, 1, 12, 2, 0, 0, time.UTC)
+
+	current, previous, err := store.Increment(ctx, "k", 10, 5, expires)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), current)
+	assert.Equal(t, int64(0), previous)
+
+	current, _, err = store.Increment(ctx, "k", 10, 3, expires)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), current)
+
+	current, previous, err = store.Increment(ctx, "k", 11, -1, expires.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), current)
+	assert.Equal(t, int64(8), previous)
+
+	// Окно 10 истекло, окно 11 еще нет
+	require.NoError(t, store.Cleanup(ctx, expires))
+	var count int64
+	require.NoError(t, store.db.Model(&domain.RateLimitCounter{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestLimiter_SQLStoreSharedBetweenReplicas(t *testing.T) {
+	store := newTestSQLStore(t)
+	ctx := context.Background()
+	limits := Limits{RequestsPerMinute: 3}
+
+	// Две реплики с общей БД делят одну квоту
+	replicaA, _ := newTestLimiterWithStore(store)
+	replicaB, _ := newTestLimiterWithStore(NewSQLStore(store.db))
+
+	for _, limiter := range []*Limiter{replicaA, replicaB, replicaA} {
+		decision, _, err := limiter.Acquire(ctx, "user-1", limits, 0)
+		require.NoError(t, err)
+		assert.True(t, decision.Allowed)
+	}
+
+	decision, _, err := replicaB.Acquire(ctx, "user-1", limits, 0)
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 0, decision.RemainingRequests)
+}
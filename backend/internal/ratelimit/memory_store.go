@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type bucketKey struct {
+	name   string
+	bucket int64
+}
+
+type memoryValue struct {
+	amount    int64
+	expiresAt time.Time
+}
+
+// MemoryStore хранит счетчики в памяти процесса. Подходит для одной реплики и тестов.
+type MemoryStore struct {
+	mu     sync.Mutex
+	values map[bucketKey]*memoryValue
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		values: make(map[bucketKey]*memoryValue),
+	}
+}
+
+func (m *MemoryStore) Increment(ctx context.Context, name string, bucket int64, delta int64, expiresAt time.Time) (int64, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := bucketKey{name: name, bucket: bucket}
+	value, ok := m.values[key]
+	if !ok {
+		value = &memoryValue{}
+		m.values[key] = value
+	}
+	value.amount += delta
+	value.expiresAt = expiresAt
+
+	// Окна старше предыдущего больше не участвуют в подсчете
+	delete(m.values, bucketKey{name: name, bucket: bucket - 2})
+
+	var previous int64
+	if prev, ok := m.values[bucketKey{name: name, bucket: bucket - 1}]; ok {
+		previous = prev.amount
+	}
+
+	return value.amount, previous, nil
+}
+
+func (m *MemoryStore) Cleanup(ctx context.Context, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, value := range m.values {
+		if !value.expiresAt.After(now) {
+			delete(m.values, key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"oneui-hub/internal/domain"
+)
+
+// SQLStore хранит счетчики в таблице rate_limit_counters, общей для всех реплик.
+// Каждое изменение - атомарный upsert строки окна, поэтому квоты соблюдаются
+// в масштабе кластера без отдельного Redis.
+type SQLStore struct {
+	db *gorm.DB
+}
+
+func NewSQLStore(db *gorm.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) Increment(ctx context.Context, name string, bucket int64, delta int64, expiresAt time.Time) (int64, int64, error) {
+	var current, previous int64
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		counter := &domain.RateLimitCounter{
+			CounterKey: name,
+			Bucket:     bucket,
+			Amount:     delta,
+			ExpiresAt:  expiresAt,
+		}
+
+		// INSERT ... ON DUPLICATE KEY UPDATE amount = amount + delta
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "counter_key"}, {Name: "bucket"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"amount":     gorm.Expr("amount + ?", delta),
+				"expires_at": expiresAt,
+			}),
+		}).Create(counter).Error; err != nil {
+			return fmt.Errorf("failed to upsert rate limit counter: %w", err)
+		}
+
+		var rows []domain.RateLimitCounter
+		if err := tx.Where("counter_key = ? AND bucket IN ?", name, []int64{bucket, bucket - 1}).
+			Find(&rows).Error; err != nil {
+			return fmt.Errorf("failed to read rate limit counters: %w", err)
+		}
+
+		for _, row := range rows {
+			if row.Bucket == bucket {
+				current = row.Amount
+			} else {
+				previous = row.Amount
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return current, previous, nil
+}
+
+func (s *SQLStore) Cleanup(ctx context.Context, now time.Time) error {
+	if err := s.db.WithContext(ctx).Where("expires_at <= ?", now).
+		Delete(&domain.RateLimitCounter{}).Error; err != nil {
+		return fmt.Errorf("failed to delete expired rate limit counters: %w", err)
+	}
+	return nil
+}
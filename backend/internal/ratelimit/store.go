@@ -0,0 +1,17 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Store хранит счетчики окон лимитов. Реализация должна выполнять Increment атомарно,
+// чтобы параллельные запросы (в том числе с разных реплик) не теряли обновления.
+type Store interface {
+	// Increment добавляет delta к счетчику name в окне bucket и возвращает
+	// значения текущего и предыдущего окон после изменения.
+	// expiresAt - момент, после которого окно больше не участвует в подсчете.
+	Increment(ctx context.Context, name string, bucket int64, delta int64, expiresAt time.Time) (current int64, previous int64, err error)
+	// Cleanup удаляет окна, истекшие к моменту now
+	Cleanup(ctx context.Context, now time.Time) error
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -45,7 +46,7 @@ func (r *apiKeyRepository) GetByUserID(ctx context.Context, userID string) ([]*d
 
 func (r *apiKeyRepository) GetByKeyHash(ctx context.Context, keyHash string) (*domain.ApiKey, error) {
 	var apiKey domain.ApiKey
-	if err := r.db.WithContext(ctx).Preload("User").First(&apiKey, "key_hash = ?", keyHash).Error; err != nil {
+	if err := r.db.WithContext(ctx).Preload("User").Preload("Team").First(&apiKey, "key_hash = ?", keyHash).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, ErrNotFound
 		}
@@ -54,6 +55,47 @@ func (r *apiKeyRepository) GetByKeyHash(ctx context.Context, keyHash string) (*d
 	return &apiKey, nil
 }
 
+func (r *apiKeyRepository) GetByTeamID(ctx context.Context, teamID string) ([]*domain.ApiKey, error) {
+	var apiKeys []*domain.ApiKey
+	if err := r.db.WithContext(ctx).Where("team_id = ?", teamID).Order("created_at DESC").Find(&apiKeys).Error; err != nil {
+		return nil, fmt.Errorf("failed to get API keys by team ID: %w", err)
+	}
+	return apiKeys, nil
+}
+
+func (r *apiKeyRepository) ExpireTeamKeys(ctx context.Context, teamID, userID string, now time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&domain.ApiKey{}).
+		Where("team_id = ? AND user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", teamID, userID, now).
+		Update("expires_at", now)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to expire team API keys: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// ListExpired возвращает истекшие, но еще не отозванные ключи
+func (r *apiKeyRepository) ListExpired(ctx context.Context, now time.Time) ([]*domain.ApiKey, error) {
+	var apiKeys []*domain.ApiKey
+	if err := r.db.WithContext(ctx).Preload("User").
+		Where("expires_at IS NOT NULL AND expires_at <= ? AND revoked_at IS NULL", now).
+		Find(&apiKeys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list expired API keys: %w", err)
+	}
+	return apiKeys, nil
+}
+
+// ListExpiringUnnotified возвращает ключи, истекающие в интервале (now, until], владельцы которых еще не уведомлены.
+// Ротированные ключи не возвращаются: их срок - льготный период, замена уже выпущена
+func (r *apiKeyRepository) ListExpiringUnnotified(ctx context.Context, now, until time.Time) ([]*domain.ApiKey, error) {
+	var apiKeys []*domain.ApiKey
+	if err := r.db.WithContext(ctx).Preload("User").
+		Where("expires_at > ? AND expires_at <= ? AND revoked_at IS NULL AND expiry_notified_at IS NULL AND successor_id IS NULL", now, until).
+		Find(&apiKeys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list expiring API keys: %w", err)
+	}
+	return apiKeys, nil
+}
+
 func (r *apiKeyRepository) Update(ctx context.Context, apiKey *domain.ApiKey) error {
 	if err := r.db.WithContext(ctx).Save(apiKey).Error; err != nil {
 		return fmt.Errorf("failed to update API key: %w", err)
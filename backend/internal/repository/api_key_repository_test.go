@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"oneui-hub/internal/domain"
+)
+
+func TestApiKeyRepository_ListExpiringUnnotified(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&TestUser{}, &domain.ApiKey{}))
+
+	repo := NewApiKeyRepository(db)
+	ctx := context.Background()
+
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(48 * time.Hour)
+	laterExpiresAt := now.Add(30 * 24 * time.Hour)
+	successorID := "key-2"
+	keys := []*domain.ApiKey{
+		{ID: "key-expiring", UserID: "user-1", KeyHash: "h1", ExpiresAt: &expiresAt},
+		// Ротированный ключ истекает в конце льготного периода, его замена - key-2
+		{ID: "key-rotated", UserID: "user-1", KeyHash: "h2", ExpiresAt: &expiresAt, SuccessorID: &successorID},
+		{ID: "key-notified", UserID: "user-1", KeyHash: "h3", ExpiresAt: &expiresAt, ExpiryNotifiedAt: &now},
+		{ID: "key-later", UserID: "user-1", KeyHash: "h4", ExpiresAt: &laterExpiresAt},
+	}
+	for _, key := range keys {
+		require.NoError(t, db.Create(key).Error)
+	}
+
+	expiring, err := repo.ListExpiringUnnotified(ctx, now, now.Add(7*24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, expiring, 1)
+	assert.Equal(t, "key-expiring", expiring[0].ID)
+}
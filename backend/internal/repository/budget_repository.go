@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -54,8 +55,16 @@ func (r *budgetRepository) GetByUserID(ctx context.Context, userID string) ([]*d
 	return budgets, nil
 }
 
+func (r *budgetRepository) GetByTeamID(ctx context.Context, teamID string) ([]*domain.Budget, error) {
+	var budgets []*domain.Budget
+	if err := r.db.WithContext(ctx).Where("team_id = ?", teamID).Find(&budgets).Error; err != nil {
+		return nil, fmt.Errorf("failed to get budgets by team ID: %w", err)
+	}
+	return budgets, nil
+}
+
 func (r *budgetRepository) Update(ctx context.Context, budget *domain.Budget) error {
-	if err := r.db.WithContext(ctx).Save(budget).Error; err != nil {
+	if err := r.db.WithContext(ctx).Omit("User", "spent_budget").Save(budget).Error; err != nil {
 		return fmt.Errorf("failed to update budget: %w", err)
 	}
 	return nil
@@ -84,3 +93,62 @@ func (r *budgetRepository) List(ctx context.Context, limit, offset int) ([]*doma
 	}
 	return budgets, nil
 }
+
+func (r *budgetRepository) AddSpent(ctx context.Context, id string, amount float64) error {
+	err := r.db.WithContext(ctx).Model(&domain.Budget{}).
+		Where("id = ?", id).
+		Update("spent_budget", gorm.Expr("spent_budget + ?", amount)).Error
+	if err != nil {
+		return fmt.Errorf("failed to add budget spending: %w", err)
+	}
+	return nil
+}
+
+func (r *budgetRepository) MarkThresholdNotified(ctx context.Context, id string, threshold int) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&domain.Budget{}).
+		Where("id = ? AND notified_threshold < ?", id, threshold).
+		Update("notified_threshold", threshold)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to mark budget threshold: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *budgetRepository) ListDueForReset(ctx context.Context, now time.Time, limit int) ([]*domain.Budget, error) {
+	var budgets []*domain.Budget
+	err := r.db.WithContext(ctx).Preload("User").
+		Where("reset_at <= ?", now).
+		Order("reset_at").
+		Limit(limit).
+		Find(&budgets).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list budgets due for reset: %w", err)
+	}
+	return budgets, nil
+}
+
+func (r *budgetRepository) Reset(ctx context.Context, id string, now, periodStart time.Time, resetAt *time.Time) (bool, error) {
+	// Условие на reset_at не дает сбросить бюджет дважды, если его одновременно сбрасывают задача и шлюз
+	result := r.db.WithContext(ctx).Model(&domain.Budget{}).
+		Where("id = ? AND reset_at <= ?", id, now).
+		Updates(map[string]interface{}{
+			"spent_budget":       0,
+			"notified_threshold": 0,
+			"period_start":       periodStart,
+			"reset_at":           resetAt,
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to reset budget: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *budgetRepository) SetExternalID(ctx context.Context, id, externalID string) error {
+	err := r.db.WithContext(ctx).Model(&domain.Budget{}).
+		Where("id = ?", id).
+		Update("external_id", externalID).Error
+	if err != nil {
+		return fmt.Errorf("failed to set budget external ID: %w", err)
+	}
+	return nil
+}
@@ -1,8 +1,31 @@
 package repository
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// mysqlDuplicateEntry - код ошибки MySQL при нарушении уникального индекса
+const mysqlDuplicateEntry = 1062
 
 var (
 	ErrNotFound  = errors.New("record not found")
 	ErrDuplicate = errors.New("record already exists")
+	// ErrLastTeamOwner - изменение оставило бы команду без владельца
+	ErrLastTeamOwner = errors.New("team must keep at least one owner")
+	// ErrInvitationNotPending - приглашение уже принято, отозвано или истекло
+	ErrInvitationNotPending = errors.New("invitation is not pending")
+	// ErrRefreshTokenUsed - refresh токен уже обменян на новый
+	ErrRefreshTokenUsed = errors.New("refresh token already used")
 )
+
+// isDuplicateKeyError сообщает, что вставка нарушила уникальный индекс
+func isDuplicateKeyError(err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
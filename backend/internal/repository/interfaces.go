@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"oneui-hub/internal/domain"
 )
@@ -11,8 +12,13 @@ type UserRepository interface {
 	GetByID(ctx context.Context, id string) (*domain.User, error)
 	GetByEmail(ctx context.Context, email string) (*domain.User, error)
 	Update(ctx context.Context, user *domain.User) error
+	// UpdateColumns сохраняет только перечисленные колонки, не затрагивая остальные (например, тариф)
+	UpdateColumns(ctx context.Context, user *domain.User, columns ...string) error
 	Delete(ctx context.Context, id string) error
 	List(ctx context.Context, limit, offset int) ([]*domain.User, error)
+	// ListIDsByTiers возвращает по возрастанию ID пользователей с незакрепленным тарифом из tierIDs,
+	// начиная после afterID
+	ListIDsByTiers(ctx context.Context, tierIDs []string, afterID string, limit int) ([]string, error)
 }
 
 type TierRepository interface {
@@ -70,6 +76,12 @@ type ApiKeyRepository interface {
 	GetByID(ctx context.Context, id string) (*domain.ApiKey, error)
 	GetByUserID(ctx context.Context, userID string) ([]*domain.ApiKey, error)
 	GetByKeyHash(ctx context.Context, keyHash string) (*domain.ApiKey, error)
+	GetByTeamID(ctx context.Context, teamID string) ([]*domain.ApiKey, error)
+	// ExpireTeamKeys назначает срок действия now еще не истекшим ключам пользователя в команде,
+	// дальше их отзывает задача истечения ключей
+	ExpireTeamKeys(ctx context.Context, teamID, userID string, now time.Time) (int64, error)
+	ListExpired(ctx context.Context, now time.Time) ([]*domain.ApiKey, error)
+	ListExpiringUnnotified(ctx context.Context, now, until time.Time) ([]*domain.ApiKey, error)
 	Update(ctx context.Context, apiKey *domain.ApiKey) error
 	Delete(ctx context.Context, id string) error
 }
@@ -80,6 +92,18 @@ type RequestRepository interface {
 	GetByUserID(ctx context.Context, userID string, limit, offset int) ([]*domain.Request, error)
 	GetByModelID(ctx context.Context, modelID string, limit, offset int) ([]*domain.Request, error)
 	List(ctx context.Context, limit, offset int) ([]*domain.Request, error)
+	SumCostByApiKeys(ctx context.Context, apiKeyIDs []string, since time.Time) (float64, error)
+	// SumUsageByTeam возвращает использование команды за [from, to) в разбивке по участникам
+	SumUsageByTeam(ctx context.Context, teamID string, from, to time.Time) ([]*UsageByUser, error)
+}
+
+// UsageByUser - сводка запросов одного пользователя
+type UsageByUser struct {
+	UserID       string  `json:"user_id"`
+	Requests     int64   `json:"requests"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	TotalCost    float64 `json:"total_cost"`
 }
 
 type UserLimitRepository interface {
@@ -94,9 +118,22 @@ type BudgetRepository interface {
 	GetByID(ctx context.Context, id string) (*domain.Budget, error)
 	GetByExternalID(ctx context.Context, externalID string) (*domain.Budget, error)
 	GetByUserID(ctx context.Context, userID string) ([]*domain.Budget, error)
+	GetByTeamID(ctx context.Context, teamID string) ([]*domain.Budget, error)
+	// Update сохраняет настройки бюджета; траты меняются только через AddSpent и Reset
 	Update(ctx context.Context, budget *domain.Budget) error
 	Delete(ctx context.Context, id string) error
 	List(ctx context.Context, limit, offset int) ([]*domain.Budget, error)
+	// AddSpent атомарно увеличивает траты бюджета
+	AddSpent(ctx context.Context, id string, amount float64) error
+	// MarkThresholdNotified запоминает порог, о котором уведомлен владелец.
+	// Возвращает false, если о таком или большем пороге уже уведомили
+	MarkThresholdNotified(ctx context.Context, id string, threshold int) (bool, error)
+	// ListDueForReset возвращает бюджеты, момент сброса которых наступил к now
+	ListDueForReset(ctx context.Context, now time.Time, limit int) ([]*domain.Budget, error)
+	// Reset обнуляет траты и начинает новый период, если сброс бюджета наступил к now.
+	// Возвращает false, если бюджет уже сброшен
+	Reset(ctx context.Context, id string, now, periodStart time.Time, resetAt *time.Time) (bool, error)
+	SetExternalID(ctx context.Context, id, externalID string) error
 }
 
 type CurrencyRepository interface {
@@ -120,5 +157,189 @@ type UserSpendingRepository interface {
 	Create(ctx context.Context, spending *domain.UserSpending) error
 	GetByUserID(ctx context.Context, userID string) (*domain.UserSpending, error)
 	Update(ctx context.Context, spending *domain.UserSpending) error
+	// AddSpent атомарно увеличивает траты пользователя и его траты за текущий день (UTC),
+	// создавая записи при необходимости
+	AddSpent(ctx context.Context, userID string, amount float64) error
+	// AddPaid так же учитывает оплату пользователя; возврат передается отрицательной суммой
+	AddPaid(ctx context.Context, userID string, amount float64) error
+	// SumSince возвращает траты пользователя начиная с дня, в который попадает since
+	SumSince(ctx context.Context, userID string, since time.Time) (float64, error)
+	// SumPaidSince возвращает оплаты пользователя начиная с дня, в который попадает since
+	SumPaidSince(ctx context.Context, userID string, since time.Time) (float64, error)
 	Delete(ctx context.Context, userID string) error
 }
+
+type JobRunRepository interface {
+	Create(ctx context.Context, run *domain.JobRun) error
+	Update(ctx context.Context, run *domain.JobRun) error
+	// List возвращает запуски, начиная с последних. Пустой jobName - запуски всех задач
+	List(ctx context.Context, jobName string, limit, offset int) ([]*domain.JobRun, error)
+}
+
+type LedgerRepository interface {
+	// Post атомарно проводит операцию: обновляет остатки счетов и заполняет BalanceAfter проводок.
+	// Операция с уже проведенными типом и Reference возвращает ErrDuplicate
+	Post(ctx context.Context, transaction *domain.LedgerTransaction) error
+	GetAccount(ctx context.Context, accountID string) (*domain.LedgerAccount, error)
+	ListEntries(ctx context.Context, accountID string, limit, offset int) ([]*domain.LedgerEntry, error)
+	// ListUnbilledRequests возвращает платные завершенные запросы без списания за использование
+	ListUnbilledRequests(ctx context.Context, since time.Time, limit int) ([]*domain.Request, error)
+	// ListUnopenedBalances возвращает ненулевые балансы пользователей, еще не перенесенные в журнал
+	ListUnopenedBalances(ctx context.Context) ([]*domain.UserLimit, error)
+}
+
+type QuotaRepository interface {
+	// Reserve в одной транзакции блокирует квоты пользователя, передает их текущее состояние в check
+	// и, если check не вернул ошибку, создает удержание. Истекшие удержания пользователя удаляются
+	Reserve(ctx context.Context, hold *domain.QuotaHold, monthStart time.Time, check func(usage *QuotaUsage) error) error
+	Release(ctx context.Context, holdID string) error
+}
+
+type PricingRepository interface {
+	CreateRule(ctx context.Context, rule *domain.PriceRule) error
+	GetRuleByID(ctx context.Context, id string) (*domain.PriceRule, error)
+	DeleteRule(ctx context.Context, id string) error
+	// ListRules возвращает правила, вступившие в силу до until (нулевое until - все правила)
+	ListRules(ctx context.Context, until time.Time) ([]*domain.PriceRule, error)
+	// CreatePrice сохраняет новую версию цены. Если версия с тем же номером уже создана
+	// другим запросом, возвращается ErrDuplicate
+	CreatePrice(ctx context.Context, price *domain.ModelPrice) error
+	GetPriceByID(ctx context.Context, id string) (*domain.ModelPrice, error)
+	// GetLatestPrice возвращает последнюю версию цены модели для тарифа
+	GetLatestPrice(ctx context.Context, modelID, tierID string) (*domain.ModelPrice, error)
+	// ListPrices возвращает историю цен модели, начиная с последних. Пустой tierID - все тарифы
+	ListPrices(ctx context.Context, modelID, tierID string, limit, offset int) ([]*domain.ModelPrice, error)
+}
+
+type InvoiceRepository interface {
+	// Create присваивает счету следующий номер за год выставления и сохраняет его вместе со строками.
+	// Если счет пользователя или команды за этот период уже выставлен, возвращается ErrDuplicate
+	Create(ctx context.Context, invoice *domain.Invoice) error
+	GetByID(ctx context.Context, id string) (*domain.Invoice, error)
+	UpdateFiles(ctx context.Context, id, pdfPath, csvPath string) error
+	// ListByUser возвращает личные счета пользователя, начиная с последнего периода
+	ListByUser(ctx context.Context, userID string, limit, offset int) ([]*domain.Invoice, error)
+	// ListByTeam возвращает счета команды, начиная с последнего периода
+	ListByTeam(ctx context.Context, teamID string, limit, offset int) ([]*domain.Invoice, error)
+	// AggregateUsage суммирует завершенные запросы пользователя по личным ключам за период
+	// по моделям и версиям цен. Запросы по ключам команд входят в счета команд
+	AggregateUsage(ctx context.Context, userID string, start, end time.Time) ([]*InvoiceUsage, error)
+	// AggregateTeamUsage суммирует завершенные запросы по ключам команды за период
+	AggregateTeamUsage(ctx context.Context, teamID string, start, end time.Time) ([]*InvoiceUsage, error)
+}
+
+type PromoRepository interface {
+	// CreateCode сохраняет промокод. Если код уже существует, возвращается ErrDuplicate
+	CreateCode(ctx context.Context, code *domain.PromoCode) error
+	GetCodeByID(ctx context.Context, id string) (*domain.PromoCode, error)
+	UpdateCode(ctx context.Context, code *domain.PromoCode) error
+	ListCodes(ctx context.Context, limit, offset int) ([]*domain.PromoCode, error)
+	// Redeem в одной транзакции блокирует промокод, передает его и число активаций пользователем в check
+	// и, если check не вернул ошибку, сохраняет активацию и увеличивает счетчик кода.
+	// Для временного тарифа в той же транзакции запоминается текущий тариф пользователя, назначается выданный
+	// и в историю тарифов сохраняется change
+	Redeem(ctx context.Context, code string, redemption *domain.PromoRedemption, change *domain.TierChange, check func(code *domain.PromoCode, usage *PromoUsage) error) error
+	// CancelRedemption удаляет активацию и возвращает ее в счетчик кода, если начисление не удалось провести
+	CancelRedemption(ctx context.Context, redemption *domain.PromoRedemption) error
+	// ListRedemptionsByUser возвращает активации пользователя, начиная с последних
+	ListRedemptionsByUser(ctx context.Context, userID string, limit, offset int) ([]*domain.PromoRedemption, error)
+	// ListActiveRedemptions возвращает действующие на момент now временные тарифы или скидки пользователя
+	ListActiveRedemptions(ctx context.Context, userID, promoType string, now time.Time) ([]*domain.PromoRedemption, error)
+	// ListExpiredTierGrants возвращает истекшие временные тарифы, которые еще не отменены
+	ListExpiredTierGrants(ctx context.Context, now time.Time, limit int) ([]*domain.PromoRedemption, error)
+	// RevertTierGrant возвращает пользователю прежний тариф, если он все еще на выданном и не закреплен,
+	// и отмечает активацию отмененной. Если тариф вернулся, в историю тарифов сохраняется change
+	RevertTierGrant(ctx context.Context, redemption *domain.PromoRedemption, change *domain.TierChange, now time.Time) error
+}
+
+type PaymentRepository interface {
+	Create(ctx context.Context, payment *domain.Payment) error
+	GetByID(ctx context.Context, id string) (*domain.Payment, error)
+	GetBySessionID(ctx context.Context, provider, sessionID string) (*domain.Payment, error)
+	Update(ctx context.Context, payment *domain.Payment) error
+	// ListByUser возвращает платежи пользователя, начиная с последних
+	ListByUser(ctx context.Context, userID string, limit, offset int) ([]*domain.Payment, error)
+	// ApplyEvent в одной транзакции блокирует платеж события и, если событие еще не обработано,
+	// передает платеж в apply, сохраняет его и запоминает событие. Для уже обработанного события
+	// apply не вызывается, event заполняется сохраненными данными и возвращается false
+	ApplyEvent(ctx context.Context, event *domain.PaymentEvent, apply func(payment *domain.Payment) error) (bool, error)
+}
+
+type TierHistoryRepository interface {
+	// ChangeUserTier в одной транзакции блокирует пользователя, передает его в check и, если check
+	// вернул true, назначает тариф change.ToTierID с закреплением change.Pinned и сохраняет запись истории
+	// с прежним тарифом в change.FromTierID. Возвращает false, если тариф и закрепление не изменились
+	ChangeUserTier(ctx context.Context, change *domain.TierChange, check func(user *domain.User) (bool, error)) (bool, error)
+	// ListByUser возвращает историю тарифов пользователя, начиная с последних изменений
+	ListByUser(ctx context.Context, userID string, limit, offset int) ([]*domain.TierChange, error)
+	// GetDowngrade возвращает запланированное понижение тарифа пользователя. Любая смена тарифа
+	// через ChangeUserTier отменяет запланированное понижение
+	GetDowngrade(ctx context.Context, userID string) (*domain.TierDowngrade, error)
+	// SaveDowngrade создает или заменяет запланированное понижение тарифа
+	SaveDowngrade(ctx context.Context, downgrade *domain.TierDowngrade) error
+	CancelDowngrade(ctx context.Context, userID string) error
+}
+
+// TeamRepository - команды и их участники
+type TeamRepository interface {
+	// Create создает команду вместе с ее первым владельцем
+	Create(ctx context.Context, team *domain.Team, owner *domain.TeamMember) error
+	GetByID(ctx context.Context, id string) (*domain.Team, error)
+	Update(ctx context.Context, team *domain.Team) error
+	// Delete удаляет команду вместе с участниками и приглашениями
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context, limit, offset int) ([]*domain.Team, error)
+	// ListByUserID возвращает команды, в которых состоит пользователь
+	ListByUserID(ctx context.Context, userID string) ([]*domain.Team, error)
+	GetMember(ctx context.Context, teamID, userID string) (*domain.TeamMember, error)
+	ListMembers(ctx context.Context, teamID string) ([]*domain.TeamMember, error)
+	// AddMember возвращает ErrDuplicate, если пользователь уже состоит в команде
+	AddMember(ctx context.Context, member *domain.TeamMember) error
+	// UpdateMemberRole и RemoveMember возвращают ErrLastTeamOwner, если в команде не останется владельца
+	UpdateMemberRole(ctx context.Context, teamID, userID, role string) error
+	RemoveMember(ctx context.Context, teamID, userID string) error
+}
+
+// TeamInvitationRepository - приглашения в команды
+type TeamInvitationRepository interface {
+	// Create отзывает действующие приглашения того же email в команду и создает новое
+	Create(ctx context.Context, invitation *domain.TeamInvitation) error
+	GetByID(ctx context.Context, id string) (*domain.TeamInvitation, error)
+	// ListPendingByTeam и ListPendingByEmail возвращают приглашения, которые еще можно принять
+	ListPendingByTeam(ctx context.Context, teamID string, now time.Time) ([]*domain.TeamInvitation, error)
+	ListPendingByEmail(ctx context.Context, email string, now time.Time) ([]*domain.TeamInvitation, error)
+	// Accept помечает приглашение принятым и добавляет участника в одной транзакции.
+	// Возвращает ErrInvitationNotPending, если приглашение уже нельзя принять,
+	// и ErrDuplicate, если пользователь уже состоит в команде
+	Accept(ctx context.Context, id string, member *domain.TeamMember, now time.Time) error
+	// Revoke возвращает ErrInvitationNotPending, если приглашение уже нельзя отозвать
+	Revoke(ctx context.Context, id string, now time.Time) error
+}
+
+// SessionRepository - сессии пользователей и их refresh токены
+type SessionRepository interface {
+	// Create создает сессию вместе с первым refresh токеном
+	Create(ctx context.Context, session *domain.Session, token *domain.RefreshToken) error
+	GetByID(ctx context.Context, id string) (*domain.Session, error)
+	// ListActiveByUserID возвращает неотозванные и не истекшие сессии пользователя
+	ListActiveByUserID(ctx context.Context, userID string, now time.Time) ([]*domain.Session, error)
+	GetRefreshToken(ctx context.Context, tokenHash string) (*domain.RefreshToken, error)
+	// Rotate помечает refresh токен использованным, выдает сессии следующий и продлевает ее
+	// до session.ExpiresAt. Возвращает ErrRefreshTokenUsed, если токен уже использован,
+	// и ErrNotFound, если сессия отозвана
+	Rotate(ctx context.Context, usedHash string, next *domain.RefreshToken, session *domain.Session, now time.Time) error
+	// Revoke возвращает ErrNotFound, если сессии нет или она уже отозвана
+	Revoke(ctx context.Context, id, reason string, now time.Time) error
+	// RevokeAllByUserID отзывает все сессии пользователя и возвращает их количество
+	RevokeAllByUserID(ctx context.Context, userID, reason string, now time.Time) (int64, error)
+	// DeleteInactive удаляет сессии, истекшие или отозванные раньше before, вместе с их токенами
+	DeleteInactive(ctx context.Context, before time.Time) (int64, error)
+}
+
+// SigningKeyRepository - ключи подписи JWT
+type SigningKeyRepository interface {
+	Create(ctx context.Context, key *domain.JWTSigningKey) error
+	// List возвращает ключи в порядке активации
+	List(ctx context.Context) ([]*domain.JWTSigningKey, error)
+	Delete(ctx context.Context, id string) error
+}
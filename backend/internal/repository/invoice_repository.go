@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"oneui-hub/internal/domain"
+)
+
+// InvoiceUsage - итог запросов одной модели по одной версии цены за период
+type InvoiceUsage struct {
+	ModelID      string
+	ModelName    string
+	ModelPriceID *string
+	Requests     int64
+	InputTokens  int64
+	OutputTokens int64
+	TotalCost    float64
+}
+
+type invoiceRepository struct {
+	db *gorm.DB
+}
+
+func NewInvoiceRepository(db *gorm.DB) InvoiceRepository {
+	return &invoiceRepository{db: db}
+}
+
+func (r *invoiceRepository) Create(ctx context.Context, invoice *domain.Invoice) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&domain.Invoice{}).
+			Where("user_id = ? AND team_id = ? AND period_start = ?", invoice.UserID, invoice.TeamID, invoice.PeriodStart).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrDuplicate
+		}
+
+		// Строка счетчика года блокируется до конца транзакции, поэтому номера идут без пропусков и повторов
+		year := invoice.IssuedAt.UTC().Year()
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&domain.InvoiceSequence{Year: year}).Error; err != nil {
+			return err
+		}
+		var sequence domain.InvoiceSequence
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&sequence, "year = ?", year).Error; err != nil {
+			return err
+		}
+		sequence.LastNumber++
+		if err := tx.Model(&sequence).Update("last_number", sequence.LastNumber).Error; err != nil {
+			return err
+		}
+
+		invoice.Number = fmt.Sprintf("INV-%d-%06d", year, sequence.LastNumber)
+		return tx.Create(invoice).Error
+	})
+	if err == ErrDuplicate {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create invoice: %w", err)
+	}
+	return nil
+}
+
+func (r *invoiceRepository) GetByID(ctx context.Context, id string) (*domain.Invoice, error) {
+	var invoice domain.Invoice
+	err := r.db.WithContext(ctx).
+		Preload("Lines", func(db *gorm.DB) *gorm.DB {
+			return db.Order("model_name, id")
+		}).
+		First(&invoice, "id = ?", id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get invoice: %w", err)
+	}
+	return &invoice, nil
+}
+
+func (r *invoiceRepository) UpdateFiles(ctx context.Context, id, pdfPath, csvPath string) error {
+	err := r.db.WithContext(ctx).Model(&domain.Invoice{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"pdf_path": pdfPath, "csv_path": csvPath}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update invoice files: %w", err)
+	}
+	return nil
+}
+
+func (r *invoiceRepository) ListByUser(ctx context.Context, userID string, limit, offset int) ([]*domain.Invoice, error) {
+	return r.list(ctx, limit, offset, "user_id = ? AND team_id = ''", userID)
+}
+
+func (r *invoiceRepository) ListByTeam(ctx context.Context, teamID string, limit, offset int) ([]*domain.Invoice, error) {
+	return r.list(ctx, limit, offset, "team_id = ?", teamID)
+}
+
+func (r *invoiceRepository) list(ctx context.Context, limit, offset int, where string, args ...interface{}) ([]*domain.Invoice, error) {
+	var invoices []*domain.Invoice
+	query := r.db.WithContext(ctx).Where(where, args...).Order("period_start DESC")
+	if limit > 0 {
+		query = query.Limit(limit).Offset(offset)
+	}
+	if err := query.Find(&invoices).Error; err != nil {
+		return nil, fmt.Errorf("failed to list invoices: %w", err)
+	}
+	return invoices, nil
+}
+
+func (r *invoiceRepository) AggregateUsage(ctx context.Context, userID string, start, end time.Time) ([]*InvoiceUsage, error) {
+	return r.aggregate(ctx, start, end, "user_id = ? AND team_id IS NULL", userID)
+}
+
+func (r *invoiceRepository) AggregateTeamUsage(ctx context.Context, teamID string, start, end time.Time) ([]*InvoiceUsage, error) {
+	// В запросе сохраняется команда ключа, по которому он выполнен
+	return r.aggregate(ctx, start, end, "team_id = ?", teamID)
+}
+
+func (r *invoiceRepository) aggregate(ctx context.Context, start, end time.Time, where string, args ...interface{}) ([]*InvoiceUsage, error) {
+	var usage []*InvoiceUsage
+	err := r.db.WithContext(ctx).Table("requests").
+		Select("model_id, COALESCE(MAX(model_name), '') AS model_name, model_price_id, COUNT(*) AS requests, "+
+			"COALESCE(SUM(input_tokens), 0) AS input_tokens, COALESCE(SUM(output_tokens), 0) AS output_tokens, "+
+			"COALESCE(SUM(total_cost), 0) AS total_cost").
+		Where(where, args...).
+		Where("status = ? AND created_at >= ? AND created_at < ?", domain.RequestStatusCompleted, start, end).
+		Group("model_id, model_price_id").
+		Order("model_name, model_price_id").
+		Scan(&usage).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate invoice usage: %w", err)
+	}
+	return usage, nil
+}
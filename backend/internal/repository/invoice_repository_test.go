@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"oneui-hub/internal/domain"
+)
+
+// TestBilledRequest - запрос с полями, которые нужны для счетов
+type TestBilledRequest struct {
+	ID           string    `gorm:"type:varchar(36);primaryKey"`
+	UserID       string    `gorm:"type:varchar(36);not null"`
+	TeamID       *string   `gorm:"type:varchar(36)"`
+	ModelID      string    `gorm:"type:varchar(36)"`
+	ModelName    *string   `gorm:"type:varchar(255)"`
+	ModelPriceID *string   `gorm:"type:varchar(36)"`
+	InputTokens  int       `gorm:"not null"`
+	OutputTokens int       `gorm:"not null"`
+	TotalCost    float64   `gorm:"type:decimal(10,6);not null"`
+	Status       string    `gorm:"type:varchar(50)"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+func (TestBilledRequest) TableName() string {
+	return "requests"
+}
+
+func setupInvoiceTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	require.NoError(t, db.AutoMigrate(
+		&domain.Invoice{},
+		&domain.InvoiceLine{},
+		&domain.InvoiceSequence{},
+		&TestBilledRequest{},
+	))
+	return db
+}
+
+func TestInvoiceRepository_CreateAssignsSequentialNumbers(t *testing.T) {
+	db := setupInvoiceTestDB(t)
+	repo := NewInvoiceRepository(db)
+	ctx := context.Background()
+
+	issuedAt := time.Date(2024, 7, 1, 3, 0, 0, 0, time.UTC)
+	newInvoice := func(userID string, periodStart time.Time) *domain.Invoice {
+		id := uuid.New().String()
+		return &domain.Invoice{
+			ID:          id,
+			UserID:      userID,
+			PeriodStart: periodStart,
+			PeriodEnd:   periodStart.AddDate(0, 1, 0),
+			Currency:    "USD",
+			Status:      domain.InvoiceStatusIssued,
+			IssuedAt:    issuedAt,
+			Lines: []domain.InvoiceLine{
+				{ID: uuid.New().String(), InvoiceID: id, ModelName: "gpt-4o", Requests: 1, AmountUSD: 1},
+			},
+		}
+	}
+
+	june := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	first := newInvoice("user-1", june)
+	require.NoError(t, repo.Create(ctx, first))
+	second := newInvoice("user-2", june)
+	require.NoError(t, repo.Create(ctx, second))
+
+	assert.Equal(t, "INV-2024-000001", first.Number)
+	assert.Equal(t, "INV-2024-000002", second.Number)
+
+	// Повторный счет за тот же период не выставляется и не расходует номер
+	assert.ErrorIs(t, repo.Create(ctx, newInvoice("user-1", june)), ErrDuplicate)
+	third := newInvoice("user-1", june.AddDate(0, -1, 0))
+	require.NoError(t, repo.Create(ctx, third))
+	assert.Equal(t, "INV-2024-000003", third.Number)
+
+	stored, err := repo.GetByID(ctx, first.ID)
+	require.NoError(t, err)
+	require.Len(t, stored.Lines, 1)
+	assert.Equal(t, "gpt-4o", stored.Lines[0].ModelName)
+
+	invoices, err := repo.ListByUser(ctx, "user-1", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, invoices, 2)
+	assert.Equal(t, first.ID, invoices[0].ID)
+
+	// Счета команд за тот же период не мешают друг другу и не попадают в личные счета
+	teamInvoice := newInvoice("", june)
+	teamInvoice.TeamID = "team-1"
+	require.NoError(t, repo.Create(ctx, teamInvoice))
+	otherTeam := newInvoice("", june)
+	otherTeam.TeamID = "team-2"
+	require.NoError(t, repo.Create(ctx, otherTeam))
+	duplicate := newInvoice("", june)
+	duplicate.TeamID = "team-1"
+	assert.ErrorIs(t, repo.Create(ctx, duplicate), ErrDuplicate)
+
+	invoices, err = repo.ListByTeam(ctx, "team-1", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, invoices, 1)
+	assert.Equal(t, teamInvoice.ID, invoices[0].ID)
+	invoices, err = repo.ListByUser(ctx, "", 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, invoices)
+}
+
+func TestInvoiceRepository_AggregateUsage(t *testing.T) {
+	db := setupInvoiceTestDB(t)
+	repo := NewInvoiceRepository(db)
+	ctx := context.Background()
+
+	modelName := "gpt-4o"
+	oldPrice, newPrice := "price-1", "price-2"
+	teamID := "team-1"
+	inPeriod := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	requests := []TestBilledRequest{
+		{ID: "r1", UserID: "user-1", ModelID: "m1", ModelName: &modelName, ModelPriceID: &oldPrice, InputTokens: 100, OutputTokens: 10, TotalCost: 0.5, Status: domain.RequestStatusCompleted, CreatedAt: inPeriod},
+		{ID: "r2", UserID: "user-1", ModelID: "m1", ModelName: &modelName, ModelPriceID: &oldPrice, InputTokens: 200, OutputTokens: 20, TotalCost: 1, Status: domain.RequestStatusCompleted, CreatedAt: inPeriod},
+		{ID: "r3", UserID: "user-1", ModelID: "m1", ModelName: &modelName, ModelPriceID: &newPrice, InputTokens: 50, OutputTokens: 5, TotalCost: 0.3, Status: domain.RequestStatusCompleted, CreatedAt: inPeriod},
+		// Не попадают в счет: неуспешный запрос, другой период, другой пользователь
+		{ID: "r4", UserID: "user-1", ModelID: "m1", ModelName: &modelName, TotalCost: 9, Status: domain.RequestStatusFailed, CreatedAt: inPeriod},
+		{ID: "r5", UserID: "user-1", ModelID: "m1", ModelName: &modelName, TotalCost: 9, Status: domain.RequestStatusCompleted, CreatedAt: inPeriod.AddDate(0, 1, 0)},
+		{ID: "r6", UserID: "user-2", ModelID: "m1", ModelName: &modelName, TotalCost: 9, Status: domain.RequestStatusCompleted, CreatedAt: inPeriod},
+		// Запросы по ключам команды входят в счет команды, а не в личный
+		{ID: "r7", UserID: "user-1", TeamID: &teamID, ModelID: "m1", ModelName: &modelName, ModelPriceID: &newPrice, InputTokens: 70, OutputTokens: 7, TotalCost: 2, Status: domain.RequestStatusCompleted, CreatedAt: inPeriod},
+		{ID: "r8", UserID: "user-2", TeamID: &teamID, ModelID: "m1", ModelName: &modelName, ModelPriceID: &newPrice, InputTokens: 30, OutputTokens: 3, TotalCost: 1, Status: domain.RequestStatusCompleted, CreatedAt: inPeriod},
+	}
+	require.NoError(t, db.Create(&requests).Error)
+
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	usage, err := repo.AggregateUsage(ctx, "user-1", start, start.AddDate(0, 1, 0))
+	require.NoError(t, err)
+	require.Len(t, usage, 2)
+
+	byPrice := map[string]*InvoiceUsage{}
+	for _, item := range usage {
+		require.NotNil(t, item.ModelPriceID)
+		byPrice[*item.ModelPriceID] = item
+	}
+	assert.Equal(t, int64(2), byPrice[oldPrice].Requests)
+	assert.Equal(t, int64(300), byPrice[oldPrice].InputTokens)
+	assert.Equal(t, int64(30), byPrice[oldPrice].OutputTokens)
+	assert.InDelta(t, 1.5, byPrice[oldPrice].TotalCost, 1e-9)
+	assert.Equal(t, "gpt-4o", byPrice[newPrice].ModelName)
+	assert.InDelta(t, 0.3, byPrice[newPrice].TotalCost, 1e-9)
+
+	teamUsage, err := repo.AggregateTeamUsage(ctx, teamID, start, start.AddDate(0, 1, 0))
+	require.NoError(t, err)
+	require.Len(t, teamUsage, 1)
+	assert.Equal(t, int64(2), teamUsage[0].Requests)
+	assert.Equal(t, int64(100), teamUsage[0].InputTokens)
+	assert.InDelta(t, 3.0, teamUsage[0].TotalCost, 1e-9)
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"oneui-hub/internal/domain"
+)
+
+type jobRunRepository struct {
+	db *gorm.DB
+}
+
+func NewJobRunRepository(db *gorm.DB) JobRunRepository {
+	return &jobRunRepository{db: db}
+}
+
+func (r *jobRunRepository) Create(ctx context.Context, run *domain.JobRun) error {
+	if err := r.db.WithContext(ctx).Create(run).Error; err != nil {
+		return fmt.Errorf("failed to create job run: %w", err)
+	}
+	return nil
+}
+
+func (r *jobRunRepository) Update(ctx context.Context, run *domain.JobRun) error {
+	if err := r.db.WithContext(ctx).Save(run).Error; err != nil {
+		return fmt.Errorf("failed to update job run: %w", err)
+	}
+	return nil
+}
+
+func (r *jobRunRepository) List(ctx context.Context, jobName string, limit, offset int) ([]*domain.JobRun, error) {
+	var runs []*domain.JobRun
+	query := r.db.WithContext(ctx).Order("started_at DESC")
+	if jobName != "" {
+		query = query.Where("job_name = ?", jobName)
+	}
+	if limit > 0 {
+		query = query.Limit(limit).Offset(offset)
+	}
+	if err := query.Find(&runs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list job runs: %w", err)
+	}
+	return runs, nil
+}
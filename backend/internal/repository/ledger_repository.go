@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"oneui-hub/internal/domain"
+)
+
+type ledgerRepository struct {
+	db *gorm.DB
+}
+
+func NewLedgerRepository(db *gorm.DB) LedgerRepository {
+	return &ledgerRepository{db: db}
+}
+
+func (r *ledgerRepository) Post(ctx context.Context, transaction *domain.LedgerTransaction) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Блокируем счета в одном порядке, чтобы параллельные проводки не взаимоблокировались
+		order := make([]int, len(transaction.Entries))
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(a, b int) bool {
+			return transaction.Entries[order[a]].AccountID < transaction.Entries[order[b]].AccountID
+		})
+
+		for _, i := range order {
+			entry := &transaction.Entries[i]
+
+			account, err := lockAccount(tx, entry.AccountID)
+			if err != nil {
+				return err
+			}
+
+			account.Balance = roundAmount(account.Balance + entry.Amount)
+			if err := tx.Model(account).Update("balance", account.Balance).Error; err != nil {
+				return err
+			}
+
+			entry.TransactionID = transaction.ID
+			entry.BalanceAfter = account.Balance
+
+			// Баланс в user_limits - копия остатка счета для старого кода и админки
+			if account.UserID != nil {
+				if err := tx.Model(&domain.UserLimit{}).
+					Where("user_id = ?", *account.UserID).
+					Update("balance", account.Balance).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		// Повтор операции отклоняет уникальный индекс (type, reference): предварительная проверка
+		// не защитила бы от параллельных проводок, а вся транзакция вместе с балансами откатывается
+		return tx.Create(transaction).Error
+	})
+	if isDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return fmt.Errorf("failed to post ledger transaction: %w", err)
+	}
+	return nil
+}
+
+// lockAccount создает счет при первой проводке и блокирует его строку до конца транзакции
+func lockAccount(tx *gorm.DB, accountID string) (*domain.LedgerAccount, error) {
+	account := &domain.LedgerAccount{ID: accountID}
+	if userID, ok := strings.CutPrefix(accountID, "user:"); ok {
+		account.UserID = &userID
+	}
+
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(account).Error; err != nil {
+		return nil, err
+	}
+
+	var locked domain.LedgerAccount
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, "id = ?", accountID).Error; err != nil {
+		return nil, err
+	}
+	return &locked, nil
+}
+
+func (r *ledgerRepository) GetAccount(ctx context.Context, accountID string) (*domain.LedgerAccount, error) {
+	var account domain.LedgerAccount
+	if err := r.db.WithContext(ctx).First(&account, "id = ?", accountID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get ledger account: %w", err)
+	}
+	return &account, nil
+}
+
+func (r *ledgerRepository) ListEntries(ctx context.Context, accountID string, limit, offset int) ([]*domain.LedgerEntry, error) {
+	var entries []*domain.LedgerEntry
+	query := r.db.WithContext(ctx).Preload("Transaction").
+		Where("account_id = ?", accountID).
+		Order("created_at DESC, id DESC")
+	if limit > 0 {
+		query = query.Limit(limit).Offset(offset)
+	}
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to list ledger entries: %w", err)
+	}
+	return entries, nil
+}
+
+func (r *ledgerRepository) ListUnbilledRequests(ctx context.Context, since time.Time, limit int) ([]*domain.Request, error) {
+	var requests []*domain.Request
+	err := r.db.WithContext(ctx).Select("requests.*").
+		Joins("LEFT JOIN ledger_transactions ON ledger_transactions.reference = requests.id AND ledger_transactions.type = ?", domain.LedgerTxUsage).
+		Where("ledger_transactions.id IS NULL AND requests.total_cost > 0 AND requests.status = ? AND requests.created_at >= ?",
+			domain.RequestStatusCompleted, since).
+		Order("requests.created_at").
+		Limit(limit).
+		Find(&requests).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unbilled requests: %w", err)
+	}
+	return requests, nil
+}
+
+func (r *ledgerRepository) ListUnopenedBalances(ctx context.Context) ([]*domain.UserLimit, error) {
+	var limits []*domain.UserLimit
+	err := r.db.WithContext(ctx).Select("user_limits.*").
+		Joins("LEFT JOIN ledger_accounts ON ledger_accounts.user_id = user_limits.user_id").
+		Where("ledger_accounts.id IS NULL AND user_limits.balance <> 0").
+		Find(&limits).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unopened balances: %w", err)
+	}
+	return limits, nil
+}
+
+// roundAmount округляет сумму до точности колонок decimal(14,6)
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*1e6) / 1e6
+}
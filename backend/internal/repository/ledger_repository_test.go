@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"oneui-hub/internal/domain"
+)
+
+// TestRequest - запрос без связей, которые SQLite не может создать
+type TestRequest struct {
+	ID           string    `gorm:"type:varchar(36);primaryKey"`
+	UserID       string    `gorm:"type:varchar(36);not null"`
+	TeamID       *string   `gorm:"type:varchar(36)"`
+	InputTokens  int       `gorm:"not null;default:0"`
+	OutputTokens int       `gorm:"not null;default:0"`
+	TotalCost    float64   `gorm:"type:decimal(10,6);not null"`
+	Status       string    `gorm:"type:varchar(50)"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+func (TestRequest) TableName() string {
+	return "requests"
+}
+
+func setupLedgerTestDB(t *testing.T) *gorm.DB {
+	// TranslateError превращает нарушение уникального индекса SQLite в gorm.ErrDuplicatedKey, как для MySQL
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true})
+	require.NoError(t, err)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	require.NoError(t, db.AutoMigrate(
+		&domain.LedgerAccount{},
+		&domain.LedgerTransaction{},
+		&domain.LedgerEntry{},
+		&TestRequest{},
+		&TestUserLimit{},
+	))
+	return db
+}
+
+func newLedgerTransaction(txType, userID string, amount float64, counterAccount string, reference *string) *domain.LedgerTransaction {
+	id := uuid.New().String()
+	return &domain.LedgerTransaction{
+		ID:        id,
+		Type:      txType,
+		UserID:    userID,
+		Amount:    amount,
+		Reference: reference,
+		Entries: []domain.LedgerEntry{
+			{ID: uuid.New().String(), AccountID: domain.LedgerUserAccount(userID), Amount: amount},
+			{ID: uuid.New().String(), AccountID: counterAccount, Amount: -amount},
+		},
+	}
+}
+
+func TestLedgerRepository_Post(t *testing.T) {
+	db := setupLedgerTestDB(t)
+	repo := NewLedgerRepository(db)
+	ctx := context.Background()
+
+	zero := 0.0
+	require.NoError(t, db.Create(&TestUserLimit{UserID: "user-1", Balance: &zero}).Error)
+
+	require.NoError(t, repo.Post(ctx, newLedgerTransaction(domain.LedgerTxTopUp, "user-1", 10, domain.LedgerAccountCash, nil)))
+
+	requestID := "request-1"
+	usage := newLedgerTransaction(domain.LedgerTxUsage, "user-1", -0.125, domain.LedgerAccountRevenue, &requestID)
+	require.NoError(t, repo.Post(ctx, usage))
+	assert.Equal(t, 9.875, usage.Entries[0].BalanceAfter)
+	assert.Equal(t, 0.125, usage.Entries[1].BalanceAfter)
+
+	// Повторное списание за тот же запрос отклоняет уникальный индекс, балансы не меняются
+	duplicate := newLedgerTransaction(domain.LedgerTxUsage, "user-1", -0.125, domain.LedgerAccountRevenue, &requestID)
+	assert.ErrorIs(t, repo.Post(ctx, duplicate), ErrDuplicate)
+
+	account, err := repo.GetAccount(ctx, domain.LedgerUserAccount("user-1"))
+	require.NoError(t, err)
+	assert.Equal(t, 9.875, account.Balance)
+
+	// Баланс в user_limits повторяет остаток счета
+	var limit TestUserLimit
+	require.NoError(t, db.First(&limit, "user_id = ?", "user-1").Error)
+	assert.Equal(t, 9.875, *limit.Balance)
+
+	// Двойная запись: сумма всех проводок равна нулю
+	var total float64
+	require.NoError(t, db.Model(&domain.LedgerEntry{}).Select("COALESCE(SUM(amount), 0)").Scan(&total).Error)
+	assert.InDelta(t, 0, total, 1e-9)
+
+	entries, err := repo.ListEntries(ctx, domain.LedgerUserAccount("user-1"), 10, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.NotNil(t, entries[0].Transaction)
+}
+
+func TestIsDuplicateKeyError(t *testing.T) {
+	assert.True(t, isDuplicateKeyError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}))
+	assert.True(t, isDuplicateKeyError(fmt.Errorf("insert: %w", gorm.ErrDuplicatedKey)))
+	assert.False(t, isDuplicateKeyError(&mysql.MySQLError{Number: 1213, Message: "Deadlock found"}))
+	assert.False(t, isDuplicateKeyError(nil))
+}
+
+func TestLedgerRepository_ListUnbilledRequests(t *testing.T) {
+	db := setupLedgerTestDB(t)
+	repo := NewLedgerRepository(db)
+	ctx := context.Background()
+
+	now := time.Now()
+	requests := []*TestRequest{
+		{ID: "billed", UserID: "user-1", TotalCost: 1, Status: domain.RequestStatusCompleted, CreatedAt: now},
+		{ID: "unbilled", UserID: "user-1", TotalCost: 2, Status: domain.RequestStatusCompleted, CreatedAt: now},
+		{ID: "free", UserID: "user-1", TotalCost: 0, Status: domain.RequestStatusCompleted, CreatedAt: now},
+		{ID: "failed", UserID: "user-1", TotalCost: 3, Status: domain.RequestStatusFailed, CreatedAt: now},
+		{ID: "old", UserID: "user-1", TotalCost: 4, Status: domain.RequestStatusCompleted, CreatedAt: now.Add(-48 * time.Hour)},
+	}
+	for _, request := range requests {
+		require.NoError(t, db.Create(request).Error)
+	}
+
+	billed := "billed"
+	require.NoError(t, repo.Post(ctx, newLedgerTransaction(domain.LedgerTxUsage, "user-1", -1, domain.LedgerAccountRevenue, &billed)))
+
+	unbilled, err := repo.ListUnbilledRequests(ctx, now.Add(-24*time.Hour), 100)
+	require.NoError(t, err)
+	require.Len(t, unbilled, 1)
+	assert.Equal(t, "unbilled", unbilled[0].ID)
+}
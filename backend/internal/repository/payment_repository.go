@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"oneui-hub/internal/domain"
+)
+
+type paymentRepository struct {
+	db *gorm.DB
+}
+
+func NewPaymentRepository(db *gorm.DB) PaymentRepository {
+	return &paymentRepository{db: db}
+}
+
+func (r *paymentRepository) Create(ctx context.Context, payment *domain.Payment) error {
+	if err := r.db.WithContext(ctx).Create(payment).Error; err != nil {
+		return fmt.Errorf("failed to create payment: %w", err)
+	}
+	return nil
+}
+
+func (r *paymentRepository) GetByID(ctx context.Context, id string) (*domain.Payment, error) {
+	var payment domain.Payment
+	if err := r.db.WithContext(ctx).First(&payment, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get payment: %w", err)
+	}
+	return &payment, nil
+}
+
+func (r *paymentRepository) GetBySessionID(ctx context.Context, provider, sessionID string) (*domain.Payment, error) {
+	var payment domain.Payment
+	err := r.db.WithContext(ctx).
+		Where("provider = ? AND provider_session_id = ?", provider, sessionID).
+		First(&payment).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get payment by session: %w", err)
+	}
+	return &payment, nil
+}
+
+func (r *paymentRepository) Update(ctx context.Context, payment *domain.Payment) error {
+	if err := r.db.WithContext(ctx).Save(payment).Error; err != nil {
+		return fmt.Errorf("failed to update payment: %w", err)
+	}
+	return nil
+}
+
+func (r *paymentRepository) ListByUser(ctx context.Context, userID string, limit, offset int) ([]*domain.Payment, error) {
+	var payments []*domain.Payment
+	query := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit).Offset(offset)
+	}
+	if err := query.Find(&payments).Error; err != nil {
+		return nil, fmt.Errorf("failed to list payments: %w", err)
+	}
+	return payments, nil
+}
+
+func (r *paymentRepository) ApplyEvent(ctx context.Context, event *domain.PaymentEvent, apply func(payment *domain.Payment) error) (bool, error) {
+	applied := false
+	var applyErr error
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Блокировка платежа упорядочивает события одного платежа, в том числе повторные доставки
+		var payment domain.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, "id = ?", event.PaymentID).Error; err != nil {
+			return err
+		}
+
+		var existing domain.PaymentEvent
+		err := tx.Where("provider = ? AND event_id = ?", event.Provider, event.EventID).First(&existing).Error
+		if err == nil {
+			*event = existing
+			return nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		if applyErr = apply(&payment); applyErr != nil {
+			return applyErr
+		}
+		if err := tx.Save(&payment).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(event).Error; err != nil {
+			return err
+		}
+
+		applied = true
+		return nil
+	})
+	if applyErr != nil {
+		return false, applyErr
+	}
+	if err == gorm.ErrRecordNotFound {
+		return false, ErrNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to apply payment event: %w", err)
+	}
+	return applied, nil
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"oneui-hub/internal/domain"
+)
+
+type pricingRepository struct {
+	db *gorm.DB
+}
+
+func NewPricingRepository(db *gorm.DB) PricingRepository {
+	return &pricingRepository{db: db}
+}
+
+func (r *pricingRepository) CreateRule(ctx context.Context, rule *domain.PriceRule) error {
+	if err := r.db.WithContext(ctx).Create(rule).Error; err != nil {
+		return fmt.Errorf("failed to create price rule: %w", err)
+	}
+	return nil
+}
+
+func (r *pricingRepository) GetRuleByID(ctx context.Context, id string) (*domain.PriceRule, error) {
+	var rule domain.PriceRule
+	if err := r.db.WithContext(ctx).First(&rule, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get price rule: %w", err)
+	}
+	return &rule, nil
+}
+
+func (r *pricingRepository) DeleteRule(ctx context.Context, id string) error {
+	result := r.db.WithContext(ctx).Delete(&domain.PriceRule{}, "id = ?", id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete price rule: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pricingRepository) ListRules(ctx context.Context, until time.Time) ([]*domain.PriceRule, error) {
+	var rules []*domain.PriceRule
+	query := r.db.WithContext(ctx).Order("effective_from DESC, created_at DESC")
+	if !until.IsZero() {
+		query = query.Where("effective_from <= ?", until)
+	}
+	if err := query.Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to list price rules: %w", err)
+	}
+	return rules, nil
+}
+
+func (r *pricingRepository) CreatePrice(ctx context.Context, price *domain.ModelPrice) error {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(price)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create model price: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (r *pricingRepository) GetPriceByID(ctx context.Context, id string) (*domain.ModelPrice, error) {
+	var price domain.ModelPrice
+	if err := r.db.WithContext(ctx).First(&price, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get model price: %w", err)
+	}
+	return &price, nil
+}
+
+func (r *pricingRepository) GetLatestPrice(ctx context.Context, modelID, tierID string) (*domain.ModelPrice, error) {
+	var price domain.ModelPrice
+	err := r.db.WithContext(ctx).
+		Where("model_id = ? AND tier_id = ?", modelID, tierID).
+		Order("version DESC").
+		First(&price).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get latest model price: %w", err)
+	}
+	return &price, nil
+}
+
+func (r *pricingRepository) ListPrices(ctx context.Context, modelID, tierID string, limit, offset int) ([]*domain.ModelPrice, error) {
+	var prices []*domain.ModelPrice
+	query := r.db.WithContext(ctx).Where("model_id = ?", modelID).Order("effective_from DESC, version DESC")
+	if tierID != "" {
+		query = query.Where("tier_id = ?", tierID)
+	}
+	if limit > 0 {
+		query = query.Limit(limit).Offset(offset)
+	}
+	if err := query.Find(&prices).Error; err != nil {
+		return nil, fmt.Errorf("failed to list model prices: %w", err)
+	}
+	return prices, nil
+}
@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"oneui-hub/internal/domain"
+)
+
+// PromoUsage - состояние активаций, по которому проверяется возможность активировать промокод
+type PromoUsage struct {
+	// UserRedemptions - сколько раз пользователь уже активировал этот код
+	UserRedemptions int64
+	// ActiveTierGrant - у пользователя уже действует временный тариф
+	ActiveTierGrant bool
+	// TierPinned - тариф пользователя закреплен администратором
+	TierPinned bool
+	// CurrentTierPrice и GrantedTierPrice - цены текущего тарифа пользователя и тарифа промокода;
+	// заполняются только для кодов с тарифом
+	CurrentTierPrice float64
+	GrantedTierPrice float64
+}
+
+type promoRepository struct {
+	db *gorm.DB
+}
+
+func NewPromoRepository(db *gorm.DB) PromoRepository {
+	return &promoRepository{db: db}
+}
+
+func (r *promoRepository) CreateCode(ctx context.Context, code *domain.PromoCode) error {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(code)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create promo code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (r *promoRepository) GetCodeByID(ctx context.Context, id string) (*domain.PromoCode, error) {
+	var code domain.PromoCode
+	if err := r.db.WithContext(ctx).First(&code, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get promo code: %w", err)
+	}
+	return &code, nil
+}
+
+func (r *promoRepository) UpdateCode(ctx context.Context, code *domain.PromoCode) error {
+	if err := r.db.WithContext(ctx).Save(code).Error; err != nil {
+		return fmt.Errorf("failed to update promo code: %w", err)
+	}
+	return nil
+}
+
+func (r *promoRepository) ListCodes(ctx context.Context, limit, offset int) ([]*domain.PromoCode, error) {
+	var codes []*domain.PromoCode
+	query := r.db.WithContext(ctx).Order("created_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit).Offset(offset)
+	}
+	if err := query.Find(&codes).Error; err != nil {
+		return nil, fmt.Errorf("failed to list promo codes: %w", err)
+	}
+	return codes, nil
+}
+
+func (r *promoRepository) Redeem(ctx context.Context, code string, redemption *domain.PromoRedemption, change *domain.TierChange, check func(code *domain.PromoCode, usage *PromoUsage) error) error {
+	var checkErr error
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Строка кода блокирует параллельные активации, чтобы не превысить лимиты
+		var promo domain.PromoCode
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&promo, "code = ?", code).Error; err != nil {
+			return err
+		}
+
+		// Строка пользователя блокирует параллельные активации разных кодов одним пользователем
+		var user domain.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "tier_id", "tier_pinned").
+			First(&user, "id = ?", redemption.UserID).Error; err != nil {
+			return err
+		}
+
+		usage := &PromoUsage{}
+		if err := tx.Model(&domain.PromoRedemption{}).
+			Where("promo_code_id = ? AND user_id = ?", promo.ID, redemption.UserID).
+			Count(&usage.UserRedemptions).Error; err != nil {
+			return err
+		}
+
+		var activeGrants int64
+		if err := tx.Model(&domain.PromoRedemption{}).
+			Where("user_id = ? AND type = ? AND reverted_at IS NULL AND expires_at > ?",
+				redemption.UserID, domain.PromoTypeTierUpgrade, redemption.RedeemedAt).
+			Count(&activeGrants).Error; err != nil {
+			return err
+		}
+		usage.ActiveTierGrant = activeGrants > 0
+		usage.TierPinned = user.TierPinned
+
+		if promo.TierID != nil {
+			var tiers []domain.Tier
+			if err := tx.Select("id", "price").Where("id IN ?", []string{user.TierID, *promo.TierID}).
+				Find(&tiers).Error; err != nil {
+				return err
+			}
+			for _, tier := range tiers {
+				if tier.ID == user.TierID {
+					usage.CurrentTierPrice = tier.Price
+				}
+				if tier.ID == *promo.TierID {
+					usage.GrantedTierPrice = tier.Price
+				}
+			}
+		}
+
+		if checkErr = check(&promo, usage); checkErr != nil {
+			return checkErr
+		}
+
+		redemption.PromoCodeID = promo.ID
+		redemption.Code = promo.Code
+		if redemption.GrantedTierID != nil {
+			previous := user.TierID
+			redemption.PreviousTierID = &previous
+			if err := tx.Model(&domain.User{}).Where("id = ?", user.ID).
+				Update("tier_id", *redemption.GrantedTierID).Error; err != nil {
+				return err
+			}
+
+			change.UserID = user.ID
+			change.FromTierID = previous
+			change.ToTierID = *redemption.GrantedTierID
+			change.Pinned = user.TierPinned
+			change.Note = "Promo code " + promo.Code
+			if err := tx.Create(change).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(redemption).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&domain.PromoCode{}).Where("id = ?", promo.ID).
+			Update("redemption_count", gorm.Expr("redemption_count + 1")).Error
+	})
+	if checkErr != nil {
+		return checkErr
+	}
+	if err == gorm.ErrRecordNotFound {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to redeem promo code: %w", err)
+	}
+	return nil
+}
+
+func (r *promoRepository) CancelRedemption(ctx context.Context, redemption *domain.PromoRedemption) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&domain.PromoRedemption{}, "id = ?", redemption.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		if redemption.GrantedTierID != nil && redemption.PreviousTierID != nil {
+			if err := tx.Model(&domain.User{}).
+				Where("id = ? AND tier_id = ?", redemption.UserID, *redemption.GrantedTierID).
+				Update("tier_id", *redemption.PreviousTierID).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&domain.PromoCode{}).Where("id = ? AND redemption_count > 0", redemption.PromoCodeID).
+			Update("redemption_count", gorm.Expr("redemption_count - 1")).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cancel promo redemption: %w", err)
+	}
+	return nil
+}
+
+func (r *promoRepository) ListRedemptionsByUser(ctx context.Context, userID string, limit, offset int) ([]*domain.PromoRedemption, error) {
+	var redemptions []*domain.PromoRedemption
+	query := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("redeemed_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit).Offset(offset)
+	}
+	if err := query.Find(&redemptions).Error; err != nil {
+		return nil, fmt.Errorf("failed to list promo redemptions: %w", err)
+	}
+	return redemptions, nil
+}
+
+func (r *promoRepository) ListActiveRedemptions(ctx context.Context, userID, promoType string, now time.Time) ([]*domain.PromoRedemption, error) {
+	var redemptions []*domain.PromoRedemption
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND type = ? AND reverted_at IS NULL AND expires_at > ?", userID, promoType, now).
+		Order("expires_at DESC").
+		Find(&redemptions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active promo redemptions: %w", err)
+	}
+	return redemptions, nil
+}
+
+func (r *promoRepository) ListExpiredTierGrants(ctx context.Context, now time.Time, limit int) ([]*domain.PromoRedemption, error) {
+	var redemptions []*domain.PromoRedemption
+	query := r.db.WithContext(ctx).
+		Where("type = ? AND reverted_at IS NULL AND expires_at <= ?", domain.PromoTypeTierUpgrade, now).
+		Order("expires_at")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&redemptions).Error; err != nil {
+		return nil, fmt.Errorf("failed to list expired tier grants: %w", err)
+	}
+	return redemptions, nil
+}
+
+func (r *promoRepository) RevertTierGrant(ctx context.Context, redemption *domain.PromoRedemption, change *domain.TierChange, now time.Time) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&domain.PromoRedemption{}).
+			Where("id = ? AND reverted_at IS NULL", redemption.ID).
+			Update("reverted_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		// Активацию уже отменил другой экземпляр задачи
+		if result.RowsAffected == 0 || redemption.GrantedTierID == nil || redemption.PreviousTierID == nil {
+			return nil
+		}
+
+		// Если тариф пользователя за это время сменили или администратор закрепил его, оставляем как есть
+		result = tx.Model(&domain.User{}).
+			Where("id = ? AND tier_id = ? AND tier_pinned = ?", redemption.UserID, *redemption.GrantedTierID, false).
+			Update("tier_id", *redemption.PreviousTierID)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		change.UserID = redemption.UserID
+		change.FromTierID = *redemption.GrantedTierID
+		change.ToTierID = *redemption.PreviousTierID
+		change.Note = "Promo code " + redemption.Code + " expired"
+		return tx.Create(change).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revert tier grant: %w", err)
+	}
+	redemption.RevertedAt = &now
+	return nil
+}
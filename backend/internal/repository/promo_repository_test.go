@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"oneui-hub/internal/domain"
+)
+
+func setupPromoTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	require.NoError(t, db.AutoMigrate(&TestUser{}, &TestTier{}, &domain.PromoCode{}, &domain.PromoRedemption{}, &domain.TierChange{}))
+	for _, tier := range []*TestTier{{ID: "free", Name: "Free"}, {ID: "pro", Name: "Pro", Price: 50}, {ID: "enterprise", Name: "Enterprise", Price: 500}} {
+		require.NoError(t, db.Create(tier).Error)
+	}
+	return db
+}
+
+// promoTestUserTier читает только тариф: репозиторий обновляет updated_at в формате domain.User
+func promoTestUserTier(t *testing.T, db *gorm.DB, userID string) string {
+	var tierID string
+	require.NoError(t, db.Table("users").Select("tier_id").Where("id = ?", userID).Scan(&tierID).Error)
+	return tierID
+}
+
+func TestPromoRepository_RedeemTierGrant(t *testing.T) {
+	db := setupPromoTestDB(t)
+	repo := NewPromoRepository(db)
+	ctx := context.Background()
+
+	require.NoError(t, db.Create(&TestUser{ID: "user-1", Email: "user@example.com", PasswordHash: "x", TierID: "free"}).Error)
+	proTier := "pro"
+	code := &domain.PromoCode{ID: "code-1", Code: "PRO30", Type: domain.PromoTypeTierUpgrade, TierID: &proTier, DurationDays: 30, PerUserLimit: 1, IsActive: true}
+	require.NoError(t, repo.CreateCode(ctx, code))
+	assert.ErrorIs(t, repo.CreateCode(ctx, &domain.PromoCode{ID: "code-2", Code: "PRO30", Type: domain.PromoTypeCredit}), ErrDuplicate)
+
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := now.AddDate(0, 0, 30)
+	redemption := &domain.PromoRedemption{ID: "r-1", UserID: "user-1", RedeemedAt: now}
+	err := repo.Redeem(ctx, "PRO30", redemption, &domain.TierChange{ID: "change-1", Reason: domain.TierChangeReasonPromo}, func(promo *domain.PromoCode, usage *PromoUsage) error {
+		assert.Equal(t, int64(0), usage.UserRedemptions)
+		assert.False(t, usage.ActiveTierGrant)
+		assert.False(t, usage.TierPinned)
+		assert.Equal(t, 0.0, usage.CurrentTierPrice)
+		assert.Equal(t, 50.0, usage.GrantedTierPrice)
+		redemption.Type = promo.Type
+		redemption.GrantedTierID = promo.TierID
+		redemption.ExpiresAt = &expiresAt
+		return nil
+	})
+	require.NoError(t, err)
+	require.NotNil(t, redemption.PreviousTierID)
+	assert.Equal(t, "free", *redemption.PreviousTierID)
+	assert.Equal(t, "PRO30", redemption.Code)
+
+	assert.Equal(t, "pro", promoTestUserTier(t, db, "user-1"))
+
+	stored, err := repo.GetCodeByID(ctx, "code-1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, stored.RedemptionCount)
+
+	// Повторная активация видит прошлую активацию и действующий тариф
+	err = repo.Redeem(ctx, "PRO30", &domain.PromoRedemption{ID: "r-2", UserID: "user-1", RedeemedAt: now.AddDate(0, 0, 1)}, &domain.TierChange{ID: "change-2"},
+		func(promo *domain.PromoCode, usage *PromoUsage) error {
+			assert.Equal(t, int64(1), usage.UserRedemptions)
+			assert.True(t, usage.ActiveTierGrant)
+			return ErrDuplicate
+		})
+	assert.ErrorIs(t, err, ErrDuplicate)
+	assert.ErrorIs(t, repo.Redeem(ctx, "MISSING", &domain.PromoRedemption{ID: "r-3", UserID: "user-1", RedeemedAt: now}, &domain.TierChange{ID: "change-3"},
+		func(*domain.PromoCode, *PromoUsage) error { return nil }), ErrNotFound)
+
+	expired, err := repo.ListExpiredTierGrants(ctx, expiresAt, 10)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+
+	require.NoError(t, repo.RevertTierGrant(ctx, expired[0], &domain.TierChange{ID: "change-4", Reason: domain.TierChangeReasonPromoExpired}, expiresAt))
+	assert.Equal(t, "free", promoTestUserTier(t, db, "user-1"))
+
+	var history []domain.TierChange
+	require.NoError(t, db.Order("created_at, id").Find(&history).Error)
+	require.Len(t, history, 2)
+	assert.Equal(t, "free", history[0].FromTierID)
+	assert.Equal(t, "pro", history[0].ToTierID)
+	assert.Equal(t, domain.TierChangeReasonPromo, history[0].Reason)
+	assert.Equal(t, "pro", history[1].FromTierID)
+	assert.Equal(t, "free", history[1].ToTierID)
+	assert.Equal(t, domain.TierChangeReasonPromoExpired, history[1].Reason)
+
+	expired, err = repo.ListExpiredTierGrants(ctx, expiresAt, 10)
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+}
+
+func TestPromoRepository_RedeemReportsPinnedAndHigherTier(t *testing.T) {
+	db := setupPromoTestDB(t)
+	repo := NewPromoRepository(db)
+	ctx := context.Background()
+
+	require.NoError(t, db.Create(&TestUser{ID: "user-1", Email: "user@example.com", PasswordHash: "x", TierID: "enterprise", TierPinned: true}).Error)
+	proTier := "pro"
+	require.NoError(t, repo.CreateCode(ctx, &domain.PromoCode{ID: "code-1", Code: "PRO30", Type: domain.PromoTypeTierUpgrade, TierID: &proTier, DurationDays: 30, IsActive: true}))
+
+	rejected := errors.New("rejected")
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	err := repo.Redeem(ctx, "PRO30", &domain.PromoRedemption{ID: "r-1", UserID: "user-1", RedeemedAt: now}, &domain.TierChange{ID: "change-1"},
+		func(promo *domain.PromoCode, usage *PromoUsage) error {
+			assert.True(t, usage.TierPinned)
+			assert.Equal(t, 500.0, usage.CurrentTierPrice)
+			assert.Equal(t, 50.0, usage.GrantedTierPrice)
+			return rejected
+		})
+	assert.ErrorIs(t, err, rejected)
+	assert.Equal(t, "enterprise", promoTestUserTier(t, db, "user-1"))
+}
+
+func TestPromoRepository_RevertKeepsChangedTier(t *testing.T) {
+	db := setupPromoTestDB(t)
+	repo := NewPromoRepository(db)
+	ctx := context.Background()
+
+	require.NoError(t, db.Create(&TestUser{ID: "user-1", Email: "user@example.com", PasswordHash: "x", TierID: "pro"}).Error)
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	granted, previous := "pro", "free"
+	redemption := &domain.PromoRedemption{
+		ID: "r-1", PromoCodeID: "code-1", UserID: "user-1", Code: "PRO30", Type: domain.PromoTypeTierUpgrade,
+		GrantedTierID: &granted, PreviousTierID: &previous, ExpiresAt: &now, RedeemedAt: now.AddDate(0, 0, -30),
+	}
+	require.NoError(t, db.Create(redemption).Error)
+
+	// Администратор перевел пользователя на другой тариф, пока действовал временный
+	require.NoError(t, db.Model(&TestUser{}).Where("id = ?", "user-1").Update("tier_id", "enterprise").Error)
+	require.NoError(t, repo.RevertTierGrant(ctx, redemption, &domain.TierChange{ID: "change-1"}, now))
+
+	assert.Equal(t, "enterprise", promoTestUserTier(t, db, "user-1"))
+	assert.NotNil(t, redemption.RevertedAt)
+
+	var changes int64
+	require.NoError(t, db.Model(&domain.TierChange{}).Count(&changes).Error)
+	assert.Zero(t, changes)
+}
+
+func TestPromoRepository_RevertKeepsPinnedTier(t *testing.T) {
+	db := setupPromoTestDB(t)
+	repo := NewPromoRepository(db)
+	ctx := context.Background()
+
+	require.NoError(t, db.Create(&TestUser{ID: "user-1", Email: "user@example.com", PasswordHash: "x", TierID: "pro"}).Error)
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	granted, previous := "pro", "free"
+	redemption := &domain.PromoRedemption{
+		ID: "r-1", PromoCodeID: "code-1", UserID: "user-1", Code: "PRO30", Type: domain.PromoTypeTierUpgrade,
+		GrantedTierID: &granted, PreviousTierID: &previous, ExpiresAt: &now, RedeemedAt: now.AddDate(0, 0, -30),
+	}
+	require.NoError(t, db.Create(redemption).Error)
+
+	// Администратор закрепил тот же тариф, что выдал промокод: он должен остаться
+	require.NoError(t, db.Model(&TestUser{}).Where("id = ?", "user-1").Update("tier_pinned", true).Error)
+	require.NoError(t, repo.RevertTierGrant(ctx, redemption, &domain.TierChange{ID: "change-1"}, now))
+
+	assert.Equal(t, "pro", promoTestUserTier(t, db, "user-1"))
+	assert.NotNil(t, redemption.RevertedAt)
+
+	var changes int64
+	require.NoError(t, db.Model(&domain.TierChange{}).Count(&changes).Error)
+	assert.Zero(t, changes)
+}
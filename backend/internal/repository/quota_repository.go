@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"oneui-hub/internal/domain"
+)
+
+// QuotaUsage - состояние баланса и месячного лимита токенов пользователя
+type QuotaUsage struct {
+	Balance           float64
+	MonthlyTokenLimit *int64
+	// UsedTokens - токены запросов с начала месяца
+	UsedTokens int64
+	// HeldAmount и HeldTokens - удержания запросов, которые еще выполняются
+	HeldAmount float64
+	HeldTokens int64
+	// KeyHeldAmount - удержания запросов, которые еще выполняются по ключу удержания
+	KeyHeldAmount float64
+}
+
+type quotaRepository struct {
+	db *gorm.DB
+}
+
+func NewQuotaRepository(db *gorm.DB) QuotaRepository {
+	return &quotaRepository{db: db}
+}
+
+func (r *quotaRepository) Reserve(ctx context.Context, hold *domain.QuotaHold, monthStart time.Time, check func(usage *QuotaUsage) error) error {
+	var checkErr error
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		usage := &QuotaUsage{}
+
+		// Строка user_limits блокирует параллельные резервирования и проводки по балансу пользователя
+		var limit domain.UserLimit
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&limit, "user_id = ?", hold.UserID).Error
+		switch {
+		case err == nil:
+			if limit.Balance != nil {
+				usage.Balance = *limit.Balance
+			}
+			usage.MonthlyTokenLimit = limit.MonthlyTokenLimit
+		case err != gorm.ErrRecordNotFound:
+			return err
+		}
+
+		if err := tx.Where("user_id = ? AND expires_at <= ?", hold.UserID, time.Now()).
+			Delete(&domain.QuotaHold{}).Error; err != nil {
+			return err
+		}
+
+		var held struct {
+			Amount float64
+			Tokens int64
+		}
+		if err := tx.Model(&domain.QuotaHold{}).
+			Select("COALESCE(SUM(amount), 0) AS amount, COALESCE(SUM(tokens), 0) AS tokens").
+			Where("user_id = ?", hold.UserID).
+			Scan(&held).Error; err != nil {
+			return err
+		}
+		usage.HeldAmount = held.Amount
+		usage.HeldTokens = held.Tokens
+
+		// Ключ принадлежит пользователю, поэтому его удержания тоже защищены блокировкой user_limits
+		if hold.ApiKeyID != "" {
+			if err := tx.Model(&domain.QuotaHold{}).
+				Select("COALESCE(SUM(amount), 0)").
+				Where("api_key_id = ?", hold.ApiKeyID).
+				Scan(&usage.KeyHeldAmount).Error; err != nil {
+				return err
+			}
+		}
+
+		if usage.MonthlyTokenLimit != nil && *usage.MonthlyTokenLimit > 0 {
+			if err := tx.Model(&domain.Request{}).
+				Select("COALESCE(SUM(input_tokens + output_tokens), 0)").
+				Where("user_id = ? AND created_at >= ?", hold.UserID, monthStart).
+				Scan(&usage.UsedTokens).Error; err != nil {
+				return err
+			}
+		}
+
+		if checkErr = check(usage); checkErr != nil {
+			return checkErr
+		}
+
+		return tx.Create(hold).Error
+	})
+	if checkErr != nil {
+		return checkErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reserve quota: %w", err)
+	}
+	return nil
+}
+
+func (r *quotaRepository) Release(ctx context.Context, holdID string) error {
+	if err := r.db.WithContext(ctx).Delete(&domain.QuotaHold{}, "id = ?", holdID).Error; err != nil {
+		return fmt.Errorf("failed to release quota hold: %w", err)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -85,3 +86,32 @@ func (r *requestRepository) List(ctx context.Context, limit, offset int) ([]*dom
 	}
 	return requests, nil
 }
+
+func (r *requestRepository) SumCostByApiKeys(ctx context.Context, apiKeyIDs []string, since time.Time) (float64, error) {
+	if len(apiKeyIDs) == 0 {
+		return 0, nil
+	}
+
+	var total float64
+	if err := r.db.WithContext(ctx).Model(&domain.Request{}).
+		Where("api_key_id IN ? AND created_at >= ?", apiKeyIDs, since).
+		Select("COALESCE(SUM(total_cost), 0)").
+		Scan(&total).Error; err != nil {
+		return 0, fmt.Errorf("failed to sum request cost by API keys: %w", err)
+	}
+	return total, nil
+}
+
+func (r *requestRepository) SumUsageByTeam(ctx context.Context, teamID string, from, to time.Time) ([]*UsageByUser, error) {
+	var usage []*UsageByUser
+	if err := r.db.WithContext(ctx).Model(&domain.Request{}).
+		Select("user_id, COUNT(*) AS requests, COALESCE(SUM(input_tokens), 0) AS input_tokens, "+
+			"COALESCE(SUM(output_tokens), 0) AS output_tokens, COALESCE(SUM(total_cost), 0) AS total_cost").
+		Where("team_id = ? AND created_at >= ? AND created_at < ?", teamID, from, to).
+		Group("user_id").
+		Order("total_cost DESC").
+		Scan(&usage).Error; err != nil {
+		return nil, fmt.Errorf("failed to sum team usage: %w", err)
+	}
+	return usage, nil
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"oneui-hub/internal/domain"
+)
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) Create(ctx context.Context, session *domain.Session, token *domain.RefreshToken) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+		token.SessionID = session.ID
+		return tx.Create(token).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+func (r *sessionRepository) GetByID(ctx context.Context, id string) (*domain.Session, error) {
+	var session domain.Session
+	if err := r.db.WithContext(ctx).First(&session, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get session by ID: %w", err)
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) ListActiveByUserID(ctx context.Context, userID string, now time.Time) ([]*domain.Session, error) {
+	var sessions []*domain.Session
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (r *sessionRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	var token domain.RefreshToken
+	if err := r.db.WithContext(ctx).First(&token, "token_hash = ?", tokenHash).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	return &token, nil
+}
+
+func (r *sessionRepository) Rotate(ctx context.Context, usedHash string, next *domain.RefreshToken, session *domain.Session, now time.Time) error {
+	var rotateErr error
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Условное обновление: из двух одновременных продлений одним токеном проходит только одно
+		result := tx.Model(&domain.RefreshToken{}).
+			Where("token_hash = ? AND used_at IS NULL", usedHash).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			rotateErr = ErrRefreshTokenUsed
+			return rotateErr
+		}
+
+		result = tx.Model(&domain.Session{}).
+			Where("id = ? AND revoked_at IS NULL", session.ID).
+			Updates(map[string]interface{}{
+				"expires_at":   session.ExpiresAt,
+				"last_used_at": now,
+				"ip_address":   session.IPAddress,
+				"user_agent":   session.UserAgent,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			rotateErr = ErrNotFound
+			return rotateErr
+		}
+
+		next.SessionID = session.ID
+		return tx.Create(next).Error
+	})
+	if rotateErr != nil {
+		return rotateErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	return nil
+}
+
+func (r *sessionRepository) Revoke(ctx context.Context, id, reason string, now time.Time) error {
+	result := r.db.WithContext(ctx).Model(&domain.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{"revoked_at": now, "revoke_reason": reason})
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke session: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *sessionRepository) RevokeAllByUserID(ctx context.Context, userID, reason string, now time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&domain.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{"revoked_at": now, "revoke_reason": reason})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to revoke user sessions: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+func (r *sessionRepository) DeleteInactive(ctx context.Context, before time.Time) (int64, error) {
+	var deleted int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		inactive := tx.Model(&domain.Session{}).Select("id").
+			Where("expires_at < ? OR revoked_at < ?", before, before)
+		if err := tx.Where("session_id IN (?)", inactive).Delete(&domain.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("expires_at < ? OR revoked_at < ?", before, before).Delete(&domain.Session{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete inactive sessions: %w", err)
+	}
+	return deleted, nil
+}
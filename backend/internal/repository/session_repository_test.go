@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"oneui-hub/internal/domain"
+)
+
+func setupSessionTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	require.NoError(t, db.AutoMigrate(&domain.Session{}, &domain.RefreshToken{}))
+	return db
+}
+
+func TestSessionRepository_Rotate(t *testing.T) {
+	db := setupSessionTestDB(t)
+	repo := NewSessionRepository(db)
+	ctx := context.Background()
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	session := &domain.Session{ID: "session-1", UserID: "user-1", ExpiresAt: now.Add(time.Hour), LastUsedAt: now, CreatedAt: now}
+	require.NoError(t, repo.Create(ctx, session, &domain.RefreshToken{TokenHash: "hash-1"}))
+
+	session.ExpiresAt = now.Add(2 * time.Hour)
+	session.IPAddress = "10.0.0.2"
+	require.NoError(t, repo.Rotate(ctx, "hash-1", &domain.RefreshToken{TokenHash: "hash-2"}, session, now.Add(time.Minute)))
+
+	// Использованный токен второй раз не обменивается
+	assert.ErrorIs(t, repo.Rotate(ctx, "hash-1", &domain.RefreshToken{TokenHash: "hash-3"}, session, now.Add(time.Minute)), ErrRefreshTokenUsed)
+
+	used, err := repo.GetRefreshToken(ctx, "hash-1")
+	require.NoError(t, err)
+	assert.NotNil(t, used.UsedAt)
+	next, err := repo.GetRefreshToken(ctx, "hash-2")
+	require.NoError(t, err)
+	assert.Nil(t, next.UsedAt)
+	assert.Equal(t, "session-1", next.SessionID)
+
+	stored, err := repo.GetByID(ctx, "session-1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2", stored.IPAddress)
+	assert.True(t, stored.ExpiresAt.Equal(now.Add(2*time.Hour)))
+
+	// Отозванную сессию продлить нельзя
+	require.NoError(t, repo.Revoke(ctx, "session-1", domain.SessionRevokedLogout, now.Add(2*time.Minute)))
+	assert.ErrorIs(t, repo.Revoke(ctx, "session-1", domain.SessionRevokedLogout, now.Add(2*time.Minute)), ErrNotFound)
+	assert.ErrorIs(t, repo.Rotate(ctx, "hash-2", &domain.RefreshToken{TokenHash: "hash-4"}, session, now.Add(3*time.Minute)), ErrNotFound)
+	next, err = repo.GetRefreshToken(ctx, "hash-2")
+	require.NoError(t, err)
+	assert.Nil(t, next.UsedAt, "неудачное продление откатывается целиком")
+}
+
+func TestSessionRepository_RevokeAllAndCleanup(t *testing.T) {
+	db := setupSessionTestDB(t)
+	repo := NewSessionRepository(db)
+	ctx := context.Background()
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, id := range []string{"session-1", "session-2", "session-3"} {
+		userID := "user-1"
+		if id == "session-3" {
+			userID = "user-2"
+		}
+		session := &domain.Session{ID: id, UserID: userID, ExpiresAt: now.Add(time.Hour), LastUsedAt: now.Add(time.Duration(i) * time.Minute), CreatedAt: now}
+		require.NoError(t, repo.Create(ctx, session, &domain.RefreshToken{TokenHash: "hash-" + id}))
+	}
+
+	active, err := repo.ListActiveByUserID(ctx, "user-1", now)
+	require.NoError(t, err)
+	require.Len(t, active, 2)
+	assert.Equal(t, "session-2", active[0].ID)
+
+	revoked, err := repo.RevokeAllByUserID(ctx, "user-1", domain.SessionRevokedByUser, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), revoked)
+	active, err = repo.ListActiveByUserID(ctx, "user-1", now)
+	require.NoError(t, err)
+	assert.Empty(t, active)
+
+	// Удаляются только сессии, отозванные или истекшие раньше границы, вместе с их токенами
+	deleted, err := repo.DeleteInactive(ctx, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	_, err = repo.GetByID(ctx, "session-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = repo.GetRefreshToken(ctx, "hash-session-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = repo.GetByID(ctx, "session-3")
+	assert.NoError(t, err)
+}
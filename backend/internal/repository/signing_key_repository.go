@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"oneui-hub/internal/domain"
+)
+
+type signingKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewSigningKeyRepository(db *gorm.DB) SigningKeyRepository {
+	return &signingKeyRepository{db: db}
+}
+
+func (r *signingKeyRepository) Create(ctx context.Context, key *domain.JWTSigningKey) error {
+	if err := r.db.WithContext(ctx).Create(key).Error; err != nil {
+		return fmt.Errorf("failed to create signing key: %w", err)
+	}
+	return nil
+}
+
+func (r *signingKeyRepository) List(ctx context.Context) ([]*domain.JWTSigningKey, error) {
+	var keys []*domain.JWTSigningKey
+	if err := r.db.WithContext(ctx).Order("activates_at, created_at").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list signing keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (r *signingKeyRepository) Delete(ctx context.Context, id string) error {
+	if err := r.db.WithContext(ctx).Delete(&domain.JWTSigningKey{}, "id = ?", id).Error; err != nil {
+		return fmt.Errorf("failed to delete signing key: %w", err)
+	}
+	return nil
+}
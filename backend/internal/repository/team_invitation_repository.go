@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"oneui-hub/internal/domain"
+)
+
+type teamInvitationRepository struct {
+	db *gorm.DB
+}
+
+func NewTeamInvitationRepository(db *gorm.DB) TeamInvitationRepository {
+	return &teamInvitationRepository{db: db}
+}
+
+func (r *teamInvitationRepository) Create(ctx context.Context, invitation *domain.TeamInvitation) error {
+	invitation.Email = strings.ToLower(invitation.Email)
+	if invitation.CreatedAt.IsZero() {
+		invitation.CreatedAt = time.Now()
+	}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Действует только последнее приглашение: ссылки из прошлых писем перестают работать
+		if err := pendingInvitations(tx, invitation.CreatedAt).
+			Where("team_id = ? AND email = ?", invitation.TeamID, invitation.Email).
+			Update("revoked_at", invitation.CreatedAt).Error; err != nil {
+			return err
+		}
+		return tx.Omit("Team").Create(invitation).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create team invitation: %w", err)
+	}
+	return nil
+}
+
+func (r *teamInvitationRepository) GetByID(ctx context.Context, id string) (*domain.TeamInvitation, error) {
+	var invitation domain.TeamInvitation
+	if err := r.db.WithContext(ctx).Preload("Team").First(&invitation, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get team invitation by ID: %w", err)
+	}
+	return &invitation, nil
+}
+
+func (r *teamInvitationRepository) ListPendingByTeam(ctx context.Context, teamID string, now time.Time) ([]*domain.TeamInvitation, error) {
+	var invitations []*domain.TeamInvitation
+	err := pendingInvitations(r.db.WithContext(ctx), now).
+		Where("team_id = ?", teamID).
+		Order("created_at DESC").
+		Find(&invitations).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list team invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+func (r *teamInvitationRepository) ListPendingByEmail(ctx context.Context, email string, now time.Time) ([]*domain.TeamInvitation, error) {
+	var invitations []*domain.TeamInvitation
+	err := pendingInvitations(r.db.WithContext(ctx), now).
+		Preload("Team").
+		Where("email = ?", strings.ToLower(email)).
+		Order("created_at DESC").
+		Find(&invitations).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+func (r *teamInvitationRepository) Accept(ctx context.Context, id string, member *domain.TeamMember, now time.Time) error {
+	var acceptErr error
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Условное обновление делает приглашение одноразовым даже при одновременном принятии
+		result := pendingInvitations(tx, now).
+			Where("id = ?", id).
+			Updates(map[string]interface{}{"accepted_at": now, "accepted_by": member.UserID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			acceptErr = ErrInvitationNotPending
+			return acceptErr
+		}
+
+		created := tx.Omit("User").Clauses(clause.OnConflict{DoNothing: true}).Create(member)
+		if created.Error != nil {
+			return created.Error
+		}
+		if created.RowsAffected == 0 {
+			acceptErr = ErrDuplicate
+			return acceptErr
+		}
+		return nil
+	})
+	if acceptErr != nil {
+		return acceptErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to accept team invitation: %w", err)
+	}
+	return nil
+}
+
+func (r *teamInvitationRepository) Revoke(ctx context.Context, id string, now time.Time) error {
+	result := pendingInvitations(r.db.WithContext(ctx), now).
+		Where("id = ?", id).
+		Update("revoked_at", now)
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke team invitation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvitationNotPending
+	}
+	return nil
+}
+
+// pendingInvitations ограничивает запрос приглашениями, которые еще можно принять
+func pendingInvitations(db *gorm.DB, now time.Time) *gorm.DB {
+	return db.Model(&domain.TeamInvitation{}).
+		Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", now)
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"oneui-hub/internal/domain"
+)
+
+type teamRepository struct {
+	db *gorm.DB
+}
+
+func NewTeamRepository(db *gorm.DB) TeamRepository {
+	return &teamRepository{db: db}
+}
+
+func (r *teamRepository) Create(ctx context.Context, team *domain.Team, owner *domain.TeamMember) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Tier").Create(team).Error; err != nil {
+			return err
+		}
+		owner.TeamID = team.ID
+		return tx.Omit("User").Create(owner).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create team: %w", err)
+	}
+	return nil
+}
+
+func (r *teamRepository) GetByID(ctx context.Context, id string) (*domain.Team, error) {
+	var team domain.Team
+	if err := r.db.WithContext(ctx).Preload("Tier").First(&team, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get team by ID: %w", err)
+	}
+	return &team, nil
+}
+
+func (r *teamRepository) Update(ctx context.Context, team *domain.Team) error {
+	if err := r.db.WithContext(ctx).Omit("Tier").Save(team).Error; err != nil {
+		return fmt.Errorf("failed to update team: %w", err)
+	}
+	return nil
+}
+
+func (r *teamRepository) Delete(ctx context.Context, id string) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&domain.TeamMember{}, "team_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&domain.TeamInvitation{}, "team_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.Team{}, "id = ?", id).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete team: %w", err)
+	}
+	return nil
+}
+
+func (r *teamRepository) List(ctx context.Context, limit, offset int) ([]*domain.Team, error) {
+	var teams []*domain.Team
+	query := r.db.WithContext(ctx).Order("created_at DESC")
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	if err := query.Find(&teams).Error; err != nil {
+		return nil, fmt.Errorf("failed to list teams: %w", err)
+	}
+	return teams, nil
+}
+
+func (r *teamRepository) ListByUserID(ctx context.Context, userID string) ([]*domain.Team, error) {
+	var teams []*domain.Team
+	err := r.db.WithContext(ctx).
+		Joins("JOIN team_members ON team_members.team_id = teams.id").
+		Where("team_members.user_id = ?", userID).
+		Order("teams.name").
+		Find(&teams).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user teams: %w", err)
+	}
+	return teams, nil
+}
+
+func (r *teamRepository) GetMember(ctx context.Context, teamID, userID string) (*domain.TeamMember, error) {
+	var member domain.TeamMember
+	if err := r.db.WithContext(ctx).First(&member, "team_id = ? AND user_id = ?", teamID, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get team member: %w", err)
+	}
+	return &member, nil
+}
+
+func (r *teamRepository) ListMembers(ctx context.Context, teamID string) ([]*domain.TeamMember, error) {
+	var members []*domain.TeamMember
+	err := r.db.WithContext(ctx).Preload("User").
+		Where("team_id = ?", teamID).
+		Order("created_at").
+		Find(&members).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list team members: %w", err)
+	}
+	return members, nil
+}
+
+func (r *teamRepository) AddMember(ctx context.Context, member *domain.TeamMember) error {
+	result := r.db.WithContext(ctx).Omit("User").Clauses(clause.OnConflict{DoNothing: true}).Create(member)
+	if result.Error != nil {
+		return fmt.Errorf("failed to add team member: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (r *teamRepository) UpdateMemberRole(ctx context.Context, teamID, userID, role string) error {
+	return r.changeMember(ctx, teamID, userID, func(tx *gorm.DB, member *domain.TeamMember) error {
+		return tx.Model(&domain.TeamMember{}).
+			Where("team_id = ? AND user_id = ?", teamID, userID).
+			Update("role", role).Error
+	}, role != domain.TeamRoleOwner)
+}
+
+func (r *teamRepository) RemoveMember(ctx context.Context, teamID, userID string) error {
+	return r.changeMember(ctx, teamID, userID, func(tx *gorm.DB, member *domain.TeamMember) error {
+		return tx.Delete(&domain.TeamMember{}, "team_id = ? AND user_id = ?", teamID, userID).Error
+	}, true)
+}
+
+// changeMember меняет участника команды, не позволяя убрать последнего владельца.
+// losesOwnership - перестанет ли участник быть владельцем после изменения
+func (r *teamRepository) changeMember(ctx context.Context, teamID, userID string, change func(tx *gorm.DB, member *domain.TeamMember) error, losesOwnership bool) error {
+	var changeErr error
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Блокируем владельцев команды, чтобы два владельца не сняли друг друга одновременно
+		var owners []*domain.TeamMember
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("team_id = ? AND role = ?", teamID, domain.TeamRoleOwner).
+			Find(&owners).Error; err != nil {
+			return err
+		}
+
+		var member domain.TeamMember
+		if err := tx.First(&member, "team_id = ? AND user_id = ?", teamID, userID).Error; err != nil {
+			return err
+		}
+
+		if losesOwnership && member.Role == domain.TeamRoleOwner && len(owners) <= 1 {
+			changeErr = ErrLastTeamOwner
+			return changeErr
+		}
+
+		return change(tx, &member)
+	})
+	if changeErr != nil {
+		return changeErr
+	}
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to change team member: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"oneui-hub/internal/domain"
+)
+
+func setupTeamTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	require.NoError(t, db.AutoMigrate(&TestUser{}, &domain.Team{}, &domain.TeamMember{}, &domain.TeamInvitation{}, &TestRequest{}))
+	return db
+}
+
+func TestTeamRepository_KeepsLastOwner(t *testing.T) {
+	db := setupTeamTestDB(t)
+	repo := NewTeamRepository(db)
+	ctx := context.Background()
+
+	for _, id := range []string{"user-1", "user-2"} {
+		require.NoError(t, db.Create(&TestUser{ID: id, Email: id + "@example.com", PasswordHash: "x", TierID: "free"}).Error)
+	}
+
+	team := &domain.Team{ID: "team-1", Name: "Analytics", CreatedBy: "user-1"}
+	require.NoError(t, repo.Create(ctx, team, &domain.TeamMember{UserID: "user-1", Role: domain.TeamRoleOwner}))
+	require.NoError(t, repo.AddMember(ctx, &domain.TeamMember{TeamID: "team-1", UserID: "user-2", Role: domain.TeamRoleMember}))
+	assert.ErrorIs(t, repo.AddMember(ctx, &domain.TeamMember{TeamID: "team-1", UserID: "user-2", Role: domain.TeamRoleAdmin}), ErrDuplicate)
+
+	// Единственного владельца нельзя ни понизить, ни исключить
+	assert.ErrorIs(t, repo.UpdateMemberRole(ctx, "team-1", "user-1", domain.TeamRoleAdmin), ErrLastTeamOwner)
+	assert.ErrorIs(t, repo.RemoveMember(ctx, "team-1", "user-1"), ErrLastTeamOwner)
+	assert.ErrorIs(t, repo.RemoveMember(ctx, "team-1", "user-3"), ErrNotFound)
+
+	// Со вторым владельцем первый может выйти из команды
+	require.NoError(t, repo.UpdateMemberRole(ctx, "team-1", "user-2", domain.TeamRoleOwner))
+	require.NoError(t, repo.RemoveMember(ctx, "team-1", "user-1"))
+
+	_, err := repo.GetMember(ctx, "team-1", "user-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	member, err := repo.GetMember(ctx, "team-1", "user-2")
+	require.NoError(t, err)
+	assert.Equal(t, domain.TeamRoleOwner, member.Role)
+
+	teams, err := repo.ListByUserID(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Empty(t, teams)
+	teams, err = repo.ListByUserID(ctx, "user-2")
+	require.NoError(t, err)
+	require.Len(t, teams, 1)
+	assert.Equal(t, "Analytics", teams[0].Name)
+
+	require.NoError(t, repo.Delete(ctx, "team-1"))
+	_, err = repo.GetByID(ctx, "team-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	var members int64
+	require.NoError(t, db.Model(&domain.TeamMember{}).Where("team_id = ?", "team-1").Count(&members).Error)
+	assert.Zero(t, members)
+}
+
+func TestRequestRepository_SumUsageByTeam(t *testing.T) {
+	db := setupTeamTestDB(t)
+	repo := NewRequestRepository(db)
+	ctx := context.Background()
+
+	teamID := "team-1"
+	otherTeamID := "team-2"
+	from := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	requests := []*TestRequest{
+		{ID: "r-1", UserID: "user-1", TeamID: &teamID, InputTokens: 100, OutputTokens: 50, TotalCost: 1.5, CreatedAt: from.Add(time.Hour)},
+		{ID: "r-2", UserID: "user-1", TeamID: &teamID, InputTokens: 200, OutputTokens: 10, TotalCost: 0.5, CreatedAt: from.Add(2 * time.Hour)},
+		{ID: "r-3", UserID: "user-2", TeamID: &teamID, InputTokens: 10, OutputTokens: 10, TotalCost: 0.25, CreatedAt: from.Add(3 * time.Hour)},
+		// Вне периода, другой команды и без команды - не учитываются
+		{ID: "r-4", UserID: "user-1", TeamID: &teamID, InputTokens: 1000, OutputTokens: 1000, TotalCost: 10, CreatedAt: from.Add(-time.Hour)},
+		{ID: "r-5", UserID: "user-1", TeamID: &otherTeamID, InputTokens: 1000, OutputTokens: 1000, TotalCost: 10, CreatedAt: from.Add(time.Hour)},
+		{ID: "r-6", UserID: "user-1", InputTokens: 1000, OutputTokens: 1000, TotalCost: 10, CreatedAt: from.Add(time.Hour)},
+	}
+	for _, request := range requests {
+		require.NoError(t, db.Create(request).Error)
+	}
+
+	usage, err := repo.SumUsageByTeam(ctx, teamID, from, from.AddDate(0, 1, 0))
+	require.NoError(t, err)
+	require.Len(t, usage, 2)
+
+	assert.Equal(t, "user-1", usage[0].UserID)
+	assert.Equal(t, int64(2), usage[0].Requests)
+	assert.Equal(t, int64(300), usage[0].InputTokens)
+	assert.Equal(t, int64(60), usage[0].OutputTokens)
+	assert.InDelta(t, 2.0, usage[0].TotalCost, 1e-9)
+
+	assert.Equal(t, "user-2", usage[1].UserID)
+	assert.Equal(t, int64(1), usage[1].Requests)
+}
+
+func TestTeamInvitationRepository_SingleUse(t *testing.T) {
+	db := setupTeamTestDB(t)
+	teams := NewTeamRepository(db)
+	repo := NewTeamInvitationRepository(db)
+	ctx := context.Background()
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	require.NoError(t, db.Create(&TestUser{ID: "user-1", Email: "user-1@example.com", PasswordHash: "x", TierID: "free"}).Error)
+	require.NoError(t, teams.Create(ctx, &domain.Team{ID: "team-1", Name: "Analytics", CreatedBy: "user-1"}, &domain.TeamMember{UserID: "user-1", Role: domain.TeamRoleOwner}))
+
+	first := &domain.TeamInvitation{ID: "inv-1", TeamID: "team-1", Email: "Dev@Example.com", Role: domain.TeamRoleMember, InvitedBy: "user-1", ExpiresAt: now.Add(time.Hour), CreatedAt: now}
+	require.NoError(t, repo.Create(ctx, first))
+	assert.Equal(t, "dev@example.com", first.Email)
+
+	// Повторное приглашение отзывает предыдущее
+	second := &domain.TeamInvitation{ID: "inv-2", TeamID: "team-1", Email: "dev@example.com", Role: domain.TeamRoleAdmin, InvitedBy: "user-1", ExpiresAt: now.Add(2 * time.Hour), CreatedAt: now.Add(time.Minute)}
+	require.NoError(t, repo.Create(ctx, second))
+
+	pending, err := repo.ListPendingByTeam(ctx, "team-1", now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "inv-2", pending[0].ID)
+
+	member := &domain.TeamMember{TeamID: "team-1", UserID: "user-2", Role: domain.TeamRoleAdmin}
+	assert.ErrorIs(t, repo.Accept(ctx, "inv-1", member, now.Add(time.Minute)), ErrInvitationNotPending)
+	assert.ErrorIs(t, repo.Accept(ctx, "inv-2", member, now.Add(3*time.Hour)), ErrInvitationNotPending, "истекшее приглашение не принимается")
+
+	require.NoError(t, repo.Accept(ctx, "inv-2", member, now.Add(2*time.Minute)))
+	assert.ErrorIs(t, repo.Accept(ctx, "inv-2", member, now.Add(2*time.Minute)), ErrInvitationNotPending)
+
+	accepted, err := repo.GetByID(ctx, "inv-2")
+	require.NoError(t, err)
+	require.NotNil(t, accepted.AcceptedBy)
+	assert.Equal(t, "user-2", *accepted.AcceptedBy)
+	joined, err := teams.GetMember(ctx, "team-1", "user-2")
+	require.NoError(t, err)
+	assert.Equal(t, domain.TeamRoleAdmin, joined.Role)
+
+	// Уже состоящий в команде пользователь не тратит приглашение
+	third := &domain.TeamInvitation{ID: "inv-3", TeamID: "team-1", Email: "user-1@example.com", Role: domain.TeamRoleMember, InvitedBy: "user-1", ExpiresAt: now.Add(time.Hour), CreatedAt: now}
+	require.NoError(t, repo.Create(ctx, third))
+	assert.ErrorIs(t, repo.Accept(ctx, "inv-3", &domain.TeamMember{TeamID: "team-1", UserID: "user-1", Role: domain.TeamRoleMember}, now), ErrDuplicate)
+	require.NoError(t, repo.Revoke(ctx, "inv-3", now))
+	assert.ErrorIs(t, repo.Revoke(ctx, "inv-3", now), ErrInvitationNotPending)
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"oneui-hub/internal/domain"
+)
+
+type tierHistoryRepository struct {
+	db *gorm.DB
+}
+
+func NewTierHistoryRepository(db *gorm.DB) TierHistoryRepository {
+	return &tierHistoryRepository{db: db}
+}
+
+func (r *tierHistoryRepository) ChangeUserTier(ctx context.Context, change *domain.TierChange, check func(user *domain.User) (bool, error)) (bool, error) {
+	changed := false
+	var checkErr error
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Блокировка пользователя упорядочивает автоматическую и ручную смену тарифа
+		var user domain.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "tier_id", "tier_pinned").
+			First(&user, "id = ?", change.UserID).Error; err != nil {
+			return err
+		}
+
+		var ok bool
+		if ok, checkErr = check(&user); checkErr != nil || !ok {
+			return checkErr
+		}
+		if user.TierID == change.ToTierID && user.TierPinned == change.Pinned {
+			return nil
+		}
+
+		change.FromTierID = user.TierID
+		if err := tx.Model(&domain.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"tier_id":     change.ToTierID,
+			"tier_pinned": change.Pinned,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(change).Error; err != nil {
+			return err
+		}
+		// Запланированное понижение относилось к прежнему тарифу
+		if err := tx.Delete(&domain.TierDowngrade{}, "user_id = ?", user.ID).Error; err != nil {
+			return err
+		}
+
+		changed = true
+		return nil
+	})
+	if checkErr != nil {
+		return false, checkErr
+	}
+	if err == gorm.ErrRecordNotFound {
+		return false, ErrNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to change user tier: %w", err)
+	}
+	return changed, nil
+}
+
+func (r *tierHistoryRepository) ListByUser(ctx context.Context, userID string, limit, offset int) ([]*domain.TierChange, error) {
+	var changes []*domain.TierChange
+	query := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit).Offset(offset)
+	}
+	if err := query.Find(&changes).Error; err != nil {
+		return nil, fmt.Errorf("failed to list tier history: %w", err)
+	}
+	return changes, nil
+}
+
+func (r *tierHistoryRepository) GetDowngrade(ctx context.Context, userID string) (*domain.TierDowngrade, error) {
+	var downgrade domain.TierDowngrade
+	if err := r.db.WithContext(ctx).First(&downgrade, "user_id = ?", userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get tier downgrade: %w", err)
+	}
+	return &downgrade, nil
+}
+
+func (r *tierHistoryRepository) SaveDowngrade(ctx context.Context, downgrade *domain.TierDowngrade) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"from_tier_id", "to_tier_id", "downgrade_at"}),
+	}).Create(downgrade).Error
+	if err != nil {
+		return fmt.Errorf("failed to save tier downgrade: %w", err)
+	}
+	return nil
+}
+
+func (r *tierHistoryRepository) CancelDowngrade(ctx context.Context, userID string) error {
+	if err := r.db.WithContext(ctx).Delete(&domain.TierDowngrade{}, "user_id = ?", userID).Error; err != nil {
+		return fmt.Errorf("failed to cancel tier downgrade: %w", err)
+	}
+	return nil
+}
@@ -53,6 +53,17 @@ func (r *userRepository) Update(ctx context.Context, user *domain.User) error {
 	return nil
 }
 
+func (r *userRepository) UpdateColumns(ctx context.Context, user *domain.User, columns ...string) error {
+	if len(columns) == 0 {
+		return nil
+	}
+	columns = append(columns, "updated_at")
+	if err := r.db.WithContext(ctx).Model(user).Select(columns).Updates(user).Error; err != nil {
+		return fmt.Errorf("failed to update user columns: %w", err)
+	}
+	return nil
+}
+
 func (r *userRepository) Delete(ctx context.Context, id string) error {
 	if err := r.db.WithContext(ctx).Delete(&domain.User{}, "id = ?", id).Error; err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
@@ -76,3 +87,21 @@ func (r *userRepository) List(ctx context.Context, limit, offset int) ([]*domain
 	}
 	return users, nil
 }
+
+func (r *userRepository) ListIDsByTiers(ctx context.Context, tierIDs []string, afterID string, limit int) ([]string, error) {
+	var ids []string
+	if len(tierIDs) == 0 {
+		return ids, nil
+	}
+
+	query := r.db.WithContext(ctx).Model(&domain.User{}).
+		Where("tier_id IN ? AND tier_pinned = ? AND id > ?", tierIDs, false, afterID).
+		Order("id")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to list users by tiers: %w", err)
+	}
+	return ids, nil
+}
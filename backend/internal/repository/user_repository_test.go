@@ -21,9 +21,13 @@ type TestUser struct {
 	Name         string `gorm:"type:varchar(255)"`
 	PasswordHash string `gorm:"type:varchar(255);not null"`
 	TierID       string `gorm:"type:varchar(36);not null"`
+	TierPinned   bool   `gorm:"default:false"`
 	Role         string `gorm:"type:varchar(50);default:'customer'"`
 	CreatedAt    int64  `gorm:"autoCreateTime"`
 	UpdatedAt    int64  `gorm:"autoUpdateTime"`
+
+	EmailVerifiedAt     *time.Time
+	PasswordResetSentAt *time.Time
 }
 
 func (TestUser) TableName() string {
@@ -310,6 +314,35 @@ func TestUserRepository_Update(t *testing.T) {
 	assert.Equal(t, string(domain.RoleAdmin), updatedUser.Role)
 }
 
+func TestUserRepository_UpdateColumnsKeepsTier(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	require.NoError(t, db.Create(&TestUser{ID: "user-1", Email: "user@example.com", PasswordHash: "old", TierID: "free"}).Error)
+
+	// Копия пользователя прочитана до того, как тариф сменили и закрепили
+	user := &domain.User{ID: "user-1", Email: "user@example.com", PasswordHash: "old", TierID: "free"}
+	require.NoError(t, db.Model(&TestUser{}).Where("id = ?", "user-1").
+		Updates(map[string]interface{}{"tier_id": "pro", "tier_pinned": true}).Error)
+
+	verifiedAt := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	user.PasswordHash = "new"
+	user.EmailVerifiedAt = &verifiedAt
+	user.PasswordResetSentAt = &verifiedAt
+	require.NoError(t, repo.UpdateColumns(ctx, user, "password_hash", "email_verified_at"))
+
+	var stored TestUser
+	require.NoError(t, db.Select("password_hash", "tier_id", "tier_pinned", "email_verified_at", "password_reset_sent_at").
+		First(&stored, "id = ?", "user-1").Error)
+	assert.Equal(t, "new", stored.PasswordHash)
+	require.NotNil(t, stored.EmailVerifiedAt)
+	assert.True(t, verifiedAt.Equal(*stored.EmailVerifiedAt))
+	assert.Nil(t, stored.PasswordResetSentAt, "неперечисленные колонки не сохраняются")
+	assert.Equal(t, "pro", stored.TierID)
+	assert.True(t, stored.TierPinned)
+}
+
 func TestUserRepository_Delete(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewTestUserRepository(db)
@@ -388,3 +421,122 @@ func TestUserRepository_List(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, foundUsers, 1)
 }
+
+func TestTierHistoryRepository_ChangeUserTier(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&domain.TierChange{}, &domain.TierDowngrade{}))
+	repo := NewTierHistoryRepository(db)
+	ctx := context.Background()
+
+	require.NoError(t, db.Create(&TestUser{ID: "user-1", Email: "user@example.com", PasswordHash: "x", TierID: "free"}).Error)
+
+	downgradeAt := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, repo.SaveDowngrade(ctx, &domain.TierDowngrade{UserID: "user-1", FromTierID: "free", ToTierID: "free", DowngradeAt: downgradeAt}))
+	require.NoError(t, repo.SaveDowngrade(ctx, &domain.TierDowngrade{UserID: "user-1", FromTierID: "free", ToTierID: "basic", DowngradeAt: downgradeAt}))
+	downgrade, err := repo.GetDowngrade(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, "basic", downgrade.ToTierID)
+
+	change := &domain.TierChange{ID: "change-1", UserID: "user-1", ToTierID: "pro", Reason: domain.TierChangeReasonAdmin, Pinned: true}
+	changed, err := repo.ChangeUserTier(ctx, change, func(user *domain.User) (bool, error) {
+		assert.Equal(t, "free", user.TierID)
+		assert.False(t, user.TierPinned)
+		return true, nil
+	})
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "free", change.FromTierID)
+
+	// Смена тарифа отменяет запланированное понижение
+	_, err = repo.GetDowngrade(ctx, "user-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	var stored TestUser
+	require.NoError(t, db.Select("tier_id", "tier_pinned").First(&stored, "id = ?", "user-1").Error)
+	assert.Equal(t, "pro", stored.TierID)
+	assert.True(t, stored.TierPinned)
+
+	// Отказ check не меняет тариф
+	changed, err = repo.ChangeUserTier(ctx, &domain.TierChange{ID: "change-2", UserID: "user-1", ToTierID: "business", Reason: domain.TierChangeReasonSpending},
+		func(user *domain.User) (bool, error) { return !user.TierPinned, nil })
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	_, err = repo.ChangeUserTier(ctx, &domain.TierChange{ID: "change-3", UserID: "missing", ToTierID: "pro"},
+		func(*domain.User) (bool, error) { return true, nil })
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	history, err := repo.ListByUser(ctx, "user-1", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "pro", history[0].ToTierID)
+	assert.True(t, history[0].Pinned)
+}
+
+func TestUserRepository_ListIDsByTiers(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	for _, user := range []*TestUser{
+		{ID: "user-1", Email: "1@example.com", PasswordHash: "x", TierID: "pro"},
+		{ID: "user-2", Email: "2@example.com", PasswordHash: "x", TierID: "free"},
+		{ID: "user-3", Email: "3@example.com", PasswordHash: "x", TierID: "pro", TierPinned: true},
+		{ID: "user-4", Email: "4@example.com", PasswordHash: "x", TierID: "business"},
+		{ID: "user-5", Email: "5@example.com", PasswordHash: "x", TierID: "pro"},
+	} {
+		require.NoError(t, db.Create(user).Error)
+	}
+
+	ids, err := repo.ListIDsByTiers(ctx, []string{"pro", "business"}, "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user-1", "user-4"}, ids)
+
+	ids, err = repo.ListIDsByTiers(ctx, []string{"pro", "business"}, "user-4", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user-5"}, ids)
+}
+
+func TestUserSpendingRepository_SumSince(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&domain.UserSpendingDay{}))
+	require.NoError(t, db.Exec("CREATE TABLE user_spendings (user_id TEXT PRIMARY KEY, total_spent REAL NOT NULL DEFAULT 0, total_paid REAL NOT NULL DEFAULT 0, updated_at DATETIME)").Error)
+	repo := NewUserSpendingRepository(db)
+	ctx := context.Background()
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	require.NoError(t, db.Create(&domain.UserSpendingDay{UserID: "user-1", Day: today.AddDate(0, 0, -40), Amount: 100}).Error)
+	require.NoError(t, db.Create(&domain.UserSpendingDay{UserID: "user-1", Day: today.AddDate(0, 0, -10), Amount: 20}).Error)
+
+	require.NoError(t, repo.AddSpent(ctx, "user-1", 5))
+	require.NoError(t, repo.AddSpent(ctx, "user-1", 2.5))
+	require.NoError(t, repo.AddSpent(ctx, "user-2", 1))
+
+	spending, err := repo.GetByUserID(ctx, "user-1")
+	require.NoError(t, err)
+	assert.InDelta(t, 7.5, spending.TotalSpent, 1e-9)
+
+	total, err := repo.SumSince(ctx, "user-1", today.AddDate(0, 0, -29))
+	require.NoError(t, err)
+	assert.InDelta(t, 27.5, total, 1e-9)
+
+	total, err = repo.SumSince(ctx, "user-1", today.AddDate(0, 0, -60))
+	require.NoError(t, err)
+	assert.InDelta(t, 127.5, total, 1e-9)
+
+	// Оплаты учитываются отдельно от использования, возврат их уменьшает
+	require.NoError(t, repo.AddPaid(ctx, "user-1", 50))
+	require.NoError(t, repo.AddPaid(ctx, "user-1", -20))
+
+	spending, err = repo.GetByUserID(ctx, "user-1")
+	require.NoError(t, err)
+	assert.InDelta(t, 7.5, spending.TotalSpent, 1e-9)
+	assert.InDelta(t, 30, spending.TotalPaid, 1e-9)
+
+	paid, err := repo.SumPaidSince(ctx, "user-1", today.AddDate(0, 0, -29))
+	require.NoError(t, err)
+	assert.InDelta(t, 30, paid, 1e-9)
+	total, err = repo.SumSince(ctx, "user-1", today.AddDate(0, 0, -29))
+	require.NoError(t, err)
+	assert.InDelta(t, 27.5, total, 1e-9)
+}
@@ -2,10 +2,13 @@ package repository
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"oneui-hub/internal/domain"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type userSpendingRepository struct {
@@ -35,6 +38,77 @@ func (r *userSpendingRepository) Update(ctx context.Context, spending *domain.Us
 	return r.db.WithContext(ctx).Save(spending).Error
 }
 
+func (r *userSpendingRepository) AddSpent(ctx context.Context, userID string, amount float64) error {
+	spending := &domain.UserSpending{
+		UserID:     userID,
+		TotalSpent: amount,
+	}
+	day := &domain.UserSpendingDay{
+		UserID: userID,
+		Day:    spendingDay(time.Now()),
+		Amount: amount,
+	}
+	return r.add(ctx, spending, day, "total_spent", "amount", amount)
+}
+
+func (r *userSpendingRepository) AddPaid(ctx context.Context, userID string, amount float64) error {
+	spending := &domain.UserSpending{
+		UserID:    userID,
+		TotalPaid: amount,
+	}
+	day := &domain.UserSpendingDay{
+		UserID: userID,
+		Day:    spendingDay(time.Now()),
+		Paid:   amount,
+	}
+	return r.add(ctx, spending, day, "total_paid", "paid", amount)
+}
+
+// add создает записи пользователя и дня или атомарно увеличивает в них totalColumn и dayColumn
+func (r *userSpendingRepository) add(ctx context.Context, spending *domain.UserSpending, day *domain.UserSpendingDay, totalColumn, dayColumn string, amount float64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				totalColumn:  gorm.Expr(totalColumn+" + ?", amount),
+				"updated_at": gorm.Expr("CURRENT_TIMESTAMP"),
+			}),
+		}).Create(spending).Error; err != nil {
+			return err
+		}
+
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "day"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{dayColumn: gorm.Expr(dayColumn+" + ?", amount)}),
+		}).Create(day).Error
+	})
+}
+
+func (r *userSpendingRepository) SumSince(ctx context.Context, userID string, since time.Time) (float64, error) {
+	return r.sumSince(ctx, userID, "amount", since)
+}
+
+func (r *userSpendingRepository) SumPaidSince(ctx context.Context, userID string, since time.Time) (float64, error) {
+	return r.sumSince(ctx, userID, "paid", since)
+}
+
+func (r *userSpendingRepository) sumSince(ctx context.Context, userID, column string, since time.Time) (float64, error) {
+	var total float64
+	err := r.db.WithContext(ctx).Model(&domain.UserSpendingDay{}).
+		Select("COALESCE(SUM("+column+"), 0)").
+		Where("user_id = ? AND day >= ?", userID, spendingDay(since)).
+		Scan(&total).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum user spending: %w", err)
+	}
+	return total, nil
+}
+
+// spendingDay - начало дня (UTC), к которому относятся траты
+func spendingDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
 func (r *userSpendingRepository) Delete(ctx context.Context, userID string) error {
 	return r.db.WithContext(ctx).Delete(&domain.UserSpending{}, "user_id = ?", userID).Error
 }
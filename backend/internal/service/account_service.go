@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/mail"
+	"oneui-hub/internal/repository"
+	"oneui-hub/pkg/auth"
+)
+
+// Назначения подписанных токенов из писем
+const (
+	passwordResetTokenPurpose     = "password_reset"
+	emailVerificationTokenPurpose = "email_verification"
+)
+
+// accountMailCooldown - минимальный интервал между письмами одного вида одному пользователю
+const accountMailCooldown = time.Minute
+
+var (
+	// ErrInvalidAccountToken - токен из письма поддельный или истек, пароль уже сменен
+	// или email изменился после отправки письма
+	ErrInvalidAccountToken = errors.New("invalid or expired link")
+	// ErrEmailAlreadyVerified - email пользователя уже подтвержден
+	ErrEmailAlreadyVerified = errors.New("email already verified")
+	// ErrAccountMailThrottled - письмо уже отправлено недавно
+	ErrAccountMailThrottled = errors.New("email was sent recently")
+)
+
+// AccountService восстанавливает доступ к аккаунту и подтверждает email по ссылкам из писем.
+// Токены ссылок не хранятся: подпись привязана к текущему паролю или email пользователя,
+// поэтому ссылка сброса действует один раз, а ссылка подтверждения - только для того email, на который ушла
+type AccountService interface {
+	// RequestPasswordReset отправляет ссылку сброса пароля. Для неизвестного email
+	// и повторного запроса раньше accountMailCooldown ничего не делает, чтобы не раскрывать наличие аккаунта
+	RequestPasswordReset(ctx context.Context, email string) error
+	// ResetPassword устанавливает новый пароль по токену из письма и завершает все сессии пользователя
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	// SendVerification отправляет письмо со ссылкой подтверждения email
+	SendVerification(ctx context.Context, userID string) error
+	// VerifyEmail подтверждает email по токену из письма
+	VerifyEmail(ctx context.Context, token string) (*domain.User, error)
+}
+
+type accountService struct {
+	userRepo        repository.UserRepository
+	sessionService  SessionService
+	sender          mail.Sender
+	secret          string
+	resetTTL        time.Duration
+	resetURL        string
+	verificationTTL time.Duration
+	verificationURL string
+	now             func() time.Time
+}
+
+func NewAccountService(
+	userRepo repository.UserRepository,
+	sessionService SessionService,
+	sender mail.Sender,
+	secret string,
+	resetTTL time.Duration,
+	resetURL string,
+	verificationTTL time.Duration,
+	verificationURL string,
+) AccountService {
+	return &accountService{
+		userRepo:        userRepo,
+		sessionService:  sessionService,
+		sender:          sender,
+		secret:          secret,
+		resetTTL:        resetTTL,
+		resetURL:        resetURL,
+		verificationTTL: verificationTTL,
+		verificationURL: verificationURL,
+		now:             time.Now,
+	}
+}
+
+func (s *accountService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, strings.TrimSpace(email))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	now := s.now()
+	if recentlySent(user.PasswordResetSentAt, now) {
+		return nil
+	}
+
+	expiresAt := now.Add(s.resetTTL)
+	token := auth.SignToken(s.secret, passwordResetTokenPurpose, accountTokenSubject(user.ID, user.PasswordHash), expiresAt)
+	if err := s.sender.Send(ctx, &mail.Message{
+		To:      user.Email,
+		Subject: "Сброс пароля",
+		Text: fmt.Sprintf("Кто-то запросил сброс пароля для вашего аккаунта.\n\n"+
+			"Чтобы задать новый пароль, перейдите по ссылке:\n%s\n\n"+
+			"Ссылка действует до %s. Если вы не запрашивали сброс, просто проигнорируйте это письмо.\n",
+			tokenLink(s.resetURL, token), expiresAt.UTC().Format("2006-01-02 15:04 UTC")),
+	}); err != nil {
+		return fmt.Errorf("failed to send password reset email: %w", err)
+	}
+
+	user.PasswordResetSentAt = &now
+	if err := s.userRepo.UpdateColumns(ctx, user, "password_reset_sent_at"); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	return nil
+}
+
+func (s *accountService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	user, err := s.userByToken(ctx, passwordResetTokenPurpose, token, func(user *domain.User) string {
+		return user.PasswordHash
+	})
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash new password: %w", err)
+	}
+
+	user.PasswordHash = string(hashedPassword)
+	// Письмо со ссылкой пришло на этот email - он подтвержден
+	if user.EmailVerifiedAt == nil {
+		now := s.now()
+		user.EmailVerifiedAt = &now
+	}
+	// Сохраняем только свои колонки, чтобы не затереть тариф, измененный параллельно
+	if err := s.userRepo.UpdateColumns(ctx, user, "password_hash", "email_verified_at"); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	// Пароль могли сбросить из-за утечки: завершаем сессии на всех устройствах
+	if _, err := s.sessionService.RevokeAllSessions(ctx, user.ID); err != nil {
+		fmt.Printf("Warning: failed to revoke sessions after password reset for user %s: %v\n", user.ID, err)
+	}
+	return nil
+}
+
+func (s *accountService) SendVerification(ctx context.Context, userID string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.IsEmailVerified() {
+		return ErrEmailAlreadyVerified
+	}
+
+	now := s.now()
+	if recentlySent(user.EmailVerificationSentAt, now) {
+		return ErrAccountMailThrottled
+	}
+
+	expiresAt := now.Add(s.verificationTTL)
+	token := auth.SignToken(s.secret, emailVerificationTokenPurpose, accountTokenSubject(user.ID, normalizeEmail(user.Email)), expiresAt)
+	if err := s.sender.Send(ctx, &mail.Message{
+		To:      user.Email,
+		Subject: "Подтверждение email",
+		Text: fmt.Sprintf("Подтвердите email, чтобы пользоваться всеми моделями хаба.\n"+
+			"До подтверждения доступны только бесплатные модели.\n\n"+
+			"Перейдите по ссылке:\n%s\n\n"+
+			"Ссылка действует до %s.\n",
+			tokenLink(s.verificationURL, token), expiresAt.UTC().Format("2006-01-02 15:04 UTC")),
+	}); err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+
+	user.EmailVerificationSentAt = &now
+	if err := s.userRepo.UpdateColumns(ctx, user, "email_verification_sent_at"); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	return nil
+}
+
+func (s *accountService) VerifyEmail(ctx context.Context, token string) (*domain.User, error) {
+	user, err := s.userByToken(ctx, emailVerificationTokenPurpose, token, func(user *domain.User) string {
+		return normalizeEmail(user.Email)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Повторный переход по ссылке ничего не меняет
+	if user.IsEmailVerified() {
+		return user, nil
+	}
+
+	now := s.now()
+	user.EmailVerifiedAt = &now
+	if err := s.userRepo.UpdateColumns(ctx, user, "email_verified_at"); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	return user, nil
+}
+
+// userByToken проверяет подпись токена и что привязанное к нему значение (state) у пользователя не изменилось
+func (s *accountService) userByToken(ctx context.Context, purpose, token string, state func(*domain.User) string) (*domain.User, error) {
+	subject, err := auth.VerifySignedToken(s.secret, purpose, token, s.now())
+	if err != nil {
+		return nil, ErrInvalidAccountToken
+	}
+
+	userID, fingerprint, ok := strings.Cut(subject, ":")
+	if !ok {
+		return nil, ErrInvalidAccountToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidAccountToken
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(fingerprint), []byte(stateFingerprint(state(user)))) != 1 {
+		return nil, ErrInvalidAccountToken
+	}
+	return user, nil
+}
+
+// accountTokenSubject связывает токен с пользователем и отпечатком его текущего состояния
+func accountTokenSubject(userID, state string) string {
+	return userID + ":" + stateFingerprint(state)
+}
+
+func stateFingerprint(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func recentlySent(sentAt *time.Time, now time.Time) bool {
+	return sentAt != nil && now.Sub(*sentAt) < accountMailCooldown
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/repository"
+	"oneui-hub/pkg/auth"
+)
+
+func newTestAccountService(user *domain.User) (*accountService, *capturingSender, *sessionService, *time.Time) {
+	userRepo := &MockUserRepository{}
+	userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+	userRepo.On("GetByID", mock.Anything, mock.Anything).Return(nil, repository.ErrNotFound)
+	userRepo.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+	userRepo.On("GetByEmail", mock.Anything, mock.Anything).Return(nil, repository.ErrNotFound)
+	userRepo.On("UpdateColumns", mock.Anything, user, mock.Anything).Return(nil)
+
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	sessions := NewSessionService(newFakeSessionRepository(), userRepo, auth.NewJWTManager("test-secret", 15*time.Minute), 24*time.Hour).(*sessionService)
+	sessions.now = clock
+
+	sender := &capturingSender{}
+	svc := NewAccountService(userRepo, sessions, sender, "test-secret", time.Hour, "https://hub.example/password/reset",
+		72*time.Hour, "https://hub.example/email/verify").(*accountService)
+	svc.now = clock
+	return svc, sender, sessions, &now
+}
+
+func TestAccountService_PasswordReset(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("old-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &domain.User{ID: "user-1", Email: "user@example.com", PasswordHash: string(hash)}
+	svc, sender, sessions, now := newTestAccountService(user)
+	ctx := context.Background()
+
+	// Для неизвестного email письмо не отправляется, ответ тот же
+	require.NoError(t, svc.RequestPasswordReset(ctx, "missing@example.com"))
+	assert.Empty(t, sender.messages)
+
+	require.NoError(t, svc.RequestPasswordReset(ctx, "user@example.com"))
+	require.Len(t, sender.messages, 1)
+	assert.Equal(t, "user@example.com", sender.messages[0].To)
+	token := invitationToken(t, sender.messages[0])
+
+	// Повторный запрос в течение минуты не отправляет новое письмо
+	require.NoError(t, svc.RequestPasswordReset(ctx, "user@example.com"))
+	assert.Len(t, sender.messages, 1)
+
+	tokens, err := sessions.StartSession(ctx, user, SessionMetadata{})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, svc.ResetPassword(ctx, token+"x", "new-password"), ErrInvalidAccountToken)
+	require.NoError(t, svc.ResetPassword(ctx, token, "new-password"))
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte("new-password")))
+	assert.True(t, user.IsEmailVerified(), "ссылка из письма подтверждает email")
+
+	active, err := sessions.IsSessionActive(ctx, tokens.SessionID)
+	require.NoError(t, err)
+	assert.False(t, active, "сброс пароля завершает все сессии")
+
+	// Ссылка действует один раз: после смены пароля подпись не совпадает
+	assert.ErrorIs(t, svc.ResetPassword(ctx, token, "another-password"), ErrInvalidAccountToken)
+
+	// Просроченная ссылка
+	*now = now.Add(2 * time.Minute)
+	require.NoError(t, svc.RequestPasswordReset(ctx, "user@example.com"))
+	require.Len(t, sender.messages, 2)
+	token = invitationToken(t, sender.messages[1])
+	*now = now.Add(time.Hour)
+	assert.ErrorIs(t, svc.ResetPassword(ctx, token, "another-password"), ErrInvalidAccountToken)
+}
+
+func TestAccountService_EmailVerification(t *testing.T) {
+	user := &domain.User{ID: "user-1", Email: "User@Example.com"}
+	svc, sender, _, now := newTestAccountService(user)
+	ctx := context.Background()
+
+	require.NoError(t, svc.SendVerification(ctx, "user-1"))
+	require.Len(t, sender.messages, 1)
+	first := invitationToken(t, sender.messages[0])
+
+	assert.ErrorIs(t, svc.SendVerification(ctx, "user-1"), ErrAccountMailThrottled)
+
+	// После смены email прежняя ссылка не действует
+	*now = now.Add(2 * time.Minute)
+	user.Email = "new@example.com"
+	_, err := svc.VerifyEmail(ctx, first)
+	assert.ErrorIs(t, err, ErrInvalidAccountToken)
+
+	require.NoError(t, svc.SendVerification(ctx, "user-1"))
+	require.Len(t, sender.messages, 2)
+	assert.Equal(t, "new@example.com", sender.messages[1].To)
+
+	verified, err := svc.VerifyEmail(ctx, invitationToken(t, sender.messages[1]))
+	require.NoError(t, err)
+	require.NotNil(t, verified.EmailVerifiedAt)
+	assert.Equal(t, *now, *verified.EmailVerifiedAt)
+
+	// Повторный переход по ссылке ничего не меняет
+	_, err = svc.VerifyEmail(ctx, invitationToken(t, sender.messages[1]))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, svc.SendVerification(ctx, "user-1"), ErrEmailAlreadyVerified)
+}
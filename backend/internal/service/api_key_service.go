@@ -0,0 +1,692 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/litellm"
+	"oneui-hub/internal/notification"
+	"oneui-hub/internal/repository"
+	"oneui-hub/pkg/auth"
+)
+
+// ErrInvalidApiKeyRequest - некорректные параметры ключа (ограничения, бюджет и т.п.)
+var ErrInvalidApiKeyRequest = errors.New("invalid API key request")
+
+// ApiKeyService управляет API ключами хаба и соответствующими ключами LiteLLM
+type ApiKeyService interface {
+	// CreateApiKey создает ключ в LiteLLM и сохраняет его в БД.
+	// Возвращает сохраненный ключ и сам ключ в открытом виде (показывается только один раз).
+	CreateApiKey(ctx context.Context, userID string, req *CreateApiKeyRequest) (*domain.ApiKey, string, error)
+	// CreateTeamApiKey создает ключ участника команды: запросы по нему учитываются за командой
+	// и тарифицируются по ее тарифу. Членство пользователя в команде проверяет вызывающий.
+	CreateTeamApiKey(ctx context.Context, teamID, userID string, req *CreateApiKeyRequest) (*domain.ApiKey, string, error)
+	// UpdateApiKey изменяет название и бюджет ключа
+	UpdateApiKey(ctx context.Context, keyID string, req *UpdateApiKeyRequest) (*domain.ApiKey, error)
+	// RotateApiKey выпускает ключ-преемник с теми же названием, ограничениями и бюджетом.
+	// Старый ключ остается действительным в течение gracePeriod (nil - период из конфигурации).
+	// Возвращает преемника, обновленный старый ключ и новый ключ в открытом виде.
+	RotateApiKey(ctx context.Context, keyID string, gracePeriod *time.Duration) (*domain.ApiKey, *domain.ApiKey, string, error)
+	// RevokeApiKey сразу прекращает действие ключа и удаляет его в LiteLLM. Запись о ключе
+	// сохраняется, чтобы не ломать связи ротации и историю трат
+	RevokeApiKey(ctx context.Context, keyID string) (*domain.ApiKey, error)
+	// ExpireApiKeys отзывает истекшие ключи: удаляет их в LiteLLM и помечает отозванными в БД
+	ExpireApiKeys(ctx context.Context) error
+	// NotifyExpiringApiKeys предупреждает владельцев ключей, которые скоро истекут
+	NotifyExpiringApiKeys(ctx context.Context) error
+	// GetApiKeyBudget считает траты ключа в текущем периоде бюджета по истории запросов
+	GetApiKeyBudget(ctx context.Context, apiKey *domain.ApiKey) (*ApiKeyBudget, error)
+}
+
+// CreateApiKeyRequest - параметры нового API ключа
+type CreateApiKeyRequest struct {
+	Name string `json:"name" binding:"required"`
+	// Ограничения ключа, пустые списки означают отсутствие ограничения
+	AllowedModels    []string `json:"allowed_models"`
+	AllowedCompanies []string `json:"allowed_companies"`
+	AllowedCallTypes []string `json:"allowed_call_types"`
+	AllowedCIDRs     []string `json:"allowed_cidrs"`
+	Permission       string   `json:"permission"`
+	// Лимит трат ключа в USD и период его сброса в формате LiteLLM ("1d", "30d", "1mo")
+	MaxBudget      *float64 `json:"max_budget"`
+	BudgetDuration string   `json:"budget_duration"`
+}
+
+// UpdateApiKeyRequest - изменяемые поля ключа. Не переданные поля не меняются,
+// max_budget = 0 снимает лимит трат.
+type UpdateApiKeyRequest struct {
+	Name           *string  `json:"name"`
+	MaxBudget      *float64 `json:"max_budget"`
+	BudgetDuration *string  `json:"budget_duration"`
+}
+
+// ApiKeyBudget - состояние бюджета ключа
+type ApiKeyBudget struct {
+	MaxBudget       *float64   `json:"max_budget"`
+	BudgetDuration  string     `json:"budget_duration,omitempty"`
+	Spent           float64    `json:"spent"`
+	RemainingBudget *float64   `json:"remaining_budget"`
+	PeriodStart     *time.Time `json:"period_start,omitempty"`
+	ResetAt         *time.Time `json:"reset_at,omitempty"`
+}
+
+type apiKeyService struct {
+	apiKeyRepo    repository.ApiKeyRepository
+	modelRepo     repository.ModelRepository
+	companyRepo   repository.CompanyRepository
+	requestRepo   repository.RequestRepository
+	litellmClient *litellm.Client
+	notifier      notification.Notifier
+	// rotationGracePeriod - время, в течение которого старый ключ работает после ротации
+	rotationGracePeriod time.Duration
+	// expiryNoticePeriod - за сколько до истечения ключа уведомлять владельца
+	expiryNoticePeriod time.Duration
+}
+
+func NewApiKeyService(
+	apiKeyRepo repository.ApiKeyRepository,
+	modelRepo repository.ModelRepository,
+	companyRepo repository.CompanyRepository,
+	requestRepo repository.RequestRepository,
+	litellmClient *litellm.Client,
+	notifier notification.Notifier,
+	rotationGracePeriod time.Duration,
+	expiryNoticePeriod time.Duration,
+) ApiKeyService {
+	return &apiKeyService{
+		apiKeyRepo:          apiKeyRepo,
+		modelRepo:           modelRepo,
+		companyRepo:         companyRepo,
+		requestRepo:         requestRepo,
+		litellmClient:       litellmClient,
+		notifier:            notifier,
+		rotationGracePeriod: rotationGracePeriod,
+		expiryNoticePeriod:  expiryNoticePeriod,
+	}
+}
+
+func (s *apiKeyService) CreateApiKey(ctx context.Context, userID string, req *CreateApiKeyRequest) (*domain.ApiKey, string, error) {
+	return s.createKey(ctx, userID, nil, req)
+}
+
+func (s *apiKeyService) CreateTeamApiKey(ctx context.Context, teamID, userID string, req *CreateApiKeyRequest) (*domain.ApiKey, string, error) {
+	return s.createKey(ctx, userID, &teamID, req)
+}
+
+func (s *apiKeyService) createKey(ctx context.Context, userID string, teamID *string, req *CreateApiKeyRequest) (*domain.ApiKey, string, error) {
+	scopes, err := s.validateScopes(ctx, req)
+	if err != nil {
+		return nil, "", err
+	}
+
+	maxBudget, err := validateBudget(req.MaxBudget, req.BudgetDuration)
+	if err != nil {
+		return nil, "", err
+	}
+
+	apiKey := &domain.ApiKey{
+		UserID:         userID,
+		TeamID:         teamID,
+		Name:           req.Name,
+		MaxBudget:      maxBudget,
+		BudgetDuration: req.BudgetDuration,
+	}
+	apiKey.SetScopes(scopes)
+
+	return s.issueKey(ctx, apiKey)
+}
+
+func (s *apiKeyService) RotateApiKey(ctx context.Context, keyID string, gracePeriod *time.Duration) (*domain.ApiKey, *domain.ApiKey, string, error) {
+	grace := s.rotationGracePeriod
+	if gracePeriod != nil {
+		grace = *gracePeriod
+	}
+	if grace < 0 {
+		return nil, nil, "", fmt.Errorf("%w: grace period cannot be negative", ErrInvalidApiKeyRequest)
+	}
+
+	current, err := s.apiKeyRepo.GetByID(ctx, keyID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	now := time.Now()
+	if current.RevokedAt != nil {
+		return nil, nil, "", fmt.Errorf("%w: API key has been revoked", ErrInvalidApiKeyRequest)
+	}
+	if current.SuccessorID != nil {
+		return nil, nil, "", fmt.Errorf("%w: API key has already been rotated", ErrInvalidApiKeyRequest)
+	}
+	if current.ExpiresAt != nil && !current.ExpiresAt.After(now) {
+		return nil, nil, "", fmt.Errorf("%w: API key has expired", ErrInvalidApiKeyRequest)
+	}
+
+	// Преемник наследует название, ограничения и бюджет. Период бюджета продолжается,
+	// а траты считаются по всей цепочке ключей.
+	successor := &domain.ApiKey{
+		UserID:            current.UserID,
+		TeamID:            current.TeamID,
+		Name:              current.Name,
+		AllowedModels:     current.AllowedModels,
+		AllowedCompanies:  current.AllowedCompanies,
+		AllowedCallTypes:  current.AllowedCallTypes,
+		AllowedCIDRs:      current.AllowedCIDRs,
+		Permission:        current.Permission,
+		MaxBudget:         current.MaxBudget,
+		BudgetDuration:    current.BudgetDuration,
+		BudgetPeriodStart: current.BudgetPeriodStart,
+		PredecessorID:     &current.ID,
+	}
+	if successor.BudgetDuration != "" && successor.BudgetPeriodStart == nil {
+		successor.BudgetPeriodStart = &current.CreatedAt
+	}
+
+	successor, key, err := s.issueKey(ctx, successor)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	// Старый ключ продолжает работать до конца периода перекрытия
+	graceEnd := now.Add(grace)
+	if current.ExpiresAt == nil || current.ExpiresAt.After(graceEnd) {
+		current.ExpiresAt = &graceEnd
+	}
+	current.SuccessorID = &successor.ID
+	current.User = nil
+	if err := s.apiKeyRepo.Update(ctx, current); err != nil {
+		return nil, nil, "", fmt.Errorf("failed to link rotated API key: %w", err)
+	}
+
+	// LiteLLM сам перестанет принимать старый ключ после окончания периода перекрытия
+	if litellmKey := litellmKeyID(current); litellmKey != "" {
+		if err := s.litellmClient.UpdateKey(ctx, litellmKey, &litellm.LiteLLMKeyRequest{ExpiresAt: current.ExpiresAt}); err != nil {
+			fmt.Printf("Warning: failed to set expiry for rotated API key %s in LiteLLM: %v\n", current.ID, err)
+		}
+	}
+
+	return successor, current, key, nil
+}
+
+// issueKey создает ключ в LiteLLM по шаблону и сохраняет его в БД.
+// Шаблон должен содержать владельца, название, ограничения и бюджет.
+func (s *apiKeyService) issueKey(ctx context.Context, apiKey *domain.ApiKey) (*domain.ApiKey, string, error) {
+	scopes := apiKey.Scopes()
+
+	litellmModels, err := s.litellmModels(ctx, scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Создаем ключ в LiteLLM. Ограничения по моделям LiteLLM проверяет сам,
+	// остальные ограничения сохраняем в metadata для наглядности
+	keyReq := &litellm.LiteLLMKeyRequest{
+		KeyAlias:       apiKey.Name,
+		UserID:         apiKey.UserID,
+		Models:         litellmModels,
+		Metadata:       scopesMetadata(scopes),
+		MaxBudget:      apiKey.MaxBudget,
+		BudgetDuration: apiKey.BudgetDuration,
+	}
+	if apiKey.TeamID != nil {
+		keyReq.TeamID = *apiKey.TeamID
+	}
+
+	keyResponse, err := s.litellmClient.CreateKey(ctx, keyReq)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create API key in LiteLLM: %w", err)
+	}
+
+	// Шифруем оригинальный ключ для хранения
+	encryptedKey, err := auth.EncryptAPIKey(keyResponse.Key)
+	if err != nil {
+		// Если не удалось зашифровать, удаляем ключ из LiteLLM
+		_ = s.litellmClient.DeleteKey(ctx, keyResponse.KeyName)
+		return nil, "", fmt.Errorf("failed to encrypt API key: %w", err)
+	}
+
+	now := time.Now()
+	apiKey.ID = uuid.New().String()
+	apiKey.KeyHash = fmt.Sprintf("%x", sha256.Sum256([]byte(keyResponse.Key)))
+	apiKey.OriginalKey = encryptedKey
+	apiKey.ApiKeyPreview = auth.CreateAPIKeyPreview(keyResponse.Key)
+	apiKey.ExternalID = keyResponse.KeyName
+	apiKey.CreatedAt = now
+	if apiKey.BudgetDuration != "" && apiKey.BudgetPeriodStart == nil {
+		apiKey.BudgetPeriodStart = &now
+	}
+
+	if err := s.apiKeyRepo.Create(ctx, apiKey); err != nil {
+		// Если не удалось сохранить в БД, удаляем ключ из LiteLLM
+		_ = s.litellmClient.DeleteKey(ctx, keyResponse.KeyName)
+		return nil, "", fmt.Errorf("failed to save API key: %w", err)
+	}
+
+	return apiKey, keyResponse.Key, nil
+}
+
+func (s *apiKeyService) UpdateApiKey(ctx context.Context, keyID string, req *UpdateApiKeyRequest) (*domain.ApiKey, error) {
+	apiKey, err := s.apiKeyRepo.GetByID(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	budgetChanged := false
+
+	if req.Name != nil {
+		if *req.Name == "" {
+			return nil, fmt.Errorf("%w: name cannot be empty", ErrInvalidApiKeyRequest)
+		}
+		apiKey.Name = *req.Name
+	}
+
+	if req.MaxBudget != nil || req.BudgetDuration != nil {
+		maxBudget := apiKey.MaxBudget
+		if req.MaxBudget != nil {
+			maxBudget = req.MaxBudget
+		}
+		duration := apiKey.BudgetDuration
+		if req.BudgetDuration != nil {
+			duration = *req.BudgetDuration
+		}
+
+		maxBudget, err = validateBudget(maxBudget, duration)
+		if err != nil {
+			return nil, err
+		}
+
+		// Смена периода начинает новый период с текущего момента
+		if duration != apiKey.BudgetDuration {
+			now := time.Now()
+			apiKey.BudgetPeriodStart = &now
+			if duration == "" {
+				apiKey.BudgetPeriodStart = nil
+			}
+		}
+
+		apiKey.MaxBudget = maxBudget
+		apiKey.BudgetDuration = duration
+		budgetChanged = true
+	}
+
+	// User подгружается репозиторием и не должен сохраняться вместе с ключом
+	apiKey.User = nil
+	if err := s.apiKeyRepo.Update(ctx, apiKey); err != nil {
+		return nil, fmt.Errorf("failed to update API key: %w", err)
+	}
+
+	// Синхронизируем изменения с LiteLLM, ошибки не блокируют локальное изменение
+	if keyID := litellmKeyID(apiKey); keyID != "" {
+		if req.Name != nil {
+			if err := s.litellmClient.UpdateKey(ctx, keyID, &litellm.LiteLLMKeyRequest{KeyAlias: apiKey.Name}); err != nil {
+				fmt.Printf("Warning: failed to update API key %s alias in LiteLLM: %v\n", apiKey.ID, err)
+			}
+		}
+		if budgetChanged {
+			if err := s.litellmClient.UpdateKeyBudget(ctx, keyID, apiKey.MaxBudget, apiKey.BudgetDuration); err != nil {
+				fmt.Printf("Warning: failed to update API key %s budget in LiteLLM: %v\n", apiKey.ID, err)
+			}
+		}
+	}
+
+	return apiKey, nil
+}
+
+func (s *apiKeyService) RevokeApiKey(ctx context.Context, keyID string) (*domain.ApiKey, error) {
+	apiKey, err := s.apiKeyRepo.GetByID(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if apiKey.RevokedAt != nil {
+		return apiKey, nil
+	}
+
+	// Сначала хаб перестает принимать ключ
+	now := time.Now()
+	if apiKey.ExpiresAt == nil || apiKey.ExpiresAt.After(now) {
+		apiKey.ExpiresAt = &now
+	}
+	apiKey.User = nil
+	if err := s.apiKeyRepo.Update(ctx, apiKey); err != nil {
+		return nil, fmt.Errorf("failed to expire API key: %w", err)
+	}
+
+	// Если удалить ключ в LiteLLM не удалось, это повторит задача api_key_expiry
+	if litellmKey := litellmKeyID(apiKey); litellmKey != "" && s.litellmClient != nil {
+		if err := s.litellmClient.DeleteKey(ctx, litellmKey); err != nil {
+			fmt.Printf("Warning: failed to delete revoked API key %s in LiteLLM: %v\n", apiKey.ID, err)
+			return apiKey, nil
+		}
+	}
+
+	apiKey.RevokedAt = &now
+	if err := s.apiKeyRepo.Update(ctx, apiKey); err != nil {
+		return nil, fmt.Errorf("failed to mark API key as revoked: %w", err)
+	}
+	return apiKey, nil
+}
+
+func (s *apiKeyService) ExpireApiKeys(ctx context.Context) error {
+	now := time.Now()
+
+	apiKeys, err := s.apiKeyRepo.ListExpired(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, apiKey := range apiKeys {
+		// Если удалить ключ в LiteLLM не удалось, оставляем его до следующего запуска.
+		// Хаб уже не принимает истекший ключ, поэтому повтор безопасен.
+		if keyID := litellmKeyID(apiKey); keyID != "" {
+			if err := s.litellmClient.DeleteKey(ctx, keyID); err != nil {
+				fmt.Printf("Warning: failed to delete expired API key %s in LiteLLM: %v\n", apiKey.ID, err)
+				failed++
+				continue
+			}
+		}
+
+		owner := apiKey.User
+		apiKey.RevokedAt = &now
+		apiKey.User = nil
+		if err := s.apiKeyRepo.Update(ctx, apiKey); err != nil {
+			fmt.Printf("Warning: failed to mark API key %s as revoked: %v\n", apiKey.ID, err)
+			failed++
+			continue
+		}
+
+		if owner != nil {
+			s.notify(ctx, &notification.Notification{
+				Event:   notification.EventApiKeyRevoked,
+				UserID:  owner.ID,
+				Email:   owner.Email,
+				Subject: fmt.Sprintf("API key \"%s\" has expired", apiKey.Name),
+				Text: fmt.Sprintf("Your API key \"%s\" (%s) expired on %s and has been revoked.",
+					apiKey.Name, apiKey.ApiKeyPreview, apiKey.ExpiresAt.UTC().Format(time.RFC1123)),
+				Data: apiKeyNotificationData(apiKey),
+			})
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to revoke %d of %d expired API keys", failed, len(apiKeys))
+	}
+
+	return nil
+}
+
+func (s *apiKeyService) NotifyExpiringApiKeys(ctx context.Context) error {
+	if s.expiryNoticePeriod <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	apiKeys, err := s.apiKeyRepo.ListExpiringUnnotified(ctx, now, now.Add(s.expiryNoticePeriod))
+	if err != nil {
+		return err
+	}
+
+	for _, apiKey := range apiKeys {
+		owner := apiKey.User
+		if owner == nil {
+			continue
+		}
+
+		err := s.notifier.Notify(ctx, &notification.Notification{
+			Event:   notification.EventApiKeyExpiring,
+			UserID:  owner.ID,
+			Email:   owner.Email,
+			Subject: fmt.Sprintf("API key \"%s\" expires soon", apiKey.Name),
+			Text: fmt.Sprintf("Your API key \"%s\" (%s) expires on %s. Rotate it before then to avoid interruptions.",
+				apiKey.Name, apiKey.ApiKeyPreview, apiKey.ExpiresAt.UTC().Format(time.RFC1123)),
+			Data:      apiKeyNotificationData(apiKey),
+			CreatedAt: now,
+		})
+		if err != nil {
+			// Не отмечаем ключ, чтобы повторить уведомление при следующем запуске
+			fmt.Printf("Warning: failed to notify about expiring API key %s: %v\n", apiKey.ID, err)
+			continue
+		}
+
+		apiKey.ExpiryNotifiedAt = &now
+		apiKey.User = nil
+		if err := s.apiKeyRepo.Update(ctx, apiKey); err != nil {
+			fmt.Printf("Warning: failed to mark API key %s as notified: %v\n", apiKey.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// notify отправляет уведомление, ошибки доставки только логируются
+func (s *apiKeyService) notify(ctx context.Context, n *notification.Notification) {
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now()
+	}
+	if err := s.notifier.Notify(ctx, n); err != nil {
+		fmt.Printf("Warning: failed to send %s notification to user %s: %v\n", n.Event, n.UserID, err)
+	}
+}
+
+func apiKeyNotificationData(apiKey *domain.ApiKey) map[string]interface{} {
+	return map[string]interface{}{
+		"api_key_id":      apiKey.ID,
+		"name":            apiKey.Name,
+		"api_key_preview": apiKey.ApiKeyPreview,
+		"expires_at":      apiKey.ExpiresAt,
+	}
+}
+
+func (s *apiKeyService) GetApiKeyBudget(ctx context.Context, apiKey *domain.ApiKey) (*ApiKeyBudget, error) {
+	now := time.Now()
+	periodStart, resetAt := apiKey.BudgetPeriod(now)
+
+	// Траты ротированного ключа продолжают траты его предшественников
+	keyIDs, err := s.lineage(ctx, apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	spent, err := s.requestRepo.SumCostByApiKeys(ctx, keyIDs, periodStart)
+	if err != nil {
+		return nil, err
+	}
+
+	budget := &ApiKeyBudget{
+		BudgetDuration: apiKey.BudgetDuration,
+		Spent:          spent,
+		ResetAt:        resetAt,
+	}
+	if !periodStart.IsZero() {
+		budget.PeriodStart = &periodStart
+	}
+	if apiKey.HasBudget() {
+		remaining := *apiKey.MaxBudget - spent
+		if remaining < 0 {
+			remaining = 0
+		}
+		budget.MaxBudget = apiKey.MaxBudget
+		budget.RemainingBudget = &remaining
+	}
+
+	return budget, nil
+}
+
+// maxLineageDepth ограничивает обход цепочки ротаций
+const maxLineageDepth = 50
+
+// lineage возвращает ID ключа и всех его предшественников
+func (s *apiKeyService) lineage(ctx context.Context, apiKey *domain.ApiKey) ([]string, error) {
+	ids := []string{apiKey.ID}
+
+	predecessorID := apiKey.PredecessorID
+	for predecessorID != nil && len(ids) < maxLineageDepth {
+		predecessor, err := s.apiKeyRepo.GetByID(ctx, *predecessorID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				break
+			}
+			return nil, fmt.Errorf("failed to get predecessor API key: %w", err)
+		}
+		ids = append(ids, predecessor.ID)
+		predecessorID = predecessor.PredecessorID
+	}
+
+	return ids, nil
+}
+
+// validateBudget проверяет лимит трат и период. Нулевой лимит означает отсутствие лимита.
+func validateBudget(maxBudget *float64, duration string) (*float64, error) {
+	if maxBudget != nil && *maxBudget < 0 {
+		return nil, fmt.Errorf("%w: max_budget cannot be negative", ErrInvalidApiKeyRequest)
+	}
+	if duration != "" {
+		if _, _, ok := domain.ParseBudgetDuration(duration); !ok {
+			return nil, fmt.Errorf("%w: invalid budget_duration %q, expected values like 1d, 30d or 1mo", ErrInvalidApiKeyRequest, duration)
+		}
+	}
+
+	if maxBudget == nil || *maxBudget == 0 {
+		return nil, nil
+	}
+	return maxBudget, nil
+}
+
+// litellmKeyID возвращает идентификатор ключа для запросов к LiteLLM:
+// расшифрованный оригинальный ключ или, если его нет, ExternalID
+func litellmKeyID(apiKey *domain.ApiKey) string {
+	if apiKey.OriginalKey != "" {
+		key, err := auth.DecryptAPIKey(apiKey.OriginalKey)
+		if err == nil {
+			return key
+		}
+		fmt.Printf("Warning: failed to decrypt API key %s: %v\n", apiKey.ID, err)
+	}
+	return apiKey.ExternalID
+}
+
+// validateScopes проверяет и нормализует ограничения ключа
+func (s *apiKeyService) validateScopes(ctx context.Context, req *CreateApiKeyRequest) (domain.ApiKeyScopes, error) {
+	scopes := domain.ApiKeyScopes{
+		Models:     req.AllowedModels,
+		Companies:  req.AllowedCompanies,
+		Permission: req.Permission,
+	}
+
+	if scopes.Permission == "" {
+		scopes.Permission = domain.ApiKeyPermissionInference
+	}
+	if scopes.Permission != domain.ApiKeyPermissionInference && scopes.Permission != domain.ApiKeyPermissionReadOnly {
+		return scopes, fmt.Errorf("%w: unknown permission %q", ErrInvalidApiKeyRequest, req.Permission)
+	}
+
+	for _, externalID := range req.AllowedModels {
+		if _, err := s.modelRepo.GetByExternalID(ctx, externalID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return scopes, fmt.Errorf("%w: model %q not found", ErrInvalidApiKeyRequest, externalID)
+			}
+			return scopes, fmt.Errorf("failed to get model: %w", err)
+		}
+	}
+
+	for _, companyID := range req.AllowedCompanies {
+		if _, err := s.companyRepo.GetByID(ctx, companyID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return scopes, fmt.Errorf("%w: company %q not found", ErrInvalidApiKeyRequest, companyID)
+			}
+			return scopes, fmt.Errorf("failed to get company: %w", err)
+		}
+	}
+
+	for _, callType := range req.AllowedCallTypes {
+		switch callType {
+		case domain.CallTypeChat, domain.CallTypeEmbeddings, domain.CallTypeImages:
+			scopes.CallTypes = append(scopes.CallTypes, callType)
+		default:
+			return scopes, fmt.Errorf("%w: unknown call type %q", ErrInvalidApiKeyRequest, callType)
+		}
+	}
+
+	for _, cidr := range req.AllowedCIDRs {
+		// Одиночный адрес приводим к подсети из одного адреса
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return scopes, fmt.Errorf("%w: invalid IP address %q", ErrInvalidApiKeyRequest, cidr)
+			}
+			if ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return scopes, fmt.Errorf("%w: invalid CIDR %q", ErrInvalidApiKeyRequest, cidr)
+		}
+		scopes.CIDRs = append(scopes.CIDRs, network.String())
+	}
+
+	return scopes, nil
+}
+
+// litellmModels возвращает список моделей для ключа LiteLLM: явно разрешенные модели
+// и все модели разрешенных компаний. nil означает доступ ко всем моделям.
+func (s *apiKeyService) litellmModels(ctx context.Context, scopes domain.ApiKeyScopes) ([]string, error) {
+	if len(scopes.Models) == 0 && len(scopes.Companies) == 0 {
+		return nil, nil
+	}
+
+	seen := make(map[string]bool)
+	var models []string
+	for _, externalID := range scopes.Models {
+		if !seen[externalID] {
+			seen[externalID] = true
+			models = append(models, externalID)
+		}
+	}
+
+	for _, companyID := range scopes.Companies {
+		companyModels, err := s.modelRepo.GetByCompanyID(ctx, companyID, 1000, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get company models: %w", err)
+		}
+		for _, model := range companyModels {
+			if model.ExternalID != "" && !seen[model.ExternalID] {
+				seen[model.ExternalID] = true
+				models = append(models, model.ExternalID)
+			}
+		}
+	}
+
+	// Пустой список LiteLLM воспринимает как доступ ко всем моделям
+	if len(models) == 0 {
+		return nil, fmt.Errorf("%w: allowed companies have no models", ErrInvalidApiKeyRequest)
+	}
+
+	return models, nil
+}
+
+func scopesMetadata(scopes domain.ApiKeyScopes) map[string]interface{} {
+	metadata := map[string]interface{}{
+		"hub_permission": scopes.Permission,
+	}
+	if len(scopes.CallTypes) > 0 {
+		metadata["hub_allowed_call_types"] = scopes.CallTypes
+	}
+	if len(scopes.CIDRs) > 0 {
+		metadata["hub_allowed_cidrs"] = scopes.CIDRs
+	}
+	if len(scopes.Companies) > 0 {
+		metadata["hub_allowed_companies"] = scopes.Companies
+	}
+	return metadata
+}
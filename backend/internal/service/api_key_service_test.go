@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"oneui-hub/internal/config"
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/litellm"
+	"oneui-hub/internal/notification"
+	"oneui-hub/internal/repository"
+)
+
+// fakeApiKeyRepository хранит ключи в памяти
+type fakeApiKeyRepository struct {
+	mu   sync.Mutex
+	keys map[string]*domain.ApiKey
+}
+
+func newFakeApiKeyRepository() *fakeApiKeyRepository {
+	return &fakeApiKeyRepository{keys: map[string]*domain.ApiKey{}}
+}
+
+func (r *fakeApiKeyRepository) Create(ctx context.Context, apiKey *domain.ApiKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *apiKey
+	r.keys[apiKey.ID] = &stored
+	return nil
+}
+
+func (r *fakeApiKeyRepository) GetByID(ctx context.Context, id string) (*domain.ApiKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	apiKey, ok := r.keys[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *apiKey
+	return &copied, nil
+}
+
+func (r *fakeApiKeyRepository) GetByUserID(ctx context.Context, userID string) ([]*domain.ApiKey, error) {
+	return nil, nil
+}
+
+func (r *fakeApiKeyRepository) GetByKeyHash(ctx context.Context, keyHash string) (*domain.ApiKey, error) {
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeApiKeyRepository) GetByTeamID(ctx context.Context, teamID string) ([]*domain.ApiKey, error) {
+	return r.filter(func(k *domain.ApiKey) bool {
+		return k.TeamID != nil && *k.TeamID == teamID
+	}), nil
+}
+
+func (r *fakeApiKeyRepository) ExpireTeamKeys(ctx context.Context, teamID, userID string, now time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var expired int64
+	for _, apiKey := range r.keys {
+		if apiKey.TeamID == nil || *apiKey.TeamID != teamID || apiKey.UserID != userID || apiKey.RevokedAt != nil {
+			continue
+		}
+		if apiKey.ExpiresAt == nil || apiKey.ExpiresAt.After(now) {
+			expiresAt := now
+			apiKey.ExpiresAt = &expiresAt
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+func (r *fakeApiKeyRepository) Update(ctx context.Context, apiKey *domain.ApiKey) error {
+	return r.Create(ctx, apiKey)
+}
+
+func (r *fakeApiKeyRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.keys, id)
+	return nil
+}
+
+func (r *fakeApiKeyRepository) ListExpired(ctx context.Context, now time.Time) ([]*domain.ApiKey, error) {
+	return r.filter(func(k *domain.ApiKey) bool {
+		return k.RevokedAt == nil && k.ExpiresAt != nil && !k.ExpiresAt.After(now)
+	}), nil
+}
+
+func (r *fakeApiKeyRepository) ListExpiringUnnotified(ctx context.Context, now, until time.Time) ([]*domain.ApiKey, error) {
+	return r.filter(func(k *domain.ApiKey) bool {
+		return k.RevokedAt == nil && k.ExpiryNotifiedAt == nil && k.SuccessorID == nil && k.ExpiresAt != nil &&
+			k.ExpiresAt.After(now) && !k.ExpiresAt.After(until)
+	}), nil
+}
+
+func (r *fakeApiKeyRepository) filter(match func(*domain.ApiKey) bool) []*domain.ApiKey {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []*domain.ApiKey
+	for _, apiKey := range r.keys {
+		if match(apiKey) {
+			copied := *apiKey
+			copied.User = &domain.User{ID: apiKey.UserID, Email: apiKey.UserID + "@example.com"}
+			result = append(result, &copied)
+		}
+	}
+	return result
+}
+
+// fakeNotifier запоминает отправленные уведомления
+type fakeNotifier struct {
+	mu   sync.Mutex
+	sent []*notification.Notification
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, notification *notification.Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, notification)
+	return nil
+}
+
+// fakeLiteLLMKeys эмулирует эндпоинты управления ключами LiteLLM
+type fakeLiteLLMKeys struct {
+	mu      sync.Mutex
+	created []map[string]interface{}
+	updated []map[string]interface{}
+	deleted []map[string]interface{}
+}
+
+func (f *fakeLiteLLMKeys) handler(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var body map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	switch r.URL.Path {
+	case "/key/generate":
+		f.created = append(f.created, body)
+		key := fmt.Sprintf("sk-test-%d", len(f.created))
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"key": key, "key_name": key})
+	case "/key/update":
+		f.updated = append(f.updated, body)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{})
+	case "/key/delete":
+		f.deleted = append(f.deleted, body)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestApiKeyService_RotateApiKey(t *testing.T) {
+	upstream := &fakeLiteLLMKeys{}
+	server := httptest.NewServer(http.HandlerFunc(upstream.handler))
+	t.Cleanup(server.Close)
+
+	apiKeyRepo := newFakeApiKeyRepository()
+	requestRepo := &fakeRequestRepository{}
+	svc := &apiKeyService{
+		apiKeyRepo:          apiKeyRepo,
+		requestRepo:         requestRepo,
+		litellmClient:       litellm.NewClient(&config.LiteLLMConfig{BaseURL: server.URL, Timeout: 5 * time.Second}),
+		rotationGracePeriod: time.Hour,
+	}
+	ctx := context.Background()
+
+	maxBudget := 10.0
+	original, _, err := svc.CreateApiKey(ctx, "user-1", &CreateApiKeyRequest{
+		Name:             "ci",
+		AllowedCallTypes: []string{domain.CallTypeChat},
+		Permission:       domain.ApiKeyPermissionInference,
+		MaxBudget:        &maxBudget,
+		BudgetDuration:   "30d",
+	})
+	require.NoError(t, err)
+
+	requestRepo.requests = append(requestRepo.requests, &domain.Request{
+		ApiKeyID:  &original.ID,
+		TotalCost: 4,
+		CreatedAt: time.Now(),
+	})
+
+	successor, previous, key, err := svc.RotateApiKey(ctx, original.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-test-2", key)
+
+	// Преемник наследует название, ограничения и бюджет
+	assert.Equal(t, "ci", successor.Name)
+	assert.Equal(t, original.AllowedCallTypes, successor.AllowedCallTypes)
+	assert.Equal(t, 10.0, *successor.MaxBudget)
+	assert.Equal(t, original.ID, *successor.PredecessorID)
+	assert.Equal(t, *original.BudgetPeriodStart, *successor.BudgetPeriodStart)
+
+	// Старый ключ работает до конца периода перекрытия и ссылается на преемника
+	assert.Equal(t, successor.ID, *previous.SuccessorID)
+	require.NotNil(t, previous.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *previous.ExpiresAt, 5*time.Second)
+	require.Len(t, upstream.updated, 1)
+	assert.Equal(t, "sk-test-1", upstream.updated[0]["key"])
+	assert.NotNil(t, upstream.updated[0]["expires"])
+
+	// Траты предшественника учитываются в бюджете преемника
+	budget, err := svc.GetApiKeyBudget(ctx, successor)
+	require.NoError(t, err)
+	assert.InDelta(t, 4.0, budget.Spent, 1e-9)
+	assert.InDelta(t, 6.0, *budget.RemainingBudget, 1e-9)
+
+	// Повторная ротация того же ключа запрещена
+	_, _, _, err = svc.RotateApiKey(ctx, original.ID, nil)
+	assert.ErrorIs(t, err, ErrInvalidApiKeyRequest)
+}
+
+func TestApiKeyService_RevokeApiKeyKeepsRecord(t *testing.T) {
+	upstream := &fakeLiteLLMKeys{}
+	server := httptest.NewServer(http.HandlerFunc(upstream.handler))
+	t.Cleanup(server.Close)
+
+	apiKeyRepo := newFakeApiKeyRepository()
+	svc := &apiKeyService{
+		apiKeyRepo:    apiKeyRepo,
+		litellmClient: litellm.NewClient(&config.LiteLLMConfig{BaseURL: server.URL, Timeout: 5 * time.Second}),
+	}
+	ctx := context.Background()
+
+	previousID, successorID := "old", "new"
+	graceEnd := time.Now().Add(time.Hour)
+	require.NoError(t, apiKeyRepo.Create(ctx, &domain.ApiKey{ID: "old", UserID: "user-1", ExternalID: "sk-old", SuccessorID: &successorID, ExpiresAt: &graceEnd}))
+	require.NoError(t, apiKeyRepo.Create(ctx, &domain.ApiKey{ID: "new", UserID: "user-1", ExternalID: "sk-new", PredecessorID: &previousID}))
+
+	revoked, err := svc.RevokeApiKey(ctx, "new")
+	require.NoError(t, err)
+	require.NotNil(t, revoked.RevokedAt)
+	assert.False(t, revoked.IsActive(time.Now()))
+	require.Len(t, upstream.deleted, 1)
+	assert.Equal(t, "sk-new", upstream.deleted[0]["key"])
+
+	// Запись остается, связь ротации не теряется
+	stored, err := apiKeyRepo.GetByID(ctx, "new")
+	require.NoError(t, err)
+	assert.NotNil(t, stored.RevokedAt)
+	assert.Equal(t, &previousID, stored.PredecessorID)
+
+	// Повторный отзыв ничего не делает
+	_, err = svc.RevokeApiKey(ctx, "new")
+	require.NoError(t, err)
+	assert.Len(t, upstream.deleted, 1)
+
+	_, err = svc.RevokeApiKey(ctx, "missing")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestApiKeyService_ExpireApiKeys(t *testing.T) {
+	upstream := &fakeLiteLLMKeys{}
+	server := httptest.NewServer(http.HandlerFunc(upstream.handler))
+	t.Cleanup(server.Close)
+
+	apiKeyRepo := newFakeApiKeyRepository()
+	notifier := &fakeNotifier{}
+	svc := &apiKeyService{
+		apiKeyRepo:         apiKeyRepo,
+		litellmClient:      litellm.NewClient(&config.LiteLLMConfig{BaseURL: server.URL, Timeout: 5 * time.Second}),
+		notifier:           notifier,
+		expiryNoticePeriod: 7 * 24 * time.Hour,
+	}
+	ctx := context.Background()
+
+	expired := time.Now().Add(-time.Minute)
+	expiringSoon := time.Now().Add(48 * time.Hour)
+	expiringLater := time.Now().Add(30 * 24 * time.Hour)
+	require.NoError(t, apiKeyRepo.Create(ctx, &domain.ApiKey{ID: "expired", UserID: "user-1", Name: "old", ExternalID: "sk-old", ExpiresAt: &expired}))
+	require.NoError(t, apiKeyRepo.Create(ctx, &domain.ApiKey{ID: "soon", UserID: "user-1", Name: "soon", ExternalID: "sk-soon", ExpiresAt: &expiringSoon}))
+	require.NoError(t, apiKeyRepo.Create(ctx, &domain.ApiKey{ID: "later", UserID: "user-1", Name: "later", ExternalID: "sk-later", ExpiresAt: &expiringLater}))
+
+	require.NoError(t, svc.ExpireApiKeys(ctx))
+
+	// Истекший ключ удален в LiteLLM, но в БД остается с отметкой об отзыве
+	require.Len(t, upstream.deleted, 1)
+	assert.Equal(t, "sk-old", upstream.deleted[0]["key"])
+	revoked, err := apiKeyRepo.GetByID(ctx, "expired")
+	require.NoError(t, err)
+	assert.NotNil(t, revoked.RevokedAt)
+	require.Len(t, notifier.sent, 1)
+	assert.Equal(t, notification.EventApiKeyRevoked, notifier.sent[0].Event)
+	assert.Equal(t, "user-1@example.com", notifier.sent[0].Email)
+
+	// Повторный запуск не трогает уже отозванные ключи
+	require.NoError(t, svc.ExpireApiKeys(ctx))
+	assert.Len(t, upstream.deleted, 1)
+
+	// Предупреждение получает только ключ, истекающий в ближайшие 7 дней, и только один раз
+	require.NoError(t, svc.NotifyExpiringApiKeys(ctx))
+	require.NoError(t, svc.NotifyExpiringApiKeys(ctx))
+	require.Len(t, notifier.sent, 2)
+	assert.Equal(t, notification.EventApiKeyExpiring, notifier.sent[1].Event)
+	assert.Equal(t, "soon", notifier.sent[1].Data["api_key_id"])
+}
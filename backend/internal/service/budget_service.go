@@ -2,23 +2,43 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"oneui-hub/internal/domain"
 	"oneui-hub/internal/litellm"
+	"oneui-hub/internal/notification"
 	"oneui-hub/internal/repository"
 
 	"github.com/google/uuid"
 )
 
+// ErrInvalidBudget - некорректные параметры бюджета
+var ErrInvalidBudget = errors.New("invalid budget")
+
+// budgetResetBatchSize - сколько бюджетов сбрасывается за один запрос к БД
+const budgetResetBatchSize = 200
+
 type BudgetService interface {
-	// Методы для синхронизации с LiteLLM
+	// SyncBudgetsFromLiteLLM импортирует бюджеты, созданные в LiteLLM, и отправляет
+	// в LiteLLM лимиты и периоды бюджетов хаба, которые там отличаются
 	SyncBudgetsFromLiteLLM(ctx context.Context) error
 
+	// Учет трат: хаб - источник истины для SpentBudget
+	// RecordSpend добавляет стоимость завершенного запроса к бюджетам пользователя
+	// и команды, от имени которой выполнен запрос (teamID может быть nil)
+	RecordSpend(ctx context.Context, userID string, teamID *string, amount float64) error
+	// ExceededBudget возвращает исчерпанный бюджет пользователя или команды с жестким лимитом или nil
+	ExceededBudget(ctx context.Context, userID string, teamID *string) (*domain.Budget, error)
+	// ResetBudgets начинает новый период у бюджетов, момент сброса которых наступил
+	ResetBudgets(ctx context.Context) error
+
 	// CRUD операции
 	GetAllBudgets(ctx context.Context) ([]*domain.Budget, error)
 	GetBudgetByID(ctx context.Context, id string) (*domain.Budget, error)
 	GetBudgetsByUserID(ctx context.Context, userID string) ([]*domain.Budget, error)
+	GetBudgetsByTeamID(ctx context.Context, teamID string) ([]*domain.Budget, error)
 	CreateBudget(ctx context.Context, budget *domain.Budget) error
 	UpdateBudget(ctx context.Context, budget *domain.Budget) error
 	DeleteBudget(ctx context.Context, id string) error
@@ -37,18 +57,26 @@ type BudgetService interface {
 type budgetService struct {
 	budgetRepo    repository.BudgetRepository
 	userRepo      repository.UserRepository
+	teamRepo      repository.TeamRepository
 	litellmClient *litellm.Client
+	notifier      notification.Notifier
+	now           func() time.Time
 }
 
 func NewBudgetService(
 	budgetRepo repository.BudgetRepository,
 	userRepo repository.UserRepository,
+	teamRepo repository.TeamRepository,
 	litellmClient *litellm.Client,
+	notifier notification.Notifier,
 ) BudgetService {
 	return &budgetService{
 		budgetRepo:    budgetRepo,
 		userRepo:      userRepo,
+		teamRepo:      teamRepo,
 		litellmClient: litellmClient,
+		notifier:      notifier,
+		now:           time.Now,
 	}
 }
 
@@ -59,41 +87,69 @@ func (s *budgetService) SyncBudgetsFromLiteLLM(ctx context.Context) error {
 		return fmt.Errorf("failed to get budgets from LiteLLM: %w", err)
 	}
 
-	// Создаем или обновляем бюджеты в БД
+	now := s.now()
+	failed := 0
 	for _, lb := range litellmBudgets {
 		existingBudget, err := s.budgetRepo.GetByExternalID(ctx, lb.ID)
-		if err != nil && err != repository.ErrNotFound {
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
 			return fmt.Errorf("failed to check budget: %w", err)
 		}
 
+		if existingBudget != nil {
+			// Лимит и период задает хаб: расхождение исправляется в LiteLLM
+			if lb.MaxBudget != existingBudget.MaxBudget || lb.BudgetDuration != existingBudget.LiteLLMDuration() {
+				if err := s.pushToLiteLLM(ctx, existingBudget); err != nil {
+					fmt.Printf("Warning: failed to push budget %s to LiteLLM: %v\n", existingBudget.ID, err)
+					failed++
+				}
+			}
+			continue
+		}
+
+		// Бюджет, созданный напрямую в LiteLLM, переходит под управление хаба
+		externalID := lb.ID
 		budget := &domain.Budget{
+			ID:             uuid.New().String(),
 			MaxBudget:      lb.MaxBudget,
 			SpentBudget:    lb.SpentBudget,
 			BudgetDuration: lb.BudgetDuration,
+			PeriodStart:    &now,
 			ResetAt:        lb.ResetAt,
-			ExternalID:     lb.ID,
+			ExternalID:     &externalID,
 		}
-
 		if lb.UserID != "" {
 			budget.UserID = &lb.UserID
 		}
 		if lb.TeamID != "" {
 			budget.TeamID = &lb.TeamID
 		}
+		if budget.ResetAt == nil {
+			_, budget.ResetAt = budget.Period(now)
+		}
 
-		if existingBudget == nil {
-			budget.ID = uuid.New().String()
-			if err := s.budgetRepo.Create(ctx, budget); err != nil {
-				return fmt.Errorf("failed to create budget: %w", err)
-			}
-		} else {
-			budget.ID = existingBudget.ID
-			if err := s.budgetRepo.Update(ctx, budget); err != nil {
-				return fmt.Errorf("failed to update budget: %w", err)
-			}
+		if err := s.budgetRepo.Create(ctx, budget); err != nil {
+			return fmt.Errorf("failed to create budget: %w", err)
+		}
+	}
+
+	// Бюджеты хаба, которые еще не удалось отправить в LiteLLM
+	budgets, err := s.budgetRepo.List(ctx, 0, 0)
+	if err != nil {
+		return err
+	}
+	for _, budget := range budgets {
+		if budget.ExternalID != nil {
+			continue
+		}
+		if err := s.pushToLiteLLM(ctx, budget); err != nil {
+			fmt.Printf("Warning: failed to push budget %s to LiteLLM: %v\n", budget.ID, err)
+			failed++
 		}
 	}
 
+	if failed > 0 {
+		return fmt.Errorf("failed to push %d budgets to LiteLLM", failed)
+	}
 	return nil
 }
 
@@ -109,13 +165,66 @@ func (s *budgetService) GetBudgetsByUserID(ctx context.Context, userID string) (
 	return s.budgetRepo.GetByUserID(ctx, userID)
 }
 
+func (s *budgetService) GetBudgetsByTeamID(ctx context.Context, teamID string) ([]*domain.Budget, error) {
+	return s.budgetRepo.GetByTeamID(ctx, teamID)
+}
+
 func (s *budgetService) CreateBudget(ctx context.Context, budget *domain.Budget) error {
+	if !budget.HasValidDuration() {
+		return fmt.Errorf("%w: invalid budget_duration %q, expected daily, weekly, monthly or values like 30d", ErrInvalidBudget, budget.BudgetDuration)
+	}
+
+	now := s.now()
 	budget.ID = uuid.New().String()
-	return s.budgetRepo.Create(ctx, budget)
+	budget.SpentBudget = 0
+	budget.NotifiedThreshold = 0
+	budget.ExternalID = nil
+	budget.PeriodStart = &now
+	if budget.ResetAt == nil {
+		_, budget.ResetAt = budget.Period(now)
+	}
+
+	if err := s.budgetRepo.Create(ctx, budget); err != nil {
+		return err
+	}
+
+	// Недоставленный в LiteLLM бюджет будет отправлен задачей budget_sync
+	if err := s.pushToLiteLLM(ctx, budget); err != nil {
+		fmt.Printf("Warning: failed to push budget %s to LiteLLM: %v\n", budget.ID, err)
+	}
+	return nil
 }
 
 func (s *budgetService) UpdateBudget(ctx context.Context, budget *domain.Budget) error {
-	return s.budgetRepo.Update(ctx, budget)
+	if !budget.HasValidDuration() {
+		return fmt.Errorf("%w: invalid budget_duration %q, expected daily, weekly, monthly or values like 30d", ErrInvalidBudget, budget.BudgetDuration)
+	}
+
+	existing, err := s.budgetRepo.GetByID(ctx, budget.ID)
+	if err != nil {
+		return err
+	}
+
+	// Новый период отсчитывается от момента смены, если момент сброса не задан явно
+	now := s.now()
+	if budget.BudgetDuration != existing.BudgetDuration && timesEqual(budget.ResetAt, existing.ResetAt) {
+		budget.PeriodStart = &now
+		_, budget.ResetAt = budget.Period(now)
+	}
+	// После смены лимита уведомления о порогах считаются заново
+	if budget.MaxBudget != existing.MaxBudget {
+		budget.SpentBudget = existing.SpentBudget
+		budget.NotifiedThreshold = budget.ReachedThreshold()
+	}
+
+	if err := s.budgetRepo.Update(ctx, budget); err != nil {
+		return err
+	}
+
+	if err := s.pushToLiteLLM(ctx, budget); err != nil {
+		fmt.Printf("Warning: failed to push budget %s to LiteLLM: %v\n", budget.ID, err)
+	}
+	return nil
 }
 
 func (s *budgetService) DeleteBudget(ctx context.Context, id string) error {
@@ -126,8 +235,8 @@ func (s *budgetService) DeleteBudget(ctx context.Context, id string) error {
 	}
 
 	// Удаляем из LiteLLM если есть ExternalID
-	if budget.ExternalID != "" {
-		if err := s.litellmClient.DeleteBudget(ctx, budget.ExternalID); err != nil {
+	if budget.ExternalID != nil {
+		if err := s.litellmClient.DeleteBudget(ctx, *budget.ExternalID); err != nil {
 			// Логируем ошибку, но не останавливаем удаление из БД
 			fmt.Printf("Warning: failed to delete budget from LiteLLM: %v\n", err)
 		}
@@ -137,6 +246,264 @@ func (s *budgetService) DeleteBudget(ctx context.Context, id string) error {
 	return s.budgetRepo.Delete(ctx, id)
 }
 
+func (s *budgetService) RecordSpend(ctx context.Context, userID string, teamID *string, amount float64) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	budgets, err := s.applicableBudgets(ctx, userID, teamID)
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	for _, budget := range budgets {
+		// Задача budget_reset могла еще не сбросить закончившийся период
+		if budget.Lapsed(now) {
+			if err := s.resetBudget(ctx, budget, now); err != nil {
+				return err
+			}
+		}
+
+		if err := s.budgetRepo.AddSpent(ctx, budget.ID, amount); err != nil {
+			return err
+		}
+		budget.SpentBudget += amount
+		s.checkThresholds(ctx, budget)
+	}
+
+	return nil
+}
+
+func (s *budgetService) ExceededBudget(ctx context.Context, userID string, teamID *string) (*domain.Budget, error) {
+	budgets, err := s.applicableBudgets(ctx, userID, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	for _, budget := range budgets {
+		if !budget.SoftLimit && !budget.Lapsed(now) && budget.Exhausted() {
+			return budget, nil
+		}
+	}
+	return nil, nil
+}
+
+// applicableBudgets возвращает бюджеты пользователя и, если запрос выполняется от имени команды, бюджеты команды
+func (s *budgetService) applicableBudgets(ctx context.Context, userID string, teamID *string) ([]*domain.Budget, error) {
+	budgets, err := s.budgetRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if teamID == nil {
+		return budgets, nil
+	}
+
+	teamBudgets, err := s.budgetRepo.GetByTeamID(ctx, *teamID)
+	if err != nil {
+		return nil, err
+	}
+	return append(budgets, teamBudgets...), nil
+}
+
+func (s *budgetService) ResetBudgets(ctx context.Context) error {
+	now := s.now()
+	reset, failed := 0, 0
+	for {
+		budgets, err := s.budgetRepo.ListDueForReset(ctx, now, budgetResetBatchSize)
+		if err != nil {
+			return err
+		}
+
+		progressed := false
+		for _, budget := range budgets {
+			if err := s.resetBudget(ctx, budget, now); err != nil {
+				fmt.Printf("Warning: failed to reset budget %s: %v\n", budget.ID, err)
+				failed++
+				continue
+			}
+			progressed = true
+			reset++
+		}
+
+		// Бюджеты, которые не удалось сбросить, вернутся в выборке; ждем следующего запуска
+		if len(budgets) < budgetResetBatchSize || !progressed {
+			break
+		}
+	}
+
+	fmt.Printf("Budget reset: reset %d budgets\n", reset)
+	if failed > 0 {
+		return fmt.Errorf("failed to reset %d budgets", failed)
+	}
+	return nil
+}
+
+// resetBudget начинает новый период бюджета и сообщает о нем LiteLLM
+func (s *budgetService) resetBudget(ctx context.Context, budget *domain.Budget, now time.Time) error {
+	periodStart, resetAt := budget.Period(now)
+	if periodStart.IsZero() {
+		// Период больше не задан или неизвестен - бюджет действует без сбросов
+		periodStart = now
+	}
+
+	changed, err := s.budgetRepo.Reset(ctx, budget.ID, now, periodStart, resetAt)
+	if err != nil {
+		return err
+	}
+
+	budget.SpentBudget = 0
+	budget.NotifiedThreshold = 0
+	budget.PeriodStart = &periodStart
+	budget.ResetAt = resetAt
+	if !changed {
+		return nil
+	}
+
+	if err := s.pushToLiteLLM(ctx, budget); err != nil {
+		fmt.Printf("Warning: failed to push budget %s to LiteLLM: %v\n", budget.ID, err)
+	}
+	return nil
+}
+
+// checkThresholds уведомляет владельца о первом достижении порога в текущем периоде
+func (s *budgetService) checkThresholds(ctx context.Context, budget *domain.Budget) {
+	threshold := budget.ReachedThreshold()
+	if threshold <= budget.NotifiedThreshold {
+		return
+	}
+
+	marked, err := s.budgetRepo.MarkThresholdNotified(ctx, budget.ID, threshold)
+	if err != nil {
+		fmt.Printf("Warning: failed to mark budget %s threshold: %v\n", budget.ID, err)
+		return
+	}
+	budget.NotifiedThreshold = threshold
+	if !marked {
+		return
+	}
+
+	s.notifyThreshold(ctx, budget, threshold)
+}
+
+func (s *budgetService) notifyThreshold(ctx context.Context, budget *domain.Budget, threshold int) {
+	if s.notifier == nil {
+		return
+	}
+
+	// Бюджет команды: уведомляем участников, которые видят ее расходы
+	recipients := []*domain.User{budget.User}
+	subject := fmt.Sprintf("You have used %d%% of your budget", threshold)
+	text := fmt.Sprintf("You have spent %.2f USD of your %.2f USD budget.", budget.SpentBudget, budget.MaxBudget)
+	if budget.TeamID != nil && s.teamRepo != nil {
+		team, err := s.teamRepo.GetByID(ctx, *budget.TeamID)
+		if err != nil {
+			fmt.Printf("Warning: failed to get team %s for budget %s: %v\n", *budget.TeamID, budget.ID, err)
+			return
+		}
+		members, err := s.teamRepo.ListMembers(ctx, team.ID)
+		if err != nil {
+			fmt.Printf("Warning: failed to list members of team %s: %v\n", team.ID, err)
+			return
+		}
+		recipients = recipients[:0]
+		for _, member := range members {
+			if member.CanViewBilling() {
+				recipients = append(recipients, member.User)
+			}
+		}
+		subject = fmt.Sprintf("Team %s has used %d%% of its budget", team.Name, threshold)
+		text = fmt.Sprintf("Team %s has spent %.2f USD of its %.2f USD budget.", team.Name, budget.SpentBudget, budget.MaxBudget)
+	}
+
+	if threshold >= 100 {
+		if budget.SoftLimit {
+			text += " The budget is exhausted, but requests are not blocked."
+		} else {
+			text += " The budget is exhausted and requests are blocked until it resets."
+		}
+	}
+	if budget.ResetAt != nil {
+		text += fmt.Sprintf(" The budget resets on %s.", budget.ResetAt.UTC().Format("January 2, 2006 15:04 MST"))
+	}
+
+	for _, user := range recipients {
+		if user == nil {
+			continue
+		}
+		n := &notification.Notification{
+			Event:     notification.EventBudgetThreshold,
+			UserID:    user.ID,
+			Email:     user.Email,
+			Subject:   subject,
+			Text:      text,
+			CreatedAt: s.now(),
+			Data: map[string]interface{}{
+				"budget_id":    budget.ID,
+				"team_id":      budget.TeamID,
+				"threshold":    threshold,
+				"max_budget":   budget.MaxBudget,
+				"spent_budget": budget.SpentBudget,
+				"soft_limit":   budget.SoftLimit,
+				"reset_at":     budget.ResetAt,
+			},
+		}
+		if err := s.notifier.Notify(ctx, n); err != nil {
+			fmt.Printf("Warning: failed to send %s notification to user %s: %v\n", n.Event, n.UserID, err)
+		}
+	}
+}
+
+// pushToLiteLLM отправляет лимит, период и момент сброса бюджета в LiteLLM.
+// Бюджет, которого там еще нет, создается, и его ID сохраняется в ExternalID
+func (s *budgetService) pushToLiteLLM(ctx context.Context, budget *domain.Budget) error {
+	maxBudget := budget.MaxBudget
+	duration := budget.LiteLLMDuration()
+
+	if budget.ExternalID != nil {
+		_, err := s.litellmClient.UpdateBudget(ctx, &litellm.LiteLLMBudgetUpdateRequest{
+			ID:             *budget.ExternalID,
+			MaxBudget:      &maxBudget,
+			BudgetDuration: &duration,
+			ResetAt:        budget.ResetAt,
+		})
+		return err
+	}
+
+	req := &litellm.LiteLLMBudgetRequest{
+		MaxBudget:      &maxBudget,
+		BudgetDuration: duration,
+		ResetAt:        budget.ResetAt,
+	}
+	if budget.UserID != nil {
+		req.UserID = *budget.UserID
+	}
+	if budget.TeamID != nil {
+		req.TeamID = *budget.TeamID
+	}
+
+	response, err := s.litellmClient.CreateBudget(ctx, req)
+	if err != nil {
+		return err
+	}
+	if response.ID == "" {
+		return fmt.Errorf("LiteLLM returned budget without ID")
+	}
+	if err := s.budgetRepo.SetExternalID(ctx, budget.ID, response.ID); err != nil {
+		return err
+	}
+	budget.ExternalID = &response.ID
+	return nil
+}
+
+func timesEqual(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
 func (s *budgetService) CreateLiteLLMBudget(ctx context.Context, req *litellm.LiteLLMBudgetRequest) (*litellm.LiteLLMBudgetResponse, error) {
 	return s.litellmClient.CreateBudget(ctx, req)
 }
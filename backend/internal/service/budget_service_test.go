@@ -0,0 +1,391 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"oneui-hub/internal/config"
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/litellm"
+	"oneui-hub/internal/notification"
+	"oneui-hub/internal/repository"
+)
+
+// fakeBudgetRepository хранит бюджеты в памяти
+type fakeBudgetRepository struct {
+	mu      sync.Mutex
+	budgets map[string]*domain.Budget
+}
+
+func newFakeBudgetRepository() *fakeBudgetRepository {
+	return &fakeBudgetRepository{budgets: map[string]*domain.Budget{}}
+}
+
+func (r *fakeBudgetRepository) get(id string) *domain.Budget {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *r.budgets[id]
+	return &copied
+}
+
+func (r *fakeBudgetRepository) Create(ctx context.Context, budget *domain.Budget) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *budget
+	r.budgets[budget.ID] = &copied
+	return nil
+}
+
+func (r *fakeBudgetRepository) GetByID(ctx context.Context, id string) (*domain.Budget, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	budget, ok := r.budgets[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *budget
+	return &copied, nil
+}
+
+func (r *fakeBudgetRepository) GetByExternalID(ctx context.Context, externalID string) (*domain.Budget, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, budget := range r.budgets {
+		if budget.ExternalID != nil && *budget.ExternalID == externalID {
+			copied := *budget
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeBudgetRepository) GetByUserID(ctx context.Context, userID string) ([]*domain.Budget, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var budgets []*domain.Budget
+	for _, budget := range r.budgets {
+		if budget.UserID != nil && *budget.UserID == userID {
+			copied := *budget
+			budgets = append(budgets, &copied)
+		}
+	}
+	return budgets, nil
+}
+
+func (r *fakeBudgetRepository) GetByTeamID(ctx context.Context, teamID string) ([]*domain.Budget, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var budgets []*domain.Budget
+	for _, budget := range r.budgets {
+		if budget.TeamID != nil && *budget.TeamID == teamID {
+			copied := *budget
+			budgets = append(budgets, &copied)
+		}
+	}
+	return budgets, nil
+}
+
+func (r *fakeBudgetRepository) Update(ctx context.Context, budget *domain.Budget) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *budget
+	copied.SpentBudget = r.budgets[budget.ID].SpentBudget
+	r.budgets[budget.ID] = &copied
+	return nil
+}
+
+func (r *fakeBudgetRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.budgets, id)
+	return nil
+}
+
+func (r *fakeBudgetRepository) List(ctx context.Context, limit, offset int) ([]*domain.Budget, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var budgets []*domain.Budget
+	for _, budget := range r.budgets {
+		copied := *budget
+		budgets = append(budgets, &copied)
+	}
+	return budgets, nil
+}
+
+func (r *fakeBudgetRepository) AddSpent(ctx context.Context, id string, amount float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.budgets[id].SpentBudget += amount
+	return nil
+}
+
+func (r *fakeBudgetRepository) MarkThresholdNotified(ctx context.Context, id string, threshold int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.budgets[id].NotifiedThreshold >= threshold {
+		return false, nil
+	}
+	r.budgets[id].NotifiedThreshold = threshold
+	return true, nil
+}
+
+func (r *fakeBudgetRepository) ListDueForReset(ctx context.Context, now time.Time, limit int) ([]*domain.Budget, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var budgets []*domain.Budget
+	for _, budget := range r.budgets {
+		if budget.Lapsed(now) {
+			copied := *budget
+			budgets = append(budgets, &copied)
+		}
+	}
+	return budgets, nil
+}
+
+func (r *fakeBudgetRepository) Reset(ctx context.Context, id string, now, periodStart time.Time, resetAt *time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	budget := r.budgets[id]
+	if !budget.Lapsed(now) {
+		return false, nil
+	}
+	budget.SpentBudget = 0
+	budget.NotifiedThreshold = 0
+	budget.PeriodStart = &periodStart
+	budget.ResetAt = resetAt
+	return true, nil
+}
+
+func (r *fakeBudgetRepository) SetExternalID(ctx context.Context, id, externalID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.budgets[id].ExternalID = &externalID
+	return nil
+}
+
+// fakeLiteLLMBudgets эмулирует эндпоинты бюджетов LiteLLM
+type fakeLiteLLMBudgets struct {
+	mu      sync.Mutex
+	listed  []map[string]interface{}
+	created []map[string]interface{}
+	updated []map[string]interface{}
+}
+
+func (f *fakeLiteLLMBudgets) handler(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var body map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	switch r.URL.Path {
+	case "/budget/list":
+		_ = json.NewEncoder(w).Encode(f.listed)
+	case "/budget/new":
+		f.created = append(f.created, body)
+		body["id"] = fmt.Sprintf("litellm-budget-%d", len(f.created))
+		_ = json.NewEncoder(w).Encode(body)
+	case "/budget/update":
+		f.updated = append(f.updated, body)
+		_ = json.NewEncoder(w).Encode(body)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestBudgetService(t *testing.T) (*budgetService, *fakeBudgetRepository, *fakeLiteLLMBudgets, *fakeNotifier) {
+	svc, budgetRepo, upstream, notifier, _ := newTestTeamBudgetService(t)
+	return svc, budgetRepo, upstream, notifier
+}
+
+func newTestTeamBudgetService(t *testing.T) (*budgetService, *fakeBudgetRepository, *fakeLiteLLMBudgets, *fakeNotifier, *fakeTeamRepository) {
+	upstream := &fakeLiteLLMBudgets{}
+	server := httptest.NewServer(http.HandlerFunc(upstream.handler))
+	t.Cleanup(server.Close)
+
+	budgetRepo := newFakeBudgetRepository()
+	teamRepo := newFakeTeamRepository()
+	notifier := &fakeNotifier{}
+	svc := NewBudgetService(budgetRepo, nil, teamRepo, litellm.NewClient(&config.LiteLLMConfig{BaseURL: server.URL, Timeout: 5 * time.Second}), notifier).(*budgetService)
+	return svc, budgetRepo, upstream, notifier, teamRepo
+}
+
+func TestBudgetService_RecordSpendNotifiesThresholdsAndBlocks(t *testing.T) {
+	svc, budgetRepo, upstream, notifier := newTestBudgetService(t)
+	ctx := context.Background()
+
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	userID := "user-1"
+	budget := &domain.Budget{
+		UserID:         &userID,
+		MaxBudget:      10,
+		BudgetDuration: domain.BudgetDurationDaily,
+		User:           &domain.User{ID: userID, Email: "user@example.com"},
+	}
+	require.NoError(t, svc.CreateBudget(ctx, budget))
+
+	// Бюджет отправлен в LiteLLM в его формате периода
+	require.Len(t, upstream.created, 1)
+	assert.Equal(t, "1d", upstream.created[0]["budget_duration"])
+	assert.Equal(t, "litellm-budget-1", *budgetRepo.get(budget.ID).ExternalID)
+	assert.Equal(t, now.AddDate(0, 0, 1), *budgetRepo.get(budget.ID).ResetAt)
+
+	require.NoError(t, svc.RecordSpend(ctx, userID, nil, 4))
+	assert.Empty(t, notifier.sent)
+
+	// Перешагнули сразу 50 и 80% - одно уведомление о старшем пороге
+	require.NoError(t, svc.RecordSpend(ctx, userID, nil, 4.5))
+	require.Len(t, notifier.sent, 1)
+	assert.Equal(t, notification.EventBudgetThreshold, notifier.sent[0].Event)
+	assert.Equal(t, 80, notifier.sent[0].Data["threshold"])
+
+	exceeded, err := svc.ExceededBudget(ctx, userID, nil)
+	require.NoError(t, err)
+	assert.Nil(t, exceeded)
+
+	require.NoError(t, svc.RecordSpend(ctx, userID, nil, 2))
+	require.Len(t, notifier.sent, 2)
+	assert.Equal(t, 100, notifier.sent[1].Data["threshold"])
+
+	exceeded, err = svc.ExceededBudget(ctx, userID, nil)
+	require.NoError(t, err)
+	require.NotNil(t, exceeded)
+	assert.Equal(t, budget.ID, exceeded.ID)
+
+	// Повторные траты в том же периоде не шлют уведомлений повторно
+	require.NoError(t, svc.RecordSpend(ctx, userID, nil, 1))
+	assert.Len(t, notifier.sent, 2)
+
+	// Мягкий лимит не блокирует запросы
+	soft := budgetRepo.get(budget.ID)
+	soft.SoftLimit = true
+	require.NoError(t, svc.UpdateBudget(ctx, soft))
+	exceeded, err = svc.ExceededBudget(ctx, userID, nil)
+	require.NoError(t, err)
+	assert.Nil(t, exceeded)
+}
+
+func TestBudgetService_ResetBudgets(t *testing.T) {
+	svc, budgetRepo, upstream, notifier := newTestBudgetService(t)
+	ctx := context.Background()
+
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	userID := "user-1"
+	budget := &domain.Budget{UserID: &userID, MaxBudget: 10, BudgetDuration: domain.BudgetDurationWeekly}
+	require.NoError(t, svc.CreateBudget(ctx, budget))
+	require.NoError(t, svc.RecordSpend(ctx, userID, nil, 10))
+	assert.Equal(t, 100, budgetRepo.get(budget.ID).NotifiedThreshold)
+	// Без загруженного владельца уведомление некому отправить
+	assert.Empty(t, notifier.sent)
+
+	// До конца периода сбрасывать нечего
+	require.NoError(t, svc.ResetBudgets(ctx))
+	assert.InDelta(t, 10, budgetRepo.get(budget.ID).SpentBudget, 1e-9)
+
+	// Через 15 дней идет третья неделя, начавшаяся вчера
+	now = now.AddDate(0, 0, 15)
+	exceeded, err := svc.ExceededBudget(ctx, userID, nil)
+	require.NoError(t, err)
+	assert.Nil(t, exceeded, "закончившийся период не блокирует запросы до сброса")
+
+	require.NoError(t, svc.ResetBudgets(ctx))
+	reset := budgetRepo.get(budget.ID)
+	assert.Zero(t, reset.SpentBudget)
+	assert.Zero(t, reset.NotifiedThreshold)
+	assert.Equal(t, now.AddDate(0, 0, -1), *reset.PeriodStart)
+	assert.Equal(t, now.AddDate(0, 0, 6), *reset.ResetAt)
+
+	// Новый момент сброса отправлен в LiteLLM
+	require.Len(t, upstream.updated, 1)
+	assert.Equal(t, "litellm-budget-1", upstream.updated[0]["id"])
+	assert.Equal(t, "7d", upstream.updated[0]["budget_duration"])
+}
+
+func TestBudgetService_SyncBudgetsFromLiteLLM(t *testing.T) {
+	svc, budgetRepo, upstream, _ := newTestBudgetService(t)
+	ctx := context.Background()
+
+	userID := "user-1"
+	externalID := "litellm-existing"
+	require.NoError(t, budgetRepo.Create(ctx, &domain.Budget{ID: "hub", UserID: &userID, MaxBudget: 20, BudgetDuration: domain.BudgetDurationMonthly, ExternalID: &externalID}))
+	require.NoError(t, budgetRepo.Create(ctx, &domain.Budget{ID: "unsent", UserID: &userID, MaxBudget: 5, BudgetDuration: domain.BudgetDurationDaily}))
+	upstream.listed = []map[string]interface{}{
+		// Лимит изменили в LiteLLM - вернется значение хаба
+		{"id": externalID, "user_id": userID, "max_budget": 50, "spent_budget": 7, "budget_duration": "1mo"},
+		// Бюджет, созданный в LiteLLM, импортируется с тратами
+		{"id": "litellm-new", "user_id": "user-2", "max_budget": 30, "spent_budget": 3, "budget_duration": "30d"},
+	}
+
+	require.NoError(t, svc.SyncBudgetsFromLiteLLM(ctx))
+
+	require.Len(t, upstream.updated, 1)
+	assert.Equal(t, externalID, upstream.updated[0]["id"])
+	assert.Equal(t, 20.0, upstream.updated[0]["max_budget"])
+	assert.Zero(t, budgetRepo.get("hub").SpentBudget)
+
+	imported, err := budgetRepo.GetByExternalID(ctx, "litellm-new")
+	require.NoError(t, err)
+	assert.Equal(t, "user-2", *imported.UserID)
+	assert.InDelta(t, 3, imported.SpentBudget, 1e-9)
+	assert.False(t, imported.SoftLimit)
+	assert.NotNil(t, imported.ResetAt)
+
+	require.Len(t, upstream.created, 1)
+	assert.Equal(t, "litellm-budget-1", *budgetRepo.get("unsent").ExternalID)
+}
+
+func TestBudgetService_TeamBudget(t *testing.T) {
+	svc, budgetRepo, upstream, notifier, teamRepo := newTestTeamBudgetService(t)
+	ctx := context.Background()
+
+	teamRepo.addTeam(&domain.Team{ID: "team-1", Name: "Analytics"},
+		&domain.TeamMember{UserID: "owner", Role: domain.TeamRoleOwner},
+		&domain.TeamMember{UserID: "billing", Role: domain.TeamRoleBilling},
+		&domain.TeamMember{UserID: "member", Role: domain.TeamRoleMember},
+	)
+
+	teamID := "team-1"
+	budget := &domain.Budget{TeamID: &teamID, MaxBudget: 10, BudgetDuration: domain.BudgetDurationMonthly}
+	require.NoError(t, svc.CreateBudget(ctx, budget))
+	require.Len(t, upstream.created, 1)
+	assert.Equal(t, "team-1", upstream.created[0]["team_id"])
+
+	// Запросы без команды бюджет команды не затрагивают
+	require.NoError(t, svc.RecordSpend(ctx, "member", nil, 5))
+	assert.Zero(t, budgetRepo.get(budget.ID).SpentBudget)
+
+	require.NoError(t, svc.RecordSpend(ctx, "member", &teamID, 10))
+	assert.InDelta(t, 10, budgetRepo.get(budget.ID).SpentBudget, 1e-9)
+
+	// Уведомление получают участники, которые видят расходы команды
+	var recipients []string
+	for _, n := range notifier.sent {
+		assert.Equal(t, notification.EventBudgetThreshold, n.Event)
+		assert.Equal(t, 100, n.Data["threshold"])
+		recipients = append(recipients, n.UserID)
+	}
+	assert.ElementsMatch(t, []string{"owner", "billing"}, recipients)
+
+	// Исчерпанный бюджет команды блокирует ключи команды, но не личные ключи участников
+	exceeded, err := svc.ExceededBudget(ctx, "member", &teamID)
+	require.NoError(t, err)
+	require.NotNil(t, exceeded)
+	assert.Equal(t, budget.ID, exceeded.ID)
+
+	exceeded, err = svc.ExceededBudget(ctx, "member", nil)
+	require.NoError(t, err)
+	assert.Nil(t, exceeded)
+}
@@ -0,0 +1,754 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/litellm"
+	"oneui-hub/internal/ratelimit"
+	"oneui-hub/internal/repository"
+	"oneui-hub/pkg/auth"
+)
+
+// GatewayService обслуживает OpenAI-совместимые запросы, проходящие через хаб
+type GatewayService interface {
+	// Prepare разбирает запрос, находит модель и проверяет, что вызов разрешен
+	Prepare(ctx context.Context, req *GatewayRequest) (*GatewayCall, error)
+	// ChatCompletion выполняет подготовленный вызов и записывает его в историю запросов
+	ChatCompletion(ctx context.Context, call *GatewayCall) (*litellm.ProxyResponse, error)
+	// StreamChatCompletion выполняет вызов с stream: true, передавая SSE события в sink по мере получения
+	StreamChatCompletion(ctx context.Context, call *GatewayCall, sink StreamSink) error
+	// ListModels возвращает включенные модели, доступные ключу
+	ListModels(ctx context.Context, apiKey *domain.ApiKey) ([]*domain.Model, error)
+}
+
+// GatewayRequest - входящий запрос к шлюзу
+type GatewayRequest struct {
+	ApiKey   *domain.ApiKey
+	CallType string
+	Body     []byte
+}
+
+// GatewayCall - запрос, прошедший проверки и готовый к отправке в LiteLLM
+type GatewayCall struct {
+	ID        string
+	ApiKey    *domain.ApiKey
+	Model     *domain.Model
+	CallType  string
+	Body      []byte
+	Payload   *ChatCompletionPayload
+	StartedAt time.Time
+	// RateLimit - состояние лимитов тарифа после учета запроса (nil, если лимиты не заданы)
+	RateLimit *ratelimit.Decision
+	// Price - версия цены продажи, по которой будет списан запрос (nil для бесплатных моделей)
+	Price *domain.ModelPrice
+	// DiscountPercent - скидка по промокоду, действующая на момент запроса
+	DiscountPercent float64
+
+	limits      ratelimit.Limits
+	reservation *ratelimit.Reservation
+	hold        *domain.QuotaHold
+	// keyBudget - траты ключа в текущем периоде на момент запроса (nil, если у ключа нет бюджета)
+	keyBudget *ApiKeyBudget
+}
+
+// ChatCompletionPayload - поля тела запроса, которые нужны хабу
+type ChatCompletionPayload struct {
+	Model               string `json:"model"`
+	Stream              bool   `json:"stream"`
+	MaxTokens           *int   `json:"max_tokens"`
+	MaxCompletionTokens *int   `json:"max_completion_tokens"`
+}
+
+// GatewayError - ошибка шлюза в формате OpenAI API
+type GatewayError struct {
+	StatusCode int
+	Type       string
+	Code       string
+	Message    string
+	// Headers - дополнительные заголовки ответа (например, Retry-After)
+	Headers map[string]string
+}
+
+func (e *GatewayError) Error() string {
+	return e.Message
+}
+
+func newGatewayError(statusCode int, errType, code, message string) *GatewayError {
+	return &GatewayError{
+		StatusCode: statusCode,
+		Type:       errType,
+		Code:       code,
+		Message:    message,
+	}
+}
+
+type chatCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type chatCompletionResult struct {
+	ID      string `json:"id"`
+	Choices []struct {
+		Message struct {
+			Content   json.RawMessage `json:"content"`
+			ToolCalls []struct {
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage *chatCompletionUsage `json:"usage"`
+}
+
+// outputText собирает сгенерированный текст и вызовы инструментов всех вариантов ответа,
+// так же как потоковый режим собирает отправленные клиенту дельты
+func (r *chatCompletionResult) outputText() string {
+	var output strings.Builder
+	for _, choice := range r.Choices {
+		output.WriteString(messageContentText(choice.Message.Content))
+		for _, toolCall := range choice.Message.ToolCalls {
+			output.WriteString(toolCall.Function.Name)
+			output.WriteString(toolCall.Function.Arguments)
+		}
+	}
+	return output.String()
+}
+
+// gatewayUsage - итог выполнения вызова, по которому ведется учет
+type gatewayUsage struct {
+	Status       string
+	ExternalID   string
+	InputTokens  int
+	OutputTokens int
+}
+
+type gatewayService struct {
+	modelRepo        repository.ModelRepository
+	requestRepo      repository.RequestRepository
+	userSpendingRepo repository.UserSpendingRepository
+	// tierService - автоматическое повышение тарифа по тратам; nil отключает проверку тарифа
+	tierService TierService
+	// budgetService - бюджеты пользователей: учет трат и жесткие лимиты; nil отключает бюджеты
+	budgetService    BudgetService
+	apiKeyService    ApiKeyService
+	rateLimitService RateLimitService
+	rateLimiter      *ratelimit.Limiter
+	ledgerService    LedgerService
+	pricingService   PricingService
+	// promoService - скидки по промокодам; nil отключает скидки
+	promoService PromoService
+	// quotaRepo - удержания баланса и месячных токенов; nil отключает проверку квот
+	quotaRepo     repository.QuotaRepository
+	litellmClient *litellm.Client
+	// defaultMaxTokens - оценка длины ответа, если ни запрос, ни модель ее не ограничивают
+	defaultMaxTokens int
+	// quotaHoldTTL - сколько удержание учитывается, если запрос так и не был завершен
+	quotaHoldTTL time.Duration
+}
+
+func NewGatewayService(
+	modelRepo repository.ModelRepository,
+	requestRepo repository.RequestRepository,
+	userSpendingRepo repository.UserSpendingRepository,
+	tierService TierService,
+	budgetService BudgetService,
+	apiKeyService ApiKeyService,
+	rateLimitService RateLimitService,
+	rateLimiter *ratelimit.Limiter,
+	ledgerService LedgerService,
+	pricingService PricingService,
+	promoService PromoService,
+	quotaRepo repository.QuotaRepository,
+	litellmClient *litellm.Client,
+	defaultMaxTokens int,
+	quotaHoldTTL time.Duration,
+) GatewayService {
+	return &gatewayService{
+		modelRepo:        modelRepo,
+		requestRepo:      requestRepo,
+		userSpendingRepo: userSpendingRepo,
+		tierService:      tierService,
+		budgetService:    budgetService,
+		apiKeyService:    apiKeyService,
+		rateLimitService: rateLimitService,
+		rateLimiter:      rateLimiter,
+		ledgerService:    ledgerService,
+		pricingService:   pricingService,
+		promoService:     promoService,
+		quotaRepo:        quotaRepo,
+		litellmClient:    litellmClient,
+		defaultMaxTokens: defaultMaxTokens,
+		quotaHoldTTL:     quotaHoldTTL,
+	}
+}
+
+func (s *gatewayService) Prepare(ctx context.Context, req *GatewayRequest) (*GatewayCall, error) {
+	var payload ChatCompletionPayload
+	if err := json.Unmarshal(req.Body, &payload); err != nil {
+		return nil, newGatewayError(http.StatusBadRequest, "invalid_request_error", "invalid_json", "Request body must be a valid JSON object")
+	}
+	if payload.Model == "" {
+		return nil, newGatewayError(http.StatusBadRequest, "invalid_request_error", "missing_model", "The 'model' field is required")
+	}
+	// Тело потокового запроса потом дополняется stream_options, поэтому проверяем его до резервирования квоты и лимитов
+	if payload.Stream {
+		if _, _, err := withStreamUsage(req.Body); err != nil {
+			return nil, errInvalidStreamOptions()
+		}
+	}
+
+	model, err := s.modelRepo.GetByExternalID(ctx, payload.Model)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, newGatewayError(http.StatusNotFound, "invalid_request_error", "model_not_found",
+				fmt.Sprintf("The model '%s' does not exist", payload.Model))
+		}
+		return nil, fmt.Errorf("failed to get model: %w", err)
+	}
+
+	if model.ModelConfig == nil || !model.ModelConfig.IsEnabled {
+		return nil, newGatewayError(http.StatusForbidden, "invalid_request_error", "model_disabled",
+			fmt.Sprintf("The model '%s' is currently disabled", payload.Model))
+	}
+
+	if err := checkKeyScopes(req.ApiKey, model, req.CallType); err != nil {
+		return nil, err
+	}
+
+	if err := checkEmailVerified(req.ApiKey, model); err != nil {
+		return nil, err
+	}
+
+	keyBudget, err := s.checkKeyBudget(ctx, req.ApiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkUserBudgets(ctx, req.ApiKey.UserID, req.ApiKey.TeamID); err != nil {
+		return nil, err
+	}
+
+	call := &GatewayCall{
+		ID:        uuid.New().String(),
+		ApiKey:    req.ApiKey,
+		Model:     model,
+		CallType:  req.CallType,
+		Body:      req.Body,
+		Payload:   &payload,
+		StartedAt: time.Now(),
+		keyBudget: keyBudget,
+	}
+
+	if err := s.resolvePrice(ctx, call); err != nil {
+		return nil, err
+	}
+
+	if err := s.resolveDiscount(ctx, call); err != nil {
+		return nil, err
+	}
+
+	if err := s.reserveQuota(ctx, call); err != nil {
+		return nil, err
+	}
+
+	if err := s.acquireRateLimit(ctx, call); err != nil {
+		s.releaseQuota(ctx, call)
+		return nil, err
+	}
+
+	return call, nil
+}
+
+func (s *gatewayService) ListModels(ctx context.Context, apiKey *domain.ApiKey) ([]*domain.Model, error) {
+	models, err := s.modelRepo.ListWithFilters(ctx, "", nil, nil, "", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+
+	scopes := apiKey.Scopes()
+	available := make([]*domain.Model, 0, len(models))
+	for _, model := range models {
+		if model.ModelConfig == nil || !model.ModelConfig.IsEnabled {
+			continue
+		}
+		if !modelInScope(scopes, model) {
+			continue
+		}
+		if checkEmailVerified(apiKey, model) != nil {
+			continue
+		}
+		available = append(available, model)
+	}
+
+	return available, nil
+}
+
+// checkKeyScopes проверяет, что ключ разрешает вызов этой модели и этого типа
+func checkKeyScopes(apiKey *domain.ApiKey, model *domain.Model, callType string) error {
+	scopes := apiKey.Scopes()
+
+	if scopes.Permission == domain.ApiKeyPermissionReadOnly {
+		return newGatewayError(http.StatusForbidden, "invalid_request_error", "insufficient_permissions",
+			"The API key is read-only and cannot be used for inference")
+	}
+
+	if len(scopes.CallTypes) > 0 && !slices.Contains(scopes.CallTypes, callType) {
+		return newGatewayError(http.StatusForbidden, "invalid_request_error", "call_type_not_allowed",
+			fmt.Sprintf("The API key is not allowed to make %s requests", callType))
+	}
+
+	if !modelInScope(scopes, model) {
+		return newGatewayError(http.StatusForbidden, "invalid_request_error", "model_not_allowed",
+			fmt.Sprintf("The API key is not allowed to use the model '%s'", model.ExternalID))
+	}
+
+	return nil
+}
+
+// modelInScope проверяет ограничения ключа по моделям и компаниям. Модель доступна,
+// если она указана явно или принадлежит одной из разрешенных компаний.
+func modelInScope(scopes domain.ApiKeyScopes, model *domain.Model) bool {
+	if len(scopes.Models) == 0 && len(scopes.Companies) == 0 {
+		return true
+	}
+
+	return slices.Contains(scopes.Models, model.ExternalID) || slices.Contains(scopes.Companies, model.CompanyID)
+}
+
+// checkEmailVerified до подтверждения email владельцем ключа разрешает только бесплатные модели
+func checkEmailVerified(apiKey *domain.ApiKey, model *domain.Model) error {
+	if apiKey.User == nil || apiKey.User.IsEmailVerified() || model.ModelConfig.IsFree {
+		return nil
+	}
+
+	return newGatewayError(http.StatusForbidden, "invalid_request_error", "email_not_verified",
+		fmt.Sprintf("Confirm your email to use the model '%s'. Until then only free models are available", model.ExternalID))
+}
+
+// checkKeyBudget блокирует ключ, траты которого в текущем периоде достигли лимита.
+// Возвращает траты ключа, чтобы reserveQuota удержала стоимость запроса в его бюджете
+func (s *gatewayService) checkKeyBudget(ctx context.Context, apiKey *domain.ApiKey) (*ApiKeyBudget, error) {
+	if !apiKey.HasBudget() {
+		return nil, nil
+	}
+
+	budget, err := s.apiKeyService.GetApiKeyBudget(ctx, apiKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key budget: %w", err)
+	}
+
+	if budget.Spent >= *apiKey.MaxBudget {
+		message := fmt.Sprintf("The API key has reached its budget of $%.2f (spent $%.4f)", *apiKey.MaxBudget, budget.Spent)
+		return nil, errKeyBudgetExceeded(budget, message)
+	}
+
+	return budget, nil
+}
+
+func errKeyBudgetExceeded(budget *ApiKeyBudget, message string) *GatewayError {
+	if budget.ResetAt != nil {
+		message += fmt.Sprintf(". The budget resets at %s", budget.ResetAt.UTC().Format(time.RFC3339))
+	}
+	return newGatewayError(http.StatusPaymentRequired, "insufficient_quota", "key_budget_exceeded", message)
+}
+
+// checkUserBudgets блокирует пользователя или команду ключа, исчерпавших бюджет с жестким лимитом
+func (s *gatewayService) checkUserBudgets(ctx context.Context, userID string, teamID *string) error {
+	if s.budgetService == nil {
+		return nil
+	}
+
+	budget, err := s.budgetService.ExceededBudget(ctx, userID, teamID)
+	if err != nil {
+		return fmt.Errorf("failed to check user budgets: %w", err)
+	}
+	if budget == nil {
+		return nil
+	}
+
+	message := fmt.Sprintf("The budget of $%.2f has been exhausted (spent $%.4f)", budget.MaxBudget, budget.SpentBudget)
+	if budget.ResetAt != nil {
+		message += fmt.Sprintf(". The budget resets at %s", budget.ResetAt.UTC().Format(time.RFC3339))
+	}
+	return newGatewayError(http.StatusPaymentRequired, "insufficient_quota", "budget_exceeded", message)
+}
+
+// acquireRateLimit учитывает запрос в лимитах тарифа пользователя (или команды ключа) для выбранной модели.
+// Токены резервируются по оценке промпта и max_tokens и уточняются после ответа.
+func (s *gatewayService) acquireRateLimit(ctx context.Context, call *GatewayCall) error {
+	tierID := call.ApiKey.EffectiveTierID()
+	if s.rateLimiter == nil || tierID == "" {
+		return nil
+	}
+
+	rateLimit, err := s.rateLimitService.GetRateLimitByModelAndTier(ctx, call.Model.ID, tierID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get rate limit: %w", err)
+	}
+
+	limits := ratelimit.Limits{
+		RequestsPerMinute: rateLimit.RequestsPerMinute,
+		RequestsPerDay:    rateLimit.RequestsPerDay,
+		TokensPerMinute:   rateLimit.TokensPerMinute,
+		TokensPerDay:      rateLimit.TokensPerDay,
+	}
+	if limits.IsZero() {
+		return nil
+	}
+
+	tokens := estimatePromptTokens(call.Body)
+	if maxTokens := call.Payload.maxOutputTokens(); maxTokens > 0 {
+		tokens += maxTokens
+	}
+
+	key := fmt.Sprintf("user:%s:model:%s", call.ApiKey.UserID, call.Model.ID)
+	decision, reservation, err := s.rateLimiter.Acquire(ctx, key, limits, tokens)
+	if err != nil {
+		return fmt.Errorf("failed to check rate limit: %w", err)
+	}
+
+	if !decision.Allowed {
+		gwErr := newGatewayError(http.StatusTooManyRequests, "tokens", "rate_limit_exceeded",
+			fmt.Sprintf("Rate limit reached for %s on %s. Please try again in %s.",
+				call.Model.ExternalID, decision.Exceeded, decision.RetryAfter.Round(time.Second)))
+		if strings.HasPrefix(decision.Exceeded, "requests") {
+			gwErr.Type = "requests"
+		}
+		gwErr.Headers = decision.Headers()
+		return gwErr
+	}
+
+	call.RateLimit = decision
+	call.limits = limits
+	call.reservation = reservation
+
+	return nil
+}
+
+// resolvePrice фиксирует версию цены, по которой будет посчитана стоимость запроса
+func (s *gatewayService) resolvePrice(ctx context.Context, call *GatewayCall) error {
+	if s.pricingService == nil || call.Model.ModelConfig.IsFree {
+		return nil
+	}
+
+	tierID := call.ApiKey.EffectiveTierID()
+
+	price, err := s.pricingService.ResolvePrice(ctx, call.Model, tierID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve model price: %w", err)
+	}
+
+	call.Price = price
+	return nil
+}
+
+// resolveDiscount фиксирует скидку по промокоду, чтобы она не изменилась во время выполнения запроса
+func (s *gatewayService) resolveDiscount(ctx context.Context, call *GatewayCall) error {
+	if s.promoService == nil || call.Model.ModelConfig.IsFree {
+		return nil
+	}
+
+	discount, err := s.promoService.GetActiveDiscount(ctx, call.ApiKey.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve promo discount: %w", err)
+	}
+
+	call.DiscountPercent = discount
+	return nil
+}
+
+// maxOutputTokens возвращает ограничение длины ответа из запроса или 0, если оно не задано
+func (p *ChatCompletionPayload) maxOutputTokens() int {
+	if p.MaxCompletionTokens != nil && *p.MaxCompletionTokens > 0 {
+		return *p.MaxCompletionTokens
+	}
+	if p.MaxTokens != nil && *p.MaxTokens > 0 {
+		return *p.MaxTokens
+	}
+	return 0
+}
+
+// reserveQuota проверяет, что баланс, остаток месячного лимита токенов и остаток бюджета ключа
+// покрывают максимальную стоимость запроса, и удерживает их до завершения запроса.
+// Бесплатные модели не требуют баланса, но расходуют месячный лимит токенов.
+func (s *gatewayService) reserveQuota(ctx context.Context, call *GatewayCall) error {
+	if s.quotaRepo == nil {
+		return nil
+	}
+
+	promptTokens := estimatePromptTokens(call.Body)
+	outputTokens := call.Payload.maxOutputTokens()
+	if outputTokens == 0 {
+		outputTokens = s.defaultMaxTokens
+		if call.Model.MaxOutputTokens != nil && *call.Model.MaxOutputTokens > 0 {
+			outputTokens = *call.Model.MaxOutputTokens
+		}
+	}
+
+	inputCost, outputCost := call.cost(promptTokens, outputTokens)
+	now := time.Now()
+	hold := &domain.QuotaHold{
+		ID:        call.ID,
+		UserID:    call.ApiKey.UserID,
+		ApiKeyID:  call.ApiKey.ID,
+		Amount:    inputCost + outputCost,
+		Tokens:    int64(promptTokens + outputTokens),
+		ExpiresAt: now.Add(s.quotaHoldTTL),
+	}
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	err := s.quotaRepo.Reserve(ctx, hold, monthStart, func(usage *repository.QuotaUsage) error {
+		if usage.MonthlyTokenLimit != nil && *usage.MonthlyTokenLimit > 0 {
+			remaining := *usage.MonthlyTokenLimit - usage.UsedTokens - usage.HeldTokens
+			if hold.Tokens > remaining {
+				return newGatewayError(http.StatusPaymentRequired, "insufficient_quota", "monthly_token_limit_exceeded",
+					fmt.Sprintf("The request may use up to %d tokens, but only %d of the monthly limit of %d tokens remain",
+						hold.Tokens, max(remaining, 0), *usage.MonthlyTokenLimit))
+			}
+		}
+
+		if hold.Amount > 0 {
+			available := usage.Balance - usage.HeldAmount
+			if hold.Amount > available {
+				return newGatewayError(http.StatusPaymentRequired, "insufficient_quota", "insufficient_balance",
+					fmt.Sprintf("Your balance of $%.4f cannot cover the maximum cost of this request ($%.4f). "+
+						"Top up your balance or lower max_tokens", max(available, 0), hold.Amount))
+			}
+		}
+
+		// Траты ключа учитываются только после завершения запроса, поэтому остаток бюджета
+		// уменьшают и удержания запросов по ключу, которые еще выполняются
+		if call.keyBudget != nil && hold.Amount > 0 {
+			maxBudget := *call.ApiKey.MaxBudget
+			remaining := maxBudget - call.keyBudget.Spent - usage.KeyHeldAmount
+			if hold.Amount > remaining {
+				return errKeyBudgetExceeded(call.keyBudget, fmt.Sprintf(
+					"The remaining API key budget of $%.4f (of $%.2f) cannot cover the maximum cost of this request ($%.4f). "+
+						"Wait for running requests to finish or lower max_tokens", max(remaining, 0), maxBudget, hold.Amount))
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		var gwErr *GatewayError
+		if errors.As(err, &gwErr) {
+			return gwErr
+		}
+		return fmt.Errorf("failed to reserve quota: %w", err)
+	}
+
+	call.hold = hold
+	return nil
+}
+
+// releaseQuota снимает удержание запроса
+func (s *gatewayService) releaseQuota(ctx context.Context, call *GatewayCall) {
+	if call.hold == nil {
+		return
+	}
+	if err := s.quotaRepo.Release(ctx, call.hold.ID); err != nil {
+		fmt.Printf("Warning: failed to release quota hold for request %s: %v\n", call.ID, err)
+	}
+	call.hold = nil
+}
+
+func (s *gatewayService) ChatCompletion(ctx context.Context, call *GatewayCall) (*litellm.ProxyResponse, error) {
+	upstreamKey, err := s.upstreamKey(call.ApiKey)
+	if err != nil {
+		fmt.Printf("Warning: no upstream key for request %s: %v\n", call.ID, err)
+		s.settle(ctx, call, &gatewayUsage{Status: domain.RequestStatusFailed})
+		return nil, errUpstreamKeyUnavailable()
+	}
+
+	resp, err := s.litellmClient.ChatCompletion(ctx, upstreamKey, call.Body)
+	if err != nil {
+		s.settle(ctx, call, &gatewayUsage{Status: domain.RequestStatusFailed})
+		return nil, errUpstreamUnavailable()
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		s.settle(ctx, call, &gatewayUsage{Status: domain.RequestStatusFailed})
+		return resp, nil
+	}
+
+	var result chatCompletionResult
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		fmt.Printf("Warning: failed to parse chat completion response for request %s: %v\n", call.ID, err)
+	}
+
+	usage := &gatewayUsage{
+		Status:     domain.RequestStatusCompleted,
+		ExternalID: result.ID,
+	}
+	if result.Usage != nil {
+		usage.InputTokens = result.Usage.PromptTokens
+		usage.OutputTokens = result.Usage.CompletionTokens
+	} else {
+		usage.InputTokens = estimatePromptTokens(call.Body)
+		usage.OutputTokens = estimateTextTokens(result.outputText())
+	}
+
+	s.settle(ctx, call, usage)
+
+	return resp, nil
+}
+
+func errInvalidStreamOptions() *GatewayError {
+	return newGatewayError(http.StatusBadRequest, "invalid_request_error", "invalid_stream_options", "The 'stream_options' field must be an object")
+}
+
+func errUpstreamUnavailable() *GatewayError {
+	return newGatewayError(http.StatusBadGateway, "api_error", "upstream_unavailable", "Upstream provider is unavailable")
+}
+
+func errUpstreamKeyUnavailable() *GatewayError {
+	return newGatewayError(http.StatusInternalServerError, "api_error", "upstream_key_unavailable", "API key is not configured for upstream access")
+}
+
+// upstreamKey возвращает ключ LiteLLM, от имени которого выполняется запрос.
+// Пустой ключ означал бы запрос от имени мастер-ключа в обход бюджетов и лимитов ключа, поэтому это ошибка.
+func (s *gatewayService) upstreamKey(apiKey *domain.ApiKey) (string, error) {
+	if apiKey == nil || apiKey.OriginalKey == "" {
+		return "", fmt.Errorf("api key has no stored upstream key")
+	}
+
+	key, err := auth.DecryptAPIKey(apiKey.OriginalKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt api key %s: %w", apiKey.ID, err)
+	}
+	if key == "" {
+		return "", fmt.Errorf("api key %s has empty upstream key", apiKey.ID)
+	}
+
+	return key, nil
+}
+
+// settle записывает запрос в историю и учитывает его стоимость в тратах пользователя.
+// Ошибки учета не должны ломать ответ клиенту, поэтому они только логируются.
+func (s *gatewayService) settle(ctx context.Context, call *GatewayCall, usage *gatewayUsage) {
+	// Запрос мог быть отменен клиентом, но учет должен завершиться
+	ctx = context.WithoutCancel(ctx)
+
+	inputCost, outputCost := call.cost(usage.InputTokens, usage.OutputTokens)
+	totalCost := inputCost + outputCost
+	endTime := time.Now()
+	modelName := call.Model.ExternalID
+	callType := call.CallType
+
+	request := &domain.Request{
+		ID:           call.ID,
+		UserID:       call.ApiKey.UserID,
+		ModelID:      call.Model.ID,
+		ApiKeyID:     &call.ApiKey.ID,
+		TeamID:       call.ApiKey.TeamID,
+		InputTokens:  usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+		InputCost:    inputCost,
+		OutputCost:   outputCost,
+		TotalCost:    totalCost,
+		Status:       usage.Status,
+		CallType:     &callType,
+		ModelName:    &modelName,
+		StartTime:    &call.StartedAt,
+		EndTime:      &endTime,
+	}
+
+	if usage.ExternalID != "" {
+		request.ExternalRequestID = &usage.ExternalID
+	}
+	if call.Price != nil {
+		request.ModelPriceID = &call.Price.ID
+	}
+
+	var providers []string
+	if err := json.Unmarshal([]byte(call.Model.Providers), &providers); err == nil && len(providers) > 0 {
+		request.Provider = &providers[0]
+	}
+
+	if err := s.requestRepo.Create(ctx, request); err != nil {
+		fmt.Printf("Warning: failed to record gateway request %s: %v\n", call.ID, err)
+	}
+
+	// Заменяем оценку токенов, зарезервированную в лимитах, фактическим расходом
+	if call.reservation != nil {
+		actualTokens := usage.InputTokens + usage.OutputTokens
+		if err := s.rateLimiter.Reconcile(ctx, call.reservation, call.limits, actualTokens); err != nil {
+			fmt.Printf("Warning: failed to reconcile rate limit for request %s: %v\n", call.ID, err)
+		}
+	}
+
+	if totalCost > 0 {
+		if err := s.userSpendingRepo.AddSpent(ctx, call.ApiKey.UserID, totalCost); err != nil {
+			fmt.Printf("Warning: failed to update spending for user %s: %v\n", call.ApiKey.UserID, err)
+		} else if s.tierService != nil {
+			if err := s.tierService.CheckAndUpgradeTier(ctx, call.ApiKey.UserID); err != nil {
+				fmt.Printf("Warning: failed to check tier for user %s: %v\n", call.ApiKey.UserID, err)
+			}
+		}
+
+		if s.budgetService != nil {
+			if err := s.budgetService.RecordSpend(ctx, call.ApiKey.UserID, call.ApiKey.TeamID, totalCost); err != nil {
+				fmt.Printf("Warning: failed to record budget spending for user %s: %v\n", call.ApiKey.UserID, err)
+			}
+		}
+	}
+
+	// Списываем фактическую стоимость сразу, чтобы снятое удержание не открыло баланс повторно.
+	// Если списать не удалось, запрос будет списан задачей сверки журнала
+	if s.ledgerService != nil {
+		if err := s.ledgerService.ChargeRequest(ctx, request); err != nil {
+			fmt.Printf("Warning: failed to charge request %s: %v\n", call.ID, err)
+		}
+	}
+	s.releaseQuota(ctx, call)
+}
+
+// cost считает стоимость вызова по зафиксированной версии цены с учетом скидки по промокоду
+func (c *GatewayCall) cost(inputTokens, outputTokens int) (float64, float64) {
+	inputCost, outputCost := calculateCost(c.Model.ModelConfig, c.Price, inputTokens, outputTokens)
+	if c.DiscountPercent > 0 {
+		factor := 1 - c.DiscountPercent/100
+		inputCost *= factor
+		outputCost *= factor
+	}
+	return inputCost, outputCost
+}
+
+// calculateCost считает стоимость запроса по версии цены продажи (цены указаны за токен).
+// Без версии цены используется стоимость провайдера из конфигурации модели
+func calculateCost(config *domain.ModelConfig, price *domain.ModelPrice, inputTokens, outputTokens int) (float64, float64) {
+	if config == nil || config.IsFree {
+		return 0, 0
+	}
+
+	if price != nil {
+		return float64(inputTokens) * price.InputTokenCost, float64(outputTokens) * price.OutputTokenCost
+	}
+
+	var inputCost, outputCost float64
+	if config.InputTokenCost != nil {
+		inputCost = float64(inputTokens) * *config.InputTokenCost
+	}
+	if config.OutputTokenCost != nil {
+		outputCost = float64(outputTokens) * *config.OutputTokenCost
+	}
+
+	return inputCost, outputCost
+}
@@ -0,0 +1,635 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"oneui-hub/internal/config"
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/litellm"
+	"oneui-hub/internal/repository"
+	"oneui-hub/pkg/auth"
+)
+
+// fakeRequestRepository хранит созданные запросы в памяти
+type fakeRequestRepository struct {
+	mu       sync.Mutex
+	requests []*domain.Request
+}
+
+func (r *fakeRequestRepository) Create(ctx context.Context, request *domain.Request) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, request)
+	return nil
+}
+
+func (r *fakeRequestRepository) GetByID(ctx context.Context, id string) (*domain.Request, error) {
+	return nil, nil
+}
+
+func (r *fakeRequestRepository) GetByUserID(ctx context.Context, userID string, limit, offset int) ([]*domain.Request, error) {
+	return nil, nil
+}
+
+func (r *fakeRequestRepository) GetByModelID(ctx context.Context, modelID string, limit, offset int) ([]*domain.Request, error) {
+	return nil, nil
+}
+
+func (r *fakeRequestRepository) List(ctx context.Context, limit, offset int) ([]*domain.Request, error) {
+	return nil, nil
+}
+
+func (r *fakeRequestRepository) SumCostByApiKeys(ctx context.Context, apiKeyIDs []string, since time.Time) (float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var total float64
+	for _, request := range r.requests {
+		if request.ApiKeyID != nil && slices.Contains(apiKeyIDs, *request.ApiKeyID) && !request.CreatedAt.Before(since) {
+			total += request.TotalCost
+		}
+	}
+	return total, nil
+}
+
+func (r *fakeRequestRepository) SumUsageByTeam(ctx context.Context, teamID string, from, to time.Time) ([]*repository.UsageByUser, error) {
+	return nil, nil
+}
+
+// fakeUserSpendingRepository накапливает траты в памяти, в том числе по дням
+type fakeUserSpendingRepository struct {
+	mu        sync.Mutex
+	spent     map[string]float64
+	daily     map[string]map[time.Time]float64
+	paid      map[string]float64
+	paidDaily map[string]map[time.Time]float64
+}
+
+func (r *fakeUserSpendingRepository) Create(ctx context.Context, spending *domain.UserSpending) error {
+	return nil
+}
+
+func (r *fakeUserSpendingRepository) GetByUserID(ctx context.Context, userID string) (*domain.UserSpending, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &domain.UserSpending{UserID: userID, TotalSpent: r.spent[userID], TotalPaid: r.paid[userID]}, nil
+}
+
+func (r *fakeUserSpendingRepository) Update(ctx context.Context, spending *domain.UserSpending) error {
+	return nil
+}
+
+func (r *fakeUserSpendingRepository) AddSpent(ctx context.Context, userID string, amount float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.spent == nil {
+		r.spent = map[string]float64{}
+	}
+	r.spent[userID] += amount
+	r.addDay(userID, time.Now(), amount)
+	return nil
+}
+
+func (r *fakeUserSpendingRepository) AddPaid(ctx context.Context, userID string, amount float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.paid == nil {
+		r.paid = map[string]float64{}
+		r.paidDaily = map[string]map[time.Time]float64{}
+	}
+	r.paid[userID] += amount
+	addToDay(r.paidDaily, userID, time.Now(), amount)
+	return nil
+}
+
+func (r *fakeUserSpendingRepository) addDay(userID string, day time.Time, amount float64) {
+	if r.daily == nil {
+		r.daily = map[string]map[time.Time]float64{}
+	}
+	addToDay(r.daily, userID, day, amount)
+}
+
+func addToDay(daily map[string]map[time.Time]float64, userID string, day time.Time, amount float64) {
+	if daily[userID] == nil {
+		daily[userID] = map[time.Time]float64{}
+	}
+	daily[userID][day.UTC().Truncate(24*time.Hour)] += amount
+}
+
+func (r *fakeUserSpendingRepository) SumSince(ctx context.Context, userID string, since time.Time) (float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return sumSinceDay(r.daily[userID], since), nil
+}
+
+func (r *fakeUserSpendingRepository) SumPaidSince(ctx context.Context, userID string, since time.Time) (float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return sumSinceDay(r.paidDaily[userID], since), nil
+}
+
+func sumSinceDay(daily map[time.Time]float64, since time.Time) float64 {
+	var total float64
+	for day, amount := range daily {
+		if !day.Before(since.UTC().Truncate(24 * time.Hour)) {
+			total += amount
+		}
+	}
+	return total
+}
+
+func (r *fakeUserSpendingRepository) Delete(ctx context.Context, userID string) error {
+	return nil
+}
+
+// bufferSink собирает потоковый ответ шлюза
+type bufferSink struct {
+	status      int
+	contentType string
+	body        bytes.Buffer
+	flushes     int
+}
+
+func (s *bufferSink) Start(statusCode int, contentType string) {
+	s.status = statusCode
+	s.contentType = contentType
+}
+
+func (s *bufferSink) Write(p []byte) error {
+	_, err := s.body.Write(p)
+	return err
+}
+
+func (s *bufferSink) Flush() {
+	s.flushes++
+}
+
+// testUpstreamKey - ключ LiteLLM, сохраненный в тестовом API ключе
+const testUpstreamKey = "sk-litellm-user-1"
+
+func newTestGatewayCall(body string) *GatewayCall {
+	inputCost := 0.001
+	outputCost := 0.002
+	originalKey, err := auth.EncryptAPIKey(testUpstreamKey)
+	if err != nil {
+		panic(err)
+	}
+
+	return &GatewayCall{
+		ID:       "request-1",
+		ApiKey:   &domain.ApiKey{ID: "key-1", UserID: "user-1", OriginalKey: originalKey},
+		CallType: domain.CallTypeChat,
+		Model: &domain.Model{
+			ID:         "model-1",
+			ExternalID: "gpt-test",
+			Providers:  `["openai"]`,
+			ModelConfig: &domain.ModelConfig{
+				IsEnabled:       true,
+				InputTokenCost:  &inputCost,
+				OutputTokenCost: &outputCost,
+			},
+		},
+		Body:      []byte(body),
+		Payload:   &ChatCompletionPayload{Model: "gpt-test", Stream: true},
+		StartedAt: time.Now(),
+	}
+}
+
+func newTestGatewayService(t *testing.T, handler http.HandlerFunc) (*gatewayService, *fakeRequestRepository, *fakeUserSpendingRepository) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	requestRepo := &fakeRequestRepository{}
+	spendingRepo := &fakeUserSpendingRepository{}
+	client := litellm.NewClient(&config.LiteLLMConfig{BaseURL: server.URL, Timeout: 5 * time.Second})
+
+	return &gatewayService{
+		requestRepo:      requestRepo,
+		userSpendingRepo: spendingRepo,
+		litellmClient:    client,
+	}, requestRepo, spendingRepo
+}
+
+func writeSSE(w http.ResponseWriter, chunks ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, chunk := range chunks {
+		fmt.Fprintf(w, "data: %s\n\n", chunk)
+		w.(http.Flusher).Flush()
+	}
+}
+
+func TestGatewayService_StreamChatCompletion_UsesTerminalUsageChunk(t *testing.T) {
+	var upstreamBody map[string]interface{}
+
+	svc, requestRepo, spendingRepo := newTestGatewayService(t, func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&upstreamBody))
+		writeSSE(w,
+			`{"id":"chatcmpl-1","choices":[{"delta":{"content":"Hel"}}]}`,
+			`{"id":"chatcmpl-1","choices":[{"delta":{"content":"lo"}}]}`,
+			`{"id":"chatcmpl-1","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":2}}`,
+			`[DONE]`,
+		)
+	})
+
+	call := newTestGatewayCall(`{"model":"gpt-test","stream":true,"messages":[{"role":"user","content":"Hi"}]}`)
+	sink := &bufferSink{}
+
+	err := svc.StreamChatCompletion(context.Background(), call, sink)
+	require.NoError(t, err)
+
+	// Хаб запросил usage у провайдера, но клиент его не просил - итоговый чанк скрыт
+	options, ok := upstreamBody["stream_options"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, true, options["include_usage"])
+
+	assert.Equal(t, http.StatusOK, sink.status)
+	assert.Equal(t, "text/event-stream", sink.contentType)
+	assert.Contains(t, sink.body.String(), `"content":"Hel"`)
+	assert.Contains(t, sink.body.String(), "data: [DONE]")
+	assert.NotContains(t, sink.body.String(), "prompt_tokens")
+	assert.Greater(t, sink.flushes, 2)
+
+	require.Len(t, requestRepo.requests, 1)
+	recorded := requestRepo.requests[0]
+	assert.Equal(t, domain.RequestStatusCompleted, recorded.Status)
+	assert.Equal(t, 12, recorded.InputTokens)
+	assert.Equal(t, 2, recorded.OutputTokens)
+	assert.Equal(t, "chatcmpl-1", *recorded.ExternalRequestID)
+	assert.InDelta(t, 12*0.001+2*0.002, recorded.TotalCost, 1e-9)
+	assert.InDelta(t, recorded.TotalCost, spendingRepo.spent["user-1"], 1e-9)
+}
+
+func TestGatewayService_StreamChatCompletion_CountsTokensWithoutUsage(t *testing.T) {
+	svc, requestRepo, _ := newTestGatewayService(t, func(w http.ResponseWriter, r *http.Request) {
+		writeSSE(w,
+			`{"id":"chatcmpl-2","choices":[{"delta":{"content":"`+strings.Repeat("a", 40)+`"}}]}`,
+			`[DONE]`,
+		)
+	})
+
+	call := newTestGatewayCall(`{"model":"gpt-test","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"Hi"}]}`)
+	sink := &bufferSink{}
+
+	err := svc.StreamChatCompletion(context.Background(), call, sink)
+	require.NoError(t, err)
+
+	require.Len(t, requestRepo.requests, 1)
+	recorded := requestRepo.requests[0]
+	assert.Equal(t, 10, recorded.OutputTokens)
+	assert.Equal(t, estimatePromptTokens(call.Body), recorded.InputTokens)
+	assert.Greater(t, recorded.InputTokens, 0)
+}
+
+func TestGatewayService_ChatCompletion_CountsTokensWithoutUsage(t *testing.T) {
+	svc, requestRepo, spendingRepo := newTestGatewayService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"chatcmpl-3","choices":[`+
+			`{"message":{"role":"assistant","content":"%s"}},`+
+			`{"message":{"role":"assistant","content":null,"tool_calls":[{"function":{"name":"lookup","arguments":"%s"}}]}}`+
+			`]}`, strings.Repeat("a", 40), strings.Repeat("b", 14))
+	})
+
+	call := newTestGatewayCall(`{"model":"gpt-test","messages":[{"role":"user","content":"Hi"}]}`)
+
+	resp, err := svc.ChatCompletion(context.Background(), call)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Провайдер не вернул usage: выходные токены оцениваются по тексту ответа и вызовам инструментов
+	require.Len(t, requestRepo.requests, 1)
+	recorded := requestRepo.requests[0]
+	assert.Equal(t, domain.RequestStatusCompleted, recorded.Status)
+	assert.Equal(t, "chatcmpl-3", *recorded.ExternalRequestID)
+	assert.Equal(t, estimatePromptTokens(call.Body), recorded.InputTokens)
+	assert.Equal(t, 15, recorded.OutputTokens)
+	assert.InDelta(t, float64(recorded.InputTokens)*0.001+15*0.002, recorded.TotalCost, 1e-9)
+	assert.InDelta(t, recorded.TotalCost, spendingRepo.spent["user-1"], 1e-9)
+}
+
+func TestGatewayService_UsesOwnUpstreamKeyOrFails(t *testing.T) {
+	var authorizations []string
+	svc, requestRepo, _ := newTestGatewayService(t, func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-4","usage":{"prompt_tokens":1,"completion_tokens":1}}`)
+	})
+	ctx := context.Background()
+	body := `{"model":"gpt-test","messages":[{"role":"user","content":"Hi"}]}`
+
+	_, err := svc.ChatCompletion(ctx, newTestGatewayCall(body))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer " + testUpstreamKey}, authorizations)
+
+	// Без собственного ключа запрос не должен уходить от имени мастер-ключа LiteLLM
+	for name, originalKey := range map[string]string{"missing": "", "undecryptable": "not-encrypted"} {
+		t.Run(name, func(t *testing.T) {
+			authorizations = nil
+			requestRepo.requests = nil
+
+			call := newTestGatewayCall(body)
+			call.ApiKey.OriginalKey = originalKey
+			_, err := svc.ChatCompletion(ctx, call)
+			require.Error(t, err)
+			assert.Equal(t, http.StatusInternalServerError, err.(*GatewayError).StatusCode)
+
+			call = newTestGatewayCall(body)
+			call.ApiKey.OriginalKey = originalKey
+			err = svc.StreamChatCompletion(ctx, call, &bufferSink{})
+			require.Error(t, err)
+			assert.Equal(t, "upstream_key_unavailable", err.(*GatewayError).Code)
+
+			assert.Empty(t, authorizations)
+			require.Len(t, requestRepo.requests, 2)
+			assert.Equal(t, domain.RequestStatusFailed, requestRepo.requests[0].Status)
+			assert.Equal(t, domain.RequestStatusFailed, requestRepo.requests[1].Status)
+		})
+	}
+}
+
+func TestGatewayService_InvalidStreamOptionsDoNotLeakReservations(t *testing.T) {
+	upstreamCalled := false
+	svc, requestRepo, _ := newTestGatewayService(t, func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalled = true
+	})
+	quotaRepo := &fakeQuotaRepository{usage: repository.QuotaUsage{Balance: 1}}
+	svc.quotaRepo = quotaRepo
+	svc.defaultMaxTokens = 100
+	ctx := context.Background()
+	body := `{"model":"gpt-test","stream":true,"stream_options":"yes","messages":[{"role":"user","content":"Hi"}]}`
+
+	// Prepare отклоняет запрос до поиска модели и резервирования квоты
+	call, err := svc.Prepare(ctx, &GatewayRequest{ApiKey: &domain.ApiKey{ID: "key-1", UserID: "user-1"}, CallType: domain.CallTypeChat, Body: []byte(body)})
+	assert.Nil(t, call)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.(*GatewayError).StatusCode)
+	assert.Equal(t, "invalid_stream_options", err.(*GatewayError).Code)
+	assert.Empty(t, quotaRepo.holds)
+
+	// Если вызов все же дошел до потоковой передачи, удержание снимается, а запрос записывается как неудачный
+	call = newTestGatewayCall(body)
+	require.NoError(t, svc.reserveQuota(ctx, call))
+	require.Len(t, quotaRepo.holds, 1)
+
+	err = svc.StreamChatCompletion(ctx, call, &bufferSink{})
+	require.Error(t, err)
+	assert.Equal(t, "invalid_stream_options", err.(*GatewayError).Code)
+	assert.Empty(t, quotaRepo.holds)
+	assert.False(t, upstreamCalled)
+	require.Len(t, requestRepo.requests, 1)
+	assert.Equal(t, domain.RequestStatusFailed, requestRepo.requests[0].Status)
+}
+
+func TestGatewayService_StreamChatCompletion_PassesUpstreamErrors(t *testing.T) {
+	svc, requestRepo, spendingRepo := newTestGatewayService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"message":"bad request"}}`))
+	})
+
+	call := newTestGatewayCall(`{"model":"gpt-test","stream":true,"messages":[]}`)
+	sink := &bufferSink{}
+
+	err := svc.StreamChatCompletion(context.Background(), call, sink)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusBadRequest, sink.status)
+	assert.Contains(t, sink.body.String(), "bad request")
+	require.Len(t, requestRepo.requests, 1)
+	assert.Equal(t, domain.RequestStatusFailed, requestRepo.requests[0].Status)
+	assert.Empty(t, spendingRepo.spent)
+}
+
+func TestWithStreamUsage(t *testing.T) {
+	body, injected, err := withStreamUsage([]byte(`{"model":"m","stream_options":{"include_usage":true}}`))
+	require.NoError(t, err)
+	assert.False(t, injected)
+	assert.JSONEq(t, `{"model":"m","stream_options":{"include_usage":true}}`, string(body))
+
+	body, injected, err = withStreamUsage([]byte(`{"model":"m"}`))
+	require.NoError(t, err)
+	assert.True(t, injected)
+	assert.JSONEq(t, `{"model":"m","stream_options":{"include_usage":true}}`, string(body))
+}
+
+func TestCheckKeyScopes(t *testing.T) {
+	model := &domain.Model{ID: "model-1", CompanyID: "company-1", ExternalID: "gpt-test"}
+
+	newKey := func(scopes domain.ApiKeyScopes) *domain.ApiKey {
+		key := &domain.ApiKey{ID: "key-1"}
+		key.SetScopes(scopes)
+		return key
+	}
+
+	codeOf := func(err error) string {
+		if err == nil {
+			return ""
+		}
+		return err.(*GatewayError).Code
+	}
+
+	// Ключ без ограничений
+	assert.NoError(t, checkKeyScopes(newKey(domain.ApiKeyScopes{}), model, domain.CallTypeChat))
+
+	// Модель разрешена через компанию
+	assert.NoError(t, checkKeyScopes(newKey(domain.ApiKeyScopes{Companies: []string{"company-1"}}), model, domain.CallTypeChat))
+
+	assert.Equal(t, "model_not_allowed",
+		codeOf(checkKeyScopes(newKey(domain.ApiKeyScopes{Models: []string{"other-model"}}), model, domain.CallTypeChat)))
+	assert.Equal(t, "call_type_not_allowed",
+		codeOf(checkKeyScopes(newKey(domain.ApiKeyScopes{CallTypes: []string{domain.CallTypeEmbeddings}}), model, domain.CallTypeChat)))
+	assert.Equal(t, "insufficient_permissions",
+		codeOf(checkKeyScopes(newKey(domain.ApiKeyScopes{Permission: domain.ApiKeyPermissionReadOnly}), model, domain.CallTypeChat)))
+}
+
+func TestCheckEmailVerified(t *testing.T) {
+	paid := &domain.Model{ID: "model-1", ExternalID: "gpt-test", ModelConfig: &domain.ModelConfig{IsEnabled: true}}
+	free := &domain.Model{ID: "model-2", ExternalID: "free-test", ModelConfig: &domain.ModelConfig{IsEnabled: true, IsFree: true}}
+
+	verifiedAt := time.Now()
+	unverified := &domain.ApiKey{ID: "key-1", User: &domain.User{ID: "user-1"}}
+	verified := &domain.ApiKey{ID: "key-2", User: &domain.User{ID: "user-2", EmailVerifiedAt: &verifiedAt}}
+
+	err := checkEmailVerified(unverified, paid)
+	require.Error(t, err)
+	assert.Equal(t, "email_not_verified", err.(*GatewayError).Code)
+	assert.NoError(t, checkEmailVerified(unverified, free))
+	assert.NoError(t, checkEmailVerified(verified, paid))
+}
+
+func TestGatewayService_CheckKeyBudget(t *testing.T) {
+	requestRepo := &fakeRequestRepository{}
+	svc := &gatewayService{
+		apiKeyService: &apiKeyService{requestRepo: requestRepo},
+	}
+
+	maxBudget := 1.0
+	periodStart := time.Now().Add(-36 * time.Hour)
+	key := &domain.ApiKey{
+		ID:                "key-1",
+		MaxBudget:         &maxBudget,
+		BudgetDuration:    "1d",
+		BudgetPeriodStart: &periodStart,
+	}
+
+	addRequest := func(cost float64, createdAt time.Time) {
+		requestRepo.requests = append(requestRepo.requests, &domain.Request{
+			ApiKeyID:  &key.ID,
+			TotalCost: cost,
+			CreatedAt: createdAt,
+		})
+	}
+
+	// Траты прошлого периода не учитываются
+	addRequest(5, time.Now().Add(-30*time.Hour))
+	addRequest(0.6, time.Now().Add(-time.Hour))
+	budget, err := svc.checkKeyBudget(context.Background(), key)
+	require.NoError(t, err)
+	assert.InDelta(t, 0.6, budget.Spent, 1e-9)
+
+	addRequest(0.4, time.Now())
+	_, err = svc.checkKeyBudget(context.Background(), key)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusPaymentRequired, err.(*GatewayError).StatusCode)
+	assert.Equal(t, "key_budget_exceeded", err.(*GatewayError).Code)
+
+	budget, err = svc.apiKeyService.GetApiKeyBudget(context.Background(), key)
+	require.NoError(t, err)
+	assert.InDelta(t, 1.0, budget.Spent, 1e-9)
+	assert.Equal(t, 0.0, *budget.RemainingBudget)
+	assert.WithinDuration(t, periodStart.Add(48*time.Hour), *budget.ResetAt, time.Second)
+}
+
+// fakeQuotaRepository проверяет квоты по заданному состоянию и запоминает удержания
+type fakeQuotaRepository struct {
+	mu    sync.Mutex
+	usage repository.QuotaUsage
+	holds map[string]*domain.QuotaHold
+}
+
+func (r *fakeQuotaRepository) Reserve(ctx context.Context, hold *domain.QuotaHold, monthStart time.Time, check func(usage *repository.QuotaUsage) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	usage := r.usage
+	for _, held := range r.holds {
+		usage.HeldAmount += held.Amount
+		usage.HeldTokens += held.Tokens
+		if held.ApiKeyID == hold.ApiKeyID {
+			usage.KeyHeldAmount += held.Amount
+		}
+	}
+	if err := check(&usage); err != nil {
+		return err
+	}
+
+	if r.holds == nil {
+		r.holds = map[string]*domain.QuotaHold{}
+	}
+	r.holds[hold.ID] = hold
+	return nil
+}
+
+func (r *fakeQuotaRepository) Release(ctx context.Context, holdID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.holds, holdID)
+	return nil
+}
+
+func TestGatewayService_ReserveQuota(t *testing.T) {
+	quotaRepo := &fakeQuotaRepository{usage: repository.QuotaUsage{Balance: 1}}
+	ledgerRepo := newFakeLedgerRepository()
+	svc, _, _ := newTestGatewayService(t, nil)
+	svc.quotaRepo = quotaRepo
+	svc.ledgerService = NewLedgerService(ledgerRepo, time.Time{})
+	svc.defaultMaxTokens = 1000
+	ctx := context.Background()
+
+	// 100 токенов ответа по $0.002 и короткий промпт укладываются в баланс $1
+	maxTokens := 100
+	call := newTestGatewayCall(`{"model":"gpt-test","messages":[{"role":"user","content":"Hi"}]}`)
+	call.Payload.MaxTokens = &maxTokens
+	require.NoError(t, svc.reserveQuota(ctx, call))
+	require.NotNil(t, call.hold)
+	assert.InDelta(t, 0.2+0.001*float64(call.hold.Tokens-100), call.hold.Amount, 1e-9)
+
+	// Без max_tokens оценка берется по умолчанию: 1000 * $0.002 больше остатка с учетом удержания
+	second := newTestGatewayCall(`{"model":"gpt-test","messages":[{"role":"user","content":"Hi"}]}`)
+	second.ID = "request-2"
+	err := svc.reserveQuota(ctx, second)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusPaymentRequired, err.(*GatewayError).StatusCode)
+	assert.Equal(t, "insufficient_balance", err.(*GatewayError).Code)
+
+	// После завершения списывается фактическая стоимость, а удержание снимается
+	svc.settle(ctx, call, &gatewayUsage{Status: domain.RequestStatusCompleted, InputTokens: 10, OutputTokens: 20})
+	assert.Empty(t, quotaRepo.holds)
+	assert.InDelta(t, -0.05, ledgerRepo.accounts[domain.LedgerUserAccount("user-1")], 1e-9)
+
+	// Бесплатная модель не требует баланса, но расходует месячный лимит токенов
+	limit := int64(500)
+	quotaRepo.usage = repository.QuotaUsage{Balance: 0, MonthlyTokenLimit: &limit, UsedTokens: 450}
+	free := newTestGatewayCall(`{"model":"gpt-test","messages":[{"role":"user","content":"Hi"}]}`)
+	free.Model.ModelConfig.IsFree = true
+	free.Payload.MaxTokens = &maxTokens
+	err = svc.reserveQuota(ctx, free)
+	require.Error(t, err)
+	assert.Equal(t, "monthly_token_limit_exceeded", err.(*GatewayError).Code)
+
+	quotaRepo.usage.UsedTokens = 0
+	require.NoError(t, svc.reserveQuota(ctx, free))
+	assert.Zero(t, free.hold.Amount)
+}
+
+func TestGatewayService_ReserveKeyBudget(t *testing.T) {
+	quotaRepo := &fakeQuotaRepository{usage: repository.QuotaUsage{Balance: 10}}
+	svc, _, _ := newTestGatewayService(t, nil)
+	svc.quotaRepo = quotaRepo
+	ctx := context.Background()
+
+	maxBudget := 1.0
+	maxTokens := 100
+	newCall := func(id, keyID string) *GatewayCall {
+		call := newTestGatewayCall(`{"model":"gpt-test","messages":[{"role":"user","content":"Hi"}]}`)
+		call.ID = id
+		call.ApiKey.ID = keyID
+		call.ApiKey.MaxBudget = &maxBudget
+		call.Payload.MaxTokens = &maxTokens
+		call.keyBudget = &ApiKeyBudget{MaxBudget: &maxBudget, Spent: 0.5}
+		return call
+	}
+
+	// Два запроса примерно по $0.2 укладываются в остаток бюджета ключа $0.5
+	first := newCall("request-1", "key-1")
+	require.NoError(t, svc.reserveQuota(ctx, first))
+	assert.Equal(t, "key-1", first.hold.ApiKeyID)
+	require.NoError(t, svc.reserveQuota(ctx, newCall("request-2", "key-1")))
+
+	// Третий превысил бы бюджет вместе с запросами, которые еще выполняются
+	err := svc.reserveQuota(ctx, newCall("request-3", "key-1"))
+	require.Error(t, err)
+	assert.Equal(t, http.StatusPaymentRequired, err.(*GatewayError).StatusCode)
+	assert.Equal(t, "key_budget_exceeded", err.(*GatewayError).Code)
+	assert.Len(t, quotaRepo.holds, 2)
+
+	// Удержания другого ключа пользователя не расходуют его бюджет
+	require.NoError(t, svc.reserveQuota(ctx, newCall("request-4", "key-2")))
+
+	// После завершения запроса удержание заменяется фактической стоимостью в истории запросов
+	svc.settle(ctx, first, &gatewayUsage{Status: domain.RequestStatusCompleted, InputTokens: 10, OutputTokens: 20})
+	assert.NotContains(t, quotaRepo.holds, "request-1")
+	require.NoError(t, svc.reserveQuota(ctx, newCall("request-3", "key-1")))
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"oneui-hub/internal/domain"
+)
+
+// StreamSink принимает ответ шлюза, который передается клиенту по частям
+type StreamSink interface {
+	// Start отправляет клиенту статус и тип содержимого ответа
+	Start(statusCode int, contentType string)
+	// Write передает клиенту очередную часть ответа
+	Write(p []byte) error
+	// Flush немедленно отправляет накопленные данные клиенту
+	Flush()
+}
+
+// errClientGone означает, что клиент закрыл соединение во время потоковой передачи
+var errClientGone = errors.New("client disconnected")
+
+type streamChunk struct {
+	ID      string `json:"id"`
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *chatCompletionUsage `json:"usage"`
+}
+
+// streamAccumulator собирает данные о потоке, нужные для учета токенов
+type streamAccumulator struct {
+	externalID string
+	usage      *chatCompletionUsage
+	output     strings.Builder
+	// hideUsage скрывает от клиента итоговый чанк с usage, если клиент его не запрашивал
+	hideUsage bool
+}
+
+func (s *gatewayService) StreamChatCompletion(ctx context.Context, call *GatewayCall, sink StreamSink) error {
+	body, usageInjected, err := withStreamUsage(call.Body)
+	if err != nil {
+		// Prepare уже проверил тело, но удержание квоты и слот лимита нужно освободить в любом случае
+		s.settle(ctx, call, &gatewayUsage{Status: domain.RequestStatusFailed})
+		return errInvalidStreamOptions()
+	}
+
+	upstreamKey, err := s.upstreamKey(call.ApiKey)
+	if err != nil {
+		fmt.Printf("Warning: no upstream key for request %s: %v\n", call.ID, err)
+		s.settle(ctx, call, &gatewayUsage{Status: domain.RequestStatusFailed})
+		return errUpstreamKeyUnavailable()
+	}
+
+	// Отмена контекста прерывает запрос к LiteLLM, если клиент отключился
+	upstreamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resp, err := s.litellmClient.ChatCompletionStream(upstreamCtx, upstreamKey, body)
+	if err != nil {
+		s.settle(ctx, call, &gatewayUsage{Status: domain.RequestStatusFailed})
+		return errUpstreamUnavailable()
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		s.settle(ctx, call, &gatewayUsage{Status: domain.RequestStatusFailed})
+
+		contentType := resp.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		sink.Start(resp.StatusCode, contentType)
+		_ = sink.Write(respBody)
+		return nil
+	}
+
+	sink.Start(http.StatusOK, "text/event-stream")
+	sink.Flush()
+
+	acc := &streamAccumulator{hideUsage: usageInjected}
+	status := domain.RequestStatusCompleted
+
+	if err := relayStream(resp.Body, sink, acc); err != nil {
+		if errors.Is(err, errClientGone) || upstreamCtx.Err() != nil {
+			cancel()
+			status = domain.RequestStatusCancelled
+		} else {
+			fmt.Printf("Warning: upstream stream for request %s broke: %v\n", call.ID, err)
+			status = domain.RequestStatusFailed
+		}
+	}
+
+	usage := &gatewayUsage{
+		Status:     status,
+		ExternalID: acc.externalID,
+	}
+	if acc.usage != nil {
+		usage.InputTokens = acc.usage.PromptTokens
+		usage.OutputTokens = acc.usage.CompletionTokens
+	} else {
+		// Провайдер не прислал usage (или поток прервался) - считаем сами
+		usage.InputTokens = estimatePromptTokens(call.Body)
+		usage.OutputTokens = estimateTextTokens(acc.output.String())
+	}
+
+	s.settle(ctx, call, usage)
+
+	return nil
+}
+
+// relayStream построчно читает SSE поток LiteLLM и пересылает клиенту события целиком,
+// не дожидаясь окончания ответа
+func relayStream(upstream io.Reader, sink StreamSink, acc *streamAccumulator) error {
+	reader := bufio.NewReader(upstream)
+	var event []byte
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			event = append(event, line...)
+			if len(bytes.TrimSpace(line)) == 0 {
+				if writeErr := forwardEvent(event, sink, acc); writeErr != nil {
+					return writeErr
+				}
+				event = event[:0]
+			}
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				if len(bytes.TrimSpace(event)) > 0 {
+					return forwardEvent(append(event, '\n'), sink, acc)
+				}
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// forwardEvent учитывает данные SSE события и отправляет его клиенту
+func forwardEvent(event []byte, sink StreamSink, acc *streamAccumulator) error {
+	hidden := false
+
+	for _, line := range bytes.Split(event, []byte("\n")) {
+		data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+		if !ok {
+			continue
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 || bytes.Equal(data, []byte("[DONE]")) {
+			continue
+		}
+
+		var chunk streamChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			continue
+		}
+
+		if chunk.ID != "" && acc.externalID == "" {
+			acc.externalID = chunk.ID
+		}
+		for _, choice := range chunk.Choices {
+			acc.output.WriteString(choice.Delta.Content)
+			for _, toolCall := range choice.Delta.ToolCalls {
+				acc.output.WriteString(toolCall.Function.Name)
+				acc.output.WriteString(toolCall.Function.Arguments)
+			}
+		}
+		if chunk.Usage != nil {
+			acc.usage = chunk.Usage
+			if acc.hideUsage && len(chunk.Choices) == 0 {
+				hidden = true
+			}
+		}
+	}
+
+	if hidden {
+		return nil
+	}
+
+	if err := sink.Write(event); err != nil {
+		return errClientGone
+	}
+	sink.Flush()
+
+	return nil
+}
+
+// withStreamUsage включает stream_options.include_usage, чтобы провайдер прислал итоговый usage.
+// Возвращает true, если опция была добавлена хабом, а не клиентом.
+func withStreamUsage(body []byte) ([]byte, bool, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, false, err
+	}
+
+	options := map[string]json.RawMessage{}
+	if raw, ok := fields["stream_options"]; ok && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &options); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if string(options["include_usage"]) == "true" {
+		return body, false, nil
+	}
+
+	options["include_usage"] = json.RawMessage("true")
+	rawOptions, err := json.Marshal(options)
+	if err != nil {
+		return nil, false, err
+	}
+	fields["stream_options"] = rawOptions
+
+	newBody, err := json.Marshal(fields)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return newBody, true, nil
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"oneui-hub/internal/domain"
+)
+
+// pricePerMillion переводит цену за токен в цену за миллион токенов, как ее показывают провайдеры
+func pricePerMillion(price float64) string {
+	if price == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(price*1e6, 'f', 4, 64)
+}
+
+// renderInvoiceCSV записывает строки счета в CSV, последняя строка - итог
+func renderInvoiceCSV(w io.Writer, invoice *domain.Invoice) error {
+	writer := csv.NewWriter(w)
+
+	period := [2]string{invoice.PeriodStart.Format("2006-01-02"), invoice.PeriodEnd.Format("2006-01-02")}
+	records := [][]string{{
+		"invoice_number", "period_start", "period_end", "model", "model_price_id",
+		"requests", "input_tokens", "output_tokens",
+		"input_price_per_1m_usd", "output_price_per_1m_usd", "amount_usd", "amount", "currency",
+	}}
+	for _, line := range invoice.Lines {
+		priceID := ""
+		if line.ModelPriceID != nil {
+			priceID = *line.ModelPriceID
+		}
+		records = append(records, []string{
+			invoice.Number, period[0], period[1], line.ModelName, priceID,
+			strconv.FormatInt(line.Requests, 10),
+			strconv.FormatInt(line.InputTokens, 10),
+			strconv.FormatInt(line.OutputTokens, 10),
+			pricePerMillion(line.InputTokenPrice),
+			pricePerMillion(line.OutputTokenPrice),
+			strconv.FormatFloat(line.AmountUSD, 'f', 6, 64),
+			strconv.FormatFloat(line.Amount, 'f', 2, 64),
+			invoice.Currency,
+		})
+	}
+	records = append(records, []string{
+		invoice.Number, period[0], period[1], "TOTAL", "", "", "", "", "", "",
+		strconv.FormatFloat(invoice.SubtotalUSD, 'f', 6, 64),
+		strconv.FormatFloat(invoice.Total, 'f', 2, 64),
+		invoice.Currency,
+	})
+
+	if err := writer.WriteAll(records); err != nil {
+		return fmt.Errorf("failed to write invoice CSV: %w", err)
+	}
+	return nil
+}
+
+// renderInvoicePDF создает PDF счета на одной или нескольких страницах A4
+func renderInvoicePDF(w io.Writer, invoice *domain.Invoice, billTo []string) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Invoice "+invoice.Number, true)
+	pdf.SetAutoPageBreak(true, 15)
+	// Встроенные шрифты PDF поддерживают только cp1252, остальные символы заменяются
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 20)
+	pdf.CellFormat(0, 10, "INVOICE", "", 1, "L", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 10)
+	details := [][2]string{
+		{"Invoice number", invoice.Number},
+		{"Issue date", invoice.IssuedAt.UTC().Format("2006-01-02")},
+		{"Billing period", fmt.Sprintf("%s - %s", invoice.PeriodStart.Format("2006-01-02"), invoice.PeriodEnd.AddDate(0, 0, -1).Format("2006-01-02"))},
+		{"Currency", invoice.Currency},
+	}
+	if invoice.Currency != "USD" {
+		details = append(details, [2]string{"Exchange rate", fmt.Sprintf("1 USD = %.6f %s", invoice.ExchangeRate, invoice.Currency)})
+	}
+	for _, detail := range details {
+		pdf.CellFormat(40, 6, detail[0], "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 6, detail[1], "", 1, "L", false, 0, "")
+	}
+
+	pdf.Ln(4)
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(0, 6, "Bill to", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	for _, line := range billTo {
+		pdf.CellFormat(0, 6, tr(line), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(6)
+
+	widths := []float64{62, 20, 28, 28, 22, 30}
+	headers := []string{"Model", "Requests", "Input tokens", "Output tokens", "USD", "Amount, " + invoice.Currency}
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.SetFillColor(235, 235, 235)
+	for i, header := range headers {
+		align := "R"
+		if i == 0 {
+			align = "L"
+		}
+		pdf.CellFormat(widths[i], 7, header, "B", 0, align, true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Helvetica", "", 9)
+	for _, line := range invoice.Lines {
+		name := line.ModelName
+		if name == "" {
+			name = line.ModelID
+		}
+		cells := []string{
+			tr(name),
+			strconv.FormatInt(line.Requests, 10),
+			strconv.FormatInt(line.InputTokens, 10),
+			strconv.FormatInt(line.OutputTokens, 10),
+			strconv.FormatFloat(line.AmountUSD, 'f', 4, 64),
+			strconv.FormatFloat(line.Amount, 'f', 2, 64),
+		}
+		for i, cell := range cells {
+			align := "R"
+			if i == 0 {
+				align = "L"
+			}
+			pdf.CellFormat(widths[i], 6, cell, "", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	if len(invoice.Lines) == 0 {
+		pdf.CellFormat(0, 6, "No usage in this period", "", 1, "L", false, 0, "")
+	}
+
+	pdf.SetFont("Helvetica", "B", 10)
+	totalWidth := widths[0] + widths[1] + widths[2] + widths[3]
+	pdf.CellFormat(totalWidth, 8, "Total", "T", 0, "L", false, 0, "")
+	pdf.CellFormat(widths[4], 8, strconv.FormatFloat(invoice.SubtotalUSD, 'f', 4, 64), "T", 0, "R", false, 0, "")
+	pdf.CellFormat(widths[5], 8, fmt.Sprintf("%.2f %s", invoice.Total, invoice.Currency), "T", 1, "R", false, 0, "")
+
+	if err := pdf.Output(w); err != nil {
+		return fmt.Errorf("failed to write invoice PDF: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,407 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/repository"
+)
+
+var ErrInvalidInvoiceRequest = errors.New("invalid invoice request")
+
+// GenerateInvoiceRequest - закрытие расчетного периода клиента.
+// Задается либо UserID (личный счет), либо TeamID (счет команды)
+type GenerateInvoiceRequest struct {
+	UserID string
+	TeamID string
+	// PeriodStart - любой момент месяца, за который выставляется счет
+	PeriodStart time.Time
+	// Currency - валюта счета; пустое значение - валюта предыдущего счета клиента
+	Currency string
+}
+
+type InvoiceService interface {
+	// GenerateInvoice выставляет счет за месяц. Месяц должен быть завершен,
+	// повторный счет за тот же период возвращает repository.ErrDuplicate
+	GenerateInvoice(ctx context.Context, req *GenerateInvoiceRequest) (*domain.Invoice, error)
+	// GenerateMonthlyInvoices выставляет счета за прошедший месяц всем корпоративным клиентам
+	// и командам, ключами которых пользовались в этом месяце
+	GenerateMonthlyInvoices(ctx context.Context) error
+	GetInvoice(ctx context.Context, id string) (*domain.Invoice, error)
+	ListInvoices(ctx context.Context, userID string, limit, offset int) ([]*domain.Invoice, error)
+	ListTeamInvoices(ctx context.Context, teamID string, limit, offset int) ([]*domain.Invoice, error)
+	// InvoiceFile возвращает путь к файлу счета в формате pdf или csv, создавая файл заново, если его нет
+	InvoiceFile(ctx context.Context, invoice *domain.Invoice, format string) (string, error)
+}
+
+type invoiceService struct {
+	invoiceRepo     repository.InvoiceRepository
+	userRepo        repository.UserRepository
+	teamRepo        repository.TeamRepository
+	pricingService  PricingService
+	currencyService CurrencyService
+	storageDir      string
+	defaultCurrency string
+	now             func() time.Time
+}
+
+func NewInvoiceService(
+	invoiceRepo repository.InvoiceRepository,
+	userRepo repository.UserRepository,
+	teamRepo repository.TeamRepository,
+	pricingService PricingService,
+	currencyService CurrencyService,
+	storageDir string,
+	defaultCurrency string,
+) InvoiceService {
+	return &invoiceService{
+		invoiceRepo:     invoiceRepo,
+		userRepo:        userRepo,
+		teamRepo:        teamRepo,
+		pricingService:  pricingService,
+		currencyService: currencyService,
+		storageDir:      storageDir,
+		defaultCurrency: strings.ToUpper(defaultCurrency),
+		now:             time.Now,
+	}
+}
+
+// invoiceCustomer - получатель счета: пользователь или команда
+type invoiceCustomer struct {
+	userID string
+	teamID string
+	// billTo - строки блока "Bill to" в PDF
+	billTo []string
+}
+
+func (s *invoiceService) GenerateInvoice(ctx context.Context, req *GenerateInvoiceRequest) (*domain.Invoice, error) {
+	if (req.UserID == "") == (req.TeamID == "") {
+		return nil, fmt.Errorf("%w: either user or team is required", ErrInvalidInvoiceRequest)
+	}
+
+	periodStart, periodEnd := invoicePeriod(req.PeriodStart)
+	if periodEnd.After(s.now()) {
+		return nil, fmt.Errorf("%w: billing period %s is not closed yet", ErrInvalidInvoiceRequest, periodStart.Format("2006-01"))
+	}
+
+	customer, err := s.customer(ctx, req.UserID, req.TeamID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := s.aggregateUsage(ctx, customer, periodStart, periodEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issue(ctx, customer, periodStart, periodEnd, req.Currency, usage)
+}
+
+// invoicePeriod возвращает календарный месяц (UTC), в который попадает at; конец не включается
+func invoicePeriod(at time.Time) (time.Time, time.Time) {
+	at = at.UTC()
+	periodStart := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return periodStart, periodStart.AddDate(0, 1, 0)
+}
+
+// customer находит получателя счета
+func (s *invoiceService) customer(ctx context.Context, userID, teamID string) (*invoiceCustomer, error) {
+	if teamID != "" {
+		team, err := s.teamRepo.GetByID(ctx, teamID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get team: %w", err)
+		}
+		return teamInvoiceCustomer(team), nil
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	customer := &invoiceCustomer{userID: user.ID}
+	if user.Name != nil && *user.Name != "" {
+		customer.billTo = append(customer.billTo, *user.Name)
+	}
+	customer.billTo = append(customer.billTo, user.Email)
+	return customer, nil
+}
+
+func teamInvoiceCustomer(team *domain.Team) *invoiceCustomer {
+	return &invoiceCustomer{teamID: team.ID, billTo: []string{team.Name}}
+}
+
+func (s *invoiceService) aggregateUsage(ctx context.Context, customer *invoiceCustomer, start, end time.Time) ([]*repository.InvoiceUsage, error) {
+	if customer.teamID != "" {
+		return s.invoiceRepo.AggregateTeamUsage(ctx, customer.teamID, start, end)
+	}
+	return s.invoiceRepo.AggregateUsage(ctx, customer.userID, start, end)
+}
+
+// issue пересчитывает использование в валюту счета, сохраняет счет и создает его файлы
+func (s *invoiceService) issue(ctx context.Context, customer *invoiceCustomer, periodStart, periodEnd time.Time, currency string,
+	usage []*repository.InvoiceUsage) (*domain.Invoice, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "" {
+		var err error
+		currency, err = s.customerCurrency(ctx, customer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rate, err := s.currencyService.ConvertCurrency(ctx, 1, "USD", currency)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInvoiceRequest, err)
+	}
+
+	invoice := &domain.Invoice{
+		ID:           uuid.New().String(),
+		UserID:       customer.userID,
+		TeamID:       customer.teamID,
+		PeriodStart:  periodStart,
+		PeriodEnd:    periodEnd,
+		Currency:     currency,
+		ExchangeRate: rate,
+		Status:       domain.InvoiceStatusIssued,
+		IssuedAt:     s.now(),
+	}
+
+	prices := make(map[string]*domain.ModelPrice)
+	for _, item := range usage {
+		line := domain.InvoiceLine{
+			ID:           uuid.New().String(),
+			InvoiceID:    invoice.ID,
+			ModelID:      item.ModelID,
+			ModelName:    item.ModelName,
+			ModelPriceID: item.ModelPriceID,
+			Requests:     item.Requests,
+			InputTokens:  item.InputTokens,
+			OutputTokens: item.OutputTokens,
+			// Стоимость запросов уже посчитана по версии цены, действовавшей на момент запроса,
+			// и списана с баланса - счет должен совпадать со списаниями
+			AmountUSD: math.Round(item.TotalCost*1e6) / 1e6,
+		}
+
+		if item.ModelPriceID != nil {
+			price, ok := prices[*item.ModelPriceID]
+			if !ok {
+				price, err = s.pricingService.GetPrice(ctx, *item.ModelPriceID)
+				if err != nil && !errors.Is(err, repository.ErrNotFound) {
+					return nil, fmt.Errorf("failed to get model price: %w", err)
+				}
+				prices[*item.ModelPriceID] = price
+			}
+			if price != nil {
+				line.InputTokenPrice = price.InputTokenCost
+				line.OutputTokenPrice = price.OutputTokenCost
+			}
+		}
+
+		amount, err := s.currencyService.ConvertCurrency(ctx, line.AmountUSD, "USD", currency)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert invoice line: %w", err)
+		}
+		line.Amount = roundCents(amount)
+
+		invoice.SubtotalUSD += line.AmountUSD
+		invoice.Total += line.Amount
+		invoice.Lines = append(invoice.Lines, line)
+	}
+	invoice.SubtotalUSD = math.Round(invoice.SubtotalUSD*1e6) / 1e6
+	invoice.Total = roundCents(invoice.Total)
+
+	if err := s.invoiceRepo.Create(ctx, invoice); err != nil {
+		return nil, err
+	}
+
+	// Файлы можно создать позже при скачивании, поэтому ошибка не отменяет счет
+	if err := s.storeFiles(ctx, invoice, customer); err != nil {
+		fmt.Printf("Warning: failed to store files of invoice %s: %v\n", invoice.Number, err)
+	}
+
+	return invoice, nil
+}
+
+// customerCurrency возвращает валюту последнего счета клиента или валюту по умолчанию
+func (s *invoiceService) customerCurrency(ctx context.Context, customer *invoiceCustomer) (string, error) {
+	var invoices []*domain.Invoice
+	var err error
+	if customer.teamID != "" {
+		invoices, err = s.invoiceRepo.ListByTeam(ctx, customer.teamID, 1, 0)
+	} else {
+		invoices, err = s.invoiceRepo.ListByUser(ctx, customer.userID, 1, 0)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(invoices) > 0 {
+		return invoices[0].Currency, nil
+	}
+	return s.defaultCurrency, nil
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+func (s *invoiceService) GenerateMonthlyInvoices(ctx context.Context) error {
+	users, err := s.userRepo.List(ctx, 0, 0)
+	if err != nil {
+		return err
+	}
+	teams, err := s.teamRepo.List(ctx, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	periodStart, periodEnd := invoicePeriod(s.now().AddDate(0, -1, 0))
+	issued, failed := 0, 0
+	for _, user := range users {
+		if user.Role != domain.RoleEnterprise {
+			continue
+		}
+
+		_, err := s.GenerateInvoice(ctx, &GenerateInvoiceRequest{UserID: user.ID, PeriodStart: periodStart})
+		if errors.Is(err, repository.ErrDuplicate) {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Warning: failed to generate invoice for user %s: %v\n", user.ID, err)
+			failed++
+			continue
+		}
+		issued++
+	}
+
+	// Команде счет выставляется, только если ее ключами пользовались
+	for _, team := range teams {
+		customer := teamInvoiceCustomer(team)
+		usage, err := s.aggregateUsage(ctx, customer, periodStart, periodEnd)
+		if err == nil && len(usage) == 0 {
+			continue
+		}
+		if err == nil {
+			_, err = s.issue(ctx, customer, periodStart, periodEnd, "", usage)
+		}
+		if errors.Is(err, repository.ErrDuplicate) {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Warning: failed to generate invoice for team %s: %v\n", team.ID, err)
+			failed++
+			continue
+		}
+		issued++
+	}
+
+	if issued > 0 {
+		fmt.Printf("Invoices: issued %d invoices for %s\n", issued, periodStart.Format("2006-01"))
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to generate %d invoices", failed)
+	}
+	return nil
+}
+
+func (s *invoiceService) GetInvoice(ctx context.Context, id string) (*domain.Invoice, error) {
+	return s.invoiceRepo.GetByID(ctx, id)
+}
+
+func (s *invoiceService) ListInvoices(ctx context.Context, userID string, limit, offset int) ([]*domain.Invoice, error) {
+	return s.invoiceRepo.ListByUser(ctx, userID, limit, offset)
+}
+
+func (s *invoiceService) ListTeamInvoices(ctx context.Context, teamID string, limit, offset int) ([]*domain.Invoice, error) {
+	return s.invoiceRepo.ListByTeam(ctx, teamID, limit, offset)
+}
+
+func (s *invoiceService) InvoiceFile(ctx context.Context, invoice *domain.Invoice, format string) (string, error) {
+	path := invoice.PDFPath
+	switch format {
+	case domain.InvoiceFormatPDF:
+	case domain.InvoiceFormatCSV:
+		path = invoice.CSVPath
+	default:
+		return "", fmt.Errorf("%w: unsupported format %q", ErrInvalidInvoiceRequest, format)
+	}
+
+	if path != "" {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	// Файл еще не создан или каталог хранения очищен - счет восстанавливается из БД
+	customer, err := s.customer(ctx, invoice.UserID, invoice.TeamID)
+	if err != nil {
+		return "", err
+	}
+	if err := s.storeFiles(ctx, invoice, customer); err != nil {
+		return "", err
+	}
+
+	if format == domain.InvoiceFormatCSV {
+		return invoice.CSVPath, nil
+	}
+	return invoice.PDFPath, nil
+}
+
+// storeFiles создает PDF и CSV файлы счета и сохраняет пути к ним
+func (s *invoiceService) storeFiles(ctx context.Context, invoice *domain.Invoice, customer *invoiceCustomer) error {
+	dir := filepath.Join(s.storageDir, invoice.PeriodStart.Format("2006"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create invoice directory: %w", err)
+	}
+
+	pdfPath := filepath.Join(dir, invoice.Number+".pdf")
+	if err := writeInvoiceFile(pdfPath, func(f *os.File) error {
+		return renderInvoicePDF(f, invoice, customer.billTo)
+	}); err != nil {
+		return err
+	}
+
+	csvPath := filepath.Join(dir, invoice.Number+".csv")
+	if err := writeInvoiceFile(csvPath, func(f *os.File) error {
+		return renderInvoiceCSV(f, invoice)
+	}); err != nil {
+		return err
+	}
+
+	if err := s.invoiceRepo.UpdateFiles(ctx, invoice.ID, pdfPath, csvPath); err != nil {
+		return err
+	}
+	invoice.PDFPath = pdfPath
+	invoice.CSVPath = csvPath
+	return nil
+}
+
+// writeInvoiceFile записывает файл во временный и переименовывает его, чтобы при ошибке
+// не остался частично записанный счет
+func writeInvoiceFile(path string, render func(f *os.File) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create invoice file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := render(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to render invoice file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write invoice file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store invoice file: %w", err)
+	}
+	return nil
+}
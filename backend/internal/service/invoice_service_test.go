@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/repository"
+)
+
+// fakeInvoiceRepository хранит счета в памяти и возвращает заданное использование
+type fakeInvoiceRepository struct {
+	mu        sync.Mutex
+	invoices  []*domain.Invoice
+	usage     []*repository.InvoiceUsage
+	teamUsage map[string][]*repository.InvoiceUsage
+}
+
+func (r *fakeInvoiceRepository) Create(ctx context.Context, invoice *domain.Invoice) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.invoices {
+		if existing.UserID == invoice.UserID && existing.TeamID == invoice.TeamID && existing.PeriodStart.Equal(invoice.PeriodStart) {
+			return repository.ErrDuplicate
+		}
+	}
+	invoice.Number = fmt.Sprintf("INV-%d-%06d", invoice.IssuedAt.Year(), len(r.invoices)+1)
+	r.invoices = append(r.invoices, invoice)
+	return nil
+}
+
+func (r *fakeInvoiceRepository) GetByID(ctx context.Context, id string) (*domain.Invoice, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, invoice := range r.invoices {
+		if invoice.ID == id {
+			return invoice, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeInvoiceRepository) UpdateFiles(ctx context.Context, id, pdfPath, csvPath string) error {
+	return nil
+}
+
+func (r *fakeInvoiceRepository) ListByUser(ctx context.Context, userID string, limit, offset int) ([]*domain.Invoice, error) {
+	return r.list(func(invoice *domain.Invoice) bool { return invoice.UserID == userID && invoice.TeamID == "" }), nil
+}
+
+func (r *fakeInvoiceRepository) ListByTeam(ctx context.Context, teamID string, limit, offset int) ([]*domain.Invoice, error) {
+	return r.list(func(invoice *domain.Invoice) bool { return invoice.TeamID == teamID }), nil
+}
+
+func (r *fakeInvoiceRepository) list(match func(*domain.Invoice) bool) []*domain.Invoice {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var invoices []*domain.Invoice
+	for i := len(r.invoices) - 1; i >= 0; i-- {
+		if match(r.invoices[i]) {
+			invoices = append(invoices, r.invoices[i])
+		}
+	}
+	return invoices
+}
+
+func (r *fakeInvoiceRepository) AggregateUsage(ctx context.Context, userID string, start, end time.Time) ([]*repository.InvoiceUsage, error) {
+	return r.usage, nil
+}
+
+func (r *fakeInvoiceRepository) AggregateTeamUsage(ctx context.Context, teamID string, start, end time.Time) ([]*repository.InvoiceUsage, error) {
+	return r.teamUsage[teamID], nil
+}
+
+// fakeCurrencyService пересчитывает суммы по фиксированным курсам от USD
+type fakeCurrencyService struct {
+	rates map[string]float64
+}
+
+func (s *fakeCurrencyService) UpdateExchangeRates(ctx context.Context) error {
+	return nil
+}
+
+func (s *fakeCurrencyService) GetExchangeRate(ctx context.Context, fromCurrency, toCurrency string) (float64, error) {
+	rate, ok := s.rates[toCurrency]
+	if fromCurrency != "USD" || !ok {
+		return 0, fmt.Errorf("no exchange rate from %s to %s", fromCurrency, toCurrency)
+	}
+	return rate, nil
+}
+
+func (s *fakeCurrencyService) ConvertCurrency(ctx context.Context, amount float64, fromCurrency, toCurrency string) (float64, error) {
+	rate, err := s.GetExchangeRate(ctx, fromCurrency, toCurrency)
+	return amount * rate, err
+}
+
+func (s *fakeCurrencyService) GetSupportedCurrencies(ctx context.Context) ([]domain.Currency, error) {
+	return nil, nil
+}
+
+func (s *fakeCurrencyService) GetAllExchangeRates(ctx context.Context) ([]*domain.ExchangeRate, error) {
+	return nil, nil
+}
+
+func TestInvoiceService_GenerateInvoice(t *testing.T) {
+	priceID := "price-1"
+	invoiceRepo := &fakeInvoiceRepository{usage: []*repository.InvoiceUsage{
+		{ModelID: "m1", ModelName: "gpt-4o", ModelPriceID: &priceID, Requests: 3, InputTokens: 1000, OutputTokens: 500, TotalCost: 12.5},
+		{ModelID: "m2", ModelName: "claude-3-haiku", Requests: 1, InputTokens: 10, OutputTokens: 5, TotalCost: 0.333333},
+	}}
+	pricingRepo := &fakePricingRepository{prices: []*domain.ModelPrice{
+		{ID: priceID, ModelID: "m1", InputTokenCost: 0.0000025, OutputTokenCost: 0.00001},
+	}}
+	userRepo := &MockUserRepository{}
+	userRepo.On("GetByID", mock.Anything, "user-1").Return(&domain.User{ID: "user-1", Email: "billing@acme.example", Role: domain.RoleEnterprise}, nil)
+
+	now := time.Date(2024, 7, 1, 3, 0, 0, 0, time.UTC)
+	svc := &invoiceService{
+		invoiceRepo:     invoiceRepo,
+		userRepo:        userRepo,
+		pricingService:  &pricingService{pricingRepo: pricingRepo, now: time.Now},
+		currencyService: &fakeCurrencyService{rates: map[string]float64{"USD": 1, "EUR": 0.9}},
+		storageDir:      t.TempDir(),
+		defaultCurrency: "USD",
+		now:             func() time.Time { return now },
+	}
+	ctx := context.Background()
+
+	// Текущий месяц еще не закрыт
+	_, err := svc.GenerateInvoice(ctx, &GenerateInvoiceRequest{UserID: "user-1", PeriodStart: now})
+	assert.ErrorIs(t, err, ErrInvalidInvoiceRequest)
+
+	invoice, err := svc.GenerateInvoice(ctx, &GenerateInvoiceRequest{
+		UserID:      "user-1",
+		PeriodStart: time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC),
+		Currency:    "eur",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "INV-2024-000001", invoice.Number)
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), invoice.PeriodStart)
+	assert.Equal(t, time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), invoice.PeriodEnd)
+	assert.Equal(t, "EUR", invoice.Currency)
+	assert.InDelta(t, 12.833333, invoice.SubtotalUSD, 1e-9)
+	require.Len(t, invoice.Lines, 2)
+	assert.InDelta(t, 11.25, invoice.Lines[0].Amount, 1e-9)
+	assert.InDelta(t, 0.3, invoice.Lines[1].Amount, 1e-9)
+	// Итог - сумма округленных строк, чтобы счет сходился
+	assert.InDelta(t, 11.55, invoice.Total, 1e-9)
+	assert.InDelta(t, 0.0000025, invoice.Lines[0].InputTokenPrice, 1e-15)
+
+	pdf, err := os.ReadFile(invoice.PDFPath)
+	require.NoError(t, err)
+	assert.Equal(t, "%PDF", string(pdf[:4]))
+
+	file, err := os.Open(invoice.CSVPath)
+	require.NoError(t, err)
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, []string{"INV-2024-000001", "2024-06-01", "2024-07-01", "gpt-4o", priceID, "3", "1000", "500", "2.5000", "10.0000", "12.500000", "11.25", "EUR"}, records[1])
+	assert.Equal(t, "TOTAL", records[3][3])
+	assert.Equal(t, "11.55", records[3][11])
+
+	// Без явной валюты следующий счет выставляется в валюте предыдущего
+	next, err := svc.GenerateInvoice(ctx, &GenerateInvoiceRequest{UserID: "user-1", PeriodStart: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+	assert.Equal(t, "EUR", next.Currency)
+
+	// Удаленный файл восстанавливается при скачивании
+	require.NoError(t, os.Remove(invoice.PDFPath))
+	path, err := svc.InvoiceFile(ctx, invoice, domain.InvoiceFormatPDF)
+	require.NoError(t, err)
+	assert.FileExists(t, path)
+}
+
+func TestInvoiceService_TeamInvoices(t *testing.T) {
+	invoiceRepo := &fakeInvoiceRepository{teamUsage: map[string][]*repository.InvoiceUsage{
+		"team-1": {{ModelID: "m1", ModelName: "gpt-4o", Requests: 2, InputTokens: 100, OutputTokens: 50, TotalCost: 4}},
+	}}
+	teamRepo := newFakeTeamRepository()
+	teamRepo.addTeam(&domain.Team{ID: "team-1", Name: "Analytics"})
+	teamRepo.addTeam(&domain.Team{ID: "team-2", Name: "Idle"})
+	userRepo := &MockUserRepository{}
+	userRepo.On("List", mock.Anything, 0, 0).Return([]*domain.User{{ID: "user-1", Role: domain.RoleCustomer}}, nil)
+
+	now := time.Date(2024, 7, 1, 3, 0, 0, 0, time.UTC)
+	svc := &invoiceService{
+		invoiceRepo:     invoiceRepo,
+		userRepo:        userRepo,
+		teamRepo:        teamRepo,
+		currencyService: &fakeCurrencyService{rates: map[string]float64{"USD": 1}},
+		storageDir:      t.TempDir(),
+		defaultCurrency: "USD",
+		now:             func() time.Time { return now },
+	}
+	ctx := context.Background()
+	june := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := svc.GenerateInvoice(ctx, &GenerateInvoiceRequest{UserID: "user-1", TeamID: "team-1", PeriodStart: june})
+	assert.ErrorIs(t, err, ErrInvalidInvoiceRequest)
+
+	// Ежемесячная задача выставляет счет только команде, ключами которой пользовались
+	require.NoError(t, svc.GenerateMonthlyInvoices(ctx))
+	invoices, err := svc.ListTeamInvoices(ctx, "team-1", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, invoices, 1)
+	invoice := invoices[0]
+	assert.Equal(t, "team-1", invoice.TeamID)
+	assert.Empty(t, invoice.UserID)
+	assert.Equal(t, june, invoice.PeriodStart)
+	require.Len(t, invoice.Lines, 1)
+	assert.InDelta(t, 4.0, invoice.Total, 1e-9)
+	assert.FileExists(t, invoice.PDFPath)
+
+	idle, err := svc.ListTeamInvoices(ctx, "team-2", 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, idle)
+	personal, err := svc.ListInvoices(ctx, "user-1", 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, personal)
+
+	_, err = svc.GenerateInvoice(ctx, &GenerateInvoiceRequest{TeamID: "team-1", PeriodStart: june})
+	assert.ErrorIs(t, err, repository.ErrDuplicate)
+
+	// Потерянный файл счета команды восстанавливается при скачивании
+	require.NoError(t, os.Remove(invoice.CSVPath))
+	path, err := svc.InvoiceFile(ctx, invoice, domain.InvoiceFormatCSV)
+	require.NoError(t, err)
+	assert.FileExists(t, path)
+}
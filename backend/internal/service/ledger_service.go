@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/repository"
+)
+
+var ErrInvalidLedgerPosting = errors.New("invalid ledger posting")
+
+// reconcileBatchSize - сколько запросов списывается за один проход сверки
+const reconcileBatchSize = 500
+
+// LedgerPosting описывает операцию по балансу пользователя
+type LedgerPosting struct {
+	UserID string
+	// Amount - изменение баланса: положительное для начислений, отрицательное для списаний
+	Amount float64
+	Type   string
+	Reason string
+	// Reference - внешний идентификатор операции (ID запроса, платежа, промокода).
+	// Повторная операция того же типа с тем же Reference не проводится
+	Reference string
+	// CreatedBy - администратор, выполнивший операцию
+	CreatedBy string
+}
+
+type LedgerService interface {
+	// Post проводит операцию двойной записью: баланс пользователя и системный счет
+	// изменяются на одну и ту же сумму с разными знаками
+	Post(ctx context.Context, posting *LedgerPosting) (*domain.LedgerTransaction, error)
+	// ChargeRequest списывает стоимость запроса. Повторное списание того же запроса игнорируется
+	ChargeRequest(ctx context.Context, request *domain.Request) error
+	// ReconcileUsage списывает стоимость запросов, для которых еще нет списания,
+	// и переносит в журнал балансы, заданные до его появления
+	ReconcileUsage(ctx context.Context) error
+	GetBalance(ctx context.Context, userID string) (float64, error)
+	ListTransactions(ctx context.Context, userID string, limit, offset int) ([]*domain.LedgerEntry, error)
+}
+
+type ledgerService struct {
+	ledgerRepo repository.LedgerRepository
+	// usageStart - запросы, созданные раньше, не списываются при сверке
+	usageStart time.Time
+}
+
+func NewLedgerService(ledgerRepo repository.LedgerRepository, usageStart time.Time) LedgerService {
+	return &ledgerService{
+		ledgerRepo: ledgerRepo,
+		usageStart: usageStart,
+	}
+}
+
+// ledgerCounterAccounts - системный счет второй стороны проводки для каждого типа операции
+var ledgerCounterAccounts = map[string]string{
+	domain.LedgerTxTopUp:       domain.LedgerAccountCash,
+	domain.LedgerTxUsage:       domain.LedgerAccountRevenue,
+	domain.LedgerTxRefund:      domain.LedgerAccountRevenue,
+	domain.LedgerTxAdjustment:  domain.LedgerAccountAdjustments,
+	domain.LedgerTxPromoCredit: domain.LedgerAccountPromotions,
+	// Возврат платежа и чарджбэк уменьшают деньги, полученные от пользователя
+	domain.LedgerTxPaymentRefund: domain.LedgerAccountCash,
+	domain.LedgerTxChargeback:    domain.LedgerAccountCash,
+}
+
+// ledgerDebitTypes - типы операций, которые только уменьшают баланс пользователя
+var ledgerDebitTypes = map[string]bool{
+	domain.LedgerTxUsage:         true,
+	domain.LedgerTxPaymentRefund: true,
+	domain.LedgerTxChargeback:    true,
+}
+
+func (s *ledgerService) Post(ctx context.Context, posting *LedgerPosting) (*domain.LedgerTransaction, error) {
+	amount := math.Round(posting.Amount*1e6) / 1e6
+
+	counterAccount, ok := ledgerCounterAccounts[posting.Type]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("%w: unknown transaction type %q", ErrInvalidLedgerPosting, posting.Type)
+	case posting.UserID == "":
+		return nil, fmt.Errorf("%w: user is required", ErrInvalidLedgerPosting)
+	case amount == 0 || math.IsNaN(amount) || math.IsInf(amount, 0):
+		return nil, fmt.Errorf("%w: amount must be non-zero", ErrInvalidLedgerPosting)
+	case posting.Type == domain.LedgerTxUsage && amount > 0:
+		return nil, fmt.Errorf("%w: usage charge must be negative", ErrInvalidLedgerPosting)
+	case ledgerDebitTypes[posting.Type] && amount > 0:
+		return nil, fmt.Errorf("%w: %s must be negative", ErrInvalidLedgerPosting, posting.Type)
+	case !ledgerDebitTypes[posting.Type] && posting.Type != domain.LedgerTxAdjustment && amount < 0:
+		return nil, fmt.Errorf("%w: %s must be positive", ErrInvalidLedgerPosting, posting.Type)
+	}
+
+	transactionID := uuid.New().String()
+	transaction := &domain.LedgerTransaction{
+		ID:     transactionID,
+		Type:   posting.Type,
+		UserID: posting.UserID,
+		Amount: amount,
+		Reason: posting.Reason,
+		Entries: []domain.LedgerEntry{
+			{ID: uuid.New().String(), AccountID: domain.LedgerUserAccount(posting.UserID), Amount: amount},
+			{ID: uuid.New().String(), AccountID: counterAccount, Amount: -amount},
+		},
+	}
+	if posting.Reference != "" {
+		transaction.Reference = &posting.Reference
+	}
+	if posting.CreatedBy != "" {
+		transaction.CreatedBy = &posting.CreatedBy
+	}
+
+	if err := s.ledgerRepo.Post(ctx, transaction); err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+func (s *ledgerService) ChargeRequest(ctx context.Context, request *domain.Request) error {
+	if request.TotalCost <= 0 || request.Status != domain.RequestStatusCompleted {
+		return nil
+	}
+
+	reason := "Model usage"
+	if request.ModelName != nil {
+		reason = fmt.Sprintf("Model usage: %s", *request.ModelName)
+	}
+
+	_, err := s.Post(ctx, &LedgerPosting{
+		UserID:    request.UserID,
+		Amount:    -request.TotalCost,
+		Type:      domain.LedgerTxUsage,
+		Reason:    reason,
+		Reference: request.ID,
+	})
+	if errors.Is(err, repository.ErrDuplicate) {
+		return nil
+	}
+	return err
+}
+
+func (s *ledgerService) ReconcileUsage(ctx context.Context) error {
+	if err := s.openBalances(ctx); err != nil {
+		return err
+	}
+
+	charged, failed := 0, 0
+	for {
+		requests, err := s.ledgerRepo.ListUnbilledRequests(ctx, s.usageStart, reconcileBatchSize)
+		if err != nil {
+			return err
+		}
+
+		batchCharged := 0
+		for _, request := range requests {
+			if err := s.ChargeRequest(ctx, request); err != nil {
+				fmt.Printf("Warning: failed to charge request %s: %v\n", request.ID, err)
+				failed++
+				continue
+			}
+			batchCharged++
+		}
+		charged += batchCharged
+
+		// Если ни один запрос пачки не удалось списать, следующий проход вернет ту же пачку
+		if len(requests) < reconcileBatchSize || batchCharged == 0 {
+			break
+		}
+	}
+
+	if charged > 0 {
+		fmt.Printf("Ledger reconciliation: charged %d requests\n", charged)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to charge %d requests", failed)
+	}
+	return nil
+}
+
+// openBalances переносит в журнал балансы, которые были заданы в user_limits до его появления
+func (s *ledgerService) openBalances(ctx context.Context) error {
+	limits, err := s.ledgerRepo.ListUnopenedBalances(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, limit := range limits {
+		if limit.Balance == nil {
+			continue
+		}
+		_, err := s.Post(ctx, &LedgerPosting{
+			UserID:    limit.UserID,
+			Amount:    *limit.Balance,
+			Type:      domain.LedgerTxAdjustment,
+			Reason:    "Opening balance",
+			Reference: "opening:" + limit.UserID,
+		})
+		if err != nil && !errors.Is(err, repository.ErrDuplicate) {
+			return fmt.Errorf("failed to open balance for user %s: %w", limit.UserID, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *ledgerService) GetBalance(ctx context.Context, userID string) (float64, error) {
+	account, err := s.ledgerRepo.GetAccount(ctx, domain.LedgerUserAccount(userID))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return account.Balance, nil
+}
+
+func (s *ledgerService) ListTransactions(ctx context.Context, userID string, limit, offset int) ([]*domain.LedgerEntry, error) {
+	return s.ledgerRepo.ListEntries(ctx, domain.LedgerUserAccount(userID), limit, offset)
+}
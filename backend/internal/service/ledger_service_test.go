@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/repository"
+)
+
+// fakeLedgerRepository хранит журнал в памяти
+type fakeLedgerRepository struct {
+	mu           sync.Mutex
+	accounts     map[string]float64
+	transactions []*domain.LedgerTransaction
+	requests     []*domain.Request
+	limits       []*domain.UserLimit
+}
+
+func newFakeLedgerRepository() *fakeLedgerRepository {
+	return &fakeLedgerRepository{accounts: map[string]float64{}}
+}
+
+func (r *fakeLedgerRepository) Post(ctx context.Context, transaction *domain.LedgerTransaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if transaction.Reference != nil && r.find(transaction.Type, *transaction.Reference) != nil {
+		return repository.ErrDuplicate
+	}
+	for i := range transaction.Entries {
+		entry := &transaction.Entries[i]
+		r.accounts[entry.AccountID] += entry.Amount
+		entry.BalanceAfter = r.accounts[entry.AccountID]
+	}
+	r.transactions = append(r.transactions, transaction)
+	return nil
+}
+
+func (r *fakeLedgerRepository) find(txType, reference string) *domain.LedgerTransaction {
+	for _, transaction := range r.transactions {
+		if transaction.Type == txType && transaction.Reference != nil && *transaction.Reference == reference {
+			return transaction
+		}
+	}
+	return nil
+}
+
+func (r *fakeLedgerRepository) GetAccount(ctx context.Context, accountID string) (*domain.LedgerAccount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	balance, ok := r.accounts[accountID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &domain.LedgerAccount{ID: accountID, Balance: balance}, nil
+}
+
+func (r *fakeLedgerRepository) ListEntries(ctx context.Context, accountID string, limit, offset int) ([]*domain.LedgerEntry, error) {
+	return nil, nil
+}
+
+func (r *fakeLedgerRepository) ListUnbilledRequests(ctx context.Context, since time.Time, limit int) ([]*domain.Request, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []*domain.Request
+	for _, request := range r.requests {
+		if request.TotalCost > 0 && request.Status == domain.RequestStatusCompleted &&
+			!request.CreatedAt.Before(since) && r.find(domain.LedgerTxUsage, request.ID) == nil {
+			result = append(result, request)
+		}
+		if len(result) == limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+func (r *fakeLedgerRepository) ListUnopenedBalances(ctx context.Context) ([]*domain.UserLimit, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []*domain.UserLimit
+	for _, limit := range r.limits {
+		if _, ok := r.accounts[domain.LedgerUserAccount(limit.UserID)]; !ok && limit.Balance != nil && *limit.Balance != 0 {
+			result = append(result, limit)
+		}
+	}
+	return result, nil
+}
+
+func TestLedgerService_Post(t *testing.T) {
+	repo := newFakeLedgerRepository()
+	svc := NewLedgerService(repo, time.Time{})
+	ctx := context.Background()
+
+	transaction, err := svc.Post(ctx, &LedgerPosting{UserID: "user-1", Amount: 25, Type: domain.LedgerTxTopUp, Reason: "Bank transfer"})
+	require.NoError(t, err)
+	require.Len(t, transaction.Entries, 2)
+	assert.Equal(t, domain.LedgerAccountCash, transaction.Entries[1].AccountID)
+	assert.Equal(t, -25.0, transaction.Entries[1].Amount)
+
+	_, err = svc.Post(ctx, &LedgerPosting{UserID: "user-1", Amount: -5, Type: domain.LedgerTxAdjustment, Reason: "Correction"})
+	require.NoError(t, err)
+
+	balance, err := svc.GetBalance(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, 20.0, balance)
+
+	// Начисления не могут быть отрицательными, а списания за использование - положительными
+	_, err = svc.Post(ctx, &LedgerPosting{UserID: "user-1", Amount: -5, Type: domain.LedgerTxTopUp})
+	assert.ErrorIs(t, err, ErrInvalidLedgerPosting)
+	_, err = svc.Post(ctx, &LedgerPosting{UserID: "user-1", Amount: 5, Type: domain.LedgerTxUsage})
+	assert.ErrorIs(t, err, ErrInvalidLedgerPosting)
+	_, err = svc.Post(ctx, &LedgerPosting{UserID: "user-1", Amount: 5, Type: "gift"})
+	assert.ErrorIs(t, err, ErrInvalidLedgerPosting)
+}
+
+func TestLedgerService_ReconcileUsage(t *testing.T) {
+	repo := newFakeLedgerRepository()
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	svc := NewLedgerService(repo, start)
+	ctx := context.Background()
+
+	opening := 12.5
+	repo.limits = []*domain.UserLimit{{UserID: "user-1", Balance: &opening}}
+	repo.requests = []*domain.Request{
+		{ID: "r1", UserID: "user-1", TotalCost: 0.5, Status: domain.RequestStatusCompleted, CreatedAt: start.Add(time.Hour)},
+		{ID: "r2", UserID: "user-1", TotalCost: 1.5, Status: domain.RequestStatusCompleted, CreatedAt: start.Add(2 * time.Hour)},
+		{ID: "before-start", UserID: "user-1", TotalCost: 100, Status: domain.RequestStatusCompleted, CreatedAt: start.Add(-time.Hour)},
+	}
+
+	require.NoError(t, svc.ReconcileUsage(ctx))
+	// Повторная сверка ничего не списывает повторно
+	require.NoError(t, svc.ReconcileUsage(ctx))
+
+	balance, err := svc.GetBalance(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, 10.5, balance)
+	assert.Len(t, repo.transactions, 3)
+	assert.Equal(t, 2.0, repo.accounts[domain.LedgerAccountRevenue])
+}
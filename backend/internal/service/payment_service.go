@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/payment"
+	"oneui-hub/internal/repository"
+)
+
+var (
+	ErrInvalidPaymentRequest = errors.New("invalid payment request")
+	ErrPaymentsDisabled      = errors.New("payments are not configured")
+)
+
+// paymentCurrency - валюта пополнений; баланс пользователя ведется в USD
+const paymentCurrency = "USD"
+
+type PaymentService interface {
+	// CreateCheckout создает платеж и страницу оплаты у провайдера
+	CreateCheckout(ctx context.Context, userID string, amount float64) (*domain.Payment, error)
+	// HandleWebhook проверяет подпись вебхука и применяет событие к платежу: оплата зачисляется
+	// на баланс, возврат и чарджбэк списывают зачисленное. Повторная доставка события ничего не меняет
+	HandleWebhook(ctx context.Context, payload []byte, header http.Header) error
+	GetPayment(ctx context.Context, id string) (*domain.Payment, error)
+	ListPayments(ctx context.Context, userID string, limit, offset int) ([]*domain.Payment, error)
+}
+
+type paymentService struct {
+	paymentRepo   repository.PaymentRepository
+	userRepo      repository.UserRepository
+	ledgerService LedgerService
+	tierService   TierService
+	// provider - провайдер платежей; nil отключает пополнение
+	provider   payment.Provider
+	minAmount  float64
+	maxAmount  float64
+	successURL string
+	cancelURL  string
+	now        func() time.Time
+}
+
+func NewPaymentService(
+	paymentRepo repository.PaymentRepository,
+	userRepo repository.UserRepository,
+	ledgerService LedgerService,
+	tierService TierService,
+	provider payment.Provider,
+	minAmount, maxAmount float64,
+	successURL, cancelURL string,
+) PaymentService {
+	return &paymentService{
+		paymentRepo:   paymentRepo,
+		userRepo:      userRepo,
+		ledgerService: ledgerService,
+		tierService:   tierService,
+		provider:      provider,
+		minAmount:     minAmount,
+		maxAmount:     maxAmount,
+		successURL:    successURL,
+		cancelURL:     cancelURL,
+		now:           time.Now,
+	}
+}
+
+func (s *paymentService) CreateCheckout(ctx context.Context, userID string, amount float64) (*domain.Payment, error) {
+	if s.provider == nil {
+		return nil, ErrPaymentsDisabled
+	}
+
+	amount = math.Round(amount*100) / 100
+	switch {
+	case math.IsNaN(amount) || amount <= 0:
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidPaymentRequest)
+	case amount < s.minAmount:
+		return nil, fmt.Errorf("%w: minimum top-up is %.2f %s", ErrInvalidPaymentRequest, s.minAmount, paymentCurrency)
+	case s.maxAmount > 0 && amount > s.maxAmount:
+		return nil, fmt.Errorf("%w: maximum top-up is %.2f %s", ErrInvalidPaymentRequest, s.maxAmount, paymentCurrency)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	p := &domain.Payment{
+		ID:       uuid.New().String(),
+		UserID:   userID,
+		Provider: s.provider.Name(),
+		Amount:   amount,
+		Currency: paymentCurrency,
+		Status:   domain.PaymentStatusPending,
+	}
+	// Платеж сохраняется до обращения к провайдеру, чтобы вебхук всегда находил его
+	if err := s.paymentRepo.Create(ctx, p); err != nil {
+		return nil, err
+	}
+
+	session, err := s.provider.CreateCheckout(ctx, &payment.CheckoutRequest{
+		Reference:  p.ID,
+		Amount:     p.Amount,
+		Currency:   p.Currency,
+		Email:      user.Email,
+		SuccessURL: s.successURL,
+		CancelURL:  s.cancelURL,
+	})
+	if err != nil {
+		p.Status = domain.PaymentStatusFailed
+		if updateErr := s.paymentRepo.Update(context.WithoutCancel(ctx), p); updateErr != nil {
+			fmt.Printf("Warning: failed to mark payment %s as failed: %v\n", p.ID, updateErr)
+		}
+		return nil, fmt.Errorf("failed to create checkout session: %w", err)
+	}
+
+	p.ProviderSessionID = &session.ID
+	p.CheckoutURL = session.URL
+	if err := s.paymentRepo.Update(ctx, p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (s *paymentService) HandleWebhook(ctx context.Context, payload []byte, header http.Header) error {
+	if s.provider == nil {
+		return ErrPaymentsDisabled
+	}
+
+	event, err := s.provider.ParseWebhook(payload, header)
+	if err != nil {
+		return err
+	}
+
+	var apply func(p *domain.Payment, record *domain.PaymentEvent) error
+	switch event.Type {
+	case payment.EventPaymentSucceeded:
+		apply = s.applySucceeded(event)
+	case payment.EventPaymentFailed:
+		apply = applyFailed
+	case payment.EventRefundSucceeded:
+		apply = applyReversal(event, domain.PaymentStatusRefunded)
+	case payment.EventChargebackCreated:
+		apply = applyReversal(event, domain.PaymentStatusChargedBack)
+	default:
+		// Остальные события провайдера хабу не нужны
+		return nil
+	}
+
+	p, err := s.findPayment(ctx, event)
+	if errors.Is(err, repository.ErrNotFound) {
+		fmt.Printf("Warning: payment for webhook event %s (%s) not found\n", event.ID, event.Type)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if event.Currency != "" && event.Currency != p.Currency {
+		return fmt.Errorf("%w: currency %s does not match payment currency %s", payment.ErrInvalidEvent, event.Currency, p.Currency)
+	}
+
+	record := &domain.PaymentEvent{
+		ID:        uuid.New().String(),
+		Provider:  s.provider.Name(),
+		EventID:   event.ID,
+		Type:      event.Type,
+		PaymentID: p.ID,
+		ObjectID:  event.ObjectID,
+	}
+	applied, err := s.paymentRepo.ApplyEvent(ctx, record, func(p *domain.Payment) error {
+		return apply(p, record)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Проводка выполняется и для уже обработанного события: если в прошлый раз она не прошла,
+	// провайдер повторит вебхук, а повторная проводка с тем же Reference отклоняется журналом
+	if err := s.postEvent(ctx, p, record); err != nil {
+		return err
+	}
+
+	// Оплаты учитываются для тарифов отдельно от использования моделей, возвраты их уменьшают
+	if applied && record.Amount != 0 && s.tierService != nil {
+		if err := s.tierService.UpdateUserSpending(ctx, p.UserID, record.Amount); err != nil {
+			fmt.Printf("Warning: failed to update spending for user %s after payment %s: %v\n", p.UserID, p.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// findPayment находит платеж события по ID платежа хаба или по сессии оплаты
+func (s *paymentService) findPayment(ctx context.Context, event *payment.Event) (*domain.Payment, error) {
+	if event.Reference != "" {
+		p, err := s.paymentRepo.GetByID(ctx, event.Reference)
+		if err == nil && p.Provider == s.provider.Name() {
+			return p, nil
+		}
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+	}
+	if event.SessionID != "" {
+		return s.paymentRepo.GetBySessionID(ctx, s.provider.Name(), event.SessionID)
+	}
+	return nil, repository.ErrNotFound
+}
+
+// applySucceeded зачисляет оплату, если платеж еще не был зачислен
+func (s *paymentService) applySucceeded(event *payment.Event) func(p *domain.Payment, record *domain.PaymentEvent) error {
+	return func(p *domain.Payment, record *domain.PaymentEvent) error {
+		if p.Status != domain.PaymentStatusPending && p.Status != domain.PaymentStatusFailed {
+			return nil
+		}
+		if math.Abs(event.Amount-p.Amount) >= 0.005 {
+			return fmt.Errorf("%w: paid amount %.2f does not match payment amount %.2f", payment.ErrInvalidEvent, event.Amount, p.Amount)
+		}
+
+		now := s.now()
+		p.Status = domain.PaymentStatusSucceeded
+		p.CompletedAt = &now
+		if event.ObjectID != "" {
+			p.ProviderPaymentID = &event.ObjectID
+		}
+		record.Amount = p.Amount
+		return nil
+	}
+}
+
+func applyFailed(p *domain.Payment, record *domain.PaymentEvent) error {
+	if p.Status == domain.PaymentStatusPending {
+		p.Status = domain.PaymentStatusFailed
+	}
+	return nil
+}
+
+// applyReversal списывает возврат или чарджбэк, но не больше зачисленной и еще не возвращенной суммы
+func applyReversal(event *payment.Event, status string) func(p *domain.Payment, record *domain.PaymentEvent) error {
+	return func(p *domain.Payment, record *domain.PaymentEvent) error {
+		switch p.Status {
+		case domain.PaymentStatusSucceeded, domain.PaymentStatusPartiallyRefunded, domain.PaymentStatusRefunded:
+		case domain.PaymentStatusChargedBack:
+			return nil
+		default:
+			// Оплата еще не зачислена: ошибка заставит провайдера повторить вебхук позже
+			return fmt.Errorf("payment %s is not completed yet", p.ID)
+		}
+
+		remaining := math.Round((p.Amount-p.RefundedAmount)*100) / 100
+		amount := remaining
+		if status == domain.PaymentStatusRefunded && event.Amount > 0 {
+			amount = math.Min(event.Amount, remaining)
+		}
+
+		p.RefundedAmount = math.Round((p.RefundedAmount+amount)*100) / 100
+		switch {
+		case status == domain.PaymentStatusChargedBack:
+			p.Status = domain.PaymentStatusChargedBack
+		case p.RefundedAmount >= p.Amount:
+			p.Status = domain.PaymentStatusRefunded
+		default:
+			p.Status = domain.PaymentStatusPartiallyRefunded
+		}
+		record.Amount = -amount
+		return nil
+	}
+}
+
+// postEvent проводит по балансу изменение, вызванное событием
+func (s *paymentService) postEvent(ctx context.Context, p *domain.Payment, record *domain.PaymentEvent) error {
+	if record.Amount == 0 {
+		return nil
+	}
+
+	objectID := record.ObjectID
+	if objectID == "" {
+		objectID = record.EventID
+	}
+
+	posting := &LedgerPosting{
+		UserID: p.UserID,
+		Amount: record.Amount,
+	}
+	switch record.Type {
+	case payment.EventPaymentSucceeded:
+		posting.Type = domain.LedgerTxTopUp
+		posting.Reason = fmt.Sprintf("Payment via %s", p.Provider)
+		posting.Reference = "payment:" + p.ID
+	case payment.EventRefundSucceeded:
+		posting.Type = domain.LedgerTxPaymentRefund
+		posting.Reason = fmt.Sprintf("Refund of payment %s", p.ID)
+		posting.Reference = "refund:" + objectID
+	case payment.EventChargebackCreated:
+		posting.Type = domain.LedgerTxChargeback
+		posting.Reason = fmt.Sprintf("Chargeback of payment %s", p.ID)
+		posting.Reference = "chargeback:" + objectID
+	default:
+		return nil
+	}
+
+	if _, err := s.ledgerService.Post(ctx, posting); err != nil && !errors.Is(err, repository.ErrDuplicate) {
+		return fmt.Errorf("failed to post payment event %s: %w", record.EventID, err)
+	}
+	return nil
+}
+
+func (s *paymentService) GetPayment(ctx context.Context, id string) (*domain.Payment, error) {
+	return s.paymentRepo.GetByID(ctx, id)
+}
+
+func (s *paymentService) ListPayments(ctx context.Context, userID string, limit, offset int) ([]*domain.Payment, error) {
+	return s.paymentRepo.ListByUser(ctx, userID, limit, offset)
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/payment"
+	"oneui-hub/internal/repository"
+)
+
+// fakePaymentRepository хранит платежи и обработанные события в памяти
+type fakePaymentRepository struct {
+	mu       sync.Mutex
+	payments map[string]*domain.Payment
+	events   map[string]*domain.PaymentEvent
+}
+
+func newFakePaymentRepository() *fakePaymentRepository {
+	return &fakePaymentRepository{payments: map[string]*domain.Payment{}, events: map[string]*domain.PaymentEvent{}}
+}
+
+func (r *fakePaymentRepository) Create(ctx context.Context, p *domain.Payment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *p
+	r.payments[p.ID] = &stored
+	return nil
+}
+
+func (r *fakePaymentRepository) GetByID(ctx context.Context, id string) (*domain.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.payments[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *p
+	return &copied, nil
+}
+
+func (r *fakePaymentRepository) GetBySessionID(ctx context.Context, provider, sessionID string) (*domain.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.payments {
+		if p.Provider == provider && p.ProviderSessionID != nil && *p.ProviderSessionID == sessionID {
+			copied := *p
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakePaymentRepository) Update(ctx context.Context, p *domain.Payment) error {
+	return r.Create(ctx, p)
+}
+
+func (r *fakePaymentRepository) ListByUser(ctx context.Context, userID string, limit, offset int) ([]*domain.Payment, error) {
+	return nil, nil
+}
+
+func (r *fakePaymentRepository) ApplyEvent(ctx context.Context, event *domain.PaymentEvent, apply func(p *domain.Payment) error) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.events[event.Provider+":"+event.EventID]; ok {
+		*event = *existing
+		return false, nil
+	}
+	p, ok := r.payments[event.PaymentID]
+	if !ok {
+		return false, repository.ErrNotFound
+	}
+	updated := *p
+	if err := apply(&updated); err != nil {
+		return false, err
+	}
+	r.payments[p.ID] = &updated
+	stored := *event
+	r.events[event.Provider+":"+event.EventID] = &stored
+	return true, nil
+}
+
+// fakeTierService учитывает оплаты в хранилище трат, как настоящий сервис тарифов, и считает проверки тарифа
+type fakeTierService struct {
+	TierService
+	mu       sync.Mutex
+	spending *fakeUserSpendingRepository
+	checks   map[string]int
+}
+
+func newFakeTierService() *fakeTierService {
+	return &fakeTierService{spending: &fakeUserSpendingRepository{}, checks: map[string]int{}}
+}
+
+func (s *fakeTierService) UpdateUserSpending(ctx context.Context, userID string, amount float64) error {
+	if err := s.spending.AddPaid(ctx, userID, amount); err != nil {
+		return err
+	}
+	return s.CheckAndUpgradeTier(ctx, userID)
+}
+
+func (s *fakeTierService) CheckAndUpgradeTier(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks[userID]++
+	return nil
+}
+
+// postWebhookAction выполняет действие на фейковом провайдере и проверяет, что хаб принял вебхук
+func postWebhookAction(t *testing.T, baseURL, path string) {
+	resp, err := http.Post(baseURL+path, "application/json", nil)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	require.Contains(t, string(body), `"webhook_status":200`)
+}
+
+func TestPaymentService_CheckoutWebhookFlow(t *testing.T) {
+	userRepo := &MockUserRepository{}
+	userRepo.On("GetByID", mock.Anything, "user-1").Return(&domain.User{ID: "user-1", Email: "user@example.com"}, nil)
+	paymentRepo := newFakePaymentRepository()
+	ledgerRepo := newFakeLedgerRepository()
+	tierService := newFakeTierService()
+
+	fake := payment.NewFakeServer("sk_test", "whsec_test", "")
+	providerServer := httptest.NewServer(fake)
+	t.Cleanup(providerServer.Close)
+	fake.BaseURL = providerServer.URL
+
+	provider := payment.NewHTTPProvider("fake", providerServer.URL, "sk_test", "whsec_test", 5*time.Minute)
+	svc := NewPaymentService(paymentRepo, userRepo, NewLedgerService(ledgerRepo, time.Time{}), tierService, provider, 5, 1000, "", "")
+
+	var lastPayload []byte
+	var lastHeader http.Header
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastPayload, _ = io.ReadAll(r.Body)
+		lastHeader = r.Header.Clone()
+		if err := svc.HandleWebhook(r.Context(), lastPayload, r.Header); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(hub.Close)
+	fake.SetWebhookURL(hub.URL)
+
+	ctx := context.Background()
+	_, err := svc.CreateCheckout(ctx, "user-1", 1)
+	assert.ErrorIs(t, err, ErrInvalidPaymentRequest)
+
+	p, err := svc.CreateCheckout(ctx, "user-1", 40)
+	require.NoError(t, err)
+	require.NotNil(t, p.ProviderSessionID)
+	assert.Equal(t, domain.PaymentStatusPending, p.Status)
+	assert.NotEmpty(t, p.CheckoutURL)
+
+	balance := func() float64 { return ledgerRepo.accounts[domain.LedgerUserAccount("user-1")] }
+	paid := func() float64 { return tierService.spending.paid["user-1"] }
+	sessionPath := fmt.Sprintf("/v1/checkout/sessions/%s", *p.ProviderSessionID)
+
+	postWebhookAction(t, providerServer.URL, sessionPath+"/complete")
+	assert.InDelta(t, 40, balance(), 1e-9)
+	assert.InDelta(t, 40, paid(), 1e-9)
+	assert.Equal(t, 1, tierService.checks["user-1"])
+
+	// Повторная доставка того же события ничего не меняет
+	require.NoError(t, svc.HandleWebhook(ctx, lastPayload, lastHeader))
+	assert.InDelta(t, 40, balance(), 1e-9)
+	assert.InDelta(t, 40, paid(), 1e-9)
+	assert.Equal(t, 1, tierService.checks["user-1"])
+
+	// Подделанное тело не принимается
+	err = svc.HandleWebhook(ctx, append(lastPayload, ' '), lastHeader)
+	assert.ErrorIs(t, err, payment.ErrInvalidSignature)
+
+	postWebhookAction(t, providerServer.URL, sessionPath+"/refund?amount=1500")
+	assert.InDelta(t, 25, balance(), 1e-9)
+	assert.InDelta(t, 25, paid(), 1e-9)
+	stored, err := svc.GetPayment(ctx, p.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.PaymentStatusPartiallyRefunded, stored.Status)
+	assert.InDelta(t, 15, stored.RefundedAmount, 1e-9)
+
+	// Чарджбэк списывает остаток зачисленной суммы
+	postWebhookAction(t, providerServer.URL, sessionPath+"/chargeback")
+	assert.InDelta(t, 0, balance(), 1e-9)
+	assert.InDelta(t, 0, paid(), 1e-9)
+	assert.Equal(t, 3, tierService.checks["user-1"])
+	stored, err = svc.GetPayment(ctx, p.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.PaymentStatusChargedBack, stored.Status)
+	assert.InDelta(t, 40, stored.RefundedAmount, 1e-9)
+	assert.InDelta(t, 0, ledgerRepo.accounts[domain.LedgerAccountCash], 1e-9)
+}
+
+func TestPaymentService_TopUpAndItsUsageCountOnceForTiers(t *testing.T) {
+	user := &domain.User{ID: "user-1", Email: "user@example.com", TierID: "free"}
+	tierService, spendingRepo, _, _ := newTestTierService(user)
+
+	fake := payment.NewFakeServer("sk_test", "whsec_test", "")
+	providerServer := httptest.NewServer(fake)
+	t.Cleanup(providerServer.Close)
+	fake.BaseURL = providerServer.URL
+
+	provider := payment.NewHTTPProvider("fake", providerServer.URL, "sk_test", "whsec_test", 5*time.Minute)
+	svc := NewPaymentService(newFakePaymentRepository(), tierService.userRepo, NewLedgerService(newFakeLedgerRepository(), time.Time{}), tierService, provider, 5, 1000, "", "")
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		if err := svc.HandleWebhook(r.Context(), payload, r.Header); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(hub.Close)
+	fake.SetWebhookURL(hub.URL)
+
+	ctx := context.Background()
+	p, err := svc.CreateCheckout(ctx, "user-1", 60)
+	require.NoError(t, err)
+	postWebhookAction(t, providerServer.URL, fmt.Sprintf("/v1/checkout/sessions/%s/complete", *p.ProviderSessionID))
+
+	spending, err := spendingRepo.GetByUserID(ctx, "user-1")
+	require.NoError(t, err)
+	assert.InDelta(t, 60, spending.TotalPaid, 1e-9)
+	assert.InDelta(t, 0, spending.TotalSpent, 1e-9)
+
+	// Пополненные деньги потрачены запросом на ту же сумму: 40000 * 0.001 + 10000 * 0.002 = $60.
+	// Для тарифа Pro ($100) это по-прежнему $60, а не $120
+	gateway := &gatewayService{requestRepo: &fakeRequestRepository{}, userSpendingRepo: spendingRepo, tierService: tierService}
+	gateway.settle(ctx, newTestGatewayCall(`{}`), &gatewayUsage{Status: domain.RequestStatusCompleted, InputTokens: 40000, OutputTokens: 10000})
+	assert.Equal(t, "free", user.TierID)
+
+	// Использование сверх оплаченного засчитывается: $60 + $40 = $100
+	gateway.settle(ctx, newTestGatewayCall(`{}`), &gatewayUsage{Status: domain.RequestStatusCompleted, InputTokens: 20000, OutputTokens: 10000})
+	assert.Equal(t, "pro", user.TierID)
+}
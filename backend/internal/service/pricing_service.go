@@ -0,0 +1,292 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/repository"
+)
+
+var ErrInvalidPriceRule = errors.New("invalid price rule")
+
+// CreatePriceRuleRequest - новое правило наценки
+type CreatePriceRuleRequest struct {
+	Name          string     `json:"name"`
+	ModelID       *string    `json:"model_id"`
+	CompanyID     *string    `json:"company_id"`
+	TierID        *string    `json:"tier_id"`
+	MarkupPercent float64    `json:"markup_percent"`
+	EffectiveFrom *time.Time `json:"effective_from"`
+	CreatedBy     string     `json:"-"`
+}
+
+type PricingService interface {
+	// ResolvePrice возвращает действующую цену продажи модели для тарифа. Если стоимость
+	// провайдера или правило наценки изменились, создается новая версия цены
+	ResolvePrice(ctx context.Context, model *domain.Model, tierID string) (*domain.ModelPrice, error)
+	// RefreshPrices создает новые версии цен для всех моделей и тарифов, цена которых изменилась
+	RefreshPrices(ctx context.Context) error
+	GetPrice(ctx context.Context, id string) (*domain.ModelPrice, error)
+	ListPriceHistory(ctx context.Context, modelID, tierID string, limit, offset int) ([]*domain.ModelPrice, error)
+
+	ListRules(ctx context.Context) ([]*domain.PriceRule, error)
+	CreateRule(ctx context.Context, req *CreatePriceRuleRequest) (*domain.PriceRule, error)
+	DeleteRule(ctx context.Context, id string) error
+}
+
+type pricingService struct {
+	pricingRepo repository.PricingRepository
+	modelRepo   repository.ModelRepository
+	companyRepo repository.CompanyRepository
+	tierRepo    repository.TierRepository
+	now         func() time.Time
+}
+
+func NewPricingService(
+	pricingRepo repository.PricingRepository,
+	modelRepo repository.ModelRepository,
+	companyRepo repository.CompanyRepository,
+	tierRepo repository.TierRepository,
+) PricingService {
+	return &pricingService{
+		pricingRepo: pricingRepo,
+		modelRepo:   modelRepo,
+		companyRepo: companyRepo,
+		tierRepo:    tierRepo,
+		now:         time.Now,
+	}
+}
+
+// maxPriceVersionAttempts - сколько раз повторяется создание версии, если параллельный запрос
+// успел создать версию с тем же номером
+const maxPriceVersionAttempts = 3
+
+func (s *pricingService) ResolvePrice(ctx context.Context, model *domain.Model, tierID string) (*domain.ModelPrice, error) {
+	now := s.now()
+	rules, err := s.pricingRepo.ListRules(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	price, _, err := s.resolve(ctx, model, tierID, rules, now)
+	return price, err
+}
+
+// resolve сравнивает последнюю версию цены с ценой по текущим правилам и при расхождении
+// создает новую версию. created = true, если версия была создана
+func (s *pricingService) resolve(ctx context.Context, model *domain.Model, tierID string, rules []*domain.PriceRule, now time.Time) (*domain.ModelPrice, bool, error) {
+	expected := buildPrice(model, tierID, selectPriceRule(rules, model, tierID))
+
+	for attempt := 0; attempt < maxPriceVersionAttempts; attempt++ {
+		latest, err := s.pricingRepo.GetLatestPrice(ctx, model.ID, tierID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return nil, false, err
+		}
+		if latest != nil && samePrice(latest, expected) {
+			return latest, false, nil
+		}
+
+		price := *expected
+		price.ID = uuid.New().String()
+		price.Version = 1
+		if latest != nil {
+			price.Version = latest.Version + 1
+		}
+		price.EffectiveFrom = now
+
+		err = s.pricingRepo.CreatePrice(ctx, &price)
+		if errors.Is(err, repository.ErrDuplicate) {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return &price, true, nil
+	}
+
+	return nil, false, fmt.Errorf("failed to create price version for model %s: concurrent updates", model.ID)
+}
+
+// selectPriceRule выбирает самое конкретное из подходящих правил, а среди равных - вступившее
+// в силу последним. Правила должны быть отсортированы по убыванию EffectiveFrom
+func selectPriceRule(rules []*domain.PriceRule, model *domain.Model, tierID string) *domain.PriceRule {
+	var selected *domain.PriceRule
+	for _, rule := range rules {
+		if !rule.Matches(model, tierID) {
+			continue
+		}
+		if selected == nil || rule.Specificity() > selected.Specificity() {
+			selected = rule
+		}
+	}
+	return selected
+}
+
+// buildPrice считает цену продажи по стоимости провайдера из конфигурации модели и наценке правила
+func buildPrice(model *domain.Model, tierID string, rule *domain.PriceRule) *domain.ModelPrice {
+	price := &domain.ModelPrice{
+		ModelID: model.ID,
+		TierID:  tierID,
+	}
+	if config := model.ModelConfig; config != nil {
+		if config.InputTokenCost != nil {
+			price.UpstreamInputCost = *config.InputTokenCost
+		}
+		if config.OutputTokenCost != nil {
+			price.UpstreamOutputCost = *config.OutputTokenCost
+		}
+	}
+	if rule != nil {
+		price.PriceRuleID = &rule.ID
+		price.MarkupPercent = rule.MarkupPercent
+	}
+
+	multiplier := 1 + price.MarkupPercent/100
+	price.InputTokenCost = roundTokenPrice(price.UpstreamInputCost * multiplier)
+	price.OutputTokenCost = roundTokenPrice(price.UpstreamOutputCost * multiplier)
+	return price
+}
+
+// roundTokenPrice округляет цену за токен до точности колонки в БД
+func roundTokenPrice(value float64) float64 {
+	return math.Round(value*1e12) / 1e12
+}
+
+// samePrice сообщает, что версия цены посчитана по тем же данным
+func samePrice(a, b *domain.ModelPrice) bool {
+	const epsilon = 1e-12
+	sameRule := (a.PriceRuleID == nil && b.PriceRuleID == nil) ||
+		(a.PriceRuleID != nil && b.PriceRuleID != nil && *a.PriceRuleID == *b.PriceRuleID)
+
+	return sameRule &&
+		math.Abs(a.MarkupPercent-b.MarkupPercent) < 1e-4 &&
+		math.Abs(a.UpstreamInputCost-b.UpstreamInputCost) < epsilon &&
+		math.Abs(a.UpstreamOutputCost-b.UpstreamOutputCost) < epsilon
+}
+
+func (s *pricingService) RefreshPrices(ctx context.Context) error {
+	now := s.now()
+	rules, err := s.pricingRepo.ListRules(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	models, err := s.modelRepo.ListWithFilters(ctx, "", nil, nil, "", 0, 0)
+	if err != nil {
+		return fmt.Errorf("failed to list models: %w", err)
+	}
+
+	tiers, err := s.tierRepo.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list tiers: %w", err)
+	}
+
+	created, failed := 0, 0
+	for _, model := range models {
+		if model.ModelConfig == nil {
+			continue
+		}
+		for _, tier := range tiers {
+			_, isNew, err := s.resolve(ctx, model, tier.ID, rules, now)
+			if err != nil {
+				fmt.Printf("Warning: failed to refresh price of model %s for tier %s: %v\n", model.ExternalID, tier.Name, err)
+				failed++
+				continue
+			}
+			if isNew {
+				created++
+			}
+		}
+	}
+
+	if created > 0 {
+		fmt.Printf("Pricing: created %d new price versions\n", created)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to refresh %d prices", failed)
+	}
+	return nil
+}
+
+func (s *pricingService) GetPrice(ctx context.Context, id string) (*domain.ModelPrice, error) {
+	return s.pricingRepo.GetPriceByID(ctx, id)
+}
+
+func (s *pricingService) ListPriceHistory(ctx context.Context, modelID, tierID string, limit, offset int) ([]*domain.ModelPrice, error) {
+	return s.pricingRepo.ListPrices(ctx, modelID, tierID, limit, offset)
+}
+
+func (s *pricingService) ListRules(ctx context.Context) ([]*domain.PriceRule, error) {
+	return s.pricingRepo.ListRules(ctx, time.Time{})
+}
+
+func (s *pricingService) CreateRule(ctx context.Context, req *CreatePriceRuleRequest) (*domain.PriceRule, error) {
+	// Наценка хранится с точностью до 4 знаков, иначе сохраненная версия цены
+	// никогда не совпадет с рассчитанной и версии будут создаваться при каждом запросе
+	markup := math.Round(req.MarkupPercent*1e4) / 1e4
+	if markup <= -100 || math.IsNaN(markup) || math.IsInf(markup, 0) {
+		return nil, fmt.Errorf("%w: markup_percent must be greater than -100", ErrInvalidPriceRule)
+	}
+
+	if req.ModelID != nil {
+		if _, err := s.modelRepo.GetByID(ctx, *req.ModelID); err != nil {
+			return nil, fmt.Errorf("%w: model %s not found", ErrInvalidPriceRule, *req.ModelID)
+		}
+	}
+	if req.CompanyID != nil {
+		if _, err := s.companyRepo.GetByID(ctx, *req.CompanyID); err != nil {
+			return nil, fmt.Errorf("%w: company %s not found", ErrInvalidPriceRule, *req.CompanyID)
+		}
+	}
+	if req.TierID != nil {
+		if _, err := s.tierRepo.GetByID(ctx, *req.TierID); err != nil {
+			return nil, fmt.Errorf("%w: tier %s not found", ErrInvalidPriceRule, *req.TierID)
+		}
+	}
+
+	rule := &domain.PriceRule{
+		ID:            uuid.New().String(),
+		Name:          req.Name,
+		ModelID:       req.ModelID,
+		CompanyID:     req.CompanyID,
+		TierID:        req.TierID,
+		MarkupPercent: markup,
+		EffectiveFrom: s.now(),
+	}
+	if req.EffectiveFrom != nil {
+		rule.EffectiveFrom = *req.EffectiveFrom
+	}
+	if req.CreatedBy != "" {
+		rule.CreatedBy = &req.CreatedBy
+	}
+
+	if err := s.pricingRepo.CreateRule(ctx, rule); err != nil {
+		return nil, err
+	}
+
+	// Правило, которое уже действует, сразу отражаем в истории цен
+	if !rule.EffectiveFrom.After(s.now()) {
+		if err := s.RefreshPrices(ctx); err != nil {
+			fmt.Printf("Warning: failed to refresh prices after creating rule %s: %v\n", rule.ID, err)
+		}
+	}
+
+	return rule, nil
+}
+
+func (s *pricingService) DeleteRule(ctx context.Context, id string) error {
+	if err := s.pricingRepo.DeleteRule(ctx, id); err != nil {
+		return err
+	}
+
+	if err := s.RefreshPrices(ctx); err != nil {
+		fmt.Printf("Warning: failed to refresh prices after deleting rule %s: %v\n", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/repository"
+)
+
+// fakePricingRepository хранит правила и версии цен в памяти
+type fakePricingRepository struct {
+	mu     sync.Mutex
+	rules  []*domain.PriceRule
+	prices []*domain.ModelPrice
+}
+
+func (r *fakePricingRepository) CreateRule(ctx context.Context, rule *domain.PriceRule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = append(r.rules, rule)
+	return nil
+}
+
+func (r *fakePricingRepository) GetRuleByID(ctx context.Context, id string) (*domain.PriceRule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rule := range r.rules {
+		if rule.ID == id {
+			return rule, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakePricingRepository) DeleteRule(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, rule := range r.rules {
+		if rule.ID == id {
+			r.rules = append(r.rules[:i], r.rules[i+1:]...)
+			return nil
+		}
+	}
+	return repository.ErrNotFound
+}
+
+func (r *fakePricingRepository) ListRules(ctx context.Context, until time.Time) ([]*domain.PriceRule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rules []*domain.PriceRule
+	for _, rule := range r.rules {
+		if until.IsZero() || !rule.EffectiveFrom.After(until) {
+			rules = append(rules, rule)
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].EffectiveFrom.After(rules[j].EffectiveFrom)
+	})
+	return rules, nil
+}
+
+func (r *fakePricingRepository) CreatePrice(ctx context.Context, price *domain.ModelPrice) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.prices {
+		if existing.ModelID == price.ModelID && existing.TierID == price.TierID && existing.Version == price.Version {
+			return repository.ErrDuplicate
+		}
+	}
+	stored := *price
+	r.prices = append(r.prices, &stored)
+	return nil
+}
+
+func (r *fakePricingRepository) GetPriceByID(ctx context.Context, id string) (*domain.ModelPrice, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, price := range r.prices {
+		if price.ID == id {
+			return price, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakePricingRepository) GetLatestPrice(ctx context.Context, modelID, tierID string) (*domain.ModelPrice, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var latest *domain.ModelPrice
+	for _, price := range r.prices {
+		if price.ModelID == modelID && price.TierID == tierID && (latest == nil || price.Version > latest.Version) {
+			latest = price
+		}
+	}
+	if latest == nil {
+		return nil, repository.ErrNotFound
+	}
+	return latest, nil
+}
+
+func (r *fakePricingRepository) ListPrices(ctx context.Context, modelID, tierID string, limit, offset int) ([]*domain.ModelPrice, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var prices []*domain.ModelPrice
+	for _, price := range r.prices {
+		if price.ModelID == modelID && (tierID == "" || price.TierID == tierID) {
+			prices = append(prices, price)
+		}
+	}
+	return prices, nil
+}
+
+func TestPricingService_ResolvePrice(t *testing.T) {
+	pricingRepo := &fakePricingRepository{}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := &pricingService{
+		pricingRepo: pricingRepo,
+		now:         func() time.Time { return now },
+	}
+	ctx := context.Background()
+
+	inputCost, outputCost := 0.000002, 0.000004
+	model := &domain.Model{
+		ID:          "model-1",
+		CompanyID:   "company-1",
+		ModelConfig: &domain.ModelConfig{InputTokenCost: &inputCost, OutputTokenCost: &outputCost},
+	}
+	modelID, companyID, tierID := "model-1", "company-1", "tier-pro"
+
+	// Без правил цена продажи равна стоимости провайдера
+	price, err := svc.ResolvePrice(ctx, model, tierID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, price.Version)
+	assert.InDelta(t, 0.000002, price.InputTokenCost, 1e-15)
+	assert.Nil(t, price.PriceRuleID)
+
+	// Правило для компании действует на все ее модели, правило для модели важнее него
+	pricingRepo.rules = []*domain.PriceRule{
+		{ID: "company", CompanyID: &companyID, MarkupPercent: 50, EffectiveFrom: now.Add(-2 * time.Hour)},
+		{ID: "model", ModelID: &modelID, MarkupPercent: 25, EffectiveFrom: now.Add(-time.Hour)},
+		{ID: "pro", TierID: &tierID, MarkupPercent: 10, EffectiveFrom: now.Add(-time.Minute)},
+		{ID: "future", ModelID: &modelID, MarkupPercent: 100, EffectiveFrom: now.Add(24 * time.Hour)},
+	}
+	price, err = svc.ResolvePrice(ctx, model, tierID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, price.Version)
+	assert.Equal(t, "model", *price.PriceRuleID)
+	assert.InDelta(t, 0.0000025, price.InputTokenCost, 1e-15)
+	assert.InDelta(t, 0.000005, price.OutputTokenCost, 1e-15)
+
+	// Пока данные не менялись, новая версия не создается
+	same, err := svc.ResolvePrice(ctx, model, tierID)
+	require.NoError(t, err)
+	assert.Equal(t, price.ID, same.ID)
+
+	// Синхронизация изменила стоимость провайдера - появляется новая версия, старая сохраняется
+	newInputCost := 0.000003
+	model.ModelConfig.InputTokenCost = &newInputCost
+	updated, err := svc.ResolvePrice(ctx, model, tierID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, updated.Version)
+	assert.InDelta(t, 0.00000375, updated.InputTokenCost, 1e-15)
+
+	previous, err := svc.GetPrice(ctx, price.ID)
+	require.NoError(t, err)
+	assert.InDelta(t, 0.0000025, previous.InputTokenCost, 1e-15)
+
+	// Правило с будущей датой начинает действовать, когда дата наступает
+	now = now.Add(25 * time.Hour)
+	future, err := svc.ResolvePrice(ctx, model, tierID)
+	require.NoError(t, err)
+	assert.Equal(t, "future", *future.PriceRuleID)
+	assert.InDelta(t, 0.000006, future.InputTokenCost, 1e-15)
+	assert.Equal(t, now, future.EffectiveFrom)
+}
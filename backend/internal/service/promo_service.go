@@ -0,0 +1,315 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/repository"
+)
+
+var (
+	ErrInvalidPromoCode = errors.New("invalid promo code")
+	// ErrPromoCodeUnavailable - код существует, но не может быть активирован пользователем
+	ErrPromoCodeUnavailable = errors.New("promo code cannot be redeemed")
+)
+
+// promoRevertBatchSize - сколько истекших тарифов возвращается за один проход задачи
+const promoRevertBatchSize = 200
+
+// generatedPromoCodeLength - длина кода, созданного без явного значения
+const generatedPromoCodeLength = 10
+
+// promoCodeAlphabet не содержит похожих символов (0/O, 1/I), чтобы код было проще ввести вручную
+const promoCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+var promoCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,64}$`)
+
+// CreatePromoCodeRequest - новый промокод. Пустой Code генерируется автоматически
+type CreatePromoCodeRequest struct {
+	Code            string     `json:"code"`
+	Description     string     `json:"description"`
+	Type            string     `json:"type"`
+	CreditAmount    *float64   `json:"credit_amount"`
+	TierID          *string    `json:"tier_id"`
+	DiscountPercent *float64   `json:"discount_percent"`
+	DurationDays    int        `json:"duration_days"`
+	MaxRedemptions  *int       `json:"max_redemptions"`
+	PerUserLimit    *int       `json:"per_user_limit"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	CreatedBy       string     `json:"-"`
+}
+
+type PromoService interface {
+	CreateCode(ctx context.Context, req *CreatePromoCodeRequest) (*domain.PromoCode, error)
+	ListCodes(ctx context.Context, limit, offset int) ([]*domain.PromoCode, error)
+	// DeactivateCode запрещает новые активации. Уже выданные начисления, тарифы и скидки сохраняются
+	DeactivateCode(ctx context.Context, id string) (*domain.PromoCode, error)
+	// Redeem активирует код для пользователя: начисляет баланс, временно меняет тариф или включает скидку
+	Redeem(ctx context.Context, userID, code string) (*domain.PromoRedemption, error)
+	ListRedemptions(ctx context.Context, userID string, limit, offset int) ([]*domain.PromoRedemption, error)
+	// GetActiveDiscount возвращает наибольшую действующую скидку пользователя в процентах
+	GetActiveDiscount(ctx context.Context, userID string) (float64, error)
+	// RevertExpiredGrants возвращает пользователям прежний тариф после окончания временного
+	RevertExpiredGrants(ctx context.Context) error
+}
+
+type promoService struct {
+	promoRepo     repository.PromoRepository
+	tierRepo      repository.TierRepository
+	ledgerService LedgerService
+	now           func() time.Time
+}
+
+func NewPromoService(promoRepo repository.PromoRepository, tierRepo repository.TierRepository, ledgerService LedgerService) PromoService {
+	return &promoService{
+		promoRepo:     promoRepo,
+		tierRepo:      tierRepo,
+		ledgerService: ledgerService,
+		now:           time.Now,
+	}
+}
+
+func (s *promoService) CreateCode(ctx context.Context, req *CreatePromoCodeRequest) (*domain.PromoCode, error) {
+	code := &domain.PromoCode{
+		ID:             uuid.New().String(),
+		Code:           strings.ToUpper(strings.TrimSpace(req.Code)),
+		Description:    req.Description,
+		Type:           req.Type,
+		DurationDays:   req.DurationDays,
+		MaxRedemptions: req.MaxRedemptions,
+		PerUserLimit:   1,
+		ExpiresAt:      req.ExpiresAt,
+		IsActive:       true,
+	}
+	if req.PerUserLimit != nil {
+		code.PerUserLimit = *req.PerUserLimit
+	}
+	if req.CreatedBy != "" {
+		code.CreatedBy = &req.CreatedBy
+	}
+
+	if code.Code == "" {
+		generated, err := generatePromoCode()
+		if err != nil {
+			return nil, err
+		}
+		code.Code = generated
+	} else if !promoCodePattern.MatchString(code.Code) {
+		return nil, fmt.Errorf("%w: code must be 3-64 characters of A-Z, 0-9, '-' or '_'", ErrInvalidPromoCode)
+	}
+
+	switch {
+	case code.MaxRedemptions != nil && *code.MaxRedemptions <= 0:
+		return nil, fmt.Errorf("%w: max_redemptions must be positive", ErrInvalidPromoCode)
+	case code.PerUserLimit < 0:
+		return nil, fmt.Errorf("%w: per_user_limit must not be negative", ErrInvalidPromoCode)
+	case code.ExpiresAt != nil && !code.ExpiresAt.After(s.now()):
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidPromoCode)
+	}
+
+	switch code.Type {
+	case domain.PromoTypeCredit:
+		if req.CreditAmount == nil || *req.CreditAmount <= 0 {
+			return nil, fmt.Errorf("%w: credit_amount must be positive", ErrInvalidPromoCode)
+		}
+		amount := math.Round(*req.CreditAmount*1e6) / 1e6
+		code.CreditAmount = &amount
+		code.DurationDays = 0
+	case domain.PromoTypeTierUpgrade:
+		if req.TierID == nil || *req.TierID == "" {
+			return nil, fmt.Errorf("%w: tier_id is required", ErrInvalidPromoCode)
+		}
+		if _, err := s.tierRepo.GetByID(ctx, *req.TierID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, fmt.Errorf("%w: tier %s not found", ErrInvalidPromoCode, *req.TierID)
+			}
+			return nil, err
+		}
+		code.TierID = req.TierID
+	case domain.PromoTypeDiscount:
+		if req.DiscountPercent == nil || *req.DiscountPercent <= 0 || *req.DiscountPercent > 100 {
+			return nil, fmt.Errorf("%w: discount_percent must be between 0 and 100", ErrInvalidPromoCode)
+		}
+		code.DiscountPercent = req.DiscountPercent
+	default:
+		return nil, fmt.Errorf("%w: type must be one of %s, %s, %s", ErrInvalidPromoCode,
+			domain.PromoTypeCredit, domain.PromoTypeTierUpgrade, domain.PromoTypeDiscount)
+	}
+	if code.Type != domain.PromoTypeCredit && code.DurationDays <= 0 {
+		return nil, fmt.Errorf("%w: duration_days must be positive", ErrInvalidPromoCode)
+	}
+
+	if err := s.promoRepo.CreateCode(ctx, code); err != nil {
+		return nil, err
+	}
+
+	return code, nil
+}
+
+// generatePromoCode создает случайный код из promoCodeAlphabet
+func generatePromoCode() (string, error) {
+	buf := make([]byte, generatedPromoCodeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate promo code: %w", err)
+	}
+	for i := range buf {
+		buf[i] = promoCodeAlphabet[int(buf[i])%len(promoCodeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+func (s *promoService) ListCodes(ctx context.Context, limit, offset int) ([]*domain.PromoCode, error) {
+	return s.promoRepo.ListCodes(ctx, limit, offset)
+}
+
+func (s *promoService) DeactivateCode(ctx context.Context, id string) (*domain.PromoCode, error) {
+	code, err := s.promoRepo.GetCodeByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if code.IsActive {
+		code.IsActive = false
+		if err := s.promoRepo.UpdateCode(ctx, code); err != nil {
+			return nil, err
+		}
+	}
+
+	return code, nil
+}
+
+func (s *promoService) Redeem(ctx context.Context, userID, code string) (*domain.PromoRedemption, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return nil, fmt.Errorf("%w: code is required", ErrInvalidPromoCode)
+	}
+
+	now := s.now()
+	redemption := &domain.PromoRedemption{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		RedeemedAt: now,
+	}
+
+	change := &domain.TierChange{
+		ID:     uuid.New().String(),
+		Reason: domain.TierChangeReasonPromo,
+	}
+	err := s.promoRepo.Redeem(ctx, code, redemption, change, func(promo *domain.PromoCode, usage *repository.PromoUsage) error {
+		switch {
+		case !promo.IsActive:
+			return fmt.Errorf("%w: code is no longer active", ErrPromoCodeUnavailable)
+		case promo.ExpiresAt != nil && !now.Before(*promo.ExpiresAt):
+			return fmt.Errorf("%w: code has expired", ErrPromoCodeUnavailable)
+		case promo.MaxRedemptions != nil && promo.RedemptionCount >= *promo.MaxRedemptions:
+			return fmt.Errorf("%w: code has reached its redemption limit", ErrPromoCodeUnavailable)
+		case promo.PerUserLimit > 0 && usage.UserRedemptions >= int64(promo.PerUserLimit):
+			return fmt.Errorf("%w: code has already been redeemed", ErrPromoCodeUnavailable)
+		case promo.Type == domain.PromoTypeTierUpgrade && usage.ActiveTierGrant:
+			return fmt.Errorf("%w: another temporary tier upgrade is still active", ErrPromoCodeUnavailable)
+		case promo.Type == domain.PromoTypeTierUpgrade && usage.TierPinned:
+			return fmt.Errorf("%w: your tier is assigned by an administrator and cannot be changed by a promo code", ErrPromoCodeUnavailable)
+		case promo.Type == domain.PromoTypeTierUpgrade && usage.GrantedTierPrice <= usage.CurrentTierPrice:
+			return fmt.Errorf("%w: your current tier is already the same as or higher than the promo tier", ErrPromoCodeUnavailable)
+		}
+
+		redemption.Type = promo.Type
+		redemption.CreditAmount = promo.CreditAmount
+		redemption.DiscountPercent = promo.DiscountPercent
+		redemption.GrantedTierID = promo.TierID
+		if promo.Type != domain.PromoTypeCredit {
+			expiresAt := now.AddDate(0, 0, promo.DurationDays)
+			redemption.ExpiresAt = &expiresAt
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if redemption.Type == domain.PromoTypeCredit && redemption.CreditAmount != nil {
+		_, err := s.ledgerService.Post(ctx, &LedgerPosting{
+			UserID:    userID,
+			Amount:    *redemption.CreditAmount,
+			Type:      domain.LedgerTxPromoCredit,
+			Reason:    "Promo code " + redemption.Code,
+			Reference: "promo:" + redemption.ID,
+		})
+		if err != nil {
+			// Без начисления активация не должна расходовать лимиты кода
+			if cancelErr := s.promoRepo.CancelRedemption(context.WithoutCancel(ctx), redemption); cancelErr != nil {
+				fmt.Printf("Warning: failed to cancel promo redemption %s: %v\n", redemption.ID, cancelErr)
+			}
+			return nil, fmt.Errorf("failed to credit promo code: %w", err)
+		}
+	}
+
+	return redemption, nil
+}
+
+func (s *promoService) ListRedemptions(ctx context.Context, userID string, limit, offset int) ([]*domain.PromoRedemption, error) {
+	return s.promoRepo.ListRedemptionsByUser(ctx, userID, limit, offset)
+}
+
+func (s *promoService) GetActiveDiscount(ctx context.Context, userID string) (float64, error) {
+	redemptions, err := s.promoRepo.ListActiveRedemptions(ctx, userID, domain.PromoTypeDiscount, s.now())
+	if err != nil {
+		return 0, err
+	}
+
+	discount := 0.0
+	for _, redemption := range redemptions {
+		if redemption.DiscountPercent != nil && *redemption.DiscountPercent > discount {
+			discount = *redemption.DiscountPercent
+		}
+	}
+	return math.Min(discount, 100), nil
+}
+
+func (s *promoService) RevertExpiredGrants(ctx context.Context) error {
+	reverted, failed := 0, 0
+	for {
+		now := s.now()
+		grants, err := s.promoRepo.ListExpiredTierGrants(ctx, now, promoRevertBatchSize)
+		if err != nil {
+			return err
+		}
+
+		batchReverted := 0
+		for _, grant := range grants {
+			change := &domain.TierChange{
+				ID:     uuid.New().String(),
+				Reason: domain.TierChangeReasonPromoExpired,
+			}
+			if err := s.promoRepo.RevertTierGrant(ctx, grant, change, now); err != nil {
+				fmt.Printf("Warning: failed to revert tier grant %s for user %s: %v\n", grant.ID, grant.UserID, err)
+				failed++
+				continue
+			}
+			batchReverted++
+		}
+		reverted += batchReverted
+
+		// Если ни один тариф пачки не удалось вернуть, следующий проход вернет ту же пачку
+		if len(grants) < promoRevertBatchSize || batchReverted == 0 {
+			break
+		}
+	}
+
+	if reverted > 0 {
+		fmt.Printf("Promo expiry: reverted %d temporary tier upgrades\n", reverted)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to revert %d tier upgrades", failed)
+	}
+	return nil
+}
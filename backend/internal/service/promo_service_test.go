@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/repository"
+)
+
+// fakePromoRepository хранит промокоды и активации в памяти
+type fakePromoRepository struct {
+	mu          sync.Mutex
+	codes       []*domain.PromoCode
+	redemptions []*domain.PromoRedemption
+	userTiers   map[string]string
+	pinned      map[string]bool
+	tierPrices  map[string]float64
+}
+
+func (r *fakePromoRepository) CreateCode(ctx context.Context, code *domain.PromoCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.codes {
+		if existing.Code == code.Code {
+			return repository.ErrDuplicate
+		}
+	}
+	r.codes = append(r.codes, code)
+	return nil
+}
+
+func (r *fakePromoRepository) GetCodeByID(ctx context.Context, id string) (*domain.PromoCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, code := range r.codes {
+		if code.ID == id {
+			return code, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakePromoRepository) UpdateCode(ctx context.Context, code *domain.PromoCode) error {
+	return nil
+}
+
+func (r *fakePromoRepository) ListCodes(ctx context.Context, limit, offset int) ([]*domain.PromoCode, error) {
+	return r.codes, nil
+}
+
+func (r *fakePromoRepository) Redeem(ctx context.Context, code string, redemption *domain.PromoRedemption, change *domain.TierChange, check func(code *domain.PromoCode, usage *repository.PromoUsage) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var promo *domain.PromoCode
+	for _, existing := range r.codes {
+		if existing.Code == code {
+			promo = existing
+		}
+	}
+	if promo == nil {
+		return repository.ErrNotFound
+	}
+
+	usage := &repository.PromoUsage{}
+	for _, existing := range r.redemptions {
+		if existing.PromoCodeID == promo.ID && existing.UserID == redemption.UserID {
+			usage.UserRedemptions++
+		}
+		if existing.UserID == redemption.UserID && existing.Type == domain.PromoTypeTierUpgrade && existing.IsActive(redemption.RedeemedAt) {
+			usage.ActiveTierGrant = true
+		}
+	}
+	usage.TierPinned = r.pinned[redemption.UserID]
+	if promo.TierID != nil {
+		usage.CurrentTierPrice = r.tierPrices[r.userTiers[redemption.UserID]]
+		usage.GrantedTierPrice = r.tierPrices[*promo.TierID]
+	}
+	if err := check(promo, usage); err != nil {
+		return err
+	}
+
+	redemption.PromoCodeID = promo.ID
+	redemption.Code = promo.Code
+	if redemption.GrantedTierID != nil {
+		previous := r.userTiers[redemption.UserID]
+		redemption.PreviousTierID = &previous
+		r.userTiers[redemption.UserID] = *redemption.GrantedTierID
+	}
+	r.redemptions = append(r.redemptions, redemption)
+	promo.RedemptionCount++
+	return nil
+}
+
+func (r *fakePromoRepository) CancelRedemption(ctx context.Context, redemption *domain.PromoRedemption) error {
+	return nil
+}
+
+func (r *fakePromoRepository) ListRedemptionsByUser(ctx context.Context, userID string, limit, offset int) ([]*domain.PromoRedemption, error) {
+	return nil, nil
+}
+
+func (r *fakePromoRepository) ListActiveRedemptions(ctx context.Context, userID, promoType string, now time.Time) ([]*domain.PromoRedemption, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var active []*domain.PromoRedemption
+	for _, redemption := range r.redemptions {
+		if redemption.UserID == userID && redemption.Type == promoType && redemption.IsActive(now) {
+			active = append(active, redemption)
+		}
+	}
+	return active, nil
+}
+
+func (r *fakePromoRepository) ListExpiredTierGrants(ctx context.Context, now time.Time, limit int) ([]*domain.PromoRedemption, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var expired []*domain.PromoRedemption
+	for _, redemption := range r.redemptions {
+		if redemption.Type == domain.PromoTypeTierUpgrade && redemption.RevertedAt == nil && !now.Before(*redemption.ExpiresAt) {
+			expired = append(expired, redemption)
+		}
+	}
+	return expired, nil
+}
+
+func (r *fakePromoRepository) RevertTierGrant(ctx context.Context, redemption *domain.PromoRedemption, change *domain.TierChange, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	redemption.RevertedAt = &now
+	if r.userTiers[redemption.UserID] == *redemption.GrantedTierID {
+		r.userTiers[redemption.UserID] = *redemption.PreviousTierID
+	}
+	return nil
+}
+
+func TestPromoService_RedeemCredit(t *testing.T) {
+	promoRepo := &fakePromoRepository{userTiers: map[string]string{}}
+	ledgerRepo := newFakeLedgerRepository()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	svc := &promoService{
+		promoRepo:     promoRepo,
+		ledgerService: NewLedgerService(ledgerRepo, time.Time{}),
+		now:           func() time.Time { return now },
+	}
+	ctx := context.Background()
+
+	amount, maxRedemptions := 25.0, 2
+	code, err := svc.CreateCode(ctx, &CreatePromoCodeRequest{Code: " welcome25 ", Type: domain.PromoTypeCredit, CreditAmount: &amount, MaxRedemptions: &maxRedemptions})
+	require.NoError(t, err)
+	assert.Equal(t, "WELCOME25", code.Code)
+	assert.Equal(t, 1, code.PerUserLimit)
+
+	_, err = svc.CreateCode(ctx, &CreatePromoCodeRequest{Type: domain.PromoTypeCredit})
+	assert.ErrorIs(t, err, ErrInvalidPromoCode)
+
+	redemption, err := svc.Redeem(ctx, "user-1", "Welcome25")
+	require.NoError(t, err)
+	assert.Nil(t, redemption.ExpiresAt)
+	assert.InDelta(t, 25, ledgerRepo.accounts[domain.LedgerUserAccount("user-1")], 1e-9)
+	assert.InDelta(t, -25, ledgerRepo.accounts[domain.LedgerAccountPromotions], 1e-9)
+
+	// Один пользователь активирует код один раз, общий лимит - две активации
+	_, err = svc.Redeem(ctx, "user-1", "WELCOME25")
+	assert.ErrorIs(t, err, ErrPromoCodeUnavailable)
+	_, err = svc.Redeem(ctx, "user-2", "WELCOME25")
+	require.NoError(t, err)
+	_, err = svc.Redeem(ctx, "user-3", "WELCOME25")
+	assert.ErrorIs(t, err, ErrPromoCodeUnavailable)
+
+	_, err = svc.Redeem(ctx, "user-3", "UNKNOWN")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestPromoService_TierUpgradeAndDiscount(t *testing.T) {
+	promoRepo := &fakePromoRepository{userTiers: map[string]string{"user-1": "free"}, tierPrices: map[string]float64{"free": 0, "pro": 50}}
+	tierRepo := &MockTierRepository{}
+	tierRepo.On("GetByID", context.Background(), "pro").Return(&domain.Tier{ID: "pro"}, nil)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	svc := &promoService{
+		promoRepo: promoRepo,
+		tierRepo:  tierRepo,
+		now:       func() time.Time { return now },
+	}
+	ctx := context.Background()
+
+	proTier := "pro"
+	_, err := svc.CreateCode(ctx, &CreatePromoCodeRequest{Code: "PRO7", Type: domain.PromoTypeTierUpgrade, TierID: &proTier})
+	assert.ErrorIs(t, err, ErrInvalidPromoCode, "временный тариф требует срок действия")
+	_, err = svc.CreateCode(ctx, &CreatePromoCodeRequest{Code: "PRO7", Type: domain.PromoTypeTierUpgrade, TierID: &proTier, DurationDays: 7})
+	require.NoError(t, err)
+	percent := 20.0
+	_, err = svc.CreateCode(ctx, &CreatePromoCodeRequest{Code: "SAVE20", Type: domain.PromoTypeDiscount, DiscountPercent: &percent, DurationDays: 3})
+	require.NoError(t, err)
+
+	grant, err := svc.Redeem(ctx, "user-1", "PRO7")
+	require.NoError(t, err)
+	assert.Equal(t, "pro", promoRepo.userTiers["user-1"])
+	assert.Equal(t, now.AddDate(0, 0, 7), *grant.ExpiresAt)
+
+	_, err = svc.Redeem(ctx, "user-1", "SAVE20")
+	require.NoError(t, err)
+	discount, err := svc.GetActiveDiscount(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, 20.0, discount)
+
+	// Тариф возвращается только после окончания срока, скидка к этому времени тоже закончилась
+	require.NoError(t, svc.RevertExpiredGrants(ctx))
+	assert.Equal(t, "pro", promoRepo.userTiers["user-1"])
+
+	now = now.AddDate(0, 0, 7)
+	require.NoError(t, svc.RevertExpiredGrants(ctx))
+	assert.Equal(t, "free", promoRepo.userTiers["user-1"])
+	discount, err = svc.GetActiveDiscount(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Zero(t, discount)
+}
+
+func TestPromoService_TierUpgradeRequiresHigherUnpinnedTier(t *testing.T) {
+	promoRepo := &fakePromoRepository{
+		userTiers:  map[string]string{"user-1": "enterprise", "user-2": "free", "user-3": "free"},
+		pinned:     map[string]bool{"user-2": true},
+		tierPrices: map[string]float64{"free": 0, "pro": 50, "enterprise": 500},
+	}
+	tierRepo := &MockTierRepository{}
+	tierRepo.On("GetByID", context.Background(), "pro").Return(&domain.Tier{ID: "pro"}, nil)
+	svc := &promoService{
+		promoRepo: promoRepo,
+		tierRepo:  tierRepo,
+		now:       func() time.Time { return time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC) },
+	}
+	ctx := context.Background()
+
+	proTier := "pro"
+	_, err := svc.CreateCode(ctx, &CreatePromoCodeRequest{Code: "PRO7", Type: domain.PromoTypeTierUpgrade, TierID: &proTier, DurationDays: 7})
+	require.NoError(t, err)
+
+	// Для пользователя более дорогого тарифа "повышение" было бы понижением
+	_, err = svc.Redeem(ctx, "user-1", "PRO7")
+	assert.ErrorIs(t, err, ErrPromoCodeUnavailable)
+	assert.Equal(t, "enterprise", promoRepo.userTiers["user-1"])
+
+	// Закрепленный администратором тариф промокод не меняет
+	_, err = svc.Redeem(ctx, "user-2", "PRO7")
+	assert.ErrorIs(t, err, ErrPromoCodeUnavailable)
+	assert.Equal(t, "free", promoRepo.userTiers["user-2"])
+
+	_, err = svc.Redeem(ctx, "user-3", "PRO7")
+	require.NoError(t, err)
+	assert.Equal(t, "pro", promoRepo.userTiers["user-3"])
+}
@@ -202,8 +202,9 @@ func (s *requestService) CreateRequestFromLiteLLM(ctx context.Context, litellmLo
 		}
 	}
 
-	// Найдем API ключ
+	// Найдем API ключ. Запрос по ключу команды учитывается и за командой
 	var apiKeyID *string
+	var teamID *string
 	if apiKeyStr, ok := litellmLog["api_key"].(string); ok && apiKeyStr != "" {
 		if apiKeys, err := s.apiKeyRepo.GetByUserID(ctx, userID); err == nil {
 			for _, key := range apiKeys {
@@ -211,6 +212,7 @@ func (s *requestService) CreateRequestFromLiteLLM(ctx context.Context, litellmLo
 				if (key.OriginalKey != "" && key.OriginalKey == apiKeyStr) ||
 					(key.ExternalID != "" && key.ExternalID == apiKeyStr) {
 					apiKeyID = &key.ID
+					teamID = key.TeamID
 					break
 				}
 			}
@@ -223,6 +225,7 @@ func (s *requestService) CreateRequestFromLiteLLM(ctx context.Context, litellmLo
 		UserID:            userID,
 		ModelID:           modelID,
 		ApiKeyID:          apiKeyID,
+		TeamID:            teamID,
 		ExternalRequestID: &requestID,
 		InputTokens:       inputTokens,
 		OutputTokens:      outputTokens,
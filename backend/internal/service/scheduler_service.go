@@ -2,62 +2,330 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"runtime/debug"
+	"sort"
+	"sync"
 	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/leader"
+	"oneui-hub/internal/repository"
+)
+
+var (
+	ErrJobNotFound       = errors.New("job not found")
+	ErrJobAlreadyRunning = errors.New("job is already running")
+
+	// errNotLeader - запуск по расписанию пропущен, так как задачи выполняет другая реплика
+	errNotLeader = errors.New("replica is not the leader")
 )
 
+// defaultJobTimeout ограничивает время выполнения задачи, если таймаут не задан явно
+const defaultJobTimeout = 30 * time.Minute
+
+// Job описывает фоновую задачу планировщика
+type Job struct {
+	Name string
+	// Schedule - cron выражение из пяти полей ("0 * * * *") или дескриптор ("@every 1h", "@daily").
+	// Пустое расписание означает, что задача запускается только вручную
+	Schedule string
+	Timeout  time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// JobInfo - состояние зарегистрированной задачи
+type JobInfo struct {
+	Name     string         `json:"name"`
+	Schedule string         `json:"schedule"`
+	Timeout  string         `json:"timeout"`
+	Running  bool           `json:"running"`
+	NextRun  *time.Time     `json:"next_run,omitempty"`
+	LastRun  *domain.JobRun `json:"last_run,omitempty"`
+}
+
+// Leadership сообщает, держит ли реплика лидерство. Задачи по расписанию выполняет только лидер
+type Leadership interface {
+	// Lease возвращает токен аренды и контекст, который отменяется при потере лидерства
+	Lease() (token int64, ctx context.Context, ok bool)
+	// Validate проверяет по общей БД, что аренда с токеном token все еще действует.
+	// Локальное состояние Lease может отставать, например если реплика зависла дольше ttl
+	Validate(ctx context.Context, token int64) error
+}
+
+// leaseValidationTimeout ограничивает проверку аренды перед сохранением результата задачи
+const leaseValidationTimeout = 5 * time.Second
+
 type SchedulerService interface {
+	// Register добавляет задачу. Задачи нужно регистрировать до вызова Start
+	Register(job Job) error
 	Start(ctx context.Context)
 	Stop()
+	// Trigger запускает задачу вне расписания и возвращает созданную запись о запуске
+	Trigger(ctx context.Context, name string) (*domain.JobRun, error)
+	ListJobs(ctx context.Context) ([]*JobInfo, error)
+	ListRuns(ctx context.Context, jobName string, limit, offset int) ([]*domain.JobRun, error)
+}
+
+type scheduledJob struct {
+	Job
+	entryID cron.EntryID
 }
 
 type schedulerService struct {
-	currencyService CurrencyService
-	ticker          *time.Ticker
-	done            chan bool
+	jobRunRepo repository.JobRunRepository
+	leadership Leadership
+	cron       *cron.Cron
+
+	mu      sync.Mutex
+	jobs    map[string]*scheduledJob
+	running map[string]bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
 }
 
-func NewSchedulerService(currencyService CurrencyService) SchedulerService {
+// NewSchedulerService создает планировщик. Если leadership равен nil, реплика считается
+// единственной и выполняет задачи по расписанию сама
+func NewSchedulerService(jobRunRepo repository.JobRunRepository, leadership Leadership) SchedulerService {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &schedulerService{
-		currencyService: currencyService,
-		done:            make(chan bool),
+		jobRunRepo: jobRunRepo,
+		leadership: leadership,
+		cron:       cron.New(cron.WithLocation(time.UTC)),
+		jobs:       make(map[string]*scheduledJob),
+		running:    make(map[string]bool),
+		ctx:        ctx,
+		cancel:     cancel,
 	}
 }
 
+func (s *schedulerService) Register(job Job) error {
+	if job.Name == "" || job.Run == nil {
+		return fmt.Errorf("job name and run function are required")
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = defaultJobTimeout
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.jobs[job.Name]; exists {
+		return fmt.Errorf("job %s is already registered", job.Name)
+	}
+
+	scheduled := &scheduledJob{Job: job}
+	if job.Schedule != "" {
+		name := job.Name
+		entryID, err := s.cron.AddFunc(job.Schedule, func() {
+			_, err := s.launch(name, domain.JobTriggerSchedule)
+			if err != nil && !errors.Is(err, ErrJobAlreadyRunning) && !errors.Is(err, errNotLeader) {
+				log.Printf("Failed to start scheduled job %s: %v", name, err)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("invalid schedule %q for job %s: %w", job.Schedule, job.Name, err)
+		}
+		scheduled.entryID = entryID
+	}
+
+	s.jobs[job.Name] = scheduled
+	return nil
+}
+
 func (s *schedulerService) Start(ctx context.Context) {
-	// Обновляем курсы при запуске
-	if err := s.currencyService.UpdateExchangeRates(ctx); err != nil {
-		log.Printf("Failed to update exchange rates on startup: %v", err)
-	} else {
-		log.Println("Exchange rates updated successfully on startup")
+	s.mu.Lock()
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	count := len(s.jobs)
+	s.mu.Unlock()
+
+	s.cron.Start()
+	log.Printf("Scheduler service started with %d jobs", count)
+}
+
+func (s *schedulerService) Stop() {
+	<-s.cron.Stop().Done()
+
+	s.mu.Lock()
+	s.cancel()
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	log.Println("Scheduler service stopped")
+}
+
+func (s *schedulerService) Trigger(ctx context.Context, name string) (*domain.JobRun, error) {
+	return s.launch(name, domain.JobTriggerManual)
+}
+
+// launch создает запись о запуске и выполняет задачу в отдельной горутине.
+// Одна задача не выполняется параллельно сама с собой. Запуски по расписанию выполняются
+// только на лидере и прерываются, если лидерство потеряно во время выполнения.
+// Ручной запуск выполняется на той реплике, которая получила запрос.
+func (s *schedulerService) launch(name, trigger string) (*domain.JobRun, error) {
+	var token int64
+	var leaseCtx context.Context
+	if trigger == domain.JobTriggerSchedule && s.leadership != nil {
+		var ok bool
+		token, leaseCtx, ok = s.leadership.Lease()
+		if !ok {
+			return nil, errNotLeader
+		}
 	}
 
-	// Настраиваем ежедневное обновление в 00:00 UTC
-	s.ticker = time.NewTicker(24 * time.Hour)
+	s.mu.Lock()
+	job, exists := s.jobs[name]
+	if !exists {
+		s.mu.Unlock()
+		return nil, ErrJobNotFound
+	}
+	if s.running[name] {
+		s.mu.Unlock()
+		return nil, ErrJobAlreadyRunning
+	}
+	s.running[name] = true
+	ctx := s.ctx
+	s.mu.Unlock()
+
+	if leaseCtx != nil {
+		ctx = leader.WithFencingToken(ctx, token)
+	}
 
+	run := &domain.JobRun{
+		ID:           uuid.New().String(),
+		JobName:      name,
+		Trigger:      trigger,
+		Status:       domain.JobRunStatusRunning,
+		StartedAt:    time.Now(),
+		FencingToken: token,
+	}
+	if err := s.jobRunRepo.Create(ctx, run); err != nil {
+		// История не должна мешать выполнению задачи
+		log.Printf("Failed to record start of job %s: %v", name, err)
+	}
+
+	started := *run
+	s.wg.Add(1)
 	go func() {
-		for {
-			select {
-			case <-s.ticker.C:
-				log.Println("Starting daily exchange rates update...")
-				if err := s.currencyService.UpdateExchangeRates(ctx); err != nil {
-					log.Printf("Failed to update exchange rates: %v", err)
-				} else {
-					log.Println("Exchange rates updated successfully")
-				}
-			case <-s.done:
-				return
-			}
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, name)
+			s.mu.Unlock()
+		}()
+
+		s.execute(ctx, leaseCtx, job.Job, run)
+	}()
+
+	return &started, nil
+}
+
+// execute выполняет задачу с таймаутом и восстановлением после паники и сохраняет результат
+func (s *schedulerService) execute(ctx, leaseCtx context.Context, job Job, run *domain.JobRun) {
+	runCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+	defer cancel()
+
+	if leaseCtx != nil {
+		stop := context.AfterFunc(leaseCtx, cancel)
+		defer stop()
+	}
+
+	err := runJob(runCtx, job)
+	if err == nil && runCtx.Err() != nil {
+		// Задача могла проигнорировать отмену контекста
+		err = runCtx.Err()
+	}
+	if leaseCtx != nil && err == nil {
+		// Успех засчитывается, только если за время выполнения лидером не стала другая реплика
+		err = s.validateLease(run.FencingToken)
+	}
+	switch {
+	case errors.Is(err, leader.ErrNotLeader):
+		err = fmt.Errorf("leadership lost during job: fencing token %d is stale: %w", run.FencingToken, err)
+	case leaseCtx != nil && leaseCtx.Err() != nil && err != nil:
+		err = fmt.Errorf("leadership lost during job: %w", err)
+	case errors.Is(err, context.DeadlineExceeded):
+		err = fmt.Errorf("job timed out after %s: %w", job.Timeout, err)
+	}
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	run.DurationMs = finished.Sub(run.StartedAt).Milliseconds()
+	if err != nil {
+		run.Status = domain.JobRunStatusFailed
+		run.Error = err.Error()
+		log.Printf("Job %s failed after %dms: %v", job.Name, run.DurationMs, err)
+	} else {
+		run.Status = domain.JobRunStatusSucceeded
+		log.Printf("Job %s completed in %dms", job.Name, run.DurationMs)
+	}
+
+	// Контекст планировщика может быть уже отменен при остановке, а результат нужно сохранить
+	if err := s.jobRunRepo.Update(context.Background(), run); err != nil {
+		log.Printf("Failed to record result of job %s: %v", job.Name, err)
+	}
+}
+
+func (s *schedulerService) validateLease(token int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), leaseValidationTimeout)
+	defer cancel()
+	return s.leadership.Validate(ctx, token)
+}
+
+// runJob вызывает задачу, превращая панику в ошибку
+func runJob(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %s panicked: %v\n%s", job.Name, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
 		}
 	}()
 
-	log.Println("Scheduler service started")
+	return job.Run(ctx)
 }
 
-func (s *schedulerService) Stop() {
-	if s.ticker != nil {
-		s.ticker.Stop()
+func (s *schedulerService) ListJobs(ctx context.Context) ([]*JobInfo, error) {
+	s.mu.Lock()
+	infos := make([]*JobInfo, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		info := &JobInfo{
+			Name:     job.Name,
+			Schedule: job.Schedule,
+			Timeout:  job.Timeout.String(),
+			Running:  s.running[job.Name],
+		}
+		if job.entryID != 0 {
+			if next := s.cron.Entry(job.entryID).Next; !next.IsZero() {
+				info.NextRun = &next
+			}
+		}
+		infos = append(infos, info)
 	}
-	s.done <- true
-	log.Println("Scheduler service stopped")
+	s.mu.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	for _, info := range infos {
+		runs, err := s.jobRunRepo.List(ctx, info.Name, 1, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) > 0 {
+			info.LastRun = runs[0]
+		}
+	}
+
+	return infos, nil
+}
+
+func (s *schedulerService) ListRuns(ctx context.Context, jobName string, limit, offset int) ([]*domain.JobRun, error) {
+	return s.jobRunRepo.List(ctx, jobName, limit, offset)
 }
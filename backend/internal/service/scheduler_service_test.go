@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/leader"
+)
+
+// fakeJobRunRepository хранит историю запусков в памяти
+type fakeJobRunRepository struct {
+	mu   sync.Mutex
+	runs map[string]domain.JobRun
+}
+
+func newFakeJobRunRepository() *fakeJobRunRepository {
+	return &fakeJobRunRepository{runs: map[string]domain.JobRun{}}
+}
+
+func (r *fakeJobRunRepository) Create(ctx context.Context, run *domain.JobRun) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs[run.ID] = *run
+	return nil
+}
+
+func (r *fakeJobRunRepository) Update(ctx context.Context, run *domain.JobRun) error {
+	return r.Create(ctx, run)
+}
+
+func (r *fakeJobRunRepository) List(ctx context.Context, jobName string, limit, offset int) ([]*domain.JobRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var runs []*domain.JobRun
+	for _, run := range r.runs {
+		if jobName == "" || run.JobName == jobName {
+			copied := run
+			runs = append(runs, &copied)
+		}
+	}
+	return runs, nil
+}
+
+func (r *fakeJobRunRepository) get(id string) domain.JobRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.runs[id]
+}
+
+func waitForRun(t *testing.T, repo *fakeJobRunRepository, id string) domain.JobRun {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		return repo.get(id).Status != domain.JobRunStatusRunning
+	}, 2*time.Second, 5*time.Millisecond)
+	return repo.get(id)
+}
+
+func TestSchedulerService_Trigger(t *testing.T) {
+	repo := newFakeJobRunRepository()
+	scheduler := NewSchedulerService(repo, nil)
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	require.NoError(t, scheduler.Register(Job{
+		Name:     "sync",
+		Schedule: "*/15 * * * *",
+		Run: func(ctx context.Context) error {
+			<-release
+			return nil
+		},
+	}))
+	require.NoError(t, scheduler.Register(Job{
+		Name: "broken",
+		Run: func(ctx context.Context) error {
+			return errors.New("upstream unavailable")
+		},
+	}))
+	scheduler.Start(ctx)
+	t.Cleanup(scheduler.Stop)
+
+	run, err := scheduler.Trigger(ctx, "sync")
+	require.NoError(t, err)
+	assert.Equal(t, domain.JobTriggerManual, run.Trigger)
+	assert.Equal(t, domain.JobRunStatusRunning, run.Status)
+
+	// Пока задача выполняется, второй запуск отклоняется
+	_, err = scheduler.Trigger(ctx, "sync")
+	assert.ErrorIs(t, err, ErrJobAlreadyRunning)
+
+	jobs, err := scheduler.ListJobs(ctx)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "sync", jobs[1].Name)
+	assert.True(t, jobs[1].Running)
+	assert.NotNil(t, jobs[1].NextRun)
+	assert.Nil(t, jobs[0].NextRun)
+
+	close(release)
+	finished := waitForRun(t, repo, run.ID)
+	assert.Equal(t, domain.JobRunStatusSucceeded, finished.Status)
+	assert.NotNil(t, finished.FinishedAt)
+
+	run, err = scheduler.Trigger(ctx, "broken")
+	require.NoError(t, err)
+	failed := waitForRun(t, repo, run.ID)
+	assert.Equal(t, domain.JobRunStatusFailed, failed.Status)
+	assert.Equal(t, "upstream unavailable", failed.Error)
+
+	_, err = scheduler.Trigger(ctx, "missing")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestSchedulerService_PanicAndTimeout(t *testing.T) {
+	repo := newFakeJobRunRepository()
+	scheduler := NewSchedulerService(repo, nil)
+	ctx := context.Background()
+
+	require.NoError(t, scheduler.Register(Job{
+		Name: "panics",
+		Run: func(ctx context.Context) error {
+			var m map[string]int
+			m["boom"]++
+			return nil
+		},
+	}))
+	require.NoError(t, scheduler.Register(Job{
+		Name:    "slow",
+		Timeout: 20 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}))
+	scheduler.Start(ctx)
+	t.Cleanup(scheduler.Stop)
+
+	run, err := scheduler.Trigger(ctx, "panics")
+	require.NoError(t, err)
+	result := waitForRun(t, repo, run.ID)
+	assert.Equal(t, domain.JobRunStatusFailed, result.Status)
+	assert.Contains(t, result.Error, "panic:")
+
+	run, err = scheduler.Trigger(ctx, "slow")
+	require.NoError(t, err)
+	result = waitForRun(t, repo, run.ID)
+	assert.Equal(t, domain.JobRunStatusFailed, result.Status)
+	assert.Contains(t, result.Error, "timed out")
+
+	// После паники задачу можно запустить снова
+	_, err = scheduler.Trigger(ctx, "panics")
+	assert.NoError(t, err)
+}
+
+func TestSchedulerService_RegisterValidatesSchedule(t *testing.T) {
+	scheduler := NewSchedulerService(newFakeJobRunRepository(), nil)
+	noop := func(ctx context.Context) error { return nil }
+
+	assert.Error(t, scheduler.Register(Job{Name: "bad", Schedule: "every hour", Run: noop}))
+	require.NoError(t, scheduler.Register(Job{Name: "hourly", Schedule: "@every 1h", Run: noop}))
+	assert.Error(t, scheduler.Register(Job{Name: "hourly", Schedule: "@daily", Run: noop}))
+}
+
+// fakeLeadership позволяет переключать лидерство в тесте
+type fakeLeadership struct {
+	mu    sync.Mutex
+	token int64
+	// current - токен действующей аренды в БД; отличается от token, если лидерство
+	// перехватила другая реплика, а эта еще не заметила
+	current int64
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func (l *fakeLeadership) Lease() (int64, context.Context, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ctx == nil {
+		return 0, nil, false
+	}
+	return l.token, l.ctx, true
+}
+
+func (l *fakeLeadership) acquire(token int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.token = token
+	l.current = token
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+}
+
+func (l *fakeLeadership) Validate(ctx context.Context, token int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ctx == nil || token != l.current {
+		return leader.ErrNotLeader
+	}
+	return nil
+}
+
+// takeOver имитирует захват аренды другой репликой, о котором эта реплика еще не узнала
+func (l *fakeLeadership) takeOver() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.current = l.token + 1
+}
+
+func (l *fakeLeadership) lose() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cancel()
+	l.ctx = nil
+}
+
+func TestSchedulerService_ScheduledRunsRequireLeadership(t *testing.T) {
+	repo := newFakeJobRunRepository()
+	leadership := &fakeLeadership{}
+	scheduler := NewSchedulerService(repo, leadership).(*schedulerService)
+	ctx := context.Background()
+
+	started := make(chan struct{}, 1)
+	require.NoError(t, scheduler.Register(Job{
+		Name: "sync",
+		Run: func(ctx context.Context) error {
+			started <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}))
+	scheduler.Start(ctx)
+	t.Cleanup(scheduler.Stop)
+
+	// Реплика не лидер - запуск по расписанию пропускается
+	_, err := scheduler.launch("sync", domain.JobTriggerSchedule)
+	assert.ErrorIs(t, err, errNotLeader)
+
+	leadership.acquire(7)
+	run, err := scheduler.launch("sync", domain.JobTriggerSchedule)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), run.FencingToken)
+	<-started
+
+	// Потеря лидерства прерывает выполняющуюся задачу
+	leadership.lose()
+	result := waitForRun(t, repo, run.ID)
+	assert.Equal(t, domain.JobRunStatusFailed, result.Status)
+	assert.Contains(t, result.Error, "leadership lost")
+}
+
+func TestSchedulerService_StaleFencingTokenFailsRun(t *testing.T) {
+	repo := newFakeJobRunRepository()
+	leadership := &fakeLeadership{}
+	scheduler := NewSchedulerService(repo, leadership).(*schedulerService)
+	ctx := context.Background()
+
+	release := make(chan struct{}, 1)
+	require.NoError(t, scheduler.Register(Job{
+		Name: "sync",
+		Run: func(ctx context.Context) error {
+			<-release
+			return nil
+		},
+	}))
+	scheduler.Start(ctx)
+	t.Cleanup(scheduler.Stop)
+
+	leadership.acquire(7)
+	run, err := scheduler.launch("sync", domain.JobTriggerSchedule)
+	require.NoError(t, err)
+	release <- struct{}{}
+	result := waitForRun(t, repo, run.ID)
+	assert.Equal(t, domain.JobRunStatusSucceeded, result.Status)
+
+	// Пока задача выполнялась, аренду перехватила другая реплика: результат с устаревшим токеном не засчитывается
+	require.Eventually(t, func() bool {
+		run, err = scheduler.launch("sync", domain.JobTriggerSchedule)
+		return err == nil
+	}, 2*time.Second, 5*time.Millisecond)
+	leadership.takeOver()
+	release <- struct{}{}
+	result = waitForRun(t, repo, run.ID)
+	assert.Equal(t, domain.JobRunStatusFailed, result.Status)
+	assert.Contains(t, result.Error, "fencing token 7 is stale")
+}
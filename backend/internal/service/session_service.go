@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/repository"
+	"oneui-hub/pkg/auth"
+)
+
+// inactiveSessionRetention - сколько хранятся истекшие и отозванные сессии, чтобы их было видно в истории
+const inactiveSessionRetention = 7 * 24 * time.Hour
+
+var (
+	// ErrInvalidRefreshToken - refresh токен неизвестен, истек или его сессия отозвана
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused - предъявлен уже использованный refresh токен; сессия отозвана
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// SessionMetadata - устройство, с которого выполнен вход или продление
+type SessionMetadata struct {
+	UserAgent string
+	IPAddress string
+}
+
+// AuthTokens - пара токенов сессии
+type AuthTokens struct {
+	SessionID    string `json:"session_id"`
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresAt - срок действия access токена
+	ExpiresAt time.Time `json:"expires_at"`
+	// RefreshExpiresAt - срок действия refresh токена
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// SessionService выдает access и refresh токены и ведет сессии пользователей.
+// Refresh токен меняется при каждом продлении; повторное предъявление использованного токена
+// означает его кражу, и сессия отзывается целиком
+type SessionService interface {
+	StartSession(ctx context.Context, user *domain.User, meta SessionMetadata) (*AuthTokens, error)
+	// Refresh обменивает refresh токен на новую пару токенов
+	Refresh(ctx context.Context, refreshToken string, meta SessionMetadata) (*AuthTokens, error)
+	// IsSessionActive проверяет, что сессия access токена не отозвана
+	IsSessionActive(ctx context.Context, sessionID string) (bool, error)
+	ListSessions(ctx context.Context, userID string) ([]*domain.Session, error)
+	// RevokeSession завершает сессию пользователя; чужая сессия - ErrNotFound
+	RevokeSession(ctx context.Context, userID, sessionID, reason string) error
+	// RevokeAllSessions завершает все сессии пользователя (выход на всех устройствах)
+	RevokeAllSessions(ctx context.Context, userID string) (int64, error)
+	// CleanupSessions удаляет давно истекшие и отозванные сессии
+	CleanupSessions(ctx context.Context) error
+}
+
+type sessionService struct {
+	sessionRepo repository.SessionRepository
+	userRepo    repository.UserRepository
+	jwtManager  *auth.JWTManager
+	refreshTTL  time.Duration
+	now         func() time.Time
+}
+
+func NewSessionService(
+	sessionRepo repository.SessionRepository,
+	userRepo repository.UserRepository,
+	jwtManager *auth.JWTManager,
+	refreshTTL time.Duration,
+) SessionService {
+	return &sessionService{
+		sessionRepo: sessionRepo,
+		userRepo:    userRepo,
+		jwtManager:  jwtManager,
+		refreshTTL:  refreshTTL,
+		now:         time.Now,
+	}
+}
+
+func (s *sessionService) StartSession(ctx context.Context, user *domain.User, meta SessionMetadata) (*AuthTokens, error) {
+	refreshToken, token, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	session := &domain.Session{
+		ID:         uuid.New().String(),
+		UserID:     user.ID,
+		UserAgent:  truncate(meta.UserAgent, 512),
+		IPAddress:  truncate(meta.IPAddress, 45),
+		ExpiresAt:  now.Add(s.refreshTTL),
+		LastUsedAt: now,
+		CreatedAt:  now,
+	}
+	if err := s.sessionRepo.Create(ctx, session, token); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(user, session, refreshToken, now)
+}
+
+func (s *sessionService) Refresh(ctx context.Context, refreshToken string, meta SessionMetadata) (*AuthTokens, error) {
+	tokenHash := hashRefreshToken(refreshToken)
+	stored, err := s.sessionRepo.GetRefreshToken(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	session, err := s.sessionRepo.GetByID(ctx, stored.SessionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	now := s.now()
+	if stored.UsedAt != nil {
+		return nil, s.revokeReused(ctx, session, now)
+	}
+	if !session.IsActive(now) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, session.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	nextToken, next, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	session.ExpiresAt = now.Add(s.refreshTTL)
+	session.LastUsedAt = now
+	if meta.UserAgent != "" {
+		session.UserAgent = truncate(meta.UserAgent, 512)
+	}
+	if meta.IPAddress != "" {
+		session.IPAddress = truncate(meta.IPAddress, 45)
+	}
+
+	if err := s.sessionRepo.Rotate(ctx, tokenHash, next, session, now); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRefreshTokenUsed):
+			// Токен успели использовать между чтением и обменом
+			return nil, s.revokeReused(ctx, session, now)
+		case errors.Is(err, repository.ErrNotFound):
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	return s.issueTokens(user, session, nextToken, now)
+}
+
+// revokeReused отзывает сессию, в которой повторно предъявлен refresh токен
+func (s *sessionService) revokeReused(ctx context.Context, session *domain.Session, now time.Time) error {
+	if err := s.sessionRepo.Revoke(ctx, session.ID, domain.SessionRevokedTokenReuse, now); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	fmt.Printf("Warning: refresh token reuse detected, session %s of user %s revoked\n", session.ID, session.UserID)
+	return ErrRefreshTokenReused
+}
+
+func (s *sessionService) issueTokens(user *domain.User, session *domain.Session, refreshToken string, now time.Time) (*AuthTokens, error) {
+	accessToken, err := s.jwtManager.GenerateSessionToken(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthTokens{
+		SessionID:        session.ID,
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresAt:        now.Add(s.jwtManager.TokenDuration()),
+		RefreshExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+func (s *sessionService) IsSessionActive(ctx context.Context, sessionID string) (bool, error) {
+	session, err := s.sessionRepo.GetByID(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return session.IsActive(s.now()), nil
+}
+
+func (s *sessionService) ListSessions(ctx context.Context, userID string) ([]*domain.Session, error) {
+	return s.sessionRepo.ListActiveByUserID(ctx, userID, s.now())
+}
+
+func (s *sessionService) RevokeSession(ctx context.Context, userID, sessionID, reason string) error {
+	session, err := s.sessionRepo.GetByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return repository.ErrNotFound
+	}
+	return s.sessionRepo.Revoke(ctx, session.ID, reason, s.now())
+}
+
+func (s *sessionService) RevokeAllSessions(ctx context.Context, userID string) (int64, error) {
+	return s.sessionRepo.RevokeAllByUserID(ctx, userID, domain.SessionRevokedByUser, s.now())
+}
+
+func (s *sessionService) CleanupSessions(ctx context.Context) error {
+	deleted, err := s.sessionRepo.DeleteInactive(ctx, s.now().Add(-inactiveSessionRetention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		fmt.Printf("Deleted %d inactive sessions\n", deleted)
+	}
+	return nil
+}
+
+// newRefreshToken создает непрозрачный refresh токен и запись с его хешем
+func newRefreshToken() (string, *domain.RefreshToken, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, &domain.RefreshToken{TokenHash: hashRefreshToken(token)}, nil
+}
+
+func hashRefreshToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+func truncate(value string, limit int) string {
+	if len(value) > limit {
+		return value[:limit]
+	}
+	return value
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/repository"
+	"oneui-hub/pkg/auth"
+)
+
+// fakeSessionRepository хранит сессии и refresh токены в памяти
+type fakeSessionRepository struct {
+	mu       sync.Mutex
+	sessions map[string]*domain.Session
+	tokens   map[string]*domain.RefreshToken
+}
+
+func newFakeSessionRepository() *fakeSessionRepository {
+	return &fakeSessionRepository{sessions: map[string]*domain.Session{}, tokens: map[string]*domain.RefreshToken{}}
+}
+
+func (r *fakeSessionRepository) Create(ctx context.Context, session *domain.Session, token *domain.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *session
+	r.sessions[session.ID] = &copied
+	token.SessionID = session.ID
+	copiedToken := *token
+	r.tokens[token.TokenHash] = &copiedToken
+	return nil
+}
+
+func (r *fakeSessionRepository) GetByID(ctx context.Context, id string) (*domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (r *fakeSessionRepository) ListActiveByUserID(ctx context.Context, userID string, now time.Time) ([]*domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var sessions []*domain.Session
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.IsActive(now) {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *fakeSessionRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *token
+	return &copied, nil
+}
+
+func (r *fakeSessionRepository) Rotate(ctx context.Context, usedHash string, next *domain.RefreshToken, session *domain.Session, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	used := r.tokens[usedHash]
+	if used.UsedAt != nil {
+		return repository.ErrRefreshTokenUsed
+	}
+	stored := r.sessions[session.ID]
+	if stored.RevokedAt != nil {
+		return repository.ErrNotFound
+	}
+	used.UsedAt = &now
+	stored.ExpiresAt = session.ExpiresAt
+	stored.LastUsedAt = now
+	next.SessionID = session.ID
+	copied := *next
+	r.tokens[next.TokenHash] = &copied
+	return nil
+}
+
+func (r *fakeSessionRepository) Revoke(ctx context.Context, id, reason string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[id]
+	if !ok || session.RevokedAt != nil {
+		return repository.ErrNotFound
+	}
+	session.RevokedAt = &now
+	session.RevokeReason = reason
+	return nil
+}
+
+func (r *fakeSessionRepository) RevokeAllByUserID(ctx context.Context, userID, reason string, now time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var revoked int64
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+			session.RevokeReason = reason
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func (r *fakeSessionRepository) DeleteInactive(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestSessionService_RotationAndReuse(t *testing.T) {
+	sessionRepo := newFakeSessionRepository()
+	user := &domain.User{ID: "user-1", Email: "user@example.com", Role: domain.RoleCustomer}
+	userRepo := &MockUserRepository{}
+	userRepo.On("GetByID", mock.Anything, "user-1").Return(user, nil)
+
+	jwtManager := auth.NewJWTManager("test-secret", 15*time.Minute)
+	now := time.Now()
+	svc := NewSessionService(sessionRepo, userRepo, jwtManager, 24*time.Hour).(*sessionService)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	tokens, err := svc.StartSession(ctx, user, SessionMetadata{UserAgent: "curl/8.0", IPAddress: "10.0.0.1"})
+	require.NoError(t, err)
+	claims, err := jwtManager.ValidateToken(tokens.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, tokens.SessionID, claims.SessionID)
+
+	// Refresh токен хранится только в виде хеша
+	_, err = sessionRepo.GetRefreshToken(ctx, tokens.RefreshToken)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	now = now.Add(10 * time.Minute)
+	rotated, err := svc.Refresh(ctx, tokens.RefreshToken, SessionMetadata{IPAddress: "10.0.0.2"})
+	require.NoError(t, err)
+	assert.Equal(t, tokens.SessionID, rotated.SessionID)
+	assert.NotEqual(t, tokens.RefreshToken, rotated.RefreshToken)
+	assert.Equal(t, now.Add(24*time.Hour), rotated.RefreshExpiresAt)
+
+	_, err = svc.Refresh(ctx, "unknown", SessionMetadata{})
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	// Повторное предъявление старого токена отзывает сессию вместе с новым токеном
+	_, err = svc.Refresh(ctx, tokens.RefreshToken, SessionMetadata{})
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	active, err := svc.IsSessionActive(ctx, tokens.SessionID)
+	require.NoError(t, err)
+	assert.False(t, active)
+	session, err := sessionRepo.GetByID(ctx, tokens.SessionID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.SessionRevokedTokenReuse, session.RevokeReason)
+
+	_, err = svc.Refresh(ctx, rotated.RefreshToken, SessionMetadata{})
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestSessionService_Revoke(t *testing.T) {
+	sessionRepo := newFakeSessionRepository()
+	svc := NewSessionService(sessionRepo, &MockUserRepository{}, auth.NewJWTManager("test-secret", time.Minute), time.Hour)
+	ctx := context.Background()
+
+	first, err := svc.StartSession(ctx, &domain.User{ID: "user-1"}, SessionMetadata{})
+	require.NoError(t, err)
+	_, err = svc.StartSession(ctx, &domain.User{ID: "user-1"}, SessionMetadata{})
+	require.NoError(t, err)
+	other, err := svc.StartSession(ctx, &domain.User{ID: "user-2"}, SessionMetadata{})
+	require.NoError(t, err)
+
+	// Чужую сессию завершить нельзя
+	assert.ErrorIs(t, svc.RevokeSession(ctx, "user-1", other.SessionID, domain.SessionRevokedByUser), repository.ErrNotFound)
+	require.NoError(t, svc.RevokeSession(ctx, "user-1", first.SessionID, domain.SessionRevokedByUser))
+
+	sessions, err := svc.ListSessions(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1)
+
+	revoked, err := svc.RevokeAllSessions(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), revoked)
+	active, err := svc.IsSessionActive(ctx, other.SessionID)
+	require.NoError(t, err)
+	assert.True(t, active)
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/repository"
+	"oneui-hub/pkg/auth"
+)
+
+const (
+	// signingKeyReloadInterval - как часто реплика перечитывает ключи, созданные другими репликами
+	signingKeyReloadInterval = time.Minute
+	// signingKeyMissReloadInterval - минимальный интервал перечитывания при токене с незнакомым kid
+	signingKeyMissReloadInterval = 5 * time.Second
+	// signingKeyRetirementLeeway - запас на расхождение часов при удалении выведенного ключа
+	signingKeyRetirementLeeway = 5 * time.Minute
+)
+
+// SigningKeyService хранит ключи подписи JWT в БД и меняет их по расписанию.
+// Новый ключ сначала публикуется в JWKS и начинает подписывать токены через activationDelay;
+// прежний ключ остается в JWKS, пока не истекут подписанные им токены
+type SigningKeyService interface {
+	auth.KeyStore
+	// RotateKeys создает первый ключ, выпускает новый по истечении rotationInterval
+	// и удаляет ключи, которыми не подписан ни один действующий токен
+	RotateKeys(ctx context.Context) error
+	// PublicKeys возвращает открытые части всех опубликованных ключей
+	PublicKeys(ctx context.Context) ([]auth.JWK, error)
+}
+
+type signingKeyService struct {
+	keyRepo          repository.SigningKeyRepository
+	algorithm        string
+	rotationInterval time.Duration
+	activationDelay  time.Duration
+	tokenDuration    time.Duration
+	now              func() time.Time
+
+	mu       sync.RWMutex
+	keys     []*auth.SigningKey
+	loadedAt time.Time
+}
+
+func NewSigningKeyService(
+	keyRepo repository.SigningKeyRepository,
+	algorithm string,
+	rotationInterval time.Duration,
+	activationDelay time.Duration,
+	tokenDuration time.Duration,
+) SigningKeyService {
+	return &signingKeyService{
+		keyRepo:          keyRepo,
+		algorithm:        algorithm,
+		rotationInterval: rotationInterval,
+		activationDelay:  activationDelay,
+		tokenDuration:    tokenDuration,
+		now:              time.Now,
+	}
+}
+
+func (s *signingKeyService) SigningKey() (*auth.SigningKey, error) {
+	if err := s.reloadIfStale(context.Background(), signingKeyReloadInterval); err != nil {
+		return nil, err
+	}
+
+	if key := s.currentKey(s.snapshot(), s.now()); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("no active %s signing key", s.algorithm)
+}
+
+func (s *signingKeyService) VerificationKey(kid string) (*auth.SigningKey, error) {
+	if err := s.reloadIfStale(context.Background(), signingKeyReloadInterval); err != nil {
+		return nil, err
+	}
+	if key := findSigningKey(s.snapshot(), kid); key != nil {
+		return key, nil
+	}
+
+	// Ключ могла только что выпустить другая реплика
+	if err := s.reloadIfStale(context.Background(), signingKeyMissReloadInterval); err != nil {
+		return nil, err
+	}
+	if key := findSigningKey(s.snapshot(), kid); key != nil {
+		return key, nil
+	}
+	return nil, auth.ErrUnknownSigningKey
+}
+
+func (s *signingKeyService) RotateKeys(ctx context.Context) error {
+	keys, err := s.loadKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	current := s.currentKey(keys, now)
+	var newest *auth.SigningKey
+	for _, key := range keys {
+		if key.Algorithm == s.algorithm {
+			newest = key
+		}
+	}
+
+	switch {
+	case newest == nil:
+		// Первый ключ (или смена алгоритма) начинает подписывать сразу
+		if current, err = s.createKey(ctx, now); err != nil {
+			return err
+		}
+		fmt.Printf("Created %s signing key %s\n", s.algorithm, current.ID)
+	case !newest.ActivatesAt.Add(s.rotationInterval).After(now):
+		key, err := s.createKey(ctx, now.Add(s.activationDelay))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created %s signing key %s, active from %s\n", s.algorithm, key.ID, key.ActivatesAt.UTC().Format(time.RFC3339))
+	}
+
+	// Ключи старше текущего подписывали токены не позже его активации
+	if current != nil {
+		retiredBefore := now.Add(-s.tokenDuration - signingKeyRetirementLeeway)
+		for _, key := range keys {
+			if key.ActivatesAt.Before(current.ActivatesAt) && current.ActivatesAt.Before(retiredBefore) {
+				if err := s.keyRepo.Delete(ctx, key.ID); err != nil {
+					return err
+				}
+				fmt.Printf("Deleted retired signing key %s\n", key.ID)
+			}
+		}
+	}
+
+	_, err = s.reload(ctx)
+	return err
+}
+
+func (s *signingKeyService) PublicKeys(ctx context.Context) ([]auth.JWK, error) {
+	if err := s.reloadIfStale(ctx, signingKeyReloadInterval); err != nil {
+		return nil, err
+	}
+
+	keys := s.snapshot()
+	jwks := make([]auth.JWK, 0, len(keys))
+	for _, key := range keys {
+		jwks = append(jwks, key.JWK())
+	}
+	return jwks, nil
+}
+
+// currentKey возвращает последний активированный ключ настроенного алгоритма
+func (s *signingKeyService) currentKey(keys []*auth.SigningKey, now time.Time) *auth.SigningKey {
+	var current *auth.SigningKey
+	for _, key := range keys {
+		if key.Algorithm == s.algorithm && !key.ActivatesAt.After(now) {
+			current = key
+		}
+	}
+	return current
+}
+
+func (s *signingKeyService) createKey(ctx context.Context, activatesAt time.Time) (*auth.SigningKey, error) {
+	key, err := auth.GenerateSigningKey(s.algorithm, activatesAt)
+	if err != nil {
+		return nil, err
+	}
+
+	privatePEM, err := key.MarshalPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	// Шифруем тем же ключом ENCRYPTION_KEY, что и API ключи
+	encrypted, err := auth.EncryptAPIKey(privatePEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt signing key: %w", err)
+	}
+
+	if err := s.keyRepo.Create(ctx, &domain.JWTSigningKey{
+		ID:          key.ID,
+		Algorithm:   key.Algorithm,
+		PrivateKey:  encrypted,
+		ActivatesAt: activatesAt,
+	}); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// loadKeys читает и расшифровывает все ключи в порядке активации
+func (s *signingKeyService) loadKeys(ctx context.Context) ([]*auth.SigningKey, error) {
+	stored, err := s.keyRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*auth.SigningKey, 0, len(stored))
+	for _, record := range stored {
+		privatePEM, err := auth.DecryptAPIKey(record.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt signing key %s: %w", record.ID, err)
+		}
+		key, err := auth.ParseSigningKey(record.ID, record.Algorithm, privatePEM, record.ActivatesAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing key %s: %w", record.ID, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *signingKeyService) reload(ctx context.Context) ([]*auth.SigningKey, error) {
+	keys, err := s.loadKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.loadedAt = s.now()
+	s.mu.Unlock()
+	return keys, nil
+}
+
+// reloadIfStale перечитывает ключи, если они загружены раньше maxAge назад.
+// При ошибке БД продолжаем работать с уже загруженными ключами
+func (s *signingKeyService) reloadIfStale(ctx context.Context, maxAge time.Duration) error {
+	s.mu.RLock()
+	loaded := len(s.keys) > 0
+	fresh := s.now().Sub(s.loadedAt) < maxAge
+	s.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	if _, err := s.reload(ctx); err != nil {
+		if loaded {
+			fmt.Printf("Warning: failed to reload signing keys: %v\n", err)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *signingKeyService) snapshot() []*auth.SigningKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys
+}
+
+func findSigningKey(keys []*auth.SigningKey, kid string) *auth.SigningKey {
+	for _, key := range keys {
+		if key.ID == kid {
+			return key
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/pkg/auth"
+)
+
+// fakeSigningKeyRepository хранит ключи подписи в памяти
+type fakeSigningKeyRepository struct {
+	mu   sync.Mutex
+	keys map[string]*domain.JWTSigningKey
+}
+
+func (r *fakeSigningKeyRepository) Create(ctx context.Context, key *domain.JWTSigningKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *key
+	r.keys[key.ID] = &copied
+	return nil
+}
+
+func (r *fakeSigningKeyRepository) List(ctx context.Context) ([]*domain.JWTSigningKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []*domain.JWTSigningKey
+	for _, key := range r.keys {
+		copied := *key
+		keys = append(keys, &copied)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ActivatesAt.Before(keys[j].ActivatesAt) })
+	return keys, nil
+}
+
+func (r *fakeSigningKeyRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.keys, id)
+	return nil
+}
+
+func TestSigningKeyService_RotateKeys(t *testing.T) {
+	repo := &fakeSigningKeyRepository{keys: map[string]*domain.JWTSigningKey{}}
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	svc := NewSigningKeyService(repo, auth.AlgorithmEdDSA, 30*24*time.Hour, time.Hour, 15*time.Minute).(*signingKeyService)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// Первый ключ подписывает сразу
+	require.NoError(t, svc.RotateKeys(ctx))
+	first, err := svc.SigningKey()
+	require.NoError(t, err)
+	assert.Equal(t, auth.AlgorithmEdDSA, first.Algorithm)
+	assert.NotContains(t, repo.keys[first.ID].PrivateKey, "PRIVATE KEY", "ключ хранится зашифрованным")
+
+	jwtManager := auth.NewKeyStoreJWTManager(svc, 15*time.Minute)
+	oldToken, err := jwtManager.GenerateToken(&domain.User{ID: "user-1", Email: "user@example.com", Role: "user"})
+	require.NoError(t, err)
+
+	// До конца интервала ротации новых ключей нет
+	now = now.Add(29 * 24 * time.Hour)
+	require.NoError(t, svc.RotateKeys(ctx))
+	assert.Len(t, repo.keys, 1)
+
+	// Новый ключ сначала только публикуется
+	now = now.Add(24 * time.Hour)
+	require.NoError(t, svc.RotateKeys(ctx))
+	require.Len(t, repo.keys, 2)
+	published, err := svc.PublicKeys(ctx)
+	require.NoError(t, err)
+	assert.Len(t, published, 2)
+	current, err := svc.SigningKey()
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, current.ID)
+
+	now = now.Add(time.Hour)
+	current, err = svc.SigningKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, current.ID)
+
+	// Прежний ключ проверяет старые токены, пока они могут действовать
+	require.NoError(t, svc.RotateKeys(ctx))
+	assert.Len(t, repo.keys, 2)
+	_, err = svc.VerificationKey(first.ID)
+	require.NoError(t, err)
+
+	now = now.Add(15*time.Minute + signingKeyRetirementLeeway + time.Second)
+	require.NoError(t, svc.RotateKeys(ctx))
+	assert.Len(t, repo.keys, 1)
+	_, err = svc.VerificationKey(first.ID)
+	assert.ErrorIs(t, err, auth.ErrUnknownSigningKey)
+	_, err = jwtManager.ValidateToken(oldToken)
+	assert.Error(t, err)
+}
+
+func TestSigningKeyService_SharedKeys(t *testing.T) {
+	repo := &fakeSigningKeyRepository{keys: map[string]*domain.JWTSigningKey{}}
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	issuer := NewSigningKeyService(repo, auth.AlgorithmRS256, 30*24*time.Hour, time.Hour, 15*time.Minute).(*signingKeyService)
+	issuer.now = clock
+	verifier := NewSigningKeyService(repo, auth.AlgorithmRS256, 30*24*time.Hour, time.Hour, 15*time.Minute).(*signingKeyService)
+	verifier.now = clock
+	ctx := context.Background()
+
+	// Вторая реплика уже загрузила ключи, когда первая выпустила новый
+	require.NoError(t, issuer.RotateKeys(ctx))
+	_, err := verifier.PublicKeys(ctx)
+	require.NoError(t, err)
+
+	now = now.Add(30 * 24 * time.Hour)
+	require.NoError(t, issuer.RotateKeys(ctx))
+	now = now.Add(time.Hour)
+	token, err := auth.NewKeyStoreJWTManager(issuer, 15*time.Minute).GenerateToken(&domain.User{ID: "user-1", Email: "user@example.com", Role: "user"})
+	require.NoError(t, err)
+
+	claims, err := auth.NewKeyStoreJWTManager(verifier, 15*time.Minute).ValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.UserID)
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/litellm"
+	"oneui-hub/internal/mail"
+	"oneui-hub/internal/repository"
+	"oneui-hub/pkg/auth"
+)
+
+// teamInvitationTokenPurpose - назначение подписанных токенов приглашений
+const teamInvitationTokenPurpose = "team_invitation"
+
+// ErrInvalidInvitation - токен приглашения поддельный или истек, приглашение уже принято,
+// отозвано или выписано на другой email
+var ErrInvalidInvitation = errors.New("invalid invitation")
+
+// InviteTeamMemberRequest - приглашение по email с заранее назначенной ролью
+type InviteTeamMemberRequest struct {
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	InvitedBy string `json:"-"`
+}
+
+// TeamInvitationService приглашает пользователей в команды по email.
+// Письмо содержит ссылку с подписанным токеном; новый пользователь принимает приглашение
+// при регистрации, существующий - из профиля или по ссылке
+type TeamInvitationService interface {
+	Invite(ctx context.Context, teamID string, req *InviteTeamMemberRequest) (*domain.TeamInvitation, error)
+	// ListPending возвращает приглашения команды, которые еще можно принять
+	ListPending(ctx context.Context, teamID string) ([]*domain.TeamInvitation, error)
+	Revoke(ctx context.Context, teamID, invitationID string) error
+
+	// ValidateToken возвращает приглашение по токену, если его еще можно принять
+	ValidateToken(ctx context.Context, token string) (*domain.TeamInvitation, error)
+	// AcceptToken и AcceptInvitation добавляют пользователя в команду.
+	// Email пользователя должен совпадать с email приглашения
+	AcceptToken(ctx context.Context, token, userID string) (*domain.TeamMember, error)
+	AcceptInvitation(ctx context.Context, invitationID, userID string) (*domain.TeamMember, error)
+	// ListUserInvitations возвращает действующие приглашения на email пользователя
+	ListUserInvitations(ctx context.Context, userID string) ([]*domain.TeamInvitation, error)
+}
+
+type teamInvitationService struct {
+	invitationRepo repository.TeamInvitationRepository
+	teamRepo       repository.TeamRepository
+	userRepo       repository.UserRepository
+	sender         mail.Sender
+	litellmClient  *litellm.Client
+	secret         string
+	ttl            time.Duration
+	acceptURL      string
+	now            func() time.Time
+}
+
+func NewTeamInvitationService(
+	invitationRepo repository.TeamInvitationRepository,
+	teamRepo repository.TeamRepository,
+	userRepo repository.UserRepository,
+	sender mail.Sender,
+	litellmClient *litellm.Client,
+	secret string,
+	ttl time.Duration,
+	acceptURL string,
+) TeamInvitationService {
+	return &teamInvitationService{
+		invitationRepo: invitationRepo,
+		teamRepo:       teamRepo,
+		userRepo:       userRepo,
+		sender:         sender,
+		litellmClient:  litellmClient,
+		secret:         secret,
+		ttl:            ttl,
+		acceptURL:      acceptURL,
+		now:            time.Now,
+	}
+}
+
+func (s *teamInvitationService) Invite(ctx context.Context, teamID string, req *InviteTeamMemberRequest) (*domain.TeamInvitation, error) {
+	if !domain.ValidTeamRole(req.Role) {
+		return nil, fmt.Errorf("%w: role must be owner, admin, member or billing", ErrInvalidTeamRequest)
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email == "" || !strings.Contains(email, "@") {
+		return nil, fmt.Errorf("%w: valid email is required", ErrInvalidTeamRequest)
+	}
+
+	team, err := s.teamRepo.GetByID(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Участника команды приглашать не нужно
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if user != nil {
+		if _, err := s.teamRepo.GetMember(ctx, teamID, user.ID); err == nil {
+			return nil, fmt.Errorf("%w: user is already a team member", ErrInvalidTeamRequest)
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	now := s.now()
+	invitation := &domain.TeamInvitation{
+		ID:        uuid.New().String(),
+		TeamID:    teamID,
+		Email:     email,
+		Role:      req.Role,
+		InvitedBy: req.InvitedBy,
+		ExpiresAt: now.Add(s.ttl),
+		CreatedAt: now,
+	}
+	if err := s.invitationRepo.Create(ctx, invitation); err != nil {
+		return nil, err
+	}
+
+	// Без письма приглашение бесполезно: отзываем его, чтобы не висело в списке
+	if err := s.sendInvitation(ctx, team, invitation); err != nil {
+		if revokeErr := s.invitationRepo.Revoke(ctx, invitation.ID, now); revokeErr != nil {
+			fmt.Printf("Warning: failed to revoke unsent invitation %s: %v\n", invitation.ID, revokeErr)
+		}
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+func (s *teamInvitationService) sendInvitation(ctx context.Context, team *domain.Team, invitation *domain.TeamInvitation) error {
+	token := auth.SignToken(s.secret, teamInvitationTokenPurpose, invitation.ID, invitation.ExpiresAt)
+	link := tokenLink(s.acceptURL, token)
+
+	return s.sender.Send(ctx, &mail.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("Приглашение в команду %s", team.Name),
+		Text: fmt.Sprintf("Вас пригласили в команду %s с ролью %s.\n\n"+
+			"Чтобы принять приглашение, перейдите по ссылке:\n%s\n\n"+
+			"Если у вас еще нет аккаунта, зарегистрируйтесь по этой ссылке на этот email.\n"+
+			"Приглашение действует до %s.\n",
+			team.Name, invitation.Role, link, invitation.ExpiresAt.UTC().Format("2006-01-02 15:04 UTC")),
+	})
+}
+
+// tokenLink добавляет токен к адресу страницы фронтенда параметром token
+func tokenLink(pageURL, token string) string {
+	if strings.Contains(pageURL, "?") {
+		return pageURL + "&token=" + url.QueryEscape(token)
+	}
+	return pageURL + "?token=" + url.QueryEscape(token)
+}
+
+func (s *teamInvitationService) ListPending(ctx context.Context, teamID string) ([]*domain.TeamInvitation, error) {
+	return s.invitationRepo.ListPendingByTeam(ctx, teamID, s.now())
+}
+
+func (s *teamInvitationService) Revoke(ctx context.Context, teamID, invitationID string) error {
+	invitation, err := s.invitationRepo.GetByID(ctx, invitationID)
+	if err != nil {
+		return err
+	}
+	if invitation.TeamID != teamID {
+		return repository.ErrNotFound
+	}
+
+	if err := s.invitationRepo.Revoke(ctx, invitation.ID, s.now()); err != nil {
+		if errors.Is(err, repository.ErrInvitationNotPending) {
+			return fmt.Errorf("%w: %v", ErrInvalidInvitation, err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *teamInvitationService) ValidateToken(ctx context.Context, token string) (*domain.TeamInvitation, error) {
+	invitationID, err := auth.VerifySignedToken(s.secret, teamInvitationTokenPurpose, token, s.now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInvitation, err)
+	}
+
+	invitation, err := s.invitationRepo.GetByID(ctx, invitationID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("%w: invitation not found", ErrInvalidInvitation)
+		}
+		return nil, err
+	}
+	if !invitation.IsPending(s.now()) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInvitation, repository.ErrInvitationNotPending)
+	}
+	return invitation, nil
+}
+
+func (s *teamInvitationService) AcceptToken(ctx context.Context, token, userID string) (*domain.TeamMember, error) {
+	invitation, err := s.ValidateToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.accept(ctx, invitation, userID)
+}
+
+func (s *teamInvitationService) AcceptInvitation(ctx context.Context, invitationID, userID string) (*domain.TeamMember, error) {
+	invitation, err := s.invitationRepo.GetByID(ctx, invitationID)
+	if err != nil {
+		return nil, err
+	}
+	return s.accept(ctx, invitation, userID)
+}
+
+func (s *teamInvitationService) accept(ctx context.Context, invitation *domain.TeamInvitation, userID string) (*domain.TeamMember, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		return nil, fmt.Errorf("%w: invitation was sent to another email", ErrInvalidInvitation)
+	}
+
+	member := &domain.TeamMember{
+		TeamID: invitation.TeamID,
+		UserID: user.ID,
+		Role:   invitation.Role,
+	}
+	if err := s.invitationRepo.Accept(ctx, invitation.ID, member, s.now()); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrInvitationNotPending):
+			return nil, fmt.Errorf("%w: %v", ErrInvalidInvitation, err)
+		case errors.Is(err, repository.ErrDuplicate):
+			return nil, fmt.Errorf("%w: user is already a team member", ErrInvalidInvitation)
+		}
+		return nil, err
+	}
+
+	if s.litellmClient != nil {
+		if err := s.litellmClient.AddTeamMember(ctx, member.TeamID, litellm.LiteLLMTeamMember{UserID: user.ID, Role: member.LiteLLMRole()}); err != nil {
+			fmt.Printf("Warning: failed to add user %s to team %s in LiteLLM: %v\n", user.ID, member.TeamID, err)
+		}
+	}
+
+	return member, nil
+}
+
+func (s *teamInvitationService) ListUserInvitations(ctx context.Context, userID string) ([]*domain.TeamInvitation, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.invitationRepo.ListPendingByEmail(ctx, user.Email, s.now())
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/mail"
+	"oneui-hub/internal/repository"
+)
+
+// fakeTeamInvitationRepository хранит приглашения в памяти и добавляет участников в fakeTeamRepository
+type fakeTeamInvitationRepository struct {
+	mu          sync.Mutex
+	invitations map[string]*domain.TeamInvitation
+	teams       *fakeTeamRepository
+}
+
+func (r *fakeTeamInvitationRepository) Create(ctx context.Context, invitation *domain.TeamInvitation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, other := range r.invitations {
+		if other.TeamID == invitation.TeamID && other.Email == invitation.Email && other.IsPending(invitation.CreatedAt) {
+			revokedAt := invitation.CreatedAt
+			other.RevokedAt = &revokedAt
+		}
+	}
+	copied := *invitation
+	r.invitations[invitation.ID] = &copied
+	return nil
+}
+
+func (r *fakeTeamInvitationRepository) GetByID(ctx context.Context, id string) (*domain.TeamInvitation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	invitation, ok := r.invitations[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *invitation
+	return &copied, nil
+}
+
+func (r *fakeTeamInvitationRepository) ListPendingByTeam(ctx context.Context, teamID string, now time.Time) ([]*domain.TeamInvitation, error) {
+	return r.list(func(i *domain.TeamInvitation) bool { return i.TeamID == teamID && i.IsPending(now) }), nil
+}
+
+func (r *fakeTeamInvitationRepository) ListPendingByEmail(ctx context.Context, email string, now time.Time) ([]*domain.TeamInvitation, error) {
+	return r.list(func(i *domain.TeamInvitation) bool { return i.Email == strings.ToLower(email) && i.IsPending(now) }), nil
+}
+
+func (r *fakeTeamInvitationRepository) list(match func(i *domain.TeamInvitation) bool) []*domain.TeamInvitation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var invitations []*domain.TeamInvitation
+	for _, invitation := range r.invitations {
+		if match(invitation) {
+			copied := *invitation
+			invitations = append(invitations, &copied)
+		}
+	}
+	return invitations
+}
+
+func (r *fakeTeamInvitationRepository) Accept(ctx context.Context, id string, member *domain.TeamMember, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	invitation, ok := r.invitations[id]
+	if !ok || !invitation.IsPending(now) {
+		return repository.ErrInvitationNotPending
+	}
+	if err := r.teams.AddMember(ctx, member); err != nil {
+		return err
+	}
+	invitation.AcceptedAt = &now
+	invitation.AcceptedBy = &member.UserID
+	return nil
+}
+
+func (r *fakeTeamInvitationRepository) Revoke(ctx context.Context, id string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	invitation, ok := r.invitations[id]
+	if !ok || !invitation.IsPending(now) {
+		return repository.ErrInvitationNotPending
+	}
+	invitation.RevokedAt = &now
+	return nil
+}
+
+// capturingSender запоминает отправленные письма
+type capturingSender struct {
+	messages []*mail.Message
+}
+
+func (s *capturingSender) Send(ctx context.Context, msg *mail.Message) error {
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// invitationToken извлекает токен из ссылки в письме
+func invitationToken(t *testing.T, msg *mail.Message) string {
+	for _, line := range strings.Split(msg.Text, "\n") {
+		if strings.HasPrefix(line, "http") {
+			link, err := url.Parse(line)
+			require.NoError(t, err)
+			return link.Query().Get("token")
+		}
+	}
+	t.Fatal("invitation link not found")
+	return ""
+}
+
+func TestTeamInvitationService_InviteAndAccept(t *testing.T) {
+	teamRepo := newFakeTeamRepository()
+	teamRepo.addTeam(&domain.Team{ID: "team-1", Name: "Analytics"}, &domain.TeamMember{UserID: "owner", Role: domain.TeamRoleOwner})
+	invitationRepo := &fakeTeamInvitationRepository{invitations: map[string]*domain.TeamInvitation{}, teams: teamRepo}
+
+	userRepo := &MockUserRepository{}
+	userRepo.On("GetByEmail", mock.Anything, "owner@example.com").Return(&domain.User{ID: "owner", Email: "owner@example.com"}, nil)
+	userRepo.On("GetByEmail", mock.Anything, mock.Anything).Return(nil, repository.ErrNotFound)
+	userRepo.On("GetByID", mock.Anything, "dev").Return(&domain.User{ID: "dev", Email: "Dev@Example.com"}, nil)
+	userRepo.On("GetByID", mock.Anything, "other").Return(&domain.User{ID: "other", Email: "other@example.com"}, nil)
+
+	sender := &capturingSender{}
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	svc := NewTeamInvitationService(invitationRepo, teamRepo, userRepo, sender, nil, "secret", 24*time.Hour, "https://hub.example.com/invitations/accept").(*teamInvitationService)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err := svc.Invite(ctx, "team-1", &InviteTeamMemberRequest{Email: "owner@example.com", Role: domain.TeamRoleMember, InvitedBy: "owner"})
+	assert.ErrorIs(t, err, ErrInvalidTeamRequest, "участника команды не приглашают")
+	_, err = svc.Invite(ctx, "team-1", &InviteTeamMemberRequest{Email: "dev@example.com", Role: "superuser", InvitedBy: "owner"})
+	assert.ErrorIs(t, err, ErrInvalidTeamRequest)
+
+	invitation, err := svc.Invite(ctx, "team-1", &InviteTeamMemberRequest{Email: " Dev@example.com ", Role: domain.TeamRoleBilling, InvitedBy: "owner"})
+	require.NoError(t, err)
+	assert.Equal(t, "dev@example.com", invitation.Email)
+	require.Len(t, sender.messages, 1)
+	assert.Equal(t, "dev@example.com", sender.messages[0].To)
+	token := invitationToken(t, sender.messages[0])
+
+	validated, err := svc.ValidateToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, invitation.ID, validated.ID)
+
+	// Приглашение выписано на другой email
+	_, err = svc.AcceptToken(ctx, token, "other")
+	assert.ErrorIs(t, err, ErrInvalidInvitation)
+
+	member, err := svc.AcceptToken(ctx, token, "dev")
+	require.NoError(t, err)
+	assert.Equal(t, domain.TeamRoleBilling, member.Role)
+
+	// Токен одноразовый
+	_, err = svc.AcceptToken(ctx, token, "dev")
+	assert.ErrorIs(t, err, ErrInvalidInvitation)
+
+	// Истекший токен не принимается
+	second, err := svc.Invite(ctx, "team-1", &InviteTeamMemberRequest{Email: "new@example.com", Role: domain.TeamRoleMember, InvitedBy: "owner"})
+	require.NoError(t, err)
+	secondToken := invitationToken(t, sender.messages[1])
+	svc.now = func() time.Time { return now.Add(25 * time.Hour) }
+	_, err = svc.ValidateToken(ctx, secondToken)
+	assert.ErrorIs(t, err, ErrInvalidInvitation)
+
+	svc.now = func() time.Time { return now }
+	require.NoError(t, svc.Revoke(ctx, "team-1", second.ID))
+	_, err = svc.ValidateToken(ctx, secondToken)
+	assert.ErrorIs(t, err, ErrInvalidInvitation)
+	assert.ErrorIs(t, svc.Revoke(ctx, "team-2", second.ID), repository.ErrNotFound)
+}
@@ -0,0 +1,446 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/litellm"
+	"oneui-hub/internal/repository"
+)
+
+// ErrInvalidTeamRequest - некорректные параметры команды или участника
+var ErrInvalidTeamRequest = errors.New("invalid team request")
+
+// CreateTeamRequest - новая команда. Создатель становится ее владельцем
+type CreateTeamRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	CreatedBy   string `json:"-"`
+}
+
+// UpdateTeamRequest - изменяемые поля команды. Не переданные поля не меняются
+type UpdateTeamRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+// AddTeamMemberRequest - новый участник, задается ID или email пользователя
+type AddTeamMemberRequest struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+}
+
+// TeamUsage - использование команды за период
+type TeamUsage struct {
+	TeamID       string                    `json:"team_id"`
+	From         time.Time                 `json:"from"`
+	To           time.Time                 `json:"to"`
+	Requests     int64                     `json:"requests"`
+	InputTokens  int64                     `json:"input_tokens"`
+	OutputTokens int64                     `json:"output_tokens"`
+	TotalCost    float64                   `json:"total_cost"`
+	Members      []*repository.UsageByUser `json:"members"`
+}
+
+// TeamService управляет командами, их участниками и соответствующими командами LiteLLM.
+// Права участников проверяет вызывающий по роли из GetMember
+type TeamService interface {
+	CreateTeam(ctx context.Context, req *CreateTeamRequest) (*domain.Team, error)
+	GetTeam(ctx context.Context, id string) (*domain.Team, error)
+	ListTeams(ctx context.Context, limit, offset int) ([]*domain.Team, error)
+	// ListUserTeams возвращает команды, в которых состоит пользователь
+	ListUserTeams(ctx context.Context, userID string) ([]*domain.Team, error)
+	UpdateTeam(ctx context.Context, id string, req *UpdateTeamRequest) (*domain.Team, error)
+	// DeleteTeam удаляет команду и ее бюджеты. Команду с действующими ключами удалить нельзя
+	DeleteTeam(ctx context.Context, id string) error
+	// SetTeamTier назначает команде тариф (nil - ключи команды тарифицируются по тарифу владельца ключа)
+	SetTeamTier(ctx context.Context, id string, tierID *string) (*domain.Team, error)
+
+	GetMember(ctx context.Context, teamID, userID string) (*domain.TeamMember, error)
+	ListMembers(ctx context.Context, teamID string) ([]*domain.TeamMember, error)
+	AddMember(ctx context.Context, teamID string, req *AddTeamMemberRequest) (*domain.TeamMember, error)
+	// UpdateMemberRole меняет роль участника. Ключи команды участника, которому роль
+	// не позволяет вызывать модели, истекают
+	UpdateMemberRole(ctx context.Context, teamID, userID, role string) (*domain.TeamMember, error)
+	// RemoveMember исключает участника, его ключи команды истекают и отзываются задачей api_key_expiry
+	RemoveMember(ctx context.Context, teamID, userID string) error
+
+	ListTeamApiKeys(ctx context.Context, teamID string) ([]*domain.ApiKey, error)
+	// RevokeTeamApiKey прекращает действие ключа команды
+	RevokeTeamApiKey(ctx context.Context, teamID, keyID string) (*domain.ApiKey, error)
+	// GetTeamUsage возвращает использование команды за [from, to) в разбивке по участникам
+	GetTeamUsage(ctx context.Context, teamID string, from, to time.Time) (*TeamUsage, error)
+}
+
+type teamService struct {
+	teamRepo      repository.TeamRepository
+	userRepo      repository.UserRepository
+	tierRepo      repository.TierRepository
+	apiKeyRepo    repository.ApiKeyRepository
+	requestRepo   repository.RequestRepository
+	budgetService BudgetService
+	litellmClient *litellm.Client
+	now           func() time.Time
+}
+
+func NewTeamService(
+	teamRepo repository.TeamRepository,
+	userRepo repository.UserRepository,
+	tierRepo repository.TierRepository,
+	apiKeyRepo repository.ApiKeyRepository,
+	requestRepo repository.RequestRepository,
+	budgetService BudgetService,
+	litellmClient *litellm.Client,
+) TeamService {
+	return &teamService{
+		teamRepo:      teamRepo,
+		userRepo:      userRepo,
+		tierRepo:      tierRepo,
+		apiKeyRepo:    apiKeyRepo,
+		requestRepo:   requestRepo,
+		budgetService: budgetService,
+		litellmClient: litellmClient,
+		now:           time.Now,
+	}
+}
+
+func (s *teamService) CreateTeam(ctx context.Context, req *CreateTeamRequest) (*domain.Team, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidTeamRequest)
+	}
+
+	team := &domain.Team{
+		ID:          uuid.New().String(),
+		Name:        name,
+		Description: req.Description,
+		CreatedBy:   req.CreatedBy,
+	}
+	owner := &domain.TeamMember{
+		UserID: req.CreatedBy,
+		Role:   domain.TeamRoleOwner,
+	}
+
+	if err := s.teamRepo.Create(ctx, team, owner); err != nil {
+		return nil, err
+	}
+
+	// Ошибка LiteLLM не отменяет создание команды: хаб сам проверяет бюджеты и тарифы команды
+	if s.litellmClient != nil {
+		err := s.litellmClient.CreateTeam(ctx, &litellm.LiteLLMTeamRequest{
+			TeamID:           team.ID,
+			TeamAlias:        team.Name,
+			MembersWithRoles: []litellm.LiteLLMTeamMember{{UserID: owner.UserID, Role: owner.LiteLLMRole()}},
+		})
+		if err != nil {
+			fmt.Printf("Warning: failed to create team %s in LiteLLM: %v\n", team.ID, err)
+		}
+	}
+
+	return team, nil
+}
+
+func (s *teamService) GetTeam(ctx context.Context, id string) (*domain.Team, error) {
+	return s.teamRepo.GetByID(ctx, id)
+}
+
+func (s *teamService) ListTeams(ctx context.Context, limit, offset int) ([]*domain.Team, error) {
+	return s.teamRepo.List(ctx, limit, offset)
+}
+
+func (s *teamService) ListUserTeams(ctx context.Context, userID string) ([]*domain.Team, error) {
+	return s.teamRepo.ListByUserID(ctx, userID)
+}
+
+func (s *teamService) UpdateTeam(ctx context.Context, id string, req *UpdateTeamRequest) (*domain.Team, error) {
+	team, err := s.teamRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return nil, fmt.Errorf("%w: name cannot be empty", ErrInvalidTeamRequest)
+		}
+		team.Name = name
+	}
+	if req.Description != nil {
+		team.Description = *req.Description
+	}
+
+	team.Tier = nil
+	if err := s.teamRepo.Update(ctx, team); err != nil {
+		return nil, err
+	}
+
+	s.pushTeam(ctx, team)
+	return team, nil
+}
+
+func (s *teamService) DeleteTeam(ctx context.Context, id string) error {
+	team, err := s.teamRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	apiKeys, err := s.apiKeyRepo.GetByTeamID(ctx, team.ID)
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	for _, apiKey := range apiKeys {
+		if apiKey.IsActive(now) {
+			return fmt.Errorf("%w: team has active API keys, revoke them first", ErrInvalidTeamRequest)
+		}
+	}
+
+	budgets, err := s.budgetService.GetBudgetsByTeamID(ctx, team.ID)
+	if err != nil {
+		return err
+	}
+	for _, budget := range budgets {
+		if err := s.budgetService.DeleteBudget(ctx, budget.ID); err != nil {
+			return fmt.Errorf("failed to delete team budget: %w", err)
+		}
+	}
+
+	if err := s.teamRepo.Delete(ctx, team.ID); err != nil {
+		return err
+	}
+
+	if s.litellmClient != nil {
+		if err := s.litellmClient.DeleteTeam(ctx, team.ID); err != nil {
+			fmt.Printf("Warning: failed to delete team %s in LiteLLM: %v\n", team.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *teamService) SetTeamTier(ctx context.Context, id string, tierID *string) (*domain.Team, error) {
+	team, err := s.teamRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if tierID != nil && *tierID == "" {
+		tierID = nil
+	}
+	if tierID != nil {
+		if _, err := s.tierRepo.GetByID(ctx, *tierID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, fmt.Errorf("%w: tier %s not found", ErrInvalidTeamRequest, *tierID)
+			}
+			return nil, err
+		}
+	}
+
+	team.TierID = tierID
+	team.Tier = nil
+	if err := s.teamRepo.Update(ctx, team); err != nil {
+		return nil, err
+	}
+
+	s.pushTeam(ctx, team)
+	return team, nil
+}
+
+func (s *teamService) GetMember(ctx context.Context, teamID, userID string) (*domain.TeamMember, error) {
+	return s.teamRepo.GetMember(ctx, teamID, userID)
+}
+
+func (s *teamService) ListMembers(ctx context.Context, teamID string) ([]*domain.TeamMember, error) {
+	return s.teamRepo.ListMembers(ctx, teamID)
+}
+
+func (s *teamService) AddMember(ctx context.Context, teamID string, req *AddTeamMemberRequest) (*domain.TeamMember, error) {
+	if !domain.ValidTeamRole(req.Role) {
+		return nil, fmt.Errorf("%w: role must be owner, admin, member or billing", ErrInvalidTeamRequest)
+	}
+
+	if _, err := s.teamRepo.GetByID(ctx, teamID); err != nil {
+		return nil, err
+	}
+
+	var user *domain.User
+	var err error
+	switch {
+	case req.UserID != "":
+		user, err = s.userRepo.GetByID(ctx, req.UserID)
+	case req.Email != "":
+		user, err = s.userRepo.GetByEmail(ctx, strings.TrimSpace(req.Email))
+	default:
+		return nil, fmt.Errorf("%w: user_id or email is required", ErrInvalidTeamRequest)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("%w: user not found", ErrInvalidTeamRequest)
+		}
+		return nil, err
+	}
+
+	member := &domain.TeamMember{
+		TeamID: teamID,
+		UserID: user.ID,
+		Role:   req.Role,
+	}
+	if err := s.teamRepo.AddMember(ctx, member); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			return nil, fmt.Errorf("%w: user is already a team member", ErrInvalidTeamRequest)
+		}
+		return nil, err
+	}
+	member.User = user
+
+	if s.litellmClient != nil {
+		if err := s.litellmClient.AddTeamMember(ctx, teamID, litellm.LiteLLMTeamMember{UserID: user.ID, Role: member.LiteLLMRole()}); err != nil {
+			fmt.Printf("Warning: failed to add user %s to team %s in LiteLLM: %v\n", user.ID, teamID, err)
+		}
+	}
+
+	return member, nil
+}
+
+func (s *teamService) UpdateMemberRole(ctx context.Context, teamID, userID, role string) (*domain.TeamMember, error) {
+	if !domain.ValidTeamRole(role) {
+		return nil, fmt.Errorf("%w: role must be owner, admin, member or billing", ErrInvalidTeamRequest)
+	}
+
+	if err := s.teamRepo.UpdateMemberRole(ctx, teamID, userID, role); err != nil {
+		if errors.Is(err, repository.ErrLastTeamOwner) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidTeamRequest, err)
+		}
+		return nil, err
+	}
+
+	member, err := s.teamRepo.GetMember(ctx, teamID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Роль billing не дает вызывать модели: ключи команды участника истекают
+	if !member.CanUseModels() {
+		if _, err := s.apiKeyRepo.ExpireTeamKeys(ctx, teamID, userID, s.now()); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.litellmClient != nil {
+		if err := s.litellmClient.UpdateTeamMember(ctx, teamID, litellm.LiteLLMTeamMember{UserID: userID, Role: member.LiteLLMRole()}); err != nil {
+			fmt.Printf("Warning: failed to update user %s role in team %s in LiteLLM: %v\n", userID, teamID, err)
+		}
+	}
+
+	return member, nil
+}
+
+func (s *teamService) RemoveMember(ctx context.Context, teamID, userID string) error {
+	if err := s.teamRepo.RemoveMember(ctx, teamID, userID); err != nil {
+		if errors.Is(err, repository.ErrLastTeamOwner) {
+			return fmt.Errorf("%w: %v", ErrInvalidTeamRequest, err)
+		}
+		return err
+	}
+
+	// Бывший участник больше не может пользоваться ключами команды
+	expired, err := s.apiKeyRepo.ExpireTeamKeys(ctx, teamID, userID, s.now())
+	if err != nil {
+		return err
+	}
+	if expired > 0 {
+		fmt.Printf("Team %s: expired %d API keys of removed member %s\n", teamID, expired, userID)
+	}
+
+	if s.litellmClient != nil {
+		if err := s.litellmClient.RemoveTeamMember(ctx, teamID, userID); err != nil {
+			fmt.Printf("Warning: failed to remove user %s from team %s in LiteLLM: %v\n", userID, teamID, err)
+		}
+	}
+	return nil
+}
+
+func (s *teamService) ListTeamApiKeys(ctx context.Context, teamID string) ([]*domain.ApiKey, error) {
+	return s.apiKeyRepo.GetByTeamID(ctx, teamID)
+}
+
+func (s *teamService) RevokeTeamApiKey(ctx context.Context, teamID, keyID string) (*domain.ApiKey, error) {
+	apiKey, err := s.apiKeyRepo.GetByID(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if apiKey.TeamID == nil || *apiKey.TeamID != teamID {
+		return nil, repository.ErrNotFound
+	}
+
+	now := s.now()
+	if !apiKey.IsActive(now) {
+		return apiKey, nil
+	}
+
+	// Хаб перестает принимать ключ сразу, в LiteLLM его удалит задача api_key_expiry
+	apiKey.ExpiresAt = &now
+	apiKey.User = nil
+	if err := s.apiKeyRepo.Update(ctx, apiKey); err != nil {
+		return nil, fmt.Errorf("failed to revoke team API key: %w", err)
+	}
+
+	if s.litellmClient != nil {
+		if litellmKey := litellmKeyID(apiKey); litellmKey != "" {
+			if err := s.litellmClient.UpdateKey(ctx, litellmKey, &litellm.LiteLLMKeyRequest{ExpiresAt: apiKey.ExpiresAt}); err != nil {
+				fmt.Printf("Warning: failed to expire team API key %s in LiteLLM: %v\n", apiKey.ID, err)
+			}
+		}
+	}
+
+	return apiKey, nil
+}
+
+func (s *teamService) GetTeamUsage(ctx context.Context, teamID string, from, to time.Time) (*TeamUsage, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidTeamRequest)
+	}
+
+	members, err := s.requestRepo.SumUsageByTeam(ctx, teamID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &TeamUsage{
+		TeamID:  teamID,
+		From:    from,
+		To:      to,
+		Members: members,
+	}
+	for _, member := range members {
+		usage.Requests += member.Requests
+		usage.InputTokens += member.InputTokens
+		usage.OutputTokens += member.OutputTokens
+		usage.TotalCost += member.TotalCost
+	}
+	return usage, nil
+}
+
+// pushTeam отправляет название и тариф команды в LiteLLM
+func (s *teamService) pushTeam(ctx context.Context, team *domain.Team) {
+	if s.litellmClient == nil {
+		return
+	}
+
+	req := &litellm.LiteLLMTeamRequest{
+		TeamID:    team.ID,
+		TeamAlias: team.Name,
+	}
+	if team.TierID != nil {
+		req.Metadata = map[string]string{"tier_id": *team.TierID}
+	}
+	if err := s.litellmClient.UpdateTeam(ctx, req); err != nil {
+		fmt.Printf("Warning: failed to update team %s in LiteLLM: %v\n", team.ID, err)
+	}
+}
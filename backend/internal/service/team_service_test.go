@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"oneui-hub/internal/config"
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/litellm"
+	"oneui-hub/internal/repository"
+)
+
+// fakeTeamRepository хранит команды и участников в памяти
+type fakeTeamRepository struct {
+	mu      sync.Mutex
+	teams   map[string]*domain.Team
+	members map[string]map[string]*domain.TeamMember
+}
+
+func newFakeTeamRepository() *fakeTeamRepository {
+	return &fakeTeamRepository{teams: map[string]*domain.Team{}, members: map[string]map[string]*domain.TeamMember{}}
+}
+
+func (r *fakeTeamRepository) addTeam(team *domain.Team, members ...*domain.TeamMember) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.teams[team.ID] = team
+	r.members[team.ID] = map[string]*domain.TeamMember{}
+	for _, member := range members {
+		member.TeamID = team.ID
+		r.members[team.ID][member.UserID] = member
+	}
+}
+
+func (r *fakeTeamRepository) Create(ctx context.Context, team *domain.Team, owner *domain.TeamMember) error {
+	r.addTeam(team, owner)
+	return nil
+}
+
+func (r *fakeTeamRepository) GetByID(ctx context.Context, id string) (*domain.Team, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	team, ok := r.teams[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *team
+	return &copied, nil
+}
+
+func (r *fakeTeamRepository) Update(ctx context.Context, team *domain.Team) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *team
+	r.teams[team.ID] = &copied
+	return nil
+}
+
+func (r *fakeTeamRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.teams, id)
+	delete(r.members, id)
+	return nil
+}
+
+func (r *fakeTeamRepository) List(ctx context.Context, limit, offset int) ([]*domain.Team, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var teams []*domain.Team
+	for _, team := range r.teams {
+		copied := *team
+		teams = append(teams, &copied)
+	}
+	sort.Slice(teams, func(i, j int) bool { return teams[i].ID < teams[j].ID })
+	return teams, nil
+}
+
+func (r *fakeTeamRepository) ListByUserID(ctx context.Context, userID string) ([]*domain.Team, error) {
+	return nil, nil
+}
+
+func (r *fakeTeamRepository) GetMember(ctx context.Context, teamID, userID string) (*domain.TeamMember, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	member, ok := r.members[teamID][userID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *member
+	return &copied, nil
+}
+
+func (r *fakeTeamRepository) ListMembers(ctx context.Context, teamID string) ([]*domain.TeamMember, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var members []*domain.TeamMember
+	for _, member := range r.members[teamID] {
+		copied := *member
+		copied.User = &domain.User{ID: member.UserID, Email: member.UserID + "@example.com"}
+		members = append(members, &copied)
+	}
+	return members, nil
+}
+
+func (r *fakeTeamRepository) AddMember(ctx context.Context, member *domain.TeamMember) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.members[member.TeamID][member.UserID]; ok {
+		return repository.ErrDuplicate
+	}
+	copied := *member
+	r.members[member.TeamID][member.UserID] = &copied
+	return nil
+}
+
+func (r *fakeTeamRepository) UpdateMemberRole(ctx context.Context, teamID, userID, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	member, ok := r.members[teamID][userID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if role != domain.TeamRoleOwner && r.lastOwner(member) {
+		return repository.ErrLastTeamOwner
+	}
+	member.Role = role
+	return nil
+}
+
+func (r *fakeTeamRepository) RemoveMember(ctx context.Context, teamID, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	member, ok := r.members[teamID][userID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if r.lastOwner(member) {
+		return repository.ErrLastTeamOwner
+	}
+	delete(r.members[teamID], userID)
+	return nil
+}
+
+func (r *fakeTeamRepository) lastOwner(member *domain.TeamMember) bool {
+	if member.Role != domain.TeamRoleOwner {
+		return false
+	}
+	for _, other := range r.members[member.TeamID] {
+		if other.UserID != member.UserID && other.Role == domain.TeamRoleOwner {
+			return false
+		}
+	}
+	return true
+}
+
+// fakeLiteLLMTeams запоминает вызовы эндпоинтов команд LiteLLM
+type fakeLiteLLMTeams struct {
+	mu    sync.Mutex
+	calls map[string][]map[string]interface{}
+}
+
+func (f *fakeLiteLLMTeams) handler(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var body map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	f.calls[r.URL.Path] = append(f.calls[r.URL.Path], body)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{})
+}
+
+func TestTeamService_Members(t *testing.T) {
+	upstream := &fakeLiteLLMTeams{calls: map[string][]map[string]interface{}{}}
+	server := httptest.NewServer(http.HandlerFunc(upstream.handler))
+	t.Cleanup(server.Close)
+
+	teamRepo := newFakeTeamRepository()
+	apiKeyRepo := newFakeApiKeyRepository()
+	userRepo := &MockUserRepository{}
+	userRepo.On("GetByEmail", mock.Anything, "dev@example.com").Return(&domain.User{ID: "dev", Email: "dev@example.com"}, nil)
+	userRepo.On("GetByEmail", mock.Anything, mock.Anything).Return(nil, repository.ErrNotFound)
+
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	svc := NewTeamService(teamRepo, userRepo, nil, apiKeyRepo, &fakeRequestRepository{}, nil,
+		litellm.NewClient(&config.LiteLLMConfig{BaseURL: server.URL, Timeout: 5 * time.Second})).(*teamService)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	team, err := svc.CreateTeam(ctx, &CreateTeamRequest{Name: " Analytics ", CreatedBy: "owner"})
+	require.NoError(t, err)
+	assert.Equal(t, "Analytics", team.Name)
+	require.Len(t, upstream.calls["/team/new"], 1)
+	assert.Equal(t, team.ID, upstream.calls["/team/new"][0]["team_id"])
+
+	owner, err := svc.GetMember(ctx, team.ID, "owner")
+	require.NoError(t, err)
+	assert.Equal(t, domain.TeamRoleOwner, owner.Role)
+
+	member, err := svc.AddMember(ctx, team.ID, &AddTeamMemberRequest{Email: "dev@example.com", Role: domain.TeamRoleMember})
+	require.NoError(t, err)
+	assert.Equal(t, "dev", member.UserID)
+	require.Len(t, upstream.calls["/team/member_add"], 1)
+
+	_, err = svc.AddMember(ctx, team.ID, &AddTeamMemberRequest{Email: "dev@example.com", Role: domain.TeamRoleAdmin})
+	assert.ErrorIs(t, err, ErrInvalidTeamRequest)
+	_, err = svc.AddMember(ctx, team.ID, &AddTeamMemberRequest{Email: "missing@example.com", Role: domain.TeamRoleMember})
+	assert.ErrorIs(t, err, ErrInvalidTeamRequest)
+	_, err = svc.AddMember(ctx, team.ID, &AddTeamMemberRequest{Email: "dev@example.com", Role: "superuser"})
+	assert.ErrorIs(t, err, ErrInvalidTeamRequest)
+
+	// Команда всегда сохраняет владельца
+	_, err = svc.UpdateMemberRole(ctx, team.ID, "owner", domain.TeamRoleAdmin)
+	assert.ErrorIs(t, err, ErrInvalidTeamRequest)
+
+	// Роль billing не дает вызывать модели: ключи команды участника истекают
+	teamID := team.ID
+	require.NoError(t, apiKeyRepo.Create(ctx, &domain.ApiKey{ID: "team-key", UserID: "dev", TeamID: &teamID}))
+	require.NoError(t, apiKeyRepo.Create(ctx, &domain.ApiKey{ID: "own-key", UserID: "dev"}))
+
+	err = svc.DeleteTeam(ctx, team.ID)
+	assert.ErrorIs(t, err, ErrInvalidTeamRequest, "команду с действующими ключами удалить нельзя")
+
+	_, err = svc.UpdateMemberRole(ctx, team.ID, "dev", domain.TeamRoleBilling)
+	require.NoError(t, err)
+	teamKey, err := apiKeyRepo.GetByID(ctx, "team-key")
+	require.NoError(t, err)
+	require.NotNil(t, teamKey.ExpiresAt)
+	assert.Equal(t, now, *teamKey.ExpiresAt)
+	ownKey, err := apiKeyRepo.GetByID(ctx, "own-key")
+	require.NoError(t, err)
+	assert.Nil(t, ownKey.ExpiresAt)
+
+	require.NoError(t, svc.RemoveMember(ctx, team.ID, "dev"))
+	_, err = svc.GetMember(ctx, team.ID, "dev")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	require.Len(t, upstream.calls["/team/member_delete"], 1)
+	assert.Equal(t, "dev", upstream.calls["/team/member_delete"][0]["user_id"])
+}
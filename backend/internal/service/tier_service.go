@@ -2,47 +2,97 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"time"
 
 	"github.com/google/uuid"
 
 	"oneui-hub/internal/domain"
+	"oneui-hub/internal/notification"
 	"oneui-hub/internal/repository"
 )
 
+var ErrInvalidTierChange = errors.New("invalid tier change")
+
+const (
+	// defaultDowngradeGraceDays - льготный период нового тарифа, если он не задан
+	defaultDowngradeGraceDays = 14
+	tierEvaluationBatchSize   = 200
+)
+
 type TierService interface {
 	GetUserTier(ctx context.Context, userID string) (*domain.Tier, error)
+	// CheckAndUpgradeTier повышает тариф пользователя до наибольшего, на который хватает трат за окно тарифа.
+	// Если траты перестали соответствовать тарифу, понижение планируется через льготный период тарифа,
+	// а пользователь получает предупреждение. Закрепленный администратором тариф не меняется
 	CheckAndUpgradeTier(ctx context.Context, userID string) error
+	// EvaluateTiers проверяет тарифы всех пользователей, которые могут быть понижены
+	EvaluateTiers(ctx context.Context) error
 	GetAllTiers(ctx context.Context) ([]domain.Tier, error)
+	// UpdateUserSpending учитывает оплату пользователя (пополнение баланса; возврат - отрицательной суммой)
+	// и проверяет, не пора ли повысить тариф. Использование моделей учитывает шлюз отдельно
 	UpdateUserSpending(ctx context.Context, userID string, amount float64) error
 	GetUserSpending(ctx context.Context, userID string) (*domain.UserSpending, error)
+	// GetTierHistory возвращает историю тарифов пользователя, начиная с последних изменений
+	GetTierHistory(ctx context.Context, userID string, limit, offset int) ([]*domain.TierChange, error)
+	// GetScheduledDowngrade возвращает запланированное понижение тарифа или nil
+	GetScheduledDowngrade(ctx context.Context, userID string) (*domain.TierDowngrade, error)
 
 	// Административные методы
 	GetTierByID(ctx context.Context, id string) (*domain.Tier, error)
 	CreateTier(ctx context.Context, req *CreateTierRequest) (*domain.Tier, error)
 	UpdateTier(ctx context.Context, tier *domain.Tier) error
 	DeleteTier(ctx context.Context, id string) error
+	// SetUserTier назначает пользователю тариф. Закрепленный тариф не меняется автоматически.
+	// Возвращает nil, если тариф и закрепление не изменились
+	SetUserTier(ctx context.Context, req *SetUserTierRequest) (*domain.TierChange, error)
 }
 
 type tierService struct {
 	tierRepo         repository.TierRepository
 	userRepo         repository.UserRepository
 	userSpendingRepo repository.UserSpendingRepository
+	tierHistoryRepo  repository.TierHistoryRepository
+	// notifier - уведомления о смене тарифа; nil отключает уведомления
+	notifier notification.Notifier
+	now      func() time.Time
 }
 
-func NewTierService(tierRepo repository.TierRepository, userRepo repository.UserRepository, userSpendingRepo repository.UserSpendingRepository) TierService {
+func NewTierService(
+	tierRepo repository.TierRepository,
+	userRepo repository.UserRepository,
+	userSpendingRepo repository.UserSpendingRepository,
+	tierHistoryRepo repository.TierHistoryRepository,
+	notifier notification.Notifier,
+) TierService {
 	return &tierService{
 		tierRepo:         tierRepo,
 		userRepo:         userRepo,
 		userSpendingRepo: userSpendingRepo,
+		tierHistoryRepo:  tierHistoryRepo,
+		notifier:         notifier,
+		now:              time.Now,
 	}
 }
 
 type CreateTierRequest struct {
-	Name        string  `json:"name" validate:"required"`
-	Description string  `json:"description"`
-	IsFree      bool    `json:"is_free"`
-	Price       float64 `json:"price" validate:"min=0"`
+	Name                    string  `json:"name" validate:"required"`
+	Description             string  `json:"description"`
+	IsFree                  bool    `json:"is_free"`
+	Price                   float64 `json:"price" validate:"min=0"`
+	QualificationWindowDays int     `json:"qualification_window_days" validate:"min=0"`
+	DowngradeGraceDays      *int    `json:"downgrade_grace_days" validate:"omitempty,min=0"`
+}
+
+type SetUserTierRequest struct {
+	UserID string
+	TierID string
+	Pinned bool
+	Note   string
+	// ChangedBy - администратор, назначивший тариф
+	ChangedBy string
 }
 
 func (s *tierService) GetUserTier(ctx context.Context, userID string) (*domain.Tier, error) {
@@ -60,42 +110,221 @@ func (s *tierService) GetUserTier(ctx context.Context, userID string) (*domain.T
 }
 
 func (s *tierService) CheckAndUpgradeTier(ctx context.Context, userID string) error {
-	// Получаем текущие траты пользователя
-	spending, err := s.userSpendingRepo.GetByUserID(ctx, userID)
+	// Получаем все тарифы, отсортированные по price (по возрастанию)
+	allTiers, err := s.tierRepo.GetAllOrderedByPrice(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get user spending: %w", err)
+		return fmt.Errorf("failed to get all tiers: %w", err)
 	}
-
-	// Получаем текущий тариф пользователя
-	user, err := s.userRepo.GetByID(ctx, userID)
-	if err != nil {
-		return fmt.Errorf("failed to get user: %w", err)
+	if len(allTiers) == 0 {
+		return nil
 	}
 
-	// Получаем все тарифы, отсортированные по price (по возрастанию)
+	return s.evaluateTier(ctx, userID, allTiers, s.now())
+}
+
+func (s *tierService) EvaluateTiers(ctx context.Context) error {
 	allTiers, err := s.tierRepo.GetAllOrderedByPrice(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get all tiers: %w", err)
 	}
 
-	// Определяем подходящий тариф на основе трат
-	var newTierID string
+	// Пользователи самого дешевого тарифа могут только повыситься, а это проверяется при каждой трате
+	var tierIDs []string
 	for _, tier := range allTiers {
-		if spending.TotalSpent >= tier.Price {
-			newTierID = tier.ID
-		} else {
+		if tier.Price > allTiers[0].Price {
+			tierIDs = append(tierIDs, tier.ID)
+		}
+	}
+	if len(tierIDs) == 0 {
+		return nil
+	}
+
+	evaluated, failed := 0, 0
+	afterID := ""
+	for {
+		userIDs, err := s.userRepo.ListIDsByTiers(ctx, tierIDs, afterID, tierEvaluationBatchSize)
+		if err != nil {
+			return err
+		}
+
+		now := s.now()
+		for _, userID := range userIDs {
+			if err := s.evaluateTier(ctx, userID, allTiers, now); err != nil {
+				fmt.Printf("Warning: failed to evaluate tier for user %s: %v\n", userID, err)
+				failed++
+				continue
+			}
+			evaluated++
+		}
+
+		if len(userIDs) < tierEvaluationBatchSize {
 			break
 		}
+		afterID = userIDs[len(userIDs)-1]
+	}
+
+	fmt.Printf("Tier evaluation: checked %d users\n", evaluated)
+	if failed > 0 {
+		return fmt.Errorf("failed to evaluate tiers for %d users", failed)
+	}
+	return nil
+}
+
+// evaluateTier повышает тариф пользователя до подходящего по тратам, а если траты перестали
+// соответствовать текущему тарифу, планирует понижение после льготного периода и выполняет его
+func (s *tierService) evaluateTier(ctx context.Context, userID string, allTiers []domain.Tier, now time.Time) error {
+	target, err := s.qualifiedTier(ctx, userID, allTiers, now)
+	if err != nil {
+		return err
+	}
+
+	tiers := make(map[string]*domain.Tier, len(allTiers))
+	for i := range allTiers {
+		tiers[allTiers[i].ID] = &allTiers[i]
+	}
+
+	change := &domain.TierChange{
+		ID:       uuid.New().String(),
+		UserID:   userID,
+		ToTierID: target.ID,
+		Reason:   domain.TierChangeReasonSpending,
+	}
+	changed, err := s.tierHistoryRepo.ChangeUserTier(ctx, change, func(user *domain.User) (bool, error) {
+		if user.TierPinned {
+			return false, nil
+		}
+		// Более дорогой тариф мог быть выдан промокодом или администратором, его не трогаем
+		current, ok := tiers[user.TierID]
+		return !ok || target.Price > current.Price, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update user tier: %w", err)
+	}
+	if changed {
+		s.notifyTierChanged(ctx, change)
+		return nil
+	}
+
+	return s.checkDowngrade(ctx, userID, target, tiers, now)
+}
+
+// qualifiedTier возвращает самый дорогой тариф, на который хватает трат пользователя.
+// Траты считаются за окно тарифа; самый дешевый тариф доступен всегда.
+// Оплаты и использование - два учета одних и тех же денег: пополнение, затем потраченное на запросы,
+// не должно засчитываться дважды. Поэтому для тарифа берется большее из них, а не сумма
+func (s *tierService) qualifiedTier(ctx context.Context, userID string, allTiers []domain.Tier, now time.Time) (*domain.Tier, error) {
+	// Траты за окно считаются один раз для всех тарифов с одинаковым окном
+	spent := map[int]float64{}
+	spentFor := func(windowDays int) (float64, error) {
+		if amount, ok := spent[windowDays]; ok {
+			return amount, nil
+		}
+
+		var used, paid float64
+		if windowDays > 0 {
+			since := now.AddDate(0, 0, -(windowDays - 1))
+			var err error
+			if used, err = s.userSpendingRepo.SumSince(ctx, userID, since); err != nil {
+				return 0, err
+			}
+			if paid, err = s.userSpendingRepo.SumPaidSince(ctx, userID, since); err != nil {
+				return 0, err
+			}
+		} else {
+			spending, err := s.userSpendingRepo.GetByUserID(ctx, userID)
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				return 0, fmt.Errorf("failed to get user spending: %w", err)
+			}
+			if spending != nil {
+				used, paid = spending.TotalSpent, spending.TotalPaid
+			}
+		}
+		amount := math.Max(used, paid)
+		spent[windowDays] = amount
+		return amount, nil
+	}
+
+	target := &allTiers[0]
+	for i := 1; i < len(allTiers); i++ {
+		amount, err := spentFor(allTiers[i].QualificationWindowDays)
+		if err != nil {
+			return nil, err
+		}
+		if amount >= allTiers[i].Price {
+			target = &allTiers[i]
+		}
+	}
+	return target, nil
+}
+
+// checkDowngrade планирует, обновляет, отменяет или выполняет понижение тарифа до target
+func (s *tierService) checkDowngrade(ctx context.Context, userID string, target *domain.Tier, tiers map[string]*domain.Tier, now time.Time) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	pending, err := s.tierHistoryRepo.GetDowngrade(ctx, userID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+
+	current, ok := tiers[user.TierID]
+	if user.TierPinned || !ok || current.Price <= target.Price {
+		// Траты снова соответствуют тарифу
+		if pending != nil {
+			return s.tierHistoryRepo.CancelDowngrade(ctx, userID)
+		}
+		return nil
 	}
 
-	// Если нужно обновить тариф
-	if newTierID != "" && newTierID != user.TierID {
-		user.TierID = newTierID
-		if err := s.userRepo.Update(ctx, user); err != nil {
-			return fmt.Errorf("failed to update user tier: %w", err)
+	// Временный тариф по промокоду возвращает задача promo_expiry
+	latest, err := s.tierHistoryRepo.ListByUser(ctx, userID, 1, 0)
+	if err != nil {
+		return err
+	}
+	if len(latest) > 0 && latest[0].Reason == domain.TierChangeReasonPromo && latest[0].ToTierID == user.TierID {
+		return nil
+	}
+
+	if pending == nil || pending.FromTierID != user.TierID {
+		pending = &domain.TierDowngrade{
+			UserID:      userID,
+			FromTierID:  current.ID,
+			ToTierID:    target.ID,
+			DowngradeAt: now.AddDate(0, 0, current.DowngradeGraceDays),
 		}
+		if current.DowngradeGraceDays > 0 {
+			if err := s.tierHistoryRepo.SaveDowngrade(ctx, pending); err != nil {
+				return err
+			}
+			s.notifyDowngradeScheduled(ctx, user, current, tiers[pending.ToTierID], pending)
+			return nil
+		}
+	} else if now.Before(pending.DowngradeAt) {
+		// Траты изменились, но срок понижения остается прежним
+		if pending.ToTierID != target.ID {
+			pending.ToTierID = target.ID
+			return s.tierHistoryRepo.SaveDowngrade(ctx, pending)
+		}
+		return nil
 	}
 
+	change := &domain.TierChange{
+		ID:       uuid.New().String(),
+		UserID:   userID,
+		ToTierID: target.ID,
+		Reason:   domain.TierChangeReasonDowngrade,
+	}
+	changed, err := s.tierHistoryRepo.ChangeUserTier(ctx, change, func(locked *domain.User) (bool, error) {
+		return !locked.TierPinned && locked.TierID == current.ID, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to downgrade user tier: %w", err)
+	}
+	if changed {
+		s.notifyTierChanged(ctx, change)
+	}
 	return nil
 }
 
@@ -109,23 +338,9 @@ func (s *tierService) GetAllTiers(ctx context.Context) ([]domain.Tier, error) {
 }
 
 func (s *tierService) UpdateUserSpending(ctx context.Context, userID string, amount float64) error {
-	// Получаем или создаем запись трат
-	spending, err := s.userSpendingRepo.GetByUserID(ctx, userID)
-	if err != nil {
-		// Если записи нет, создаем новую
-		spending = &domain.UserSpending{
-			UserID:     userID,
-			TotalSpent: amount,
-		}
-		if err := s.userSpendingRepo.Create(ctx, spending); err != nil {
-			return fmt.Errorf("failed to create user spending: %w", err)
-		}
-	} else {
-		// Обновляем существующую запись
-		spending.TotalSpent += amount
-		if err := s.userSpendingRepo.Update(ctx, spending); err != nil {
-			return fmt.Errorf("failed to update user spending: %w", err)
-		}
+	// Оплаты увеличиваются атомарно, одновременно со шлюзом, который учитывает использование
+	if err := s.userSpendingRepo.AddPaid(ctx, userID, amount); err != nil {
+		return fmt.Errorf("failed to update user spending: %w", err)
 	}
 
 	// Проверяем, нужно ли повысить тариф
@@ -145,6 +360,88 @@ func (s *tierService) GetUserSpending(ctx context.Context, userID string) (*doma
 	return spending, nil
 }
 
+func (s *tierService) GetScheduledDowngrade(ctx context.Context, userID string) (*domain.TierDowngrade, error) {
+	downgrade, err := s.tierHistoryRepo.GetDowngrade(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	return downgrade, err
+}
+
+func (s *tierService) GetTierHistory(ctx context.Context, userID string, limit, offset int) ([]*domain.TierChange, error) {
+	return s.tierHistoryRepo.ListByUser(ctx, userID, limit, offset)
+}
+
+// notifyTierChanged уведомляет пользователя о смене тарифа
+func (s *tierService) notifyTierChanged(ctx context.Context, change *domain.TierChange) {
+	if s.notifier == nil || change.FromTierID == change.ToTierID {
+		return
+	}
+
+	user, err := s.userRepo.GetByID(ctx, change.UserID)
+	if err != nil {
+		fmt.Printf("Warning: failed to get user %s for tier change notification: %v\n", change.UserID, err)
+		return
+	}
+
+	toName := change.ToTierID
+	if tier, err := s.tierRepo.GetByID(ctx, change.ToTierID); err == nil {
+		toName = tier.Name
+	}
+
+	s.notify(ctx, &notification.Notification{
+		Event:   notification.EventTierChanged,
+		UserID:  user.ID,
+		Email:   user.Email,
+		Subject: fmt.Sprintf("Your tier is now %s", toName),
+		Text:    fmt.Sprintf("Your tier has been changed to %s.", toName),
+		Data: map[string]interface{}{
+			"from_tier_id": change.FromTierID,
+			"to_tier_id":   change.ToTierID,
+			"reason":       change.Reason,
+			"pinned":       change.Pinned,
+		},
+	})
+}
+
+// notifyDowngradeScheduled предупреждает пользователя о предстоящем понижении тарифа
+func (s *tierService) notifyDowngradeScheduled(ctx context.Context, user *domain.User, from, to *domain.Tier, downgrade *domain.TierDowngrade) {
+	period := "in total"
+	if from.QualificationWindowDays > 0 {
+		period = fmt.Sprintf("over the last %d days", from.QualificationWindowDays)
+	}
+	date := downgrade.DowngradeAt.UTC().Format("January 2, 2006")
+
+	s.notify(ctx, &notification.Notification{
+		Event:   notification.EventTierDowngradeScheduled,
+		UserID:  user.ID,
+		Email:   user.Email,
+		Subject: fmt.Sprintf("Your %s tier will be downgraded on %s", from.Name, date),
+		Text: fmt.Sprintf("The %s tier requires spending %.2f USD %s. Unless your spending reaches that amount, "+
+			"you will be moved to the %s tier on %s.", from.Name, from.Price, period, to.Name, date),
+		Data: map[string]interface{}{
+			"from_tier_id":   downgrade.FromTierID,
+			"to_tier_id":     downgrade.ToTierID,
+			"downgrade_at":   downgrade.DowngradeAt,
+			"required_spend": from.Price,
+			"window_days":    from.QualificationWindowDays,
+		},
+	})
+}
+
+// notify отправляет уведомление, ошибки доставки только логируются
+func (s *tierService) notify(ctx context.Context, n *notification.Notification) {
+	if s.notifier == nil {
+		return
+	}
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = s.now()
+	}
+	if err := s.notifier.Notify(ctx, n); err != nil {
+		fmt.Printf("Warning: failed to send %s notification to user %s: %v\n", n.Event, n.UserID, err)
+	}
+}
+
 // Административные методы
 
 func (s *tierService) GetTierByID(ctx context.Context, id string) (*domain.Tier, error) {
@@ -164,11 +461,16 @@ func (s *tierService) CreateTier(ctx context.Context, req *CreateTierRequest) (*
 	}
 
 	tier := &domain.Tier{
-		ID:          uuid.New().String(),
-		Name:        req.Name,
-		Description: req.Description,
-		IsFree:      req.IsFree,
-		Price:       req.Price,
+		ID:                      uuid.New().String(),
+		Name:                    req.Name,
+		Description:             req.Description,
+		IsFree:                  req.IsFree,
+		Price:                   req.Price,
+		QualificationWindowDays: req.QualificationWindowDays,
+		DowngradeGraceDays:      defaultDowngradeGraceDays,
+	}
+	if req.DowngradeGraceDays != nil {
+		tier.DowngradeGraceDays = *req.DowngradeGraceDays
 	}
 
 	if err := s.tierRepo.Create(ctx, tier); err != nil {
@@ -217,3 +519,34 @@ func (s *tierService) DeleteTier(ctx context.Context, id string) error {
 
 	return nil
 }
+
+func (s *tierService) SetUserTier(ctx context.Context, req *SetUserTierRequest) (*domain.TierChange, error) {
+	if _, err := s.tierRepo.GetByID(ctx, req.TierID); err != nil {
+		return nil, fmt.Errorf("%w: tier %s not found", ErrInvalidTierChange, req.TierID)
+	}
+
+	change := &domain.TierChange{
+		ID:       uuid.New().String(),
+		UserID:   req.UserID,
+		ToTierID: req.TierID,
+		Reason:   domain.TierChangeReasonAdmin,
+		Pinned:   req.Pinned,
+		Note:     req.Note,
+	}
+	if req.ChangedBy != "" {
+		change.ChangedBy = &req.ChangedBy
+	}
+
+	changed, err := s.tierHistoryRepo.ChangeUserTier(ctx, change, func(user *domain.User) (bool, error) {
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return nil, nil
+	}
+
+	s.notifyTierChanged(ctx, change)
+	return change, nil
+}
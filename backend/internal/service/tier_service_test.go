@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"oneui-hub/internal/domain"
+	"oneui-hub/internal/notification"
+	"oneui-hub/internal/repository"
+)
+
+// fakeTierHistoryRepository хранит тарифы пользователей и историю в памяти
+type fakeTierHistoryRepository struct {
+	mu         sync.Mutex
+	users      map[string]*domain.User
+	changes    []*domain.TierChange
+	downgrades map[string]*domain.TierDowngrade
+}
+
+func (r *fakeTierHistoryRepository) ChangeUserTier(ctx context.Context, change *domain.TierChange, check func(user *domain.User) (bool, error)) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[change.UserID]
+	if !ok {
+		return false, repository.ErrNotFound
+	}
+	if ok, err := check(user); err != nil || !ok {
+		return false, err
+	}
+	if user.TierID == change.ToTierID && user.TierPinned == change.Pinned {
+		return false, nil
+	}
+	change.FromTierID = user.TierID
+	user.TierID = change.ToTierID
+	user.TierPinned = change.Pinned
+	r.changes = append(r.changes, change)
+	delete(r.downgrades, change.UserID)
+	return true, nil
+}
+
+func (r *fakeTierHistoryRepository) ListByUser(ctx context.Context, userID string, limit, offset int) ([]*domain.TierChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var changes []*domain.TierChange
+	for i := len(r.changes) - 1; i >= 0 && (limit <= 0 || len(changes) < limit); i-- {
+		changes = append(changes, r.changes[i])
+	}
+	return changes, nil
+}
+
+func (r *fakeTierHistoryRepository) GetDowngrade(ctx context.Context, userID string) (*domain.TierDowngrade, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	downgrade, ok := r.downgrades[userID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *downgrade
+	return &copied, nil
+}
+
+func (r *fakeTierHistoryRepository) SaveDowngrade(ctx context.Context, downgrade *domain.TierDowngrade) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *downgrade
+	r.downgrades[downgrade.UserID] = &copied
+	return nil
+}
+
+func (r *fakeTierHistoryRepository) CancelDowngrade(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.downgrades, userID)
+	return nil
+}
+
+// recordingNotifier запоминает отправленные уведомления
+type recordingNotifier struct {
+	mu            sync.Mutex
+	notifications []*notification.Notification
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, notification *notification.Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.notifications = append(n.notifications, notification)
+	return nil
+}
+
+func newTestTierService(user *domain.User) (*tierService, *fakeUserSpendingRepository, *fakeTierHistoryRepository, *recordingNotifier) {
+	tiers := []domain.Tier{
+		{ID: "free", Name: "Free", Price: 0},
+		{ID: "pro", Name: "Pro", Price: 100, DowngradeGraceDays: 14},
+		{ID: "business", Name: "Business", Price: 500, QualificationWindowDays: 30, DowngradeGraceDays: 7},
+	}
+	tierRepo := &MockTierRepository{}
+	tierRepo.On("GetAllOrderedByPrice", mock.Anything).Return(tiers, nil)
+	for i := range tiers {
+		tierRepo.On("GetByID", mock.Anything, tiers[i].ID).Return(&tiers[i], nil)
+	}
+	tierRepo.On("GetByID", mock.Anything, mock.Anything).Return(nil, repository.ErrNotFound)
+
+	userRepo := &MockUserRepository{}
+	userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+	spendingRepo := &fakeUserSpendingRepository{}
+	historyRepo := &fakeTierHistoryRepository{users: map[string]*domain.User{user.ID: user}, downgrades: map[string]*domain.TierDowngrade{}}
+	notifier := &recordingNotifier{}
+	svc := NewTierService(tierRepo, userRepo, spendingRepo, historyRepo, notifier).(*tierService)
+	return svc, spendingRepo, historyRepo, notifier
+}
+
+func TestTierService_UpgradesOnSpending(t *testing.T) {
+	user := &domain.User{ID: "user-1", Email: "user@example.com", TierID: "free"}
+	svc, _, historyRepo, notifier := newTestTierService(user)
+	ctx := context.Background()
+
+	require.NoError(t, svc.UpdateUserSpending(ctx, "user-1", 60))
+	assert.Equal(t, "free", user.TierID)
+	assert.Empty(t, historyRepo.changes)
+
+	require.NoError(t, svc.UpdateUserSpending(ctx, "user-1", 50))
+	assert.Equal(t, "pro", user.TierID)
+	require.Len(t, historyRepo.changes, 1)
+	assert.Equal(t, "free", historyRepo.changes[0].FromTierID)
+	assert.Equal(t, "pro", historyRepo.changes[0].ToTierID)
+	assert.Equal(t, domain.TierChangeReasonSpending, historyRepo.changes[0].Reason)
+
+	require.Len(t, notifier.notifications, 1)
+	assert.Equal(t, notification.EventTierChanged, notifier.notifications[0].Event)
+	assert.Equal(t, "user@example.com", notifier.notifications[0].Email)
+	assert.Equal(t, "pro", notifier.notifications[0].Data["to_tier_id"])
+
+	// Повторная проверка без новых трат ничего не меняет
+	require.NoError(t, svc.CheckAndUpgradeTier(ctx, "user-1"))
+	assert.Len(t, historyRepo.changes, 1)
+
+	// Возврат уменьшает траты: тариф сохраняется до конца льготного периода
+	require.NoError(t, svc.UpdateUserSpending(ctx, "user-1", -50))
+	assert.Equal(t, "pro", user.TierID)
+	require.Len(t, notifier.notifications, 2)
+	assert.Equal(t, notification.EventTierDowngradeScheduled, notifier.notifications[1].Event)
+
+	// Новые траты снова квалифицируют пользователя и отменяют понижение
+	require.NoError(t, svc.UpdateUserSpending(ctx, "user-1", 50))
+	downgrade, err := svc.GetScheduledDowngrade(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Nil(t, downgrade)
+	assert.Equal(t, "pro", user.TierID)
+}
+
+func TestTierService_RollingWindowDowngrade(t *testing.T) {
+	user := &domain.User{ID: "user-1", Email: "user@example.com", TierID: "free"}
+	svc, spendingRepo, historyRepo, notifier := newTestTierService(user)
+	svc.userRepo.(*MockUserRepository).On("ListIDsByTiers", mock.Anything, []string{"pro", "business"}, "", tierEvaluationBatchSize).Return([]string{"user-1"}, nil)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	svc.now = func() time.Time { return now }
+
+	// 600 за последние 30 дней: тариф Business
+	spendingRepo.spent = map[string]float64{"user-1": 600}
+	spendingRepo.addDay("user-1", now.AddDate(0, 0, -20), 600)
+	require.NoError(t, svc.CheckAndUpgradeTier(ctx, "user-1"))
+	assert.Equal(t, "business", user.TierID)
+
+	// Траты вышли из окна: понижение до Pro (по накопленным тратам) через 7 дней
+	now = now.AddDate(0, 0, 15)
+	require.NoError(t, svc.EvaluateTiers(ctx))
+	assert.Equal(t, "business", user.TierID)
+
+	downgrade, err := svc.GetScheduledDowngrade(ctx, "user-1")
+	require.NoError(t, err)
+	require.NotNil(t, downgrade)
+	assert.Equal(t, "business", downgrade.FromTierID)
+	assert.Equal(t, "pro", downgrade.ToTierID)
+	assert.Equal(t, now.AddDate(0, 0, 7), downgrade.DowngradeAt)
+
+	last := notifier.notifications[len(notifier.notifications)-1]
+	assert.Equal(t, notification.EventTierDowngradeScheduled, last.Event)
+	assert.Equal(t, "pro", last.Data["to_tier_id"])
+
+	// Повторная проверка в льготный период не переносит срок и не шлет уведомление повторно
+	notified := len(notifier.notifications)
+	now = now.AddDate(0, 0, 3)
+	require.NoError(t, svc.EvaluateTiers(ctx))
+	assert.Len(t, notifier.notifications, notified)
+	assert.Equal(t, "business", user.TierID)
+
+	// После окончания льготного периода тариф понижается
+	now = now.AddDate(0, 0, 5)
+	require.NoError(t, svc.EvaluateTiers(ctx))
+	assert.Equal(t, "pro", user.TierID)
+
+	change := historyRepo.changes[len(historyRepo.changes)-1]
+	assert.Equal(t, domain.TierChangeReasonDowngrade, change.Reason)
+	assert.Equal(t, "business", change.FromTierID)
+	downgrade, err = svc.GetScheduledDowngrade(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Nil(t, downgrade)
+}
+
+func TestTierService_PinnedTierIsKept(t *testing.T) {
+	user := &domain.User{ID: "user-1", Email: "user@example.com", TierID: "free"}
+	svc, _, historyRepo, notifier := newTestTierService(user)
+	ctx := context.Background()
+
+	change, err := svc.SetUserTier(ctx, &SetUserTierRequest{UserID: "user-1", TierID: "free", Pinned: true, ChangedBy: "admin-1"})
+	require.NoError(t, err)
+	require.NotNil(t, change)
+	assert.Equal(t, domain.TierChangeReasonAdmin, change.Reason)
+	assert.True(t, user.TierPinned)
+	// Закрепление без смены тарифа не уведомляет пользователя
+	assert.Empty(t, notifier.notifications)
+
+	require.NoError(t, svc.UpdateUserSpending(ctx, "user-1", 1000))
+	assert.Equal(t, "free", user.TierID)
+	assert.Len(t, historyRepo.changes, 1)
+
+	// Повторное назначение того же тарифа ничего не меняет
+	change, err = svc.SetUserTier(ctx, &SetUserTierRequest{UserID: "user-1", TierID: "free", Pinned: true})
+	require.NoError(t, err)
+	assert.Nil(t, change)
+
+	_, err = svc.SetUserTier(ctx, &SetUserTierRequest{UserID: "user-1", TierID: "missing"})
+	assert.ErrorIs(t, err, ErrInvalidTierChange)
+
+	// После снятия закрепления тариф повышается при следующей проверке
+	_, err = svc.SetUserTier(ctx, &SetUserTierRequest{UserID: "user-1", TierID: "free", Pinned: false})
+	require.NoError(t, err)
+	require.NoError(t, svc.CheckAndUpgradeTier(ctx, "user-1"))
+	assert.Equal(t, "business", user.TierID)
+	assert.False(t, user.TierPinned)
+}
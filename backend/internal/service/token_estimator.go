@@ -0,0 +1,79 @@
+package service
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// Приблизительный подсчет токенов для случаев, когда провайдер не вернул usage.
+// Используется эвристика OpenAI: около 4 символов на токен и несколько служебных
+// токенов на каждое сообщение.
+const (
+	charsPerToken        = 4
+	tokensPerMessage     = 4
+	tokensPerReplyPrimer = 3
+)
+
+type promptMessage struct {
+	Role    string          `json:"role"`
+	Name    string          `json:"name"`
+	Content json.RawMessage `json:"content"`
+}
+
+type promptContentPart struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// estimateTextTokens оценивает количество токенов в тексте
+func estimateTextTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
+
+// estimatePromptTokens оценивает количество входных токенов по полю messages тела запроса
+func estimatePromptTokens(body []byte) int {
+	var payload struct {
+		Messages []promptMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return 0
+	}
+
+	total := tokensPerReplyPrimer
+	for _, message := range payload.Messages {
+		total += tokensPerMessage
+		total += estimateTextTokens(message.Role)
+		total += estimateTextTokens(message.Name)
+		total += estimateTextTokens(messageContentText(message.Content))
+	}
+
+	return total
+}
+
+// messageContentText извлекает текст из content, который может быть строкой или массивом частей
+func messageContentText(content json.RawMessage) string {
+	if len(content) == 0 {
+		return ""
+	}
+
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text
+	}
+
+	var parts []promptContentPart
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return ""
+	}
+
+	for _, part := range parts {
+		if part.Type == "text" {
+			text += part.Text
+		}
+	}
+
+	return text
+}
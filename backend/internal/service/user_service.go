@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
@@ -146,6 +147,11 @@ func (s *UserService) UpdateUser(ctx context.Context, id string, req *UpdateUser
 		if err == nil && existingUser != nil && existingUser.ID != id {
 			return nil, fmt.Errorf("email %s is already taken", req.Email)
 		}
+		// Новый email нужно подтвердить заново
+		if !strings.EqualFold(user.Email, req.Email) {
+			user.EmailVerifiedAt = nil
+			user.EmailVerificationSentAt = nil
+		}
 		user.Email = req.Email
 	}
 
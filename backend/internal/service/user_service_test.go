@@ -44,6 +44,11 @@ func (m *MockUserRepository) Update(ctx context.Context, user *domain.User) erro
 	return args.Error(0)
 }
 
+func (m *MockUserRepository) UpdateColumns(ctx context.Context, user *domain.User, columns ...string) error {
+	args := m.Called(ctx, user, columns)
+	return args.Error(0)
+}
+
 func (m *MockUserRepository) Delete(ctx context.Context, id string) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
@@ -57,6 +62,14 @@ func (m *MockUserRepository) List(ctx context.Context, limit, offset int) ([]*do
 	return args.Get(0).([]*domain.User), args.Error(1)
 }
 
+func (m *MockUserRepository) ListIDsByTiers(ctx context.Context, tierIDs []string, afterID string, limit int) ([]string, error) {
+	args := m.Called(ctx, tierIDs, afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
 type MockUserLimitRepository struct {
 	mock.Mock
 }
@@ -13,12 +13,17 @@ type Claims struct {
 	UserID string          `json:"user_id"`
 	Email  string          `json:"email"`
 	Role   domain.UserRole `json:"role"`
+	// SessionID - сессия, в которой выдан токен; отзыв сессии делает токен недействительным
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// JWTManager подписывает токены общим секретом (HS256) или, если задан KeyStore,
+// асимметричными ключами с kid в заголовке, открытые части которых публикуются в JWKS
 type JWTManager struct {
 	secretKey     string
 	tokenDuration time.Duration
+	keys          KeyStore
 }
 
 func NewJWTManager(secretKey string, tokenDuration time.Duration) *JWTManager {
@@ -28,11 +33,31 @@ func NewJWTManager(secretKey string, tokenDuration time.Duration) *JWTManager {
 	}
 }
 
+// NewKeyStoreJWTManager создает менеджер, подписывающий токены ключами RS256 или EdDSA из keys
+func NewKeyStoreJWTManager(keys KeyStore, tokenDuration time.Duration) *JWTManager {
+	return &JWTManager{
+		tokenDuration: tokenDuration,
+		keys:          keys,
+	}
+}
+
+// TokenDuration возвращает срок действия access токена
+func (m *JWTManager) TokenDuration() time.Duration {
+	return m.tokenDuration
+}
+
+// GenerateToken выдает токен вне сессии
 func (m *JWTManager) GenerateToken(user *domain.User) (string, error) {
+	return m.GenerateSessionToken(user, "")
+}
+
+// GenerateSessionToken выдает короткоживущий access токен сессии sessionID
+func (m *JWTManager) GenerateSessionToken(user *domain.User, sessionID string) (string, error) {
 	claims := &Claims{
-		UserID: user.ID,
-		Email:  user.Email,
-		Role:   user.Role,
+		UserID:    user.ID,
+		Email:     user.Email,
+		Role:      user.Role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(m.tokenDuration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -42,6 +67,10 @@ func (m *JWTManager) GenerateToken(user *domain.User) (string, error) {
 		},
 	}
 
+	if m.keys != nil {
+		return m.signWithKeyStore(claims)
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString([]byte(m.secretKey))
 	if err != nil {
@@ -51,13 +80,27 @@ func (m *JWTManager) GenerateToken(user *domain.User) (string, error) {
 	return tokenString, nil
 }
 
+func (m *JWTManager) signWithKeyStore(claims *Claims) (string, error) {
+	key, err := m.keys.SigningKey()
+	if err != nil {
+		return "", fmt.Errorf("failed to get signing key: %w", err)
+	}
+	method, err := key.method()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.ID
+	tokenString, err := token.SignedString(key.PrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return tokenString, nil
+}
+
 func (m *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(m.secretKey), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, m.verificationKey)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
@@ -71,36 +114,26 @@ func (m *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
-func (m *JWTManager) RefreshToken(tokenString string) (string, error) {
-	claims, err := m.ValidateToken(tokenString)
-	if err != nil {
-		return "", fmt.Errorf("invalid token for refresh: %w", err)
-	}
-
-	// Проверяем, что токен не истёк более чем на час (grace period)
-	if time.Until(claims.ExpiresAt.Time) < -time.Hour {
-		return "", fmt.Errorf("token too old for refresh")
+// verificationKey выбирает ключ проверки: общий секрет или открытый ключ по kid.
+// Алгоритм токена должен совпадать с алгоритмом ключа, иначе токен отклоняется
+func (m *JWTManager) verificationKey(token *jwt.Token) (interface{}, error) {
+	if m.keys == nil {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(m.secretKey), nil
 	}
 
-	// Создаем новый токен с обновленным временем
-	newClaims := &Claims{
-		UserID: claims.UserID,
-		Email:  claims.Email,
-		Role:   claims.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(m.tokenDuration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "oneui-hub",
-			Subject:   claims.UserID,
-		},
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no key ID")
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims)
-	newTokenString, err := token.SignedString([]byte(m.secretKey))
+	key, err := m.keys.VerificationKey(kid)
 	if err != nil {
-		return "", fmt.Errorf("failed to sign refresh token: %w", err)
+		return nil, err
 	}
-
-	return newTokenString, nil
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.PrivateKey.Public(), nil
 }
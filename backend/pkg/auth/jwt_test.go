@@ -115,70 +115,3 @@ func TestJWTManager_ValidateToken(t *testing.T) {
 		})
 	}
 }
-
-func TestJWTManager_RefreshToken(t *testing.T) {
-	manager := NewJWTManager("test-secret", time.Hour)
-
-	user := &domain.User{
-		ID:    "user-123",
-		Email: "test@example.com",
-		Role:  domain.RoleCustomer,
-	}
-
-	tests := []struct {
-		name        string
-		setupToken  func() string
-		expectError bool
-	}{
-		{
-			name: "valid token refresh",
-			setupToken: func() string {
-				token, _ := manager.GenerateToken(user)
-				// Добавляем небольшую задержку чтобы время создания токенов отличалось
-				time.Sleep(time.Millisecond * 10)
-				return token
-			},
-			expectError: false,
-		},
-		{
-			name: "invalid token",
-			setupToken: func() string {
-				return "invalid-token"
-			},
-			expectError: true,
-		},
-		{
-			name: "too old token",
-			setupToken: func() string {
-				oldManager := NewJWTManager("test-secret", -2*time.Hour)
-				token, _ := oldManager.GenerateToken(user)
-				return token
-			},
-			expectError: true,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			token := tt.setupToken()
-			newToken, err := manager.RefreshToken(token)
-
-			if tt.expectError {
-				assert.Error(t, err)
-				assert.Empty(t, newToken)
-			} else {
-				require.NoError(t, err)
-				assert.NotEmpty(t, newToken)
-				// Не проверяем неравенство токенов, так как они могут быть одинаковыми при быстрой генерации
-				// Вместо этого проверяем, что новый токен валиден
-
-				// Проверяем, что новый токен валиден
-				claims, err := manager.ValidateToken(newToken)
-				require.NoError(t, err)
-				assert.Equal(t, user.ID, claims.UserID)
-				assert.Equal(t, user.Email, claims.Email)
-				assert.Equal(t, user.Role, claims.Role)
-			}
-		})
-	}
-}
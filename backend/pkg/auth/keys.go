@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Алгоритмы подписи JWT
+const (
+	// AlgorithmHS256 - общий секрет JWT_SECRET; проверить токен может только хаб
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// rsaKeyBits - размер генерируемых RSA ключей
+const rsaKeyBits = 2048
+
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// SigningKey - асимметричный ключ подписи JWT. ID публикуется как kid в заголовке токена и в JWKS
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	// ActivatesAt - с этого момента ключ подписывает токены; до него ключ только опубликован в JWKS
+	ActivatesAt time.Time
+}
+
+// KeyStore выдает ключи подписи и проверки токенов
+type KeyStore interface {
+	// SigningKey возвращает ключ, которым подписываются новые токены
+	SigningKey() (*SigningKey, error)
+	// VerificationKey возвращает ключ по kid или ErrUnknownSigningKey
+	VerificationKey(kid string) (*SigningKey, error)
+}
+
+// ValidAsymmetricAlgorithm сообщает, что алгоритм подписывает токены ключами из KeyStore
+func ValidAsymmetricAlgorithm(algorithm string) bool {
+	return algorithm == AlgorithmRS256 || algorithm == AlgorithmEdDSA
+}
+
+// GenerateSigningKey создает новый ключ подписи со случайным kid
+func GenerateSigningKey(algorithm string, activatesAt time.Time) (*SigningKey, error) {
+	var private crypto.Signer
+	switch algorithm {
+	case AlgorithmRS256:
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate RSA key: %w", err)
+		}
+		private = key
+	case AlgorithmEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate Ed25519 key: %w", err)
+		}
+		private = key
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+
+	kid := make([]byte, 12)
+	if _, err := rand.Read(kid); err != nil {
+		return nil, fmt.Errorf("failed to generate key ID: %w", err)
+	}
+
+	return &SigningKey{
+		ID:          base64.RawURLEncoding.EncodeToString(kid),
+		Algorithm:   algorithm,
+		PrivateKey:  private,
+		ActivatesAt: activatesAt,
+	}, nil
+}
+
+// ParseSigningKey восстанавливает ключ из PKCS#8 PEM, сохраненного MarshalPrivateKey
+func ParseSigningKey(id, algorithm, privatePEM string, activatesAt time.Time) (*SigningKey, error) {
+	block, _ := pem.Decode([]byte(privatePEM))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode private key PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+	key := &SigningKey{ID: id, Algorithm: algorithm, PrivateKey: private, ActivatesAt: activatesAt}
+	if _, err := key.method(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// MarshalPrivateKey кодирует закрытый ключ в PKCS#8 PEM
+func (k *SigningKey) MarshalPrivateKey() (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.PrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// method возвращает метод подписи jwt, проверяя, что тип ключа соответствует алгоритму
+func (k *SigningKey) method() (jwt.SigningMethod, error) {
+	switch public := k.PrivateKey.Public().(type) {
+	case *rsa.PublicKey:
+		if k.Algorithm == AlgorithmRS256 {
+			return jwt.SigningMethodRS256, nil
+		}
+	case ed25519.PublicKey:
+		if k.Algorithm == AlgorithmEdDSA {
+			return jwt.SigningMethodEdDSA, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", public)
+	}
+	return nil, fmt.Errorf("key %s does not match algorithm %s", k.ID, k.Algorithm)
+}
+
+// JWK - открытый ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP (Ed25519)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWK возвращает открытую часть ключа для публикации в JWKS
+func (k *SigningKey) JWK() JWK {
+	jwk := JWK{Use: "sig", Alg: k.Algorithm, Kid: k.ID}
+	switch public := k.PrivateKey.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
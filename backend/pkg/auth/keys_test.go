@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"oneui-hub/internal/domain"
+)
+
+// staticKeyStore подписывает первым ключом и проверяет любым из ключей
+type staticKeyStore struct {
+	keys []*SigningKey
+}
+
+func (s *staticKeyStore) SigningKey() (*SigningKey, error) {
+	return s.keys[0], nil
+}
+
+func (s *staticKeyStore) VerificationKey(kid string) (*SigningKey, error) {
+	for _, key := range s.keys {
+		if key.ID == kid {
+			return key, nil
+		}
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+func TestKeyStoreJWTManager(t *testing.T) {
+	user := &domain.User{ID: "user-123", Email: "test@example.com", Role: domain.RoleCustomer}
+
+	for _, algorithm := range []string{AlgorithmRS256, AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			key, err := GenerateSigningKey(algorithm, time.Now())
+			require.NoError(t, err)
+
+			// Ключ переживает сохранение в PEM
+			privatePEM, err := key.MarshalPrivateKey()
+			require.NoError(t, err)
+			restored, err := ParseSigningKey(key.ID, algorithm, privatePEM, key.ActivatesAt)
+			require.NoError(t, err)
+
+			signer := NewKeyStoreJWTManager(&staticKeyStore{keys: []*SigningKey{key}}, time.Hour)
+			token, err := signer.GenerateSessionToken(user, "session-1")
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			require.NoError(t, err)
+			assert.Equal(t, key.ID, parsed.Header["kid"])
+			assert.Equal(t, algorithm, parsed.Header["alg"])
+
+			verifier := NewKeyStoreJWTManager(&staticKeyStore{keys: []*SigningKey{restored}}, time.Hour)
+			claims, err := verifier.ValidateToken(token)
+			require.NoError(t, err)
+			assert.Equal(t, "user-123", claims.UserID)
+			assert.Equal(t, "session-1", claims.SessionID)
+
+			// Токен, подписанный неизвестным ключом, отклоняется
+			other, err := GenerateSigningKey(algorithm, time.Now())
+			require.NoError(t, err)
+			_, err = NewKeyStoreJWTManager(&staticKeyStore{keys: []*SigningKey{other}}, time.Hour).ValidateToken(token)
+			assert.Error(t, err)
+
+			jwk := key.JWK()
+			assert.Equal(t, key.ID, jwk.Kid)
+			assert.Equal(t, "sig", jwk.Use)
+		})
+	}
+}
+
+func TestKeyStoreJWTManager_RejectsAlgorithmConfusion(t *testing.T) {
+	key, err := GenerateSigningKey(AlgorithmEdDSA, time.Now())
+	require.NoError(t, err)
+	manager := NewKeyStoreJWTManager(&staticKeyStore{keys: []*SigningKey{key}}, time.Hour)
+
+	// HS256 токен с kid асимметричного ключа не принимается
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: "admin", Role: domain.RoleAdmin,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}})
+	forged.Header["kid"] = key.ID
+	token, err := forged.SignedString([]byte(key.JWK().X))
+	require.NoError(t, err)
+
+	_, err = manager.ValidateToken(token)
+	assert.Error(t, err)
+
+	// Токены общего секрета без kid тоже не принимаются
+	legacy, err := NewJWTManager("test-secret", time.Hour).GenerateToken(&domain.User{ID: "user-1"})
+	require.NoError(t, err)
+	_, err = manager.ValidateToken(legacy)
+	assert.Error(t, err)
+}
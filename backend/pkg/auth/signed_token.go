@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSignedToken = errors.New("invalid signed token")
+	ErrSignedTokenExpired = errors.New("signed token expired")
+)
+
+// SignToken подписывает идентификатор subject со сроком действия expiresAt.
+// purpose разделяет назначения токенов: токен приглашения не примется как токен другого назначения.
+// Однократность использования обеспечивает вызывающий код по состоянию записи subject
+func SignToken(secret, purpose, subject string, expiresAt time.Time) string {
+	payload := subject + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(signedTokenMAC(secret, purpose, payload))
+}
+
+// VerifySignedToken проверяет подпись и срок действия токена и возвращает subject
+func VerifySignedToken(secret, purpose, token string, now time.Time) (string, error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidSignedToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", ErrInvalidSignedToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil {
+		return "", ErrInvalidSignedToken
+	}
+	if !hmac.Equal(mac, signedTokenMAC(secret, purpose, string(payload))) {
+		return "", ErrInvalidSignedToken
+	}
+
+	idx := strings.LastIndex(string(payload), ".")
+	if idx <= 0 {
+		return "", ErrInvalidSignedToken
+	}
+	expiresAt, err := strconv.ParseInt(string(payload[idx+1:]), 10, 64)
+	if err != nil {
+		return "", ErrInvalidSignedToken
+	}
+	if !now.Before(time.Unix(expiresAt, 0)) {
+		return "", ErrSignedTokenExpired
+	}
+
+	return string(payload[:idx]), nil
+}
+
+func signedTokenMAC(secret, purpose, payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose + ":" + payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignedToken(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	token := SignToken("secret", "team_invitation", "inv-1", now.Add(time.Hour))
+
+	subject, err := VerifySignedToken("secret", "team_invitation", token, now)
+	require.NoError(t, err)
+	assert.Equal(t, "inv-1", subject)
+
+	_, err = VerifySignedToken("secret", "team_invitation", token, now.Add(time.Hour))
+	assert.ErrorIs(t, err, ErrSignedTokenExpired)
+
+	_, err = VerifySignedToken("other-secret", "team_invitation", token, now)
+	assert.ErrorIs(t, err, ErrInvalidSignedToken)
+
+	// Токен одного назначения не подходит для другого
+	_, err = VerifySignedToken("secret", "password_reset", token, now)
+	assert.ErrorIs(t, err, ErrInvalidSignedToken)
+
+	forged := SignToken("secret", "team_invitation", "inv-2", now.Add(time.Hour))
+	_, err = VerifySignedToken("secret", "team_invitation", token[:len(token)-4]+forged[len(forged)-4:], now)
+	assert.ErrorIs(t, err, ErrInvalidSignedToken)
+
+	_, err = VerifySignedToken("secret", "team_invitation", "garbage", now)
+	assert.ErrorIs(t, err, ErrInvalidSignedToken)
+}
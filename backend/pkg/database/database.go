@@ -46,12 +46,37 @@ func (db *Database) Migrate() error {
 		&domain.Model{},
 		&domain.ModelConfig{},
 		&domain.RateLimit{},
+		&domain.RateLimitCounter{},
 		&domain.ApiKey{},
 		&domain.Request{},
 		&domain.Budget{},
 		&domain.Currency{},
 		&domain.ExchangeRate{},
 		&domain.UserSpending{},
+		&domain.JobRun{},
+		&domain.LeaderLease{},
+		&domain.LedgerAccount{},
+		&domain.LedgerTransaction{},
+		&domain.LedgerEntry{},
+		&domain.QuotaHold{},
+		&domain.PriceRule{},
+		&domain.ModelPrice{},
+		&domain.Invoice{},
+		&domain.InvoiceLine{},
+		&domain.InvoiceSequence{},
+		&domain.PromoCode{},
+		&domain.PromoRedemption{},
+		&domain.Payment{},
+		&domain.PaymentEvent{},
+		&domain.TierChange{},
+		&domain.UserSpendingDay{},
+		&domain.TierDowngrade{},
+		&domain.Team{},
+		&domain.TeamMember{},
+		&domain.TeamInvitation{},
+		&domain.Session{},
+		&domain.RefreshToken{},
+		&domain.JWTSigningKey{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
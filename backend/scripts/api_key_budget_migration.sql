@@ -0,0 +1,7 @@
+USE oneui_hub;
+
+-- Лимит трат API ключа и период его сброса (формат LiteLLM: 1d, 30d, 1mo)
+ALTER TABLE api_keys
+    ADD COLUMN max_budget DECIMAL(14, 6) NULL COMMENT 'Лимит трат ключа в USD',
+    ADD COLUMN budget_duration VARCHAR(20) NULL COMMENT 'Период сброса лимита',
+    ADD COLUMN budget_period_start DATETIME NULL COMMENT 'Начало отсчета периодов бюджета';
@@ -0,0 +1,8 @@
+USE oneui_hub;
+
+-- Отзыв истекших API ключей и уведомления об истечении
+ALTER TABLE api_keys
+    ADD COLUMN revoked_at TIMESTAMP NULL COMMENT 'Когда ключ был отозван и удален из LiteLLM',
+    ADD COLUMN expiry_notified_at TIMESTAMP NULL COMMENT 'Когда владелец был предупрежден об истечении ключа';
+
+CREATE INDEX idx_api_keys_revoked_at ON api_keys (revoked_at);
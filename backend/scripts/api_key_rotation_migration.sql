@@ -0,0 +1,8 @@
+USE oneui_hub;
+
+-- Цепочка ротации API ключей: предшественник и преемник
+ALTER TABLE api_keys
+    ADD COLUMN predecessor_id VARCHAR(36) NULL COMMENT 'Ключ, на замену которому выпущен этот ключ',
+    ADD COLUMN successor_id VARCHAR(36) NULL COMMENT 'Ключ, выпущенный на замену этому ключу';
+
+CREATE INDEX idx_api_keys_predecessor_id ON api_keys (predecessor_id);
@@ -0,0 +1,10 @@
+USE oneui_hub;
+
+-- Ограничения API ключей: модели, компании, типы вызовов, подсети и права.
+-- Списки хранятся как JSON массивы, пустое значение означает отсутствие ограничения.
+ALTER TABLE api_keys
+    ADD COLUMN allowed_models TEXT COMMENT 'JSON массив external_id разрешенных моделей',
+    ADD COLUMN allowed_companies TEXT COMMENT 'JSON массив ID разрешенных компаний',
+    ADD COLUMN allowed_call_types TEXT COMMENT 'JSON массив разрешенных типов вызовов (chat, embeddings, images)',
+    ADD COLUMN allowed_cidrs TEXT COMMENT 'JSON массив подсетей, с которых разрешено использовать ключ',
+    ADD COLUMN permission VARCHAR(20) NOT NULL DEFAULT 'inference' COMMENT 'inference или read_only';
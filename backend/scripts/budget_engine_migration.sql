@@ -0,0 +1,17 @@
+USE oneui_hub;
+
+-- Бюджеты ведет хаб: учет трат по запросам, сброс по периодам, пороги уведомлений и жесткие лимиты
+
+ALTER TABLE budgets
+    MODIFY COLUMN spent_budget DECIMAL(14,6) DEFAULT 0 COMMENT 'Траты текущего периода',
+    MODIFY COLUMN external_id VARCHAR(255) NULL COMMENT 'ID бюджета в LiteLLM, NULL - еще не отправлен',
+    ADD COLUMN soft_limit BOOLEAN NOT NULL DEFAULT FALSE COMMENT 'Исчерпание бюджета только уведомляет, не блокируя запросы' AFTER budget_duration,
+    ADD COLUMN period_start DATETIME(3) NULL COMMENT 'Начало текущего периода' AFTER soft_limit,
+    ADD COLUMN notified_threshold INT NOT NULL DEFAULT 0 COMMENT 'Последний порог (50, 80, 100), о котором уведомлен владелец в текущем периоде' AFTER reset_at,
+    ADD INDEX idx_budgets_reset_at (reset_at);
+
+-- Пустой external_id мешал уникальному индексу для бюджетов, созданных только в хабе
+UPDATE budgets SET external_id = NULL WHERE external_id = '';
+
+-- Текущий период существующих бюджетов отсчитывается от момента миграции
+UPDATE budgets SET period_start = CURRENT_TIMESTAMP(3) WHERE period_start IS NULL;
@@ -0,0 +1,12 @@
+USE oneui_hub;
+
+-- Подтверждение email и сброс пароля по ссылкам из писем.
+-- Токены ссылок не хранятся, в таблице пользователей - только время подтверждения и последних писем
+
+ALTER TABLE users
+    ADD COLUMN email_verified_at TIMESTAMP NULL COMMENT 'Когда подтвержден email; до подтверждения доступны только бесплатные модели' AFTER role,
+    ADD COLUMN email_verification_sent_at TIMESTAMP NULL COMMENT 'Последнее письмо подтверждения email' AFTER email_verified_at,
+    ADD COLUMN password_reset_sent_at TIMESTAMP NULL COMMENT 'Последнее письмо сброса пароля' AFTER email_verification_sent_at;
+
+-- Существующие пользователи зарегистрировались до появления подтверждения и не теряют доступ к моделям
+UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL;
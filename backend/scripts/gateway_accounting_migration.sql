@@ -0,0 +1,8 @@
+USE oneui_hub;
+
+-- Траты пользователей теперь увеличиваются на стоимость каждого запроса через шлюз,
+-- поэтому двух знаков после запятой недостаточно: стоимость одного запроса часто меньше цента
+ALTER TABLE user_spendings MODIFY COLUMN total_spent DECIMAL(14, 6) NOT NULL DEFAULT 0;
+
+-- Индекс для поиска запросов по ID ключа и дате
+CREATE INDEX idx_requests_api_key_created ON requests (api_key_id, created_at);
@@ -0,0 +1,15 @@
+USE oneui_hub;
+
+-- Удержания баланса и месячных токенов на время выполнения запросов через шлюз.
+-- Строка создается до отправки запроса провайдеру и удаляется после списания фактической стоимости.
+-- Удержания с истекшим expires_at не учитываются и удаляются при следующей проверке квоты
+CREATE TABLE IF NOT EXISTS quota_holds (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    amount DECIMAL(14,6) NOT NULL DEFAULT 0 COMMENT 'Максимальная оценка стоимости запроса',
+    tokens BIGINT NOT NULL DEFAULT 0 COMMENT 'Оценка токенов промпта и ответа',
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_quota_holds_user_id (user_id),
+    INDEX idx_quota_holds_expires_at (expires_at)
+);
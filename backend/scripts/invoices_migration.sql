@@ -0,0 +1,46 @@
+USE oneui_hub;
+
+-- Счета за расчетные периоды
+
+-- Счета. Для пользователя выставляется не больше одного счета за период
+CREATE TABLE IF NOT EXISTS invoices (
+    id VARCHAR(36) PRIMARY KEY,
+    number VARCHAR(32) NOT NULL COMMENT 'Сквозной номер внутри года: INV-2024-000042',
+    user_id VARCHAR(36) NOT NULL,
+    period_start TIMESTAMP NOT NULL,
+    period_end TIMESTAMP NOT NULL COMMENT 'Не включается в период',
+    currency VARCHAR(3) NOT NULL,
+    exchange_rate DECIMAL(15,8) NOT NULL DEFAULT 1 COMMENT 'Курс USD к валюте счета',
+    subtotal_usd DECIMAL(14,6) NOT NULL DEFAULT 0,
+    total DECIMAL(14,2) NOT NULL DEFAULT 0 COMMENT 'Итог в валюте счета',
+    status VARCHAR(20) NOT NULL DEFAULT 'issued',
+    pdf_path VARCHAR(255),
+    csv_path VARCHAR(255),
+    issued_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_invoices_number (number),
+    UNIQUE INDEX idx_invoices_period (user_id, period_start)
+);
+
+-- Строки счета: использование одной модели по одной версии цены
+CREATE TABLE IF NOT EXISTS invoice_lines (
+    id VARCHAR(36) PRIMARY KEY,
+    invoice_id VARCHAR(36) NOT NULL,
+    model_id VARCHAR(36),
+    model_name VARCHAR(255),
+    model_price_id VARCHAR(36) NULL,
+    input_token_price DECIMAL(20,12) NOT NULL DEFAULT 0,
+    output_token_price DECIMAL(20,12) NOT NULL DEFAULT 0,
+    requests BIGINT NOT NULL DEFAULT 0,
+    input_tokens BIGINT NOT NULL DEFAULT 0,
+    output_tokens BIGINT NOT NULL DEFAULT 0,
+    amount_usd DECIMAL(14,6) NOT NULL DEFAULT 0,
+    amount DECIMAL(14,2) NOT NULL DEFAULT 0 COMMENT 'Сумма в валюте счета',
+    INDEX idx_invoice_lines_invoice_id (invoice_id)
+);
+
+-- Последний выданный номер счета за год
+CREATE TABLE IF NOT EXISTS invoice_sequences (
+    year INT PRIMARY KEY,
+    last_number BIGINT NOT NULL DEFAULT 0
+);
@@ -0,0 +1,16 @@
+USE oneui_hub;
+
+-- История запусков фоновых задач планировщика
+CREATE TABLE IF NOT EXISTS job_runs (
+    id VARCHAR(36) PRIMARY KEY,
+    job_name VARCHAR(100) NOT NULL COMMENT 'Имя задачи, например model_sync',
+    `trigger` VARCHAR(20) NOT NULL COMMENT 'schedule - по расписанию, manual - вручную',
+    status VARCHAR(20) NOT NULL COMMENT 'running, succeeded или failed',
+    error TEXT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NULL,
+    duration_ms BIGINT DEFAULT 0,
+    INDEX idx_job_runs_job_name (job_name),
+    INDEX idx_job_runs_status (status),
+    INDEX idx_job_runs_started_at (started_at)
+);
@@ -0,0 +1,13 @@
+USE oneui_hub;
+
+-- Ключи подписи access токенов (RS256 или EdDSA). Открытые части публикуются
+-- в /.well-known/jwks.json, токен ссылается на ключ через kid
+
+CREATE TABLE IF NOT EXISTS jwt_signing_keys (
+    id VARCHAR(64) PRIMARY KEY COMMENT 'kid ключа',
+    algorithm VARCHAR(10) NOT NULL COMMENT 'RS256 или EdDSA',
+    private_key TEXT NOT NULL COMMENT 'PKCS#8 PEM, зашифрованный ENCRYPTION_KEY',
+    activates_at TIMESTAMP NOT NULL COMMENT 'С этого момента ключ подписывает токены',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_jwt_signing_keys_activates_at (activates_at)
+);
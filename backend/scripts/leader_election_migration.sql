@@ -0,0 +1,14 @@
+USE oneui_hub;
+
+-- Аренда лидерства: фоновые задачи по расписанию выполняет только реплика-держатель
+CREATE TABLE IF NOT EXISTS leader_leases (
+    name VARCHAR(100) PRIMARY KEY COMMENT 'Имя аренды, например scheduler',
+    holder_id VARCHAR(191) NOT NULL COMMENT 'Идентификатор реплики-лидера',
+    fencing_token BIGINT NOT NULL DEFAULT 0 COMMENT 'Увеличивается при каждой смене лидера',
+    expires_at DATETIME(3) NOT NULL,
+    updated_at DATETIME(3) NULL
+);
+
+-- Токен лидера, при котором выполнялся запуск задачи
+ALTER TABLE job_runs
+    ADD COLUMN fencing_token BIGINT DEFAULT 0;
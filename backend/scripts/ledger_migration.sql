@@ -0,0 +1,45 @@
+USE oneui_hub;
+
+-- Журнал операций по балансу с двойной записью
+
+-- Счета: балансы пользователей (user:<id>) и системные счета (system:cash, system:revenue, ...)
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    id VARCHAR(100) PRIMARY KEY,
+    user_id VARCHAR(36) NULL,
+    balance DECIMAL(14,6) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_ledger_accounts_user_id (user_id)
+);
+
+-- Операции: пополнение, списание за использование, возврат, корректировка, промо начисление.
+-- Строки не изменяются и не удаляются
+CREATE TABLE IF NOT EXISTS ledger_transactions (
+    id VARCHAR(36) PRIMARY KEY,
+    type VARCHAR(20) NOT NULL,
+    user_id VARCHAR(36) NOT NULL,
+    amount DECIMAL(14,6) NOT NULL COMMENT 'Изменение баланса пользователя',
+    reason TEXT,
+    reference VARCHAR(191) NULL COMMENT 'ID запроса, платежа или промокода',
+    created_by VARCHAR(36) NULL COMMENT 'Администратор, выполнивший операцию',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_ledger_transactions_reference (type, reference),
+    INDEX idx_ledger_transactions_user_id (user_id),
+    INDEX idx_ledger_transactions_created_at (created_at)
+);
+
+-- Проводки: каждая операция состоит из проводок с нулевой суммой
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id VARCHAR(36) PRIMARY KEY,
+    transaction_id VARCHAR(36) NOT NULL,
+    account_id VARCHAR(100) NOT NULL,
+    amount DECIMAL(14,6) NOT NULL,
+    balance_after DECIMAL(14,6) NOT NULL COMMENT 'Остаток счета после проводки',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_ledger_entries_transaction_id (transaction_id),
+    INDEX idx_ledger_entries_account (account_id, created_at),
+    FOREIGN KEY (transaction_id) REFERENCES ledger_transactions(id)
+);
+
+-- Баланс в user_limits становится копией остатка счета и хранится с той же точностью
+ALTER TABLE user_limits MODIFY COLUMN balance DECIMAL(14,6) DEFAULT 0;
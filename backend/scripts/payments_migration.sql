@@ -0,0 +1,36 @@
+USE oneui_hub;
+
+-- Пополнение баланса через провайдера платежей
+
+-- Платежи. Сумма зачисляется на баланс после вебхука провайдера об успешной оплате
+CREATE TABLE IF NOT EXISTS payments (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    provider_session_id VARCHAR(191) NULL,
+    provider_payment_id VARCHAR(191) NULL,
+    checkout_url TEXT,
+    amount DECIMAL(14,2) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' COMMENT 'pending, succeeded, failed, partially_refunded, refunded, charged_back',
+    refunded_amount DECIMAL(14,2) NOT NULL DEFAULT 0 COMMENT 'Сумма возвратов и чарджбэков',
+    completed_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_payments_user_id (user_id),
+    INDEX idx_payments_provider_session_id (provider_session_id)
+);
+
+-- Обработанные события вебхука. Повторная доставка события не применяется второй раз
+CREATE TABLE IF NOT EXISTS payment_events (
+    id VARCHAR(36) PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL,
+    event_id VARCHAR(191) NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    payment_id VARCHAR(36) NOT NULL,
+    object_id VARCHAR(191),
+    amount DECIMAL(14,2) NOT NULL DEFAULT 0 COMMENT 'Изменение баланса пользователя',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_payment_events_event (provider, event_id),
+    INDEX idx_payment_events_payment_id (payment_id)
+);
@@ -0,0 +1,43 @@
+USE oneui_hub;
+
+-- Цены продажи моделей: стоимость провайдера из model_configs плюс наценка по правилам
+
+-- Правила наценки. Правило действует для моделей, подходящих под все заданные условия
+-- (NULL - любое значение). Чтобы изменить наценку, создается новое правило с более поздней датой
+CREATE TABLE IF NOT EXISTS price_rules (
+    id VARCHAR(36) PRIMARY KEY,
+    name VARCHAR(255),
+    model_id VARCHAR(36) NULL,
+    company_id VARCHAR(36) NULL,
+    tier_id VARCHAR(36) NULL,
+    markup_percent DECIMAL(10,4) NOT NULL DEFAULT 0 COMMENT 'Наценка в процентах к стоимости провайдера',
+    effective_from TIMESTAMP NOT NULL,
+    created_by VARCHAR(36) NULL COMMENT 'Администратор, создавший правило',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_price_rules_model_id (model_id),
+    INDEX idx_price_rules_company_id (company_id),
+    INDEX idx_price_rules_tier_id (tier_id),
+    INDEX idx_price_rules_effective_from (effective_from)
+);
+
+-- Версии цен продажи для пары модель + тариф. Строки не изменяются
+CREATE TABLE IF NOT EXISTS model_prices (
+    id VARCHAR(36) PRIMARY KEY,
+    model_id VARCHAR(36) NOT NULL,
+    tier_id VARCHAR(36) NOT NULL DEFAULT '',
+    version INT NOT NULL,
+    upstream_input_cost DECIMAL(20,12) NOT NULL DEFAULT 0,
+    upstream_output_cost DECIMAL(20,12) NOT NULL DEFAULT 0,
+    price_rule_id VARCHAR(36) NULL,
+    markup_percent DECIMAL(10,4) NOT NULL DEFAULT 0,
+    input_token_cost DECIMAL(20,12) NOT NULL DEFAULT 0 COMMENT 'Цена продажи за токен',
+    output_token_cost DECIMAL(20,12) NOT NULL DEFAULT 0 COMMENT 'Цена продажи за токен',
+    effective_from TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_model_prices_version (model_id, tier_id, version)
+);
+
+-- Версия цены, по которой списан запрос
+ALTER TABLE requests
+ADD COLUMN model_price_id VARCHAR(36) NULL AFTER total_cost,
+ADD INDEX idx_requests_model_price_id (model_price_id);
@@ -0,0 +1,43 @@
+USE oneui_hub;
+
+-- Промокоды: начисления на баланс, временные тарифы и скидки
+
+-- Промокоды. Для credit заполняется credit_amount, для tier_upgrade - tier_id, для discount - discount_percent
+CREATE TABLE IF NOT EXISTS promo_codes (
+    id VARCHAR(36) PRIMARY KEY,
+    code VARCHAR(64) NOT NULL COMMENT 'Хранится в верхнем регистре',
+    description TEXT,
+    type VARCHAR(20) NOT NULL COMMENT 'credit, tier_upgrade или discount',
+    credit_amount DECIMAL(14,6) NULL,
+    tier_id VARCHAR(36) NULL,
+    discount_percent DECIMAL(5,2) NULL,
+    duration_days INT NOT NULL DEFAULT 0 COMMENT 'Срок действия временного тарифа или скидки',
+    max_redemptions INT NULL COMMENT 'NULL - без ограничения',
+    per_user_limit INT NOT NULL DEFAULT 1 COMMENT '0 - без ограничения',
+    redemption_count INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NULL,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_by VARCHAR(36) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_promo_codes_code (code)
+);
+
+-- Активации промокодов пользователями
+CREATE TABLE IF NOT EXISTS promo_redemptions (
+    id VARCHAR(36) PRIMARY KEY,
+    promo_code_id VARCHAR(36) NOT NULL,
+    user_id VARCHAR(36) NOT NULL,
+    code VARCHAR(64) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    credit_amount DECIMAL(14,6) NULL,
+    discount_percent DECIMAL(5,2) NULL,
+    granted_tier_id VARCHAR(36) NULL,
+    previous_tier_id VARCHAR(36) NULL COMMENT 'Тариф, который вернется после окончания временного',
+    expires_at TIMESTAMP NULL,
+    reverted_at TIMESTAMP NULL,
+    redeemed_at TIMESTAMP NOT NULL,
+    INDEX idx_promo_redemptions_promo_code_id (promo_code_id),
+    INDEX idx_promo_redemptions_user_id (user_id),
+    INDEX idx_promo_redemptions_expires_at (expires_at)
+);
@@ -0,0 +1,8 @@
+USE oneui_hub;
+
+-- Удержания запросов учитываются в бюджете API ключа вместе с уже списанными тратами,
+-- чтобы параллельные запросы по ключу не превышали его лимит
+
+ALTER TABLE quota_holds
+    ADD COLUMN api_key_id VARCHAR(36) NOT NULL DEFAULT '' COMMENT 'Ключ запроса' AFTER user_id,
+    ADD INDEX idx_quota_holds_api_key_id (api_key_id);
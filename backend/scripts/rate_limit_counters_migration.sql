@@ -0,0 +1,12 @@
+USE oneui_hub;
+
+-- Счетчики лимитов запросов по окнам. Таблица общая для всех реплик backend,
+-- значения увеличиваются атомарным INSERT ... ON DUPLICATE KEY UPDATE
+CREATE TABLE IF NOT EXISTS rate_limit_counters (
+    counter_key VARCHAR(191) NOT NULL,
+    bucket BIGINT NOT NULL,
+    amount BIGINT NOT NULL DEFAULT 0,
+    expires_at DATETIME(3) NOT NULL,
+    PRIMARY KEY (counter_key, bucket),
+    INDEX idx_rate_limit_counters_expires_at (expires_at)
+);
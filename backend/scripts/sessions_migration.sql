@@ -0,0 +1,29 @@
+USE oneui_hub;
+
+-- Сессии пользователей. Access токены короткоживущие и содержат ID сессии,
+-- продлеваются непрозрачными refresh токенами, которые меняются при каждом продлении
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    user_agent VARCHAR(512),
+    ip_address VARCHAR(45),
+    expires_at TIMESTAMP NOT NULL COMMENT 'Срок действия текущего refresh токена',
+    last_used_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL,
+    revoke_reason VARCHAR(50) COMMENT 'logout, revoked или refresh_token_reuse',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_user_sessions_user_id (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Хранятся только SHA-256 хеши токенов. Использованные токены остаются,
+-- чтобы повторное предъявление украденного токена отозвало сессию
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    session_id VARCHAR(36) NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_refresh_tokens_session_id (session_id),
+    FOREIGN KEY (session_id) REFERENCES user_sessions(id) ON DELETE CASCADE
+);
@@ -0,0 +1,20 @@
+USE oneui_hub;
+
+-- Приглашения в команды по email. Ссылка содержит подписанный токен с ID приглашения;
+-- приглашение принимается один раз, повторное приглашение того же email отзывает предыдущее
+
+CREATE TABLE IF NOT EXISTS team_invitations (
+    id VARCHAR(36) PRIMARY KEY,
+    team_id VARCHAR(36) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL COMMENT 'Роль, которую получит приглашенный',
+    invited_by VARCHAR(36) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP NULL,
+    accepted_by VARCHAR(36) NULL COMMENT 'Пользователь, принявший приглашение',
+    revoked_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_team_invitations_team_id (team_id),
+    INDEX idx_team_invitations_email (email),
+    FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE
+);
@@ -0,0 +1,9 @@
+USE oneui_hub;
+
+-- Счета команд за запросы по ключам команды.
+-- Личный счет пользователя больше не включает запросы по ключам команд
+
+ALTER TABLE invoices
+    ADD COLUMN team_id VARCHAR(36) NOT NULL DEFAULT '' COMMENT 'Команда счета; пусто - личный счет пользователя' AFTER user_id,
+    DROP INDEX idx_invoices_period,
+    ADD UNIQUE INDEX idx_invoices_period (user_id, team_id, period_start);
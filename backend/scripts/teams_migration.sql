@@ -0,0 +1,38 @@
+USE oneui_hub;
+
+-- Команды (организации, отделы) с участниками, ключами, бюджетами и тарифом команды.
+-- ID команды совпадает с team_id в LiteLLM
+
+CREATE TABLE IF NOT EXISTS teams (
+    id VARCHAR(36) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    tier_id VARCHAR(36) NULL COMMENT 'Тариф ключей команды, NULL - тариф владельца ключа',
+    created_by VARCHAR(36) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (tier_id) REFERENCES tiers(id)
+);
+
+CREATE TABLE IF NOT EXISTS team_members (
+    team_id VARCHAR(36) NOT NULL,
+    user_id VARCHAR(36) NOT NULL,
+    role VARCHAR(20) NOT NULL COMMENT 'owner, admin, member или billing',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (team_id, user_id),
+    INDEX idx_team_members_user_id (user_id),
+    FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Ключ команды: запросы учитываются и за пользователем, и за командой
+ALTER TABLE api_keys
+    ADD COLUMN team_id VARCHAR(36) NULL COMMENT 'Команда, которой принадлежит ключ' AFTER user_id,
+    ADD INDEX idx_api_keys_team_id (team_id);
+
+ALTER TABLE requests
+    ADD COLUMN team_id VARCHAR(36) NULL COMMENT 'Команда ключа, от имени которой выполнен запрос' AFTER api_key_id,
+    ADD INDEX idx_requests_team_id (team_id);
+
+ALTER TABLE budgets
+    ADD INDEX idx_budgets_team_id (team_id);
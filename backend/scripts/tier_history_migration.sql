@@ -0,0 +1,21 @@
+USE oneui_hub;
+
+-- Автоматическое повышение тарифа, закрепление тарифа администратором и история тарифов
+
+ALTER TABLE users
+    ADD COLUMN tier_pinned BOOLEAN NOT NULL DEFAULT FALSE COMMENT 'Тариф закреплен администратором и не меняется автоматически' AFTER tier_id;
+
+-- История тарифов пользователей
+CREATE TABLE IF NOT EXISTS tier_history (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    from_tier_id VARCHAR(36) NULL COMMENT 'Совпадает с to_tier_id, если изменилось только закрепление',
+    to_tier_id VARCHAR(36) NOT NULL,
+    reason VARCHAR(20) NOT NULL COMMENT 'spending, admin, promo или promo_expired',
+    pinned BOOLEAN NOT NULL DEFAULT FALSE COMMENT 'Закреплен ли тариф после смены',
+    changed_by VARCHAR(36) NULL COMMENT 'Администратор, сменивший тариф',
+    note VARCHAR(255) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_tier_history_user_id (user_id),
+    INDEX idx_tier_history_created_at (created_at)
+);
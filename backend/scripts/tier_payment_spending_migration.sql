@@ -0,0 +1,18 @@
+USE oneui_hub;
+
+-- Оплаты учитываются для тарифов отдельно от использования моделей.
+-- Тариф определяется большим из двух значений, поэтому пополнение и его последующее
+-- использование не засчитываются дважды
+
+ALTER TABLE user_spendings
+    ADD COLUMN total_paid DECIMAL(14,6) NOT NULL DEFAULT 0 COMMENT 'Пополнения баланса за вычетом возвратов' AFTER total_spent;
+
+ALTER TABLE user_spending_daily
+    ADD COLUMN paid DECIMAL(14,6) NOT NULL DEFAULT 0 COMMENT 'Пополнения за день за вычетом возвратов' AFTER amount;
+
+-- Оплаты, прошедшие до миграции, переносятся в общий итог
+INSERT INTO user_spendings (user_id, total_paid)
+SELECT user_id, SUM(amount - refunded_amount) FROM payments
+WHERE status IN ('succeeded', 'partially_refunded', 'refunded', 'charged_back')
+GROUP BY user_id
+ON DUPLICATE KEY UPDATE total_paid = VALUES(total_paid);
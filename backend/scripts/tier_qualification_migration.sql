@@ -0,0 +1,32 @@
+USE oneui_hub;
+
+-- Квалификация тарифа по тратам за скользящее окно и понижение после льготного периода
+
+ALTER TABLE tiers
+    ADD COLUMN qualification_window_days INT NOT NULL DEFAULT 0 COMMENT 'За сколько последних дней учитываются траты, 0 - за все время' AFTER price,
+    ADD COLUMN downgrade_grace_days INT NOT NULL DEFAULT 0 COMMENT 'Через сколько дней после потери права на тариф пользователь переводится ниже' AFTER qualification_window_days;
+
+-- Существующим тарифам - льготный период по умолчанию
+UPDATE tiers SET downgrade_grace_days = 14;
+
+-- Траты пользователей по дням (UTC). Заполняются с момента миграции,
+-- поэтому окно квалификации учитывает только траты после нее
+CREATE TABLE IF NOT EXISTS user_spending_daily (
+    user_id VARCHAR(36) NOT NULL,
+    day DATE NOT NULL,
+    amount DECIMAL(14,6) NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, day)
+);
+
+-- Запланированные понижения тарифа, не больше одного на пользователя
+CREATE TABLE IF NOT EXISTS tier_downgrades (
+    user_id VARCHAR(36) PRIMARY KEY,
+    from_tier_id VARCHAR(36) NOT NULL COMMENT 'Тариф, с которого понижается пользователь',
+    to_tier_id VARCHAR(36) NOT NULL COMMENT 'Тариф, на который переводится пользователь',
+    downgrade_at TIMESTAMP NOT NULL COMMENT 'Когда понижение будет выполнено, если траты не восстановятся',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_tier_downgrades_downgrade_at (downgrade_at)
+);
+
+ALTER TABLE tier_history
+    MODIFY COLUMN reason VARCHAR(20) NOT NULL COMMENT 'spending, admin, promo, promo_expired или downgrade';